@@ -0,0 +1,246 @@
+package saml2aws
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/pkg/errors"
+)
+
+const (
+	subjectTag                 = "Subject"
+	nameIDTag                  = "NameID"
+	subjectConfirmationTag     = "SubjectConfirmation"
+	subjectConfirmationDataTag = "SubjectConfirmationData"
+	authnStatementTag          = "AuthnStatement"
+
+	conditionsTag          = "Conditions"
+	audienceRestrictionTag = "AudienceRestriction"
+	audienceTag            = "Audience"
+
+	sessionNotOnOrAfterAttribute = "SessionNotOnOrAfter"
+	notBeforeAttribute           = "NotBefore"
+	notOnOrAfterAttribute        = "NotOnOrAfter"
+
+	awsRoleSessionNameAttribute    = "https://aws.amazon.com/SAML/Attributes/RoleSessionName"
+	awsPrincipalTagAttributePrefix = "https://aws.amazon.com/SAML/Attributes/PrincipalTag:"
+	awsTransitiveTagKeysAttribute  = "https://aws.amazon.com/SAML/Attributes/TransitiveTagKeys"
+)
+
+// AssertionClockSkew how far the clock may differ from the IdP's when checking if the assertion has expired
+const AssertionClockSkew = 2 * time.Minute
+
+// roleSessionNameRegexp the characters and length STS allows in a role session name
+var roleSessionNameRegexp = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+
+// SAMLAssertion the parsed contents of a SAML assertion returned by an IdP
+type SAMLAssertion struct {
+	NameID string
+
+	// SessionNotOnOrAfter is the zero time if the IdP didn't supply it
+	SessionNotOnOrAfter time.Time
+
+	Roles []string
+
+	// RoleSessionName is the name STS gives the session, which AssumeRoleWithSAML only accepts from the assertion
+	RoleSessionName string
+
+	// SessionDuration in seconds, zero if the assertion doesn't contain one
+	SessionDuration int64
+
+	// Audience the service provider the assertion is for, NotBefore and NotOnOrAfter the window in which it
+	// is valid, they are empty or the zero time if the IdP didn't supply them
+	Audience     string
+	NotBefore    time.Time
+	NotOnOrAfter time.Time
+
+	// SubjectNotOnOrAfter the time by which the assertion must be delivered, the zero time if the IdP didn't
+	// supply it
+	SubjectNotOnOrAfter time.Time
+
+	// PrincipalTags the session tags STS applies from the PrincipalTag attributes, keyed by the tag name, and
+	// TransitiveTagKeys those which persist to roles assumed from the session, both nil if the IdP sends none
+	PrincipalTags     map[string]string
+	TransitiveTagKeys []string
+
+	// Attributes all the attributes of the assertion in the order they appear, including those above
+	Attributes []AssertionAttribute
+}
+
+// AssertionAttribute an attribute of the assertion along with its values
+type AssertionAttribute struct {
+	Name   string
+	Values []string
+}
+
+// ParseSAMLAssertion decode the base64 encoded SAML response returned by a provider and extract the assertion
+func ParseSAMLAssertion(samlAssertion string) (*SAMLAssertion, error) {
+
+	data, err := base64.StdEncoding.DecodeString(samlAssertion)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding saml assertion")
+	}
+
+	return ParseSAMLAssertionXML(data)
+}
+
+// ParseSAMLAssertionXML given an assertion document extract the assertion
+func ParseSAMLAssertionXML(data []byte) (*SAMLAssertion, error) {
+
+	doc := etree.NewDocument()
+	err := doc.ReadFromBytes(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing saml assertion")
+	}
+
+	assertionElement := doc.FindElement(".//Assertion")
+	if assertionElement == nil {
+		return nil, ErrMissingAssertion
+	}
+
+	assertion := &SAMLAssertion{}
+
+	subject := assertionElement.FindElement(childPath(assertionElement.Space, subjectTag))
+	if subject != nil {
+		if nameID := subject.FindElement(childPath(assertionElement.Space, nameIDTag)); nameID != nil {
+			assertion.NameID = strings.TrimSpace(nameID.Text())
+		}
+
+		if confirmation := subject.FindElement(childPath(assertionElement.Space, subjectConfirmationTag)); confirmation != nil {
+			if data := confirmation.FindElement(childPath(assertionElement.Space, subjectConfirmationDataTag)); data != nil {
+				assertion.SubjectNotOnOrAfter, err = parseAssertionTime(data, notOnOrAfterAttribute)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	authnStatement := assertionElement.FindElement(childPath(assertionElement.Space, authnStatementTag))
+	if authnStatement != nil {
+		if value := authnStatement.SelectAttrValue(sessionNotOnOrAfterAttribute, ""); value != "" {
+			assertion.SessionNotOnOrAfter, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid SessionNotOnOrAfter in assertion")
+			}
+		}
+	}
+
+	conditions := assertionElement.FindElement(childPath(assertionElement.Space, conditionsTag))
+	if conditions != nil {
+		assertion.NotBefore, err = parseAssertionTime(conditions, notBeforeAttribute)
+		if err != nil {
+			return nil, err
+		}
+
+		assertion.NotOnOrAfter, err = parseAssertionTime(conditions, notOnOrAfterAttribute)
+		if err != nil {
+			return nil, err
+		}
+
+		if restriction := conditions.FindElement(childPath(assertionElement.Space, audienceRestrictionTag)); restriction != nil {
+			if audience := restriction.FindElement(childPath(assertionElement.Space, audienceTag)); audience != nil {
+				assertion.Audience = strings.TrimSpace(audience.Text())
+			}
+		}
+	}
+
+	attributeStatement := assertionElement.FindElement(childPath(assertionElement.Space, attributeStatementTag))
+	if attributeStatement != nil {
+		for _, attribute := range attributeStatement.FindElements(childPath(assertionElement.Space, attributeTag)) {
+			assertionAttribute := AssertionAttribute{Name: attribute.SelectAttrValue("Name", "")}
+			for _, value := range attribute.FindElements(childPath(assertionElement.Space, attributeValueTag)) {
+				assertionAttribute.Values = append(assertionAttribute.Values, strings.TrimSpace(value.Text()))
+			}
+			assertion.Attributes = append(assertion.Attributes, assertionAttribute)
+
+			switch {
+			case strings.HasPrefix(assertionAttribute.Name, awsPrincipalTagAttributePrefix) && len(assertionAttribute.Values) > 0:
+				if assertion.PrincipalTags == nil {
+					assertion.PrincipalTags = map[string]string{}
+				}
+				assertion.PrincipalTags[strings.TrimPrefix(assertionAttribute.Name, awsPrincipalTagAttributePrefix)] = assertionAttribute.Values[0]
+			case assertionAttribute.Name == awsTransitiveTagKeysAttribute:
+				assertion.TransitiveTagKeys = append(assertion.TransitiveTagKeys, assertionAttribute.Values...)
+			}
+		}
+	}
+
+	assertion.Roles, err = ExtractAwsRoles(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing aws roles")
+	}
+
+	roleSessionNames, err := extractAttributeValues(data, awsRoleSessionNameAttribute)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing role session name")
+	}
+
+	if len(roleSessionNames) > 0 {
+		assertion.RoleSessionName = strings.TrimSpace(roleSessionNames[0])
+	}
+
+	assertion.SessionDuration, err = ExtractSessionDuration(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing session duration")
+	}
+
+	return assertion, nil
+}
+
+// IsRoleAttribute whether the attribute holds the roles granted by the assertion
+func (aa AssertionAttribute) IsRoleAttribute() bool {
+	return aa.Name == awsRoleAttribute
+}
+
+// ExpiresAt the earliest of the times the assertion is valid until, the zero time if the IdP supplied neither
+func (a *SAMLAssertion) ExpiresAt() time.Time {
+	expires := a.NotOnOrAfter
+	if expires.IsZero() || (!a.SubjectNotOnOrAfter.IsZero() && a.SubjectNotOnOrAfter.Before(expires)) {
+		expires = a.SubjectNotOnOrAfter
+	}
+
+	return expires
+}
+
+// CheckExpiry fail with a clear error if the assertion expired before now, allowing for AssertionClockSkew, as
+// STS rejects an expired assertion with an opaque message
+func (a *SAMLAssertion) CheckExpiry(now time.Time) error {
+	expires := a.ExpiresAt()
+	if expires.IsZero() || now.Add(-AssertionClockSkew).Before(expires) {
+		return nil
+	}
+
+	return fmt.Errorf("SAML assertion expired at %s", expires.Local().Format(time.RFC3339))
+}
+
+func parseAssertionTime(element *etree.Element, name string) (time.Time, error) {
+	value := element.SelectAttrValue(name, "")
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "invalid %s in assertion", name)
+	}
+
+	return t, nil
+}
+
+// ValidateRoleSessionName check the role session name in the assertion will be accepted by STS
+func ValidateRoleSessionName(roleSessionName string) error {
+	if roleSessionName == "" {
+		return errors.New("assertion is missing the RoleSessionName attribute, please check the IdP is configured to supply it")
+	}
+
+	if !roleSessionNameRegexp.MatchString(roleSessionName) {
+		return fmt.Errorf("invalid RoleSessionName %q in assertion, STS requires 2 to 64 letters, numbers or the characters +=,.@-", roleSessionName)
+	}
+
+	return nil
+}
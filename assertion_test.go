@@ -0,0 +1,100 @@
+package saml2aws
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSAMLAssertion(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion_session_not_on_or_after.xml")
+	require.Nil(t, err)
+
+	assertion, err := ParseSAMLAssertion(base64.StdEncoding.EncodeToString(data))
+	require.Nil(t, err)
+	require.Equal(t, `EXAMPLE\wolfeidau`, assertion.NameID)
+	require.Equal(t, time.Date(2016, 9, 10, 10, 54, 39, 227000000, time.UTC), assertion.SessionNotOnOrAfter)
+	require.Len(t, assertion.Roles, 2)
+	require.Equal(t, "wolfeidau@example.com", assertion.RoleSessionName)
+	require.Equal(t, int64(1800), assertion.SessionDuration)
+	require.Equal(t, "urn:amazon:webservices", assertion.Audience)
+	require.Equal(t, time.Date(2016, 9, 10, 2, 54, 39, 371000000, time.UTC), assertion.NotBefore)
+	require.Equal(t, time.Date(2016, 9, 10, 3, 54, 39, 371000000, time.UTC), assertion.NotOnOrAfter)
+	require.Equal(t, time.Date(2016, 9, 10, 2, 59, 39, 387000000, time.UTC), assertion.SubjectNotOnOrAfter)
+
+	require.Len(t, assertion.Attributes, 3)
+	require.Equal(t, AssertionAttribute{Name: "https://aws.amazon.com/SAML/Attributes/RoleSessionName", Values: []string{"wolfeidau@example.com"}}, assertion.Attributes[0])
+	require.False(t, assertion.Attributes[0].IsRoleAttribute())
+	require.True(t, assertion.Attributes[2].IsRoleAttribute())
+	require.Len(t, assertion.Attributes[2].Values, 2)
+}
+
+func TestParseSAMLAssertionWithoutSession(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion_pingfed.xml")
+	require.Nil(t, err)
+
+	assertion, err := ParseSAMLAssertionXML(data)
+	require.Nil(t, err)
+	require.Equal(t, "evan.mclean@example.com.au", assertion.NameID)
+	require.True(t, assertion.SessionNotOnOrAfter.IsZero())
+	require.Equal(t, int64(0), assertion.SessionDuration)
+}
+
+func TestParseSAMLAssertionPrincipalTags(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion_principal_tags.xml")
+	require.Nil(t, err)
+
+	assertion, err := ParseSAMLAssertionXML(data)
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"Project": "Automation", "CostCenter": "987654"}, assertion.PrincipalTags)
+	require.Equal(t, []string{"Project"}, assertion.TransitiveTagKeys)
+	require.Len(t, assertion.Roles, 2)
+
+	// orgs which don't tag sessions are unaffected
+	data, err = ioutil.ReadFile("testdata/assertion_session_duration.xml")
+	require.Nil(t, err)
+
+	assertion, err = ParseSAMLAssertionXML(data)
+	require.Nil(t, err)
+	require.Nil(t, assertion.PrincipalTags)
+	require.Nil(t, assertion.TransitiveTagKeys)
+}
+
+func TestCheckExpiry(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion.xml")
+	require.Nil(t, err)
+
+	assertion, err := ParseSAMLAssertionXML(data)
+	require.Nil(t, err)
+
+	// the subject confirmation expires before the conditions
+	expires := time.Date(2016, 9, 10, 2, 59, 39, 387000000, time.UTC)
+	require.Equal(t, expires, assertion.ExpiresAt())
+
+	require.Nil(t, assertion.CheckExpiry(expires.Add(-time.Minute)))
+	require.Nil(t, assertion.CheckExpiry(expires.Add(AssertionClockSkew-time.Second)))
+
+	err = assertion.CheckExpiry(expires.Add(AssertionClockSkew + time.Second))
+	require.EqualError(t, err, "SAML assertion expired at "+expires.Local().Format(time.RFC3339))
+
+	require.Nil(t, (&SAMLAssertion{}).CheckExpiry(time.Now()))
+}
+
+func TestParseSAMLAssertionInvalidBase64(t *testing.T) {
+	_, err := ParseSAMLAssertion("not base64!")
+	require.Error(t, err)
+}
+
+func TestValidateRoleSessionName(t *testing.T) {
+	require.Nil(t, ValidateRoleSessionName("wolfeidau@example.com"))
+	require.Nil(t, ValidateRoleSessionName("first.last+admin=ops,team-1"))
+	require.Error(t, ValidateRoleSessionName(""))
+	require.Error(t, ValidateRoleSessionName("a"))
+	require.Error(t, ValidateRoleSessionName("EXAMPLE\\wolfeidau"))
+	require.Error(t, ValidateRoleSessionName("first last"))
+	require.Error(t, ValidateRoleSessionName(strings.Repeat("a", 65)))
+}
@@ -0,0 +1,131 @@
+package saml2aws
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+)
+
+// MaxConcurrentRoles the maximum number of roles assumed in parallel
+const MaxConcurrentRoles = 4
+
+// RoleResult the outcome of assuming one of several roles, Err is set when the role couldn't be assumed,
+// otherwise the credentials and the ARN of the assumed role user are
+type RoleResult struct {
+	Role           *AWSRole
+	Credentials    *awsconfig.AWSCredentials
+	AssumedRoleARN string
+	Err            error
+}
+
+// AssumeRolesError returned when some of the roles couldn't be assumed, the roles which were are unaffected
+type AssumeRolesError struct {
+	// Failed the results of the roles which couldn't be assumed, in the order the roles were supplied
+	Failed []*RoleResult
+
+	// Total the number of roles which were to be assumed
+	Total int
+}
+
+func (e *AssumeRolesError) Error() string {
+	failures := make([]string, len(e.Failed))
+	for i, result := range e.Failed {
+		failures[i] = fmt.Sprintf("%s: %v", result.Role.RoleARN, result.Err)
+	}
+
+	return fmt.Sprintf("failed to assume %d of %d roles: %s", len(e.Failed), e.Total, strings.Join(failures, "; "))
+}
+
+// Unwrap the errors of every role which couldn't be assumed, so any of them can be matched by errors.Is and
+// errors.As
+func (e *AssumeRolesError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, result := range e.Failed {
+		errs[i] = result.Err
+	}
+
+	return errs
+}
+
+// Cause the error of the first role which couldn't be assumed, for errors.Cause
+func (e *AssumeRolesError) Cause() error {
+	return e.Failed[0].Err
+}
+
+// NewAssumeRolesError an AssumeRolesError describing the results which failed, nil when none did
+func NewAssumeRolesError(results []*RoleResult) error {
+	rolesErr := &AssumeRolesError{Total: len(results)}
+
+	for _, result := range results {
+		if result.Err != nil {
+			rolesErr.Failed = append(rolesErr.Failed, result)
+		}
+	}
+
+	if len(rolesErr.Failed) == 0 {
+		return nil
+	}
+
+	return rolesErr
+}
+
+// AssumeRoles assume each of the roles with the assertion, up to MaxConcurrentRoles at a time. A result is
+// returned for every role in the order supplied, along with an AssumeRolesError if any couldn't be assumed,
+// a failure for one role doesn't prevent the others from being assumed.
+func AssumeRoles(svc stsiface.STSAPI, roles []*AWSRole, samlAssertion string, duration int64) ([]*RoleResult, error) {
+
+	results := make([]*RoleResult, len(roles))
+
+	sem := make(chan struct{}, MaxConcurrentRoles)
+	var wg sync.WaitGroup
+
+	for i, role := range roles {
+		wg.Add(1)
+		go func(i int, role *AWSRole) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = assumeRole(svc, role, samlAssertion, duration)
+		}(i, role)
+	}
+
+	wg.Wait()
+
+	return results, NewAssumeRolesError(results)
+}
+
+// AssumeRoleWithSAML assume the role with the assertion, the result holds the credentials and the ARN of the
+// assumed role user
+func AssumeRoleWithSAML(svc stsiface.STSAPI, role *AWSRole, samlAssertion string, duration int64) (*RoleResult, error) {
+	result := assumeRole(svc, role, samlAssertion, duration)
+
+	return result, result.Err
+}
+
+func assumeRole(svc stsiface.STSAPI, role *AWSRole, samlAssertion string, duration int64) *RoleResult {
+
+	resp, err := svc.AssumeRoleWithSAML(&sts.AssumeRoleWithSAMLInput{
+		PrincipalArn:    aws.String(role.PrincipalARN),
+		RoleArn:         aws.String(role.RoleARN),
+		SAMLAssertion:   aws.String(samlAssertion),
+		DurationSeconds: aws.Int64(duration),
+	})
+	if err != nil {
+		return &RoleResult{Role: role, Err: errors.Wrap(err, "error retrieving STS credentials using SAML")}
+	}
+
+	result := &RoleResult{Role: role, Credentials: convertCredentials(resp.Credentials)}
+	if resp.AssumedRoleUser != nil {
+		result.AssumedRoleARN = aws.StringValue(resp.AssumedRoleUser.Arn)
+	}
+
+	return result
+}
@@ -5,6 +5,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strings"
 
 	"fmt"
 
@@ -14,6 +16,8 @@ import (
 
 const awsURL = "https://signin.aws.amazon.com/saml"
 
+var accountIDRegexp = regexp.MustCompile(`^\d{12}$`)
+
 // AWSAccount holds the AWS account name and roles
 type AWSAccount struct {
 	Name  string
@@ -60,29 +64,148 @@ func ExtractAWSAccounts(data []byte) ([]*AWSAccount, error) {
 	return accounts, nil
 }
 
-// AssignPrincipals assign principal from roles
-func AssignPrincipals(awsRoles []*AWSRole, awsAccounts []*AWSAccount) {
+// ParseAccountAliases parse a comma separated list of account-id=name pairs
+func ParseAccountAliases(aliases string) (map[string]string, error) {
+	accountAliases := make(map[string]string)
 
-	awsPrincipalARNs := make(map[string]string)
-	for _, awsRole := range awsRoles {
-		awsPrincipalARNs[awsRole.RoleARN] = awsRole.PrincipalARN
+	for _, pair := range strings.Split(aliases, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		tokens := strings.SplitN(pair, "=", 2)
+		if len(tokens) != 2 || strings.TrimSpace(tokens[0]) == "" || strings.TrimSpace(tokens[1]) == "" {
+			return nil, fmt.Errorf("Invalid account alias, expected account-id=name: %s", pair)
+		}
+
+		accountAliases[strings.TrimSpace(tokens[0])] = strings.TrimSpace(tokens[1])
+	}
+
+	return accountAliases, nil
+}
+
+// ParseAllowedAccounts parse a comma separated list of account ids
+func ParseAllowedAccounts(accounts string) ([]string, error) {
+	var allowedAccounts []string
+
+	for _, accountID := range strings.Split(accounts, ",") {
+		accountID = strings.TrimSpace(accountID)
+		if accountID == "" {
+			continue
+		}
+
+		if !accountIDRegexp.MatchString(accountID) {
+			return nil, fmt.Errorf("Invalid allowed account, expected a 12 digit account id: %s", accountID)
+		}
+
+		allowedAccounts = append(allowedAccounts, accountID)
 	}
 
+	return allowedAccounts, nil
+}
+
+// FilterAWSAccounts keep only the supplied roles in the accounts, dropping accounts left without any, so that
+// roles removed by filtering aren't offered when prompting
+func FilterAWSAccounts(awsAccounts []*AWSAccount, awsRoles []*AWSRole) []*AWSAccount {
+	selected := []*AWSAccount{}
+
 	for _, awsAccount := range awsAccounts {
+		roles := []*AWSRole{}
 		for _, awsRole := range awsAccount.Roles {
-			awsRole.PrincipalARN = awsPrincipalARNs[awsRole.RoleARN]
+			for _, r := range awsRoles {
+				if r.RoleARN == awsRole.RoleARN {
+					roles = append(roles, awsRole)
+					break
+				}
+			}
+		}
+
+		if len(roles) > 0 {
+			awsAccount.Roles = roles
+			selected = append(selected, awsAccount)
 		}
 	}
 
+	return selected
 }
 
-// LocateRole locate role by name
+// ApplyAccountAliases name the accounts using the supplied account id to name map, accounts without
+// an alias keep the name supplied by AWS
+func ApplyAccountAliases(awsAccounts []*AWSAccount, accountAliases map[string]string) {
+	for _, awsAccount := range awsAccounts {
+		if len(awsAccount.Roles) == 0 {
+			continue
+		}
+
+		accountID := awsAccount.Roles[0].AccountID()
+		if alias, ok := accountAliases[accountID]; ok {
+			awsAccount.Name = fmt.Sprintf("Account: %s (%s)", alias, accountID)
+		}
+	}
+}
+
+// AssignPrincipals assign principal from roles, a role granted through several SAML providers is listed once for
+// each of them so the provider can be chosen
+func AssignPrincipals(awsRoles []*AWSRole, awsAccounts []*AWSAccount) {
+
+	for _, awsAccount := range awsAccounts {
+		roles := []*AWSRole{}
+
+		for _, awsRole := range awsAccount.Roles {
+			matches := []*AWSRole{}
+			for _, r := range awsRoles {
+				if r.RoleARN == awsRole.RoleARN {
+					matches = append(matches, r)
+				}
+			}
+
+			if len(matches) == 0 {
+				roles = append(roles, awsRole)
+				continue
+			}
+
+			for _, match := range matches {
+				role := *awsRole
+				role.PrincipalARN = match.PrincipalARN
+				if len(matches) > 1 {
+					role.Name = fmt.Sprintf("%s (via %s)", awsRole.Name, match.PrincipalARN)
+				}
+				roles = append(roles, &role)
+			}
+		}
+
+		awsAccount.Roles = roles
+	}
+
+}
+
+// LocateRole locate role by name, it is an error for the role to be granted through several SAML providers as
+// the provider must then be chosen with FilterPrincipal
 func LocateRole(awsRoles []*AWSRole, roleName string) (*AWSRole, error) {
+	matches := []*AWSRole{}
 	for _, awsRole := range awsRoles {
 		if awsRole.RoleARN == roleName {
-			return awsRole, nil
+			matches = append(matches, awsRole)
 		}
 	}
 
-	return nil, fmt.Errorf("Supplied RoleArn not found in saml assertion: %s", roleName)
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+
+	if len(matches) > 1 {
+		principals := make([]string, len(matches))
+		for i, match := range matches {
+			principals[i] = match.PrincipalARN
+		}
+
+		return nil, fmt.Errorf("Supplied RoleArn %s is granted through several SAML providers, choose one with the principal arn: %s", roleName, strings.Join(principals, ", "))
+	}
+
+	available := make([]string, len(awsRoles))
+	for i, awsRole := range awsRoles {
+		available[i] = awsRole.RoleARN
+	}
+
+	return nil, fmt.Errorf("Supplied RoleArn not found in saml assertion: %s, available roles: %s", roleName, strings.Join(available, ", "))
 }
@@ -58,6 +58,39 @@ func TestAssignPrincipals(t *testing.T) {
 	assert.Equal(t, "arn:aws:iam::000000000001:saml-provider/test-idp", awsAccounts[0].Roles[0].PrincipalARN)
 }
 
+func TestAssignPrincipalsSeveralProviders(t *testing.T) {
+	awsRoles := []*AWSRole{
+		{
+			PrincipalARN: "arn:aws:iam::000000000001:saml-provider/okta",
+			RoleARN:      "arn:aws:iam::000000000001:role/Development",
+		},
+		{
+			PrincipalARN: "arn:aws:iam::000000000001:saml-provider/adfs",
+			RoleARN:      "arn:aws:iam::000000000001:role/Development",
+		},
+	}
+
+	awsAccounts := []*AWSAccount{
+		{
+			Roles: []*AWSRole{
+				{
+					RoleARN: "arn:aws:iam::000000000001:role/Development",
+					Name:    "Development",
+				},
+			},
+		},
+	}
+
+	AssignPrincipals(awsRoles, awsAccounts)
+
+	roles := awsAccounts[0].Roles
+	assert.Len(t, roles, 2)
+	assert.Equal(t, "arn:aws:iam::000000000001:saml-provider/okta", roles[0].PrincipalARN)
+	assert.Equal(t, "Development (via arn:aws:iam::000000000001:saml-provider/okta)", roles[0].Name)
+	assert.Equal(t, "arn:aws:iam::000000000001:saml-provider/adfs", roles[1].PrincipalARN)
+	assert.Equal(t, "Development (via arn:aws:iam::000000000001:saml-provider/adfs)", roles[1].Name)
+}
+
 func TestLocateRole(t *testing.T) {
 	awsRoles := []*AWSRole{
 		{
@@ -76,3 +109,96 @@ func TestLocateRole(t *testing.T) {
 
 	assert.Equal(t, "arn:aws:iam::000000000001:role/Development", role.RoleARN)
 }
+
+func TestLocateRoleNotFound(t *testing.T) {
+	awsRoles := []*AWSRole{
+		{
+			PrincipalARN: "arn:aws:iam::000000000001:saml-provider/test-idp",
+			RoleARN:      "arn:aws:iam::000000000001:role/Development",
+		},
+		{
+			PrincipalARN: "arn:aws:iam::000000000002:saml-provider/test-idp",
+			RoleARN:      "arn:aws:iam::000000000002:role/Development",
+		},
+	}
+
+	_, err := LocateRole(awsRoles, "arn:aws:iam::000000000003:role/Development")
+
+	assert.EqualError(t, err, "Supplied RoleArn not found in saml assertion: arn:aws:iam::000000000003:role/Development, available roles: arn:aws:iam::000000000001:role/Development, arn:aws:iam::000000000002:role/Development")
+}
+
+func TestLocateRoleSeveralProviders(t *testing.T) {
+	awsRoles := []*AWSRole{
+		{
+			PrincipalARN: "arn:aws:iam::000000000001:saml-provider/okta",
+			RoleARN:      "arn:aws:iam::000000000001:role/Development",
+		},
+		{
+			PrincipalARN: "arn:aws:iam::000000000001:saml-provider/adfs",
+			RoleARN:      "arn:aws:iam::000000000001:role/Development",
+		},
+	}
+
+	_, err := LocateRole(awsRoles, "arn:aws:iam::000000000001:role/Development")
+	assert.EqualError(t, err, "Supplied RoleArn arn:aws:iam::000000000001:role/Development is granted through several SAML providers, choose one with the principal arn: arn:aws:iam::000000000001:saml-provider/okta, arn:aws:iam::000000000001:saml-provider/adfs")
+
+	awsRoles, err = FilterPrincipal(awsRoles, "arn:aws:iam::000000000001:saml-provider/adfs")
+	assert.Nil(t, err)
+
+	role, err := LocateRole(awsRoles, "arn:aws:iam::000000000001:role/Development")
+	assert.Nil(t, err)
+	assert.Equal(t, "arn:aws:iam::000000000001:saml-provider/adfs", role.PrincipalARN)
+}
+
+func TestParseAccountAliases(t *testing.T) {
+	aliases, err := ParseAccountAliases("000000000001=production, 000000000002=staging,")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"000000000001": "production", "000000000002": "staging"}, aliases)
+
+	aliases, err = ParseAccountAliases("")
+	assert.Nil(t, err)
+	assert.Empty(t, aliases)
+
+	_, err = ParseAccountAliases("000000000001")
+	assert.EqualError(t, err, "Invalid account alias, expected account-id=name: 000000000001")
+}
+
+func TestParseAllowedAccounts(t *testing.T) {
+	accounts, err := ParseAllowedAccounts("000000000001, 000000000002,")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"000000000001", "000000000002"}, accounts)
+
+	accounts, err = ParseAllowedAccounts("")
+	assert.Nil(t, err)
+	assert.Empty(t, accounts)
+
+	_, err = ParseAllowedAccounts("production")
+	assert.EqualError(t, err, "Invalid allowed account, expected a 12 digit account id: production")
+}
+
+func TestFilterAWSAccounts(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/saml.html")
+	assert.Nil(t, err)
+
+	accounts, err := ExtractAWSAccounts(data)
+	assert.Nil(t, err)
+
+	allowed := accounts[1].Roles[0]
+
+	accounts = FilterAWSAccounts(accounts, []*AWSRole{{RoleARN: allowed.RoleARN}})
+	assert.Len(t, accounts, 1)
+	assert.Equal(t, []*AWSRole{allowed}, accounts[0].Roles)
+}
+
+func TestApplyAccountAliases(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/saml.html")
+	assert.Nil(t, err)
+
+	accounts, err := ExtractAWSAccounts(data)
+	assert.Nil(t, err)
+
+	ApplyAccountAliases(accounts, map[string]string{"000000000002": "staging"})
+
+	assert.Equal(t, "Account: account-alias (000000000001)", accounts[0].Name)
+	assert.Equal(t, "Account: staging (000000000002)", accounts[1].Name)
+}
@@ -2,6 +2,7 @@ package saml2aws
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 )
 
@@ -56,3 +57,152 @@ func parseRole(role string) (*AWSRole, error) {
 
 	return awsRole, nil
 }
+
+// AccountID the id of the account the role belongs to, taken from the role ARN
+func (r *AWSRole) AccountID() string {
+	// arn:partition:iam::account-id:role/role-name
+	tokens := strings.SplitN(r.RoleARN, ":", 6)
+	if len(tokens) < 6 {
+		return ""
+	}
+
+	return tokens[4]
+}
+
+// RoleName the name of the role without any path, taken from the role ARN
+func (r *AWSRole) RoleName() string {
+	return r.RoleARN[strings.LastIndex(r.RoleARN, "/")+1:]
+}
+
+// FilterRoles select the roles matching either the supplied role ARNs or the role ARN pattern
+func FilterRoles(awsRoles []*AWSRole, roleARNs []string, pattern string) ([]*AWSRole, error) {
+	selected := []*AWSRole{}
+
+	for _, roleARN := range roleARNs {
+		awsRole, err := LocateRole(awsRoles, roleARN)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, awsRole)
+	}
+
+	if pattern == "" {
+		return selected, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid role filter: %s", pattern)
+	}
+
+	for _, awsRole := range awsRoles {
+		if re.MatchString(awsRole.RoleARN) && !containsRole(selected, awsRole) {
+			selected = append(selected, awsRole)
+		}
+	}
+
+	return selected, nil
+}
+
+// NarrowRoles select the roles matching the pattern, such as the role filter of an account, to choose a single
+// role from. An empty pattern selects all of them, and it is an error for none of the roles to match.
+func NarrowRoles(awsRoles []*AWSRole, pattern string) ([]*AWSRole, error) {
+	if pattern == "" {
+		return awsRoles, nil
+	}
+
+	selected, err := FilterRoles(awsRoles, nil, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("none of the roles granted match the role filter: %s", pattern)
+	}
+
+	return selected, nil
+}
+
+// AllowedRoles select the roles in the allowed accounts which are granted through the SAML provider, either of
+// which may be empty to allow all of the roles
+func AllowedRoles(awsRoles []*AWSRole, allowedAccounts []string, principalARN string) ([]*AWSRole, error) {
+	awsRoles, err := FilterAllowedAccounts(awsRoles, allowedAccounts)
+	if err != nil {
+		return nil, err
+	}
+
+	return FilterPrincipal(awsRoles, principalARN)
+}
+
+// FilterAllowedAccounts select the roles in the allowed accounts, no accounts allows all of them. It is an error
+// for none of the roles to be in an allowed account.
+func FilterAllowedAccounts(awsRoles []*AWSRole, allowedAccounts []string) ([]*AWSRole, error) {
+	if len(allowedAccounts) == 0 {
+		return awsRoles, nil
+	}
+
+	selected := []*AWSRole{}
+
+	for _, awsRole := range awsRoles {
+		for _, accountID := range allowedAccounts {
+			if awsRole.AccountID() == accountID {
+				selected = append(selected, awsRole)
+				break
+			}
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("none of the roles granted are in the allowed accounts: %s", strings.Join(allowedAccounts, ", "))
+	}
+
+	return selected, nil
+}
+
+// CheckAllowedAccounts check each of the role ARNs, such as those of a role chain, is in one of the allowed
+// accounts, no accounts allows all of them
+func CheckAllowedAccounts(roleARNs []string, allowedAccounts []string) error {
+	if len(allowedAccounts) == 0 {
+		return nil
+	}
+
+	for _, roleARN := range roleARNs {
+		_, err := FilterAllowedAccounts([]*AWSRole{{RoleARN: roleARN}}, allowedAccounts)
+		if err != nil {
+			return fmt.Errorf("role %s isn't in the allowed accounts: %s", roleARN, strings.Join(allowedAccounts, ", "))
+		}
+	}
+
+	return nil
+}
+
+// FilterPrincipal select the roles granted through the SAML provider, no provider selects all of them. It is an
+// error for none of the roles to be granted through the provider.
+func FilterPrincipal(awsRoles []*AWSRole, principalARN string) ([]*AWSRole, error) {
+	if principalARN == "" {
+		return awsRoles, nil
+	}
+
+	selected := []*AWSRole{}
+
+	for _, awsRole := range awsRoles {
+		if awsRole.PrincipalARN == principalARN {
+			selected = append(selected, awsRole)
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("none of the roles granted are through the SAML provider: %s", principalARN)
+	}
+
+	return selected, nil
+}
+
+func containsRole(awsRoles []*AWSRole, awsRole *AWSRole) bool {
+	for _, r := range awsRoles {
+		if r == awsRole {
+			return true
+		}
+	}
+	return false
+}
@@ -30,3 +30,85 @@ func TestParseRoles(t *testing.T) {
 	assert.Nil(t, awsRoles)
 
 }
+
+func TestFilterRoles(t *testing.T) {
+
+	awsRoles := []*AWSRole{
+		{RoleARN: "arn:aws:iam::000000000001:role/Development", PrincipalARN: "arn:aws:iam::000000000001:saml-provider/example-idp"},
+		{RoleARN: "arn:aws:iam::000000000001:role/Production", PrincipalARN: "arn:aws:iam::000000000001:saml-provider/example-idp"},
+		{RoleARN: "arn:aws:iam::000000000002:role/Production", PrincipalARN: "arn:aws:iam::000000000002:saml-provider/example-idp"},
+	}
+
+	selected, err := FilterRoles(awsRoles, []string{"arn:aws:iam::000000000001:role/Development"}, "role/Production$")
+	assert.Nil(t, err)
+	assert.Equal(t, []*AWSRole{awsRoles[0], awsRoles[1], awsRoles[2]}, selected)
+
+	selected, err = FilterRoles(awsRoles, []string{"arn:aws:iam::000000000002:role/Production"}, "000000000002")
+	assert.Nil(t, err)
+	assert.Equal(t, []*AWSRole{awsRoles[2]}, selected)
+
+	_, err = FilterRoles(awsRoles, []string{"arn:aws:iam::000000000003:role/Production"}, "")
+	assert.NotNil(t, err)
+
+	_, err = FilterRoles(awsRoles, nil, "role/(")
+	assert.NotNil(t, err)
+}
+
+func TestFilterAllowedAccounts(t *testing.T) {
+
+	awsRoles := []*AWSRole{
+		{RoleARN: "arn:aws:iam::000000000001:role/Development"},
+		{RoleARN: "arn:aws:iam::000000000001:role/Production"},
+		{RoleARN: "arn:aws:iam::000000000002:role/Production"},
+	}
+
+	selected, err := FilterAllowedAccounts(awsRoles, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, awsRoles, selected)
+
+	selected, err = FilterAllowedAccounts(awsRoles, []string{"000000000002", "000000000003"})
+	assert.Nil(t, err)
+	assert.Equal(t, []*AWSRole{awsRoles[2]}, selected)
+
+	_, err = FilterAllowedAccounts(awsRoles, []string{"000000000003"})
+	assert.EqualError(t, err, "none of the roles granted are in the allowed accounts: 000000000003")
+}
+
+func TestCheckAllowedAccounts(t *testing.T) {
+
+	roleARNs := []string{"arn:aws:iam::000000000001:role/Development", "arn:aws:iam::000000000002:role/Deploy"}
+
+	assert.Nil(t, CheckAllowedAccounts(roleARNs, nil))
+	assert.Nil(t, CheckAllowedAccounts(roleARNs, []string{"000000000001", "000000000002"}))
+	assert.EqualError(t, CheckAllowedAccounts(roleARNs, []string{"000000000001"}), "role arn:aws:iam::000000000002:role/Deploy isn't in the allowed accounts: 000000000001")
+}
+
+func TestFilterPrincipal(t *testing.T) {
+
+	awsRoles := []*AWSRole{
+		{PrincipalARN: "arn:aws:iam::000000000001:saml-provider/okta", RoleARN: "arn:aws:iam::000000000001:role/Development"},
+		{PrincipalARN: "arn:aws:iam::000000000001:saml-provider/adfs", RoleARN: "arn:aws:iam::000000000001:role/Development"},
+	}
+
+	selected, err := FilterPrincipal(awsRoles, "")
+	assert.Nil(t, err)
+	assert.Equal(t, awsRoles, selected)
+
+	selected, err = FilterPrincipal(awsRoles, "arn:aws:iam::000000000001:saml-provider/adfs")
+	assert.Nil(t, err)
+	assert.Equal(t, []*AWSRole{awsRoles[1]}, selected)
+
+	_, err = FilterPrincipal(awsRoles, "arn:aws:iam::000000000001:saml-provider/missing")
+	assert.EqualError(t, err, "none of the roles granted are through the SAML provider: arn:aws:iam::000000000001:saml-provider/missing")
+}
+
+func TestRoleAccountIDAndName(t *testing.T) {
+
+	awsRole := &AWSRole{RoleARN: "arn:aws:iam::456456456456:role/engineering/admin"}
+	assert.Equal(t, "456456456456", awsRole.AccountID())
+	assert.Equal(t, "admin", awsRole.RoleName())
+
+	awsRole = &AWSRole{RoleARN: "arn:aws-cn:iam::123123123123:role/readonly"}
+	assert.Equal(t, "123123123123", awsRole.AccountID())
+	assert.Equal(t, "readonly", awsRole.RoleName())
+}
@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/versent/saml2aws"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+// MaxConcurrentRoles the maximum number of roles assumed in parallel
+const MaxConcurrentRoles = saml2aws.MaxConcurrentRoles
+
+// loginToStsUsingRoles assume each of the roles using the saml assertion and store the credentials
+// in a profile per role, a failure for one role doesn't prevent the others from being assumed
+func loginToStsUsingRoles(account *cfg.IDPAccount, cache *awsconfig.CredentialsCache, roles []*saml2aws.AWSRole, samlAssertion string, duration int64, profile string) error {
+
+	fmt.Printf("Requesting AWS credentials for %d roles using SAML assertion\n", len(roles))
+
+	// the roles granted by an assertion are in the same partition
+	svc, err := saml2aws.NewRoleSTS(account, roles[0].RoleARN)
+	if err != nil {
+		return err
+	}
+
+	results, _ := saml2aws.AssumeRoles(svc, roles, samlAssertion, duration)
+
+	// the credentials are all written to the same file so save them one at a time
+	for _, result := range results {
+		roleProfile := roleProfileName(profile, result.Role)
+
+		if result.Err == nil {
+			err := awsconfig.NewSharedCredentials(roleProfile).SaveCredentials(result.Credentials)
+			if err != nil {
+				result.Err = errors.Wrap(err, "error saving credentials")
+			}
+		}
+
+		if result.Err != nil {
+			fmt.Printf("Failed to assume %s: %v\n", result.Role.RoleARN, result.Err)
+			continue
+		}
+
+		err := cache.Store(roleProfile, result.Role.RoleARN, result.Credentials)
+		if err != nil {
+			logrus.WithError(err).Warn("unable to cache credentials")
+		}
+
+		fmt.Printf("Logged in as %s, saved to profile %s (expires %v)\n",
+			result.AssumedRoleARN, roleProfile, result.Credentials.Expires.Local())
+	}
+
+	return saml2aws.NewAssumeRolesError(results)
+}
+
+// roleProfileName build a distinct profile name for the role using the account id and role name
+func roleProfileName(profile string, role *saml2aws.AWSRole) string {
+	tokens := strings.Split(role.RoleARN, ":")
+	if len(tokens) < 6 {
+		return profile
+	}
+
+	resource := tokens[5]
+	roleName := resource[strings.LastIndex(resource, "/")+1:]
+
+	return fmt.Sprintf("%s-%s-%s", profile, tokens[4], roleName)
+}
@@ -25,7 +25,10 @@ func Configure(configFlags *flags.CommonFlags) error {
 	}
 
 	// update username and hostname if supplied
-	flags.ApplyFlagOverrides(configFlags, account)
+	err = flags.ApplyFlagOverrides(configFlags, account)
+	if err != nil {
+		return errors.Wrap(err, "failed to apply flags")
+	}
 
 	// do we need to prompt for values now?
 	if !configFlags.SkipPrompt {
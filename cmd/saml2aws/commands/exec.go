@@ -35,16 +35,16 @@ func Exec(execFlags *flags.LoginExecFlags, cmdline []string) error {
 		return nil
 	}
 
-	ok, err := checkToken(execFlags.Profile)
+	login, err := loginRequired(execFlags, checkToken)
 	if err != nil {
 		return errors.Wrap(err, "error validating token")
 	}
 
-	if !ok {
+	if login {
 		err = Login(execFlags)
-	}
-	if err != nil {
-		return errors.Wrap(err, "error logging in")
+		if err != nil {
+			return errors.Wrap(err, "error logging in")
+		}
 	}
 
 	id, secret, token, err := sharedCreds.Load()
@@ -55,6 +55,21 @@ func Exec(execFlags *flags.LoginExecFlags, cmdline []string) error {
 	return shell.ExecShellCmd(cmdline, shell.BuildEnvVars(id, secret, token))
 }
 
+// loginRequired whether to log in before running the command, always when the cache is skipped with --force or
+// --skip-cache, otherwise only when the token saved for the profile is no longer accepted
+func loginRequired(execFlags *flags.LoginExecFlags, check func(profile string) (bool, error)) (bool, error) {
+	if execFlags.SkipCache {
+		return true, nil
+	}
+
+	ok, err := check(execFlags.Profile)
+	if err != nil {
+		return false, err
+	}
+
+	return !ok, nil
+}
+
 func checkToken(profile string) (bool, error) {
 	sess, err := session.NewSessionWithOptions(session.Options{
 		Profile: profile,
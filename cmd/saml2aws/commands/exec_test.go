@@ -0,0 +1,37 @@
+package commands
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/versent/saml2aws/pkg/flags"
+)
+
+func TestLoginRequired(t *testing.T) {
+
+	checked := []string{}
+	valid := func(profile string) (bool, error) {
+		checked = append(checked, profile)
+		return true, nil
+	}
+
+	login, err := loginRequired(&flags.LoginExecFlags{Profile: "saml"}, valid)
+	assert.Nil(t, err)
+	assert.False(t, login)
+	assert.Equal(t, []string{"saml"}, checked)
+
+	login, err = loginRequired(&flags.LoginExecFlags{Profile: "saml"}, func(string) (bool, error) { return false, nil })
+	assert.Nil(t, err)
+	assert.True(t, login)
+
+	_, err = loginRequired(&flags.LoginExecFlags{Profile: "saml"}, func(string) (bool, error) { return false, errors.New("no network") })
+	assert.EqualError(t, err, "no network")
+
+	// --force and --skip-cache log in without checking the saved token
+	checked = []string{}
+	login, err = loginRequired(&flags.LoginExecFlags{Profile: "saml", SkipCache: true}, valid)
+	assert.Nil(t, err)
+	assert.True(t, login)
+	assert.Empty(t, checked)
+}
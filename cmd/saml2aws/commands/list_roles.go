@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws"
+	"github.com/versent/saml2aws/pkg/flags"
+)
+
+// ListRoles login to the IdP and print the roles granted by the SAML assertion, without requesting
+// credentials from STS or saving anything
+func ListRoles(loginFlags *flags.LoginExecFlags) error {
+
+	account, err := buildIdpAccount(loginFlags)
+	if err != nil {
+		return errors.Wrap(err, "error building login details")
+	}
+
+	samlAssertion, _, err := authenticate(account, loginFlags)
+	if err != nil {
+		return err
+	}
+
+	assertion, err := saml2aws.ParseSAMLAssertion(samlAssertion)
+	if err != nil {
+		return errors.Wrap(err, "error parsing saml assertion")
+	}
+
+	awsRoles, err := saml2aws.ParseAWSRoles(assertion.Roles)
+	if err != nil {
+		return errors.Wrap(err, "error parsing aws roles")
+	}
+
+	awsRoles, err = allowedRoles(account, awsRoles, loginFlags.CommonFlags.PrincipalArn)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("")
+
+	return printRoles(os.Stdout, awsRoles)
+}
+
+// printRoles write a table of the account id, name and ARN of each role
+func printRoles(w io.Writer, awsRoles []*saml2aws.AWSRole) error {
+
+	if len(awsRoles) == 0 {
+		return errors.New("no roles available, please check you are permitted to assume roles for the AWS service")
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "ACCOUNT\tROLE\tARN")
+	for _, awsRole := range awsRoles {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", awsRole.AccountID(), awsRole.RoleName(), awsRole.RoleARN)
+	}
+
+	return tw.Flush()
+}
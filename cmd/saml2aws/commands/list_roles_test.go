@@ -0,0 +1,29 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/versent/saml2aws"
+)
+
+func TestPrintRoles(t *testing.T) {
+
+	awsRoles := []*saml2aws.AWSRole{
+		{RoleARN: "arn:aws:iam::000000000001:role/Development"},
+		{RoleARN: "arn:aws:iam::000000000002:role/ops/Production"},
+	}
+
+	out := &bytes.Buffer{}
+
+	err := printRoles(out, awsRoles)
+	assert.Nil(t, err)
+	assert.Equal(t, `ACCOUNT       ROLE         ARN
+000000000001  Development  arn:aws:iam::000000000001:role/Development
+000000000002  Production   arn:aws:iam::000000000002:role/ops/Production
+`, out.String())
+
+	err = printRoles(out, nil)
+	assert.NotNil(t, err)
+}
@@ -1,13 +1,14 @@
 package commands
 
 import (
-	"encoding/base64"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/versent/saml2aws"
@@ -16,10 +17,13 @@ import (
 	"github.com/versent/saml2aws/pkg/cfg"
 	"github.com/versent/saml2aws/pkg/creds"
 	"github.com/versent/saml2aws/pkg/flags"
+	"github.com/versent/saml2aws/pkg/provider"
 )
 
 // MaxDurationSeconds the maximum duration in seconds for an STS session
-const MaxDurationSeconds = 3600
+//
+// Deprecated: the duration is resolved from the account and the assertion, see saml2aws.DefaultSessionDuration.
+const MaxDurationSeconds = saml2aws.DefaultSessionDuration
 
 // Login login to ADFS
 func Login(loginFlags *flags.LoginExecFlags) error {
@@ -31,30 +35,146 @@ func Login(loginFlags *flags.LoginExecFlags) error {
 		return errors.Wrap(err, "error building login details")
 	}
 
-	loginDetails, err := resolveLoginDetails(account, loginFlags)
+	output, err := buildOutputTarget(loginFlags)
 	if err != nil {
-		fmt.Printf("%+v\n", err)
+		return err
+	}
+
+	cache := newCredentialsCache(account, loginFlags)
+
+	var samlAssertion string
+
+	if loginFlags.SAMLAssertion != "" {
+		// the assertion was obtained elsewhere, such as from a browser, so the IdP isn't logged into
+		samlAssertion, err = readSAMLAssertion(loginFlags.SAMLAssertion, os.Stdin)
+		if err != nil {
+			return err
+		}
+	} else {
+		if !loginFlags.SkipCache && !loginFlags.MultipleRolesSupplied() {
+			ok, err := loginFromCache(account, cache, loginFlags, output)
+			if err != nil {
+				logger.WithError(err).Warn("unable to use cached credentials")
+			}
+			if ok {
+				return nil
+			}
+		}
+
+		var loginDetails *creds.LoginDetails
+
+		samlAssertion, loginDetails, err = authenticate(account, loginFlags)
+		if err != nil {
+			return err
+		}
+
+		err = savePassword(account, loginDetails)
+		if err != nil {
+			return err
+		}
+	}
+
+	assertion, err := saml2aws.ParseSAMLAssertion(samlAssertion)
+	if err != nil {
+		return errors.Wrap(err, "error parsing saml assertion")
+	}
+
+	// a supplied assertion may have been captured some time ago
+	err = assertion.CheckExpiry(time.Now())
+	if err != nil {
+		return err
+	}
+
+	if len(assertion.Roles) == 0 {
+		fmt.Println("No roles to assume")
+		fmt.Println("Please check you are permitted to assume roles for the AWS service")
 		os.Exit(1)
 	}
 
-	fmt.Printf("Authenticating as %s ...\n", account.Username)
+	// STS takes the session name from the assertion, so fail early with a clearer error than STS returns
+	err = saml2aws.ValidateRoleSessionName(assertion.RoleSessionName)
+	if err != nil {
+		return errors.Wrap(err, "error validating role session name")
+	}
 
-	err = loginDetails.Validate()
+	duration := saml2aws.ResolveSessionDuration(account.SessionDuration, assertion.SessionDuration)
+
+	awsRoles, err := saml2aws.ParseAWSRoles(assertion.Roles)
 	if err != nil {
-		return errors.Wrap(err, "error validating login details")
+		return errors.Wrap(err, "error parsing aws roles")
 	}
 
-	logger.WithField("idpAccount", account).Debug("building provider")
+	awsRoles, err = allowedRoles(account, awsRoles, loginFlags.CommonFlags.PrincipalArn)
+	if err != nil {
+		return err
+	}
+
+	if loginFlags.MultipleRolesSupplied() {
+		roles, err := saml2aws.FilterRoles(awsRoles, loginFlags.RoleArns, loginFlags.RoleFilter)
+		if err != nil {
+			return errors.Wrap(err, "error filtering aws roles")
+		}
+
+		if len(roles) == 0 {
+			return errors.New("no roles matched the supplied role arns or filter")
+		}
+
+		return loginToStsUsingRoles(account, cache, roles, samlAssertion, duration, loginFlags.Profile)
+	}
 
-	provider, err := saml2aws.NewSAMLClient(account)
+	awsRoles, err = narrowRoles(account, awsRoles, loginFlags)
 	if err != nil {
-		return errors.Wrap(err, "error building IdP client")
+		return err
 	}
 
-	samlAssertion, err := provider.Authenticate(loginDetails)
+	accountAliases, err := saml2aws.ParseAccountAliases(account.AccountAliases)
 	if err != nil {
-		return errors.Wrap(err, "error authenticating to IdP")
+		return errors.Wrap(err, "error parsing account aliases")
+	}
+
+	role, err := resolveRole(awsRoles, samlAssertion, accountAliases, loginFlags)
+	if err != nil {
+		return errors.Wrap(err, "Failed to assume role, please check you are permitted to assume the given role for the AWS service")
+	}
+
+	fmt.Println("Selected role:", role.RoleARN)
 
+	err = loginToStsUsingRole(account, cache, role, samlAssertion, duration, loginFlags.Profile, output)
+	if err != nil {
+		return errors.Wrap(err, "error logging into aws role using saml assertion")
+	}
+
+	return nil
+}
+
+// authenticate login to the IdP and return the SAML assertion along with the login details used, for each of the
+// commands which login to the IdP
+func authenticate(account *cfg.IDPAccount, loginFlags *flags.LoginExecFlags) (string, *creds.LoginDetails, error) {
+
+	logger := logrus.WithField("command", "login")
+
+	loginDetails, err := accountLoginDetails(account, loginFlags)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if loginFlags.CheckIdP {
+		err := checkIdP(account)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	logger.WithField("idpAccount", account).Debug("building provider")
+
+	client, err := saml2aws.NewSAMLClient(account)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "error building IdP client")
+	}
+
+	samlAssertion, err := client.Authenticate(loginDetails)
+	if err != nil {
+		return "", nil, provider.RedactError(errors.Wrap(err, "error authenticating to IdP"))
 	}
 
 	if samlAssertion == "" {
@@ -63,45 +183,79 @@ func Login(loginFlags *flags.LoginExecFlags) error {
 		os.Exit(1)
 	}
 
-	err = credentials.SaveCredentials(loginDetails.URL, loginDetails.Username, loginDetails.Password)
+	return samlAssertion, loginDetails, nil
+}
+
+// savePassword save the password in the keychain once it has been used successfully
+func savePassword(account *cfg.IDPAccount, loginDetails *creds.LoginDetails) error {
+	if browserLogin(account) {
+		return nil
+	}
+
+	err := credentials.SaveCredentials(loginDetails.URL, loginDetails.Username, loginDetails.Password)
 	if err != nil {
 		return errors.Wrap(err, "error storing password in keychain")
 	}
 
-	data, err := base64.StdEncoding.DecodeString(samlAssertion)
-	if err != nil {
-		return errors.Wrap(err, "error decoding saml assertion")
+	return nil
+}
+
+// browserLogin whether the credentials are entered in the browser, so there is nothing to prompt for or save
+func browserLogin(account *cfg.IDPAccount) bool {
+	return account.Provider == "Browser"
+}
+
+// accountLoginDetails the login details for the account, which are prompted for unless they are entered in the
+// browser, used by each of the commands which log in to the IdP
+func accountLoginDetails(account *cfg.IDPAccount, loginFlags *flags.LoginExecFlags) (*creds.LoginDetails, error) {
+	if browserLogin(account) {
+		return &creds.LoginDetails{URL: account.URL}, nil
 	}
 
-	roles, err := saml2aws.ExtractAwsRoles(data)
+	loginDetails, err := resolveLoginDetails(account, loginFlags)
 	if err != nil {
-		return errors.Wrap(err, "error parsing aws roles")
+		return nil, errors.Wrap(err, "error resolving login details")
 	}
 
-	if len(roles) == 0 {
-		fmt.Println("No roles to assume")
-		fmt.Println("Please check you are permitted to assume roles for the AWS service")
-		os.Exit(1)
-	}
+	fmt.Printf("Authenticating as %s ...\n", account.Username)
 
-	awsRoles, err := saml2aws.ParseAWSRoles(roles)
+	err = loginDetails.Validate()
 	if err != nil {
-		return errors.Wrap(err, "error parsing aws roles")
+		return nil, errors.Wrap(err, "error validating login details")
 	}
 
-	role, err := resolveRole(awsRoles, samlAssertion, loginFlags)
+	return loginDetails, nil
+}
+
+// checkIdP fail fast when the host of the IdP can't be reached, such as when the VPN isn't connected
+func checkIdP(account *cfg.IDPAccount) error {
+	idpURL, err := url.Parse(account.URL)
 	if err != nil {
-		return errors.Wrap(err, "Failed to assume role, please check you are permitted to assume the given role for the AWS service")
+		return errors.Wrap(err, "error parsing idp url")
 	}
 
-	fmt.Println("Selected role:", role.RoleARN)
+	return provider.Ping(idpURL.Host, account.SkipVerify)
+}
 
-	err = loginToStsUsingRole(role, samlAssertion, loginFlags.Profile)
+// readSAMLAssertion the base64 encoded assertion supplied with the flag, or read from stdin when it is -
+func readSAMLAssertion(value string, stdin io.Reader) (string, error) {
+	if value == "-" {
+		data, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return "", errors.Wrap(err, "error reading saml assertion from stdin")
+		}
+		value = string(data)
+	}
+
+	// the assertion may be copied with line breaks
+	samlAssertion := strings.Join(strings.Fields(value), "")
+
+	err := provider.ValidateSAMLResponse(samlAssertion)
 	if err != nil {
-		return errors.Wrap(err, "error logging into aws role using saml assertion")
+		return "", err
 	}
 
-	return nil
+	return samlAssertion, nil
 }
 
 func buildIdpAccount(loginFlags *flags.LoginExecFlags) (*cfg.IDPAccount, error) {
@@ -120,7 +274,12 @@ func buildIdpAccount(loginFlags *flags.LoginExecFlags) (*cfg.IDPAccount, error)
 	}
 
 	// update username and hostname if supplied
-	flags.ApplyFlagOverrides(loginFlags.CommonFlags, account)
+	err = flags.ApplyFlagOverrides(loginFlags.CommonFlags, account)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to apply flags")
+	}
+
+	applyAccountRole(account, loginFlags)
 
 	err = account.Validate()
 	if err != nil {
@@ -130,11 +289,37 @@ func buildIdpAccount(loginFlags *flags.LoginExecFlags) (*cfg.IDPAccount, error)
 	return account, nil
 }
 
+// applyAccountRole choose the role with the role arn configured in the account, unless a role was supplied with
+// the flags. The role filter of the account isn't applied here, it narrows the roles to choose from in narrowRoles.
+func applyAccountRole(account *cfg.IDPAccount, loginFlags *flags.LoginExecFlags) {
+	if loginFlags.CommonFlags.RoleSupplied() || loginFlags.MultipleRolesSupplied() {
+		return
+	}
+
+	loginFlags.CommonFlags.RoleArn = account.RoleArn
+}
+
+// narrowRoles apply the role filter of the account to the roles a single role is chosen from, unless a role was
+// supplied with the flags
+func narrowRoles(account *cfg.IDPAccount, awsRoles []*saml2aws.AWSRole, loginFlags *flags.LoginExecFlags) ([]*saml2aws.AWSRole, error) {
+	if loginFlags.CommonFlags.RoleSupplied() {
+		return awsRoles, nil
+	}
+
+	return saml2aws.NarrowRoles(awsRoles, account.RoleFilter)
+}
+
 func resolveLoginDetails(account *cfg.IDPAccount, loginFlags *flags.LoginExecFlags) (*creds.LoginDetails, error) {
 
 	// fmt.Printf("loginFlags %+v\n", loginFlags)
 
-	loginDetails := &creds.LoginDetails{URL: account.URL, Username: account.Username}
+	loginDetails := &creds.LoginDetails{
+		URL:          account.URL,
+		Username:     account.Username,
+		DuoMFAOption: loginFlags.DuoMFAOption,
+		MFAToken:     loginFlags.MFAToken,
+		PromptMFA:    loginFlags.PromptMFA,
+	}
 
 	fmt.Printf("Using IDP Account %s to access %s %s\n", loginFlags.CommonFlags.IdpAccount, account.Provider, account.URL)
 
@@ -157,6 +342,15 @@ func resolveLoginDetails(account *cfg.IDPAccount, loginFlags *flags.LoginExecFla
 		loginDetails.Password = loginFlags.Password
 	}
 
+	// a password read from a file descriptor or stdin takes precedence over the flag
+	err = creds.ReadPassword(loginDetails, loginFlags.PasswordFd, loginFlags.PasswordStdin)
+	if err != nil {
+		return nil, err
+	}
+
+	// without a username from the flag, keychain or account fall back to the environment and then the OS user
+	loginDetails.DefaultUsername(creds.DefaultUsernameSources)
+
 	// fmt.Printf("loginDetails %+v\n", loginDetails)
 
 	// if skip prompt was passed just pass back the flag values
@@ -172,16 +366,29 @@ func resolveLoginDetails(account *cfg.IDPAccount, loginFlags *flags.LoginExecFla
 	return loginDetails, nil
 }
 
-func resolveRole(awsRoles []*saml2aws.AWSRole, samlAssertion string, loginFlags *flags.LoginExecFlags) (*saml2aws.AWSRole, error) {
-	var role = new(saml2aws.AWSRole)
+// allowedRoles drop the roles in accounts which the account doesn't allow, and those not granted through the
+// SAML provider when one is supplied
+func allowedRoles(account *cfg.IDPAccount, awsRoles []*saml2aws.AWSRole, principalArn string) ([]*saml2aws.AWSRole, error) {
+	allowedAccounts, err := saml2aws.ParseAllowedAccounts(account.AllowedAccounts)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing allowed accounts")
+	}
+
+	return saml2aws.AllowedRoles(awsRoles, allowedAccounts, principalArn)
+}
+
+func resolveRole(awsRoles []*saml2aws.AWSRole, samlAssertion string, accountAliases map[string]string, loginFlags *flags.LoginExecFlags) (*saml2aws.AWSRole, error) {
+	if len(awsRoles) == 0 {
+		return nil, errors.New("no roles available")
+	}
+
+	// a supplied role is used directly, skipping the lookup of the account names used when prompting
+	if loginFlags.CommonFlags.RoleSupplied() {
+		return saml2aws.LocateRole(awsRoles, loginFlags.CommonFlags.RoleArn)
+	}
 
 	if len(awsRoles) == 1 {
-		if loginFlags.CommonFlags.RoleSupplied() {
-			return saml2aws.LocateRole(awsRoles, loginFlags.CommonFlags.RoleArn)
-		}
 		return awsRoles[0], nil
-	} else if len(awsRoles) == 0 {
-		return nil, errors.New("no roles available")
 	}
 
 	awsAccounts, err := saml2aws.ParseAWSAccounts(samlAssertion)
@@ -189,60 +396,164 @@ func resolveRole(awsRoles []*saml2aws.AWSRole, samlAssertion string, loginFlags
 		return nil, errors.Wrap(err, "error parsing aws role accounts")
 	}
 
+	awsAccounts = saml2aws.FilterAWSAccounts(awsAccounts, awsRoles)
 	saml2aws.AssignPrincipals(awsRoles, awsAccounts)
+	saml2aws.ApplyAccountAliases(awsAccounts, accountAliases)
 
-	if loginFlags.CommonFlags.RoleSupplied() {
-		return saml2aws.LocateRole(awsRoles, loginFlags.CommonFlags.RoleArn)
+	return saml2aws.PromptForAWSRoleSelection(awsAccounts)
+}
+
+func loginToStsUsingRole(account *cfg.IDPAccount, cache *awsconfig.CredentialsCache, role *saml2aws.AWSRole, samlAssertion string, duration int64, profile string, output *awsconfig.OutputTarget) error {
+
+	fmt.Println("Requesting AWS credentials using SAML assertion")
+
+	result, err := assumeRoleWithSAML(account, role, samlAssertion, duration)
+	if err != nil {
+		return err
+	}
+
+	// fmt.Println("Saving credentials")
+
+	err = saveCredentials(profile, result.Credentials)
+	if err != nil {
+		return err
 	}
 
-	for {
-		role, err = saml2aws.PromptForAWSRoleSelection(awsAccounts)
-		if err == nil {
-			break
+	if output != nil {
+		err = output.Save(result.Credentials)
+		if err != nil {
+			return errors.Wrap(err, "error writing credentials to output file")
 		}
-		fmt.Println("error selecting role, try again")
 	}
 
-	return role, nil
+	err = cache.Store(profile, role.RoleARN, result.Credentials)
+	if err != nil {
+		logrus.WithError(err).Warn("unable to cache credentials")
+	}
+
+	fmt.Println("Logged in as:", result.AssumedRoleARN)
+	fmt.Println("")
+	fmt.Println("Your new access key pair has been stored in the AWS configuration")
+	fmt.Printf("Note that it will expire at %v\n", result.Credentials.Expires.Local())
+	fmt.Println("To use this credential, call the AWS CLI with the --profile option (e.g. aws --profile", profile, "ec2 describe-instances).")
+
+	return nil
+}
+
+// assumeRoleWithSAML assume the role through STS for the account, or the partition of the role, with the same
+// calls the library Login makes
+func assumeRoleWithSAML(account *cfg.IDPAccount, role *saml2aws.AWSRole, samlAssertion string, duration int64) (*saml2aws.RoleResult, error) {
+
+	svc, err := saml2aws.NewRoleSTS(account, role.RoleARN)
+	if err != nil {
+		return nil, err
+	}
+
+	return saml2aws.AssumeRoleWithSAML(svc, role, samlAssertion, duration)
 }
 
-func loginToStsUsingRole(role *saml2aws.AWSRole, samlAssertion string, profile string) error {
+func saveCredentials(profile string, credentials *awsconfig.AWSCredentials) error {
 
-	sess, err := session.NewSession()
+	sharedCreds := awsconfig.NewSharedCredentials(profile)
+
+	err := sharedCreds.SaveCredentials(credentials)
 	if err != nil {
-		return errors.Wrap(err, "failed to create session")
+		return errors.Wrap(err, "error saving credentials")
 	}
 
-	svc := sts.New(sess)
+	return nil
+}
 
-	params := &sts.AssumeRoleWithSAMLInput{
-		PrincipalArn:    aws.String(role.PrincipalARN), // Required
-		RoleArn:         aws.String(role.RoleARN),      // Required
-		SAMLAssertion:   aws.String(samlAssertion),     // Required
-		DurationSeconds: aws.Int64(MaxDurationSeconds), // 1 hour
+// buildOutputTarget the file the credentials are also written to, nil when one isn't supplied. The credentials
+// for several roles would overwrite each other so an output file requires a single role.
+func buildOutputTarget(loginFlags *flags.LoginExecFlags) (*awsconfig.OutputTarget, error) {
+	if loginFlags.OutputFile == "" {
+		return nil, nil
 	}
 
-	fmt.Println("Requesting AWS credentials using SAML assertion")
+	if loginFlags.MultipleRolesSupplied() {
+		return nil, errors.New("an output file can't be used when assuming multiple roles")
+	}
+
+	return awsconfig.NewOutputTarget(loginFlags.OutputFile, loginFlags.OutputFormat, loginFlags.Profile)
+}
 
-	resp, err := svc.AssumeRoleWithSAML(params)
+// newCredentialsCache the credentials cache for the IdP account and user logging in, so credentials cached by
+// another account or user aren't reused
+func newCredentialsCache(account *cfg.IDPAccount, loginFlags *flags.LoginExecFlags) *awsconfig.CredentialsCache {
+	return awsconfig.NewCredentialsCache(awsconfig.DefaultCacheFile, awsconfig.CacheIdentity{
+		IdpAccount: loginFlags.CommonFlags.IdpAccount,
+		URL:        account.URL,
+		Username:   account.Username,
+	})
+}
+
+// loginFromCache save the cached credentials for the profile, and role if supplied, when they remain
+// valid for longer than the skew, which avoids logging into the IdP again
+func loginFromCache(account *cfg.IDPAccount, cache *awsconfig.CredentialsCache, loginFlags *flags.LoginExecFlags, output *awsconfig.OutputTarget) (bool, error) {
+
+	skew := awsconfig.DefaultCacheSkew
+	if account.CacheSkew > 0 {
+		skew = time.Duration(account.CacheSkew) * time.Second
+	}
+
+	cached, err := cache.Lookup(loginFlags.Profile, loginFlags.CommonFlags.RoleArn, skew)
 	if err != nil {
-		return errors.Wrap(err, "error retrieving STS credentials using SAML")
+		return false, err
 	}
 
-	// fmt.Println("Saving credentials")
+	if cached == nil {
+		// the role of credentials in the shared credentials file isn't known, so they are only reused when a role isn't requested
+		if loginFlags.CommonFlags.RoleArn != "" {
+			return false, nil
+		}
 
-	sharedCreds := awsconfig.NewSharedCredentials(profile)
+		return loginFromSharedCredentials(awsconfig.NewSharedCredentials(loginFlags.Profile), skew, output)
+	}
 
-	err = sharedCreds.Save(aws.StringValue(resp.Credentials.AccessKeyId), aws.StringValue(resp.Credentials.SecretAccessKey), aws.StringValue(resp.Credentials.SessionToken))
+	err = awsconfig.NewSharedCredentials(loginFlags.Profile).SaveCredentials(cached.Credentials)
 	if err != nil {
-		return errors.Wrap(err, "error saving credentials")
+		return false, errors.Wrap(err, "error saving cached credentials")
 	}
 
-	fmt.Println("Logged in as:", aws.StringValue(resp.AssumedRoleUser.Arn))
-	fmt.Println("")
-	fmt.Println("Your new access key pair has been stored in the AWS configuration")
-	fmt.Printf("Note that it will expire at %v\n", resp.Credentials.Expiration.Local())
-	fmt.Println("To use this credential, call the AWS CLI with the --profile option (e.g. aws --profile", profile, "ec2 describe-instances).")
+	if output != nil {
+		err = output.Save(cached.Credentials)
+		if err != nil {
+			return false, errors.Wrap(err, "error writing cached credentials to output file")
+		}
+	}
 
-	return nil
+	fmt.Println("Using cached credentials for", cached.RoleARN)
+	fmt.Printf("Note that they will expire at %v, use --force to login again\n", cached.Credentials.Expires.Local())
+
+	return true, nil
+}
+
+// loginFromSharedCredentials reuse the credentials already saved in the profile, such as by an earlier login
+// before the cache was kept, while they remain valid for longer than the skew
+func loginFromSharedCredentials(sharedCreds *awsconfig.CredentialsProvider, skew time.Duration, output *awsconfig.OutputTarget) (bool, error) {
+
+	awsCreds, err := sharedCreds.LoadCredentials()
+	if err != nil {
+		if err == awsconfig.ErrCredentialsNotFound || os.IsNotExist(errors.Cause(err)) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "error loading saved credentials")
+	}
+
+	if !awsCreds.ValidFor(skew) {
+		return false, nil
+	}
+
+	if output != nil {
+		err = output.Save(awsCreds)
+		if err != nil {
+			return false, errors.Wrap(err, "error writing saved credentials to output file")
+		}
+	}
+
+	fmt.Println("Using the credentials saved in profile", sharedCreds.Profile)
+	fmt.Printf("Note that they will expire at %v, use --force to login again\n", awsCreds.Expires.Local())
+
+	return true, nil
 }
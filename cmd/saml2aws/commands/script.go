@@ -0,0 +1,37 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/shell"
+)
+
+// Script print statements exporting the credentials saved for the profile so they can be evaluated by the shell
+func Script(profile, shellName string) error {
+
+	sharedCreds := awsconfig.NewSharedCredentials(profile)
+
+	exist, err := sharedCreds.CredsExists()
+	if err != nil {
+		return errors.Wrap(err, "error loading credentials")
+	}
+	if !exist {
+		return errors.New("unable to load credentials, login required to create them")
+	}
+
+	awsCreds, err := sharedCreds.LoadCredentials()
+	if err != nil {
+		return errors.Wrap(err, "error loading credentials")
+	}
+
+	if !awsCreds.Expires.IsZero() && awsCreds.Expires.Before(time.Now()) {
+		return errors.New("credentials have expired, login required to refresh them")
+	}
+
+	fmt.Print(shell.BuildExports(shellName, awsCreds.AWSAccessKey, awsCreds.AWSSecretKey, awsCreds.AWSSessionToken, awsCreds.Expires))
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awscredentials "github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/flags"
+)
+
+// Verify login to the IdP and check the SAML assertion grants roles, and if requested print the contents of
+// the assertion, or assume a role and print the caller identity, without saving the password, credentials or cache
+func Verify(loginFlags *flags.LoginExecFlags, callerIdentity, showAssertion bool) error {
+
+	account, err := buildIdpAccount(loginFlags)
+	if err != nil {
+		return errors.Wrap(err, "error building login details")
+	}
+
+	samlAssertion, _, err := authenticate(account, loginFlags)
+	if err != nil {
+		return err
+	}
+
+	assertion, err := saml2aws.ParseSAMLAssertion(samlAssertion)
+	if err != nil {
+		return errors.Wrap(err, "error parsing saml assertion")
+	}
+
+	if showAssertion {
+		printAssertion(os.Stdout, assertion)
+	}
+
+	awsRoles, err := saml2aws.ParseAWSRoles(assertion.Roles)
+	if err != nil {
+		return errors.Wrap(err, "error parsing aws roles")
+	}
+
+	awsRoles, err = allowedRoles(account, awsRoles, loginFlags.CommonFlags.PrincipalArn)
+	if err != nil {
+		return err
+	}
+
+	if len(awsRoles) == 0 {
+		return errors.New("no roles available, please check you are permitted to assume roles for the AWS service")
+	}
+
+	fmt.Printf("Authenticated as %s, the assertion grants %d role(s)\n", assertion.NameID, len(awsRoles))
+
+	if len(assertion.PrincipalTags) > 0 {
+		fmt.Printf("Session tags: %s\n", formatPrincipalTags(assertion))
+	}
+
+	if !callerIdentity {
+		return nil
+	}
+
+	err = saml2aws.ValidateRoleSessionName(assertion.RoleSessionName)
+	if err != nil {
+		return errors.Wrap(err, "error validating role session name")
+	}
+
+	awsRoles, err = narrowRoles(account, awsRoles, loginFlags)
+	if err != nil {
+		return err
+	}
+
+	accountAliases, err := saml2aws.ParseAccountAliases(account.AccountAliases)
+	if err != nil {
+		return errors.Wrap(err, "error parsing account aliases")
+	}
+
+	role, err := resolveRole(awsRoles, samlAssertion, accountAliases, loginFlags)
+	if err != nil {
+		return errors.Wrap(err, "error selecting role")
+	}
+
+	duration := saml2aws.ResolveSessionDuration(account.SessionDuration, assertion.SessionDuration)
+
+	result, err := assumeRoleWithSAML(account, role, samlAssertion, duration)
+	if err != nil {
+		return err
+	}
+
+	sess, err := session.NewSession(buildCallerIdentityConfig(account, role, result.Credentials))
+	if err != nil {
+		return errors.Wrap(err, "failed to create session")
+	}
+
+	identity, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return errors.Wrap(err, "error retrieving caller identity")
+	}
+
+	fmt.Println("Caller identity:", aws.StringValue(identity.Arn))
+
+	return nil
+}
+
+// buildCallerIdentityConfig the STS config for the partition of the role using the assumed role credentials
+// directly, rather than any saved in the shared credentials file
+func buildCallerIdentityConfig(account *cfg.IDPAccount, role *saml2aws.AWSRole, credentials *awsconfig.AWSCredentials) *aws.Config {
+	return saml2aws.BuildRoleSTSConfig(account, role.RoleARN).WithCredentials(awscredentials.NewStaticCredentials(
+		credentials.AWSAccessKey,
+		credentials.AWSSecretKey,
+		credentials.AWSSessionToken,
+	))
+}
+
+// printAssertion print the contents of the assertion for checking the attributes supplied by the IdP, the roles
+// are marked with an asterisk, or an exclamation mark if AWS wouldn't accept them
+func printAssertion(w io.Writer, assertion *saml2aws.SAMLAssertion) {
+	fmt.Fprintf(w, "NameID:   %s\n", assertion.NameID)
+	fmt.Fprintf(w, "Audience: %s\n", assertion.Audience)
+	fmt.Fprintf(w, "Valid:    %s to %s\n", formatAssertionTime(assertion.NotBefore), formatAssertionTime(assertion.NotOnOrAfter))
+	fmt.Fprintln(w, "Attributes:")
+
+	for _, attribute := range assertion.Attributes {
+		fmt.Fprintf(w, "  %s\n", attribute.Name)
+
+		for _, value := range attribute.Values {
+			if !attribute.IsRoleAttribute() {
+				fmt.Fprintf(w, "    %s\n", value)
+				continue
+			}
+
+			roles, err := saml2aws.ParseAWSRoles([]string{value})
+			if err != nil {
+				fmt.Fprintf(w, "  ! %s (%v)\n", value, err)
+				continue
+			}
+
+			fmt.Fprintf(w, "  * %s via %s\n", roles[0].RoleARN, roles[0].PrincipalARN)
+		}
+	}
+
+	fmt.Fprintln(w)
+}
+
+// formatPrincipalTags the session tags in the assertion sorted by name, marking those which are transitive
+func formatPrincipalTags(assertion *saml2aws.SAMLAssertion) string {
+	transitive := map[string]bool{}
+	for _, key := range assertion.TransitiveTagKeys {
+		transitive[key] = true
+	}
+
+	tags := []string{}
+	for key, value := range assertion.PrincipalTags {
+		tag := fmt.Sprintf("%s=%s", key, value)
+		if transitive[key] {
+			tag += " (transitive)"
+		}
+		tags = append(tags, tag)
+	}
+
+	sort.Strings(tags)
+
+	return strings.Join(tags, ", ")
+}
+
+func formatAssertionTime(t time.Time) string {
+	if t.IsZero() {
+		return "(not supplied)"
+	}
+
+	return t.Format(time.RFC3339)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/alecthomas/kingpin"
 	"github.com/sirupsen/logrus"
 	"github.com/versent/saml2aws/cmd/saml2aws/commands"
+	"github.com/versent/saml2aws/pkg/awsconfig"
 	"github.com/versent/saml2aws/pkg/flags"
 )
 
@@ -39,6 +40,19 @@ func buildCmdList(s kingpin.Settings) (target *[]string) {
 	return
 }
 
+// addLoginFlags register the flags shared by the commands which login to the IDP
+func addLoginFlags(cmd *kingpin.CmdClause, commonFlags *flags.CommonFlags) *flags.LoginExecFlags {
+	loginFlags := new(flags.LoginExecFlags)
+	loginFlags.CommonFlags = commonFlags
+	cmd.Flag("password", "The password used to login.").Envar("SAML2AWS_PASSWORD").StringVar(&loginFlags.Password)
+	cmd.Flag("password-stdin", "Read the password used to login from stdin.").BoolVar(&loginFlags.PasswordStdin)
+	cmd.Flag("password-fd", "Read the password used to login from this file descriptor.").IntVar(&loginFlags.PasswordFd)
+	cmd.Flag("duo-mfa-option", "The DUO MFA option to use rather than prompting for it.").EnumVar(&loginFlags.DuoMFAOption, "push", "passcode", "phone")
+	cmd.Flag("mfa-token", "The passcode used with the DUO passcode MFA option.").Envar("SAML2AWS_MFA_TOKEN").StringVar(&loginFlags.MFAToken)
+	cmd.Flag("prompt-mfa", "Prompt for the MFA option even if one was remembered.").BoolVar(&loginFlags.PromptMFA)
+	return loginFlags
+}
+
 func main() {
 
 	app := kingpin.New("saml2aws", "A command line tool to help with SAML access to the AWS token service.")
@@ -46,19 +60,30 @@ func main() {
 
 	// Settings not related to commands
 	verbose := app.Flag("verbose", "Enable verbose logging").Bool()
-	provider := app.Flag("provider", "This flag it is obsolete see https://github.com/Versent/saml2aws#adding-idp-accounts.").Short('i').Enum("ADFS", "ADFS2", "Ping", "JumpCloud", "Okta", "KeyCloak")
+	provider := app.Flag("provider", "This flag it is obsolete see https://github.com/Versent/saml2aws#adding-idp-accounts.").Short('i').Enum("ADFS", "ADFS2", "Ping", "JumpCloud", "Okta", "KeyCloak", "AzureAD", "GoogleApps", "Shibboleth", "Auth0", "F5APM", "Browser")
 
 	// Common (to all commands) settings
 	commonFlags := new(flags.CommonFlags)
 	app.Flag("idp-account", "The name of the configured IDP account").Short('a').Default("default").StringVar(&commonFlags.IdpAccount)
-	app.Flag("idp-provider", "The configured IDP provider").EnumVar(&commonFlags.IdpProvider, "ADFS", "ADFS2", "Ping", "JumpCloud", "Okta", "KeyCloak")
+	app.Flag("account", "The name of the configured IDP account, the same as --idp-account.").Hidden().StringVar(&commonFlags.IdpAccount)
+	app.Flag("idp-provider", "The configured IDP provider").EnumVar(&commonFlags.IdpProvider, "ADFS", "ADFS2", "Ping", "JumpCloud", "Okta", "KeyCloak", "AzureAD", "GoogleApps", "Shibboleth", "Auth0", "F5APM", "Browser")
 	app.Flag("mfa", "The name of the mfa").EnumVar(&commonFlags.MFA, "Auto", "VIP")
 	app.Flag("skip-verify", "Skip verification of server certificate.").Short('s').BoolVar(&commonFlags.SkipVerify)
 	app.Flag("url", "The URL of the SAML IDP server used to login.").StringVar(&commonFlags.URL)
 	app.Flag("username", "The username used to login.").Envar("SAML2AWS_USERNAME").StringVar(&commonFlags.Username)
 	app.Flag("role", "The ARN of the role to assume.").StringVar(&commonFlags.RoleArn)
+	app.Flag("principal-arn", "The ARN of the SAML provider to assume the role through, when the role is granted through several.").StringVar(&commonFlags.PrincipalArn)
 	app.Flag("aws-urn", "The URN used by SAML when you login.").StringVar(&commonFlags.AmazonWebservicesURN)
+	app.Flag("region", "The AWS region used when requesting credentials from STS, for example us-gov-west-1 or cn-north-1.").StringVar(&commonFlags.Region)
+	app.Flag("sts-endpoint", "The STS endpoint used when requesting credentials, requires --region.").StringVar(&commonFlags.STSEndpoint)
+	app.Flag("session-duration", "The duration of the STS session in seconds, capped at the SessionDuration supplied by the IdP.").Int64Var(&commonFlags.SessionDuration)
 	app.Flag("skip-prompt", "Skip prompting for parameters during login.").BoolVar(&commonFlags.SkipPrompt)
+	app.Flag("duo-remember-device", "Ask DUO to remember this device, storing its cookie in the cookie file.").BoolVar(&commonFlags.DuoRememberDevice)
+	app.Flag("mfa-remember", "Remember the MFA option chosen when there are several, using it without prompting next time.").BoolVar(&commonFlags.MFARemember)
+	app.Flag("push-fallback", "Prompt for a passcode when a Duo or Okta Verify push isn't approved in time, rather than failing.").BoolVar(&commonFlags.PushFallback)
+	app.Flag("cookie-file", "Persist the IDP session cookies in this file so they are reused by later logins.").StringVar(&commonFlags.CookieFile)
+	app.Flag("account-aliases", "Names shown for the accounts when choosing a role, as a comma separated list of account-id=name pairs.").StringVar(&commonFlags.AccountAliases)
+	app.Flag("allowed-accounts", "Only allow roles in these accounts to be assumed, as a comma separated list of account ids, narrowing those allowed by the account.").StringVar(&commonFlags.AllowedAccounts)
 
 	// `configure` command and settings
 	cmdConfigure := app.Command("configure", "Configure a new IDP account.")
@@ -66,19 +91,40 @@ func main() {
 
 	// `login` command and settings
 	cmdLogin := app.Command("login", "Login to a SAML 2.0 IDP and convert the SAML assertion to an STS token.")
-	loginFlags := new(flags.LoginExecFlags)
-	loginFlags.CommonFlags = commonFlags
-	cmdLogin.Flag("password", "The password used to login.").Envar("SAML2AWS_PASSWORD").StringVar(&loginFlags.Password)
+	loginFlags := addLoginFlags(cmdLogin, commonFlags)
 	cmdLogin.Flag("profile", "The AWS profile to save the temporary credentials").Short('p').Default("saml").StringVar(&loginFlags.Profile)
+	cmdLogin.Flag("assume-role", "The ARN of a role to assume along with any others supplied, each is saved to its own profile.").StringsVar(&loginFlags.RoleArns)
+	cmdLogin.Flag("role-filter", "A regular expression matching the ARNs of the roles to assume, each is saved to its own profile.").StringVar(&loginFlags.RoleFilter)
+	cmdLogin.Flag("check-idp", "Check the IdP can be reached before logging in, to report a disconnected VPN clearly.").BoolVar(&loginFlags.CheckIdP)
+	cmdLogin.Flag("skip-cache", "Login to the IDP even if cached credentials for the profile are still valid.").BoolVar(&loginFlags.SkipCache)
+	cmdLogin.Flag("force", "Login to the IDP even if the credentials saved or cached for the profile are still valid, the same as --skip-cache.").BoolVar(&loginFlags.SkipCache)
+	cmdLogin.Flag("output-file", "Also write the temporary credentials to this file, replacing it.").StringVar(&loginFlags.OutputFile)
+	cmdLogin.Flag("output-format", "The format of the output file.").Default(awsconfig.DefaultOutputFormat).EnumVar(&loginFlags.OutputFormat, awsconfig.OutputFormats()...)
+	cmdLogin.Flag("saml-assertion", "Use this base64 encoded SAML assertion, or read it from stdin when -, rather than logging into the IDP.").StringVar(&loginFlags.SAMLAssertion)
 
 	// `exec` command and settings
 	cmdExec := app.Command("exec", "Exec the supplied command with env vars from STS token.")
-	execFlags := new(flags.LoginExecFlags)
-	execFlags.CommonFlags = commonFlags
-	cmdExec.Flag("password", "The password used to login.").Envar("SAML2AWS_PASSWORD").StringVar(&execFlags.Password)
+	execFlags := addLoginFlags(cmdExec, commonFlags)
 	cmdExec.Flag("profile", "The AWS profile to save the temporary credentials").Short('p').Default("saml").StringVar(&execFlags.Profile)
+	cmdExec.Flag("skip-cache", "Login to the IDP even if cached credentials for the profile are still valid.").BoolVar(&execFlags.SkipCache)
+	cmdExec.Flag("force", "Login to the IDP even if the credentials saved or cached for the profile are still valid, the same as --skip-cache.").BoolVar(&execFlags.SkipCache)
 	cmdLine := buildCmdList(cmdExec.Arg("command", "The command to execute."))
 
+	// `list-roles` command and settings
+	cmdListRoles := app.Command("list-roles", "Login to a SAML 2.0 IDP and list the roles granted by the SAML assertion, without requesting credentials.")
+	listRolesFlags := addLoginFlags(cmdListRoles, commonFlags)
+
+	// `verify` command and settings
+	cmdVerify := app.Command("verify", "Login to a SAML 2.0 IDP and check the SAML assertion grants roles, without saving the password or any credentials.")
+	verifyFlags := addLoginFlags(cmdVerify, commonFlags)
+	verifyCallerIdentity := cmdVerify.Flag("caller-identity", "Assume the role and print the caller identity returned by STS, the credentials are discarded.").Bool()
+	verifyShowAssertion := cmdVerify.Flag("show-assertion", "Print the NameID, audience, validity and attributes of the SAML assertion.").Bool()
+
+	// `script` command and settings
+	cmdScript := app.Command("script", "Emit statements which export the env vars from STS token, for use with eval.")
+	scriptProfile := cmdScript.Flag("profile", "The AWS profile containing the temporary credentials").Short('p').Default("saml").String()
+	scriptShell := cmdScript.Flag("shell", "The shell the statements are written for.").Default("bash").Enum("bash", "fish", "powershell")
+
 	// Trigger the parsing of the command line inputs via kingpin
 	command := kingpin.MustParse(app.Parse(os.Args[1:]))
 
@@ -100,6 +146,12 @@ func main() {
 		err = commands.Login(loginFlags)
 	case cmdExec.FullCommand():
 		err = commands.Exec(execFlags, *cmdLine)
+	case cmdListRoles.FullCommand():
+		err = commands.ListRoles(listRolesFlags)
+	case cmdVerify.FullCommand():
+		err = commands.Verify(verifyFlags, *verifyCallerIdentity, *verifyShowAssertion)
+	case cmdScript.FullCommand():
+		err = commands.Script(*scriptProfile, *scriptShell)
 	case cmdConfigure.FullCommand():
 		err = commands.Configure(configFlags)
 	}
@@ -0,0 +1,73 @@
+package saml2aws
+
+import (
+	"time"
+
+	awscredentials "github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/pkg/errors"
+)
+
+// CredentialsProviderName the provider name reported in the credentials value
+const CredentialsProviderName = "Saml2AWSProvider"
+
+// DefaultExpiryWindow how long before the credentials expire they are refreshed by logging in again
+const DefaultExpiryWindow = 5 * time.Minute
+
+// CredentialsProvider an AWS SDK credentials provider which logs in with saml2aws, logging in again once the
+// credentials are within the expiry window of expiring. The IdP client is kept between logins so its cookies,
+// such as a remembered Duo device, are reused, whether MFA is required again is up to the IdP.
+type CredentialsProvider struct {
+	awscredentials.Expiry
+
+	// ExpiryWindow how long before the credentials expire they are refreshed
+	ExpiryWindow time.Duration
+
+	opts LoginOptions
+}
+
+// NewCredentialsProvider create a provider which logs in with the options, they must choose the role when
+// the assertion grants more than one as nothing is prompted for
+func NewCredentialsProvider(opts LoginOptions) *CredentialsProvider {
+	return &CredentialsProvider{ExpiryWindow: DefaultExpiryWindow, opts: opts}
+}
+
+// NewCredentials create credentials for AWS SDK clients which log in with saml2aws as required
+func NewCredentials(opts LoginOptions) *awscredentials.Credentials {
+	return awscredentials.NewCredentials(NewCredentialsProvider(opts))
+}
+
+// Retrieve log in and request new credentials from STS
+func (p *CredentialsProvider) Retrieve() (awscredentials.Value, error) {
+
+	if p.opts.SAMLAssertion != "" {
+		return awscredentials.Value{ProviderName: CredentialsProviderName}, errors.New("credentials can't be refreshed with a SAML assertion obtained elsewhere")
+	}
+
+	if p.opts.Provider == nil && p.opts.Account != nil {
+		account := *p.opts.Account
+		if p.opts.MFA != "" {
+			account.MFA = p.opts.MFA
+		}
+
+		client, err := NewSAMLClient(&account)
+		if err != nil {
+			return awscredentials.Value{ProviderName: CredentialsProviderName}, errors.Wrap(err, "error building IdP client")
+		}
+
+		p.opts.Provider = client
+	}
+
+	credentials, err := Login(p.opts)
+	if err != nil {
+		return awscredentials.Value{ProviderName: CredentialsProviderName}, err
+	}
+
+	p.SetExpiration(credentials.Expires, p.ExpiryWindow)
+
+	return awscredentials.Value{
+		AccessKeyID:     credentials.AWSAccessKey,
+		SecretAccessKey: credentials.AWSSecretKey,
+		SessionToken:    credentials.AWSSessionToken,
+		ProviderName:    CredentialsProviderName,
+	}, nil
+}
@@ -0,0 +1,136 @@
+package saml2aws
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/provider"
+)
+
+// detectTimeout how long DetectProvider waits for the login page
+const detectTimeout = 10 * time.Second
+
+// providerMarker a clue found on a login page which identifies the provider serving it
+type providerMarker struct {
+	provider    string
+	description string
+	match       func(loginURL *url.URL, data []byte) bool
+}
+
+var providerMarkers = []providerMarker{
+	{"Okta", "okta-signin-widget on the page", pageContains("okta-signin-widget")},
+	{"Okta", "okta.com hostname", hostHasSuffix(".okta.com", ".oktapreview.com")},
+	{"ADFS", "/adfs/ls path", pathContains("/adfs/ls")},
+	{"ADFS", "ADFS AuthMethod form field", pageContains(`name="AuthMethod"`)},
+	{"Ping", "PingFederate resume path", pathContains("/resumeSAML20/", "/idp/startSSO.ping")},
+	{"Ping", "PingFederate pf.username form field", pageContains(`name="pf.username"`)},
+	{"KeyCloak", "/auth/realms/ path", pathContains("/auth/realms/")},
+	{"KeyCloak", "kc-form-login form", pageContains(`id="kc-form-login"`)},
+	{"JumpCloud", "jumpcloud.com hostname", hostHasSuffix("jumpcloud.com")},
+	{"AzureAD", "login.microsoftonline.com hostname", hostHasSuffix("login.microsoftonline.com")},
+	{"GoogleApps", "accounts.google.com hostname", hostHasSuffix("accounts.google.com")},
+	{"Auth0", "auth0.com hostname", hostHasSuffix(".auth0.com")},
+	{"F5APM", "/my.policy path", pathContains("/my.policy")},
+	{"Shibboleth", "/idp/profile/ path", pathContains("/idp/profile/")},
+	{"Shibboleth", "j_username form field", pageContains(`name="j_username"`)},
+}
+
+// DetectProvider fetch the login page for the hostname, or URL, and guess which provider is serving it
+func DetectProvider(hostname string) (string, error) {
+
+	loginURL := hostname
+	if !strings.Contains(loginURL, "://") {
+		loginURL = "https://" + loginURL
+	}
+
+	client, err := provider.NewHTTPClient(provider.NewDefaultTransport(false))
+	if err != nil {
+		return "", errors.Wrap(err, "error building http client")
+	}
+
+	client.Timeout = detectTimeout
+
+	res, err := client.Get(loginURL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page body")
+	}
+
+	// use the url of the page after any redirects as it often identifies the provider
+	return ExtractProvider(res.Request.URL, data)
+}
+
+// ExtractProvider guess the provider from the url and content of the login page, returning an
+// error listing the clues found when there isn't exactly one candidate
+func ExtractProvider(loginURL *url.URL, data []byte) (string, error) {
+
+	clues := map[string][]string{}
+
+	for _, marker := range providerMarkers {
+		if marker.match(loginURL, data) {
+			clues[marker.provider] = append(clues[marker.provider], marker.description)
+		}
+	}
+
+	if len(clues) == 1 {
+		for provider := range clues {
+			return provider, nil
+		}
+	}
+
+	if len(clues) == 0 {
+		return "", fmt.Errorf("unable to detect the provider for %s, no known markers found", loginURL)
+	}
+
+	providers := []string{}
+	for provider := range clues {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+
+	found := []string{}
+	for _, provider := range providers {
+		found = append(found, fmt.Sprintf("%s (%s)", provider, strings.Join(clues[provider], ", ")))
+	}
+
+	return "", fmt.Errorf("unable to detect the provider for %s, found clues for %s", loginURL, strings.Join(found, "; "))
+}
+
+func pageContains(marker string) func(*url.URL, []byte) bool {
+	return func(loginURL *url.URL, data []byte) bool {
+		return bytes.Contains(data, []byte(marker))
+	}
+}
+
+func pathContains(markers ...string) func(*url.URL, []byte) bool {
+	return func(loginURL *url.URL, data []byte) bool {
+		for _, marker := range markers {
+			if strings.Contains(loginURL.Path, marker) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func hostHasSuffix(suffixes ...string) func(*url.URL, []byte) bool {
+	return func(loginURL *url.URL, data []byte) bool {
+		for _, suffix := range suffixes {
+			if strings.HasSuffix(loginURL.Hostname(), suffix) {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,74 @@
+package saml2aws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractProvider(t *testing.T) {
+
+	tests := []struct {
+		loginURL string
+		page     string
+		provider string
+	}{
+		{"https://example.okta.com/login/login.htm", `<div id="okta-signin-widget-container"></div>`, "Okta"},
+		{"https://sso.example.com/login", `<script src="/js/okta-signin-widget.min.js"></script>`, "Okta"},
+		{"https://adfs.example.com/adfs/ls/IdpInitiatedSignOn.aspx", `<input id="authMethod" type="hidden" name="AuthMethod" value="FormsAuthentication"/>`, "ADFS"},
+		{"https://sso.example.com/idp/ZPxTf/resumeSAML20/idp/startSSO.ping", `<input type="text" name="pf.username"/>`, "Ping"},
+		{"https://id.example.com/auth/realms/example/protocol/saml", `<form id="kc-form-login"></form>`, "KeyCloak"},
+		{"https://sso.jumpcloud.com/saml2/aws", `<html></html>`, "JumpCloud"},
+		{"https://example.auth0.com/login?state=g6Fo2SBY&client=Wn3XbY5g&protocol=samlp", `<script src="https://cdn.auth0.com/js/lock/10.24/lock.min.js"></script>`, "Auth0"},
+		{"https://apm.example.com/my.policy", `<form id="auth_form" name="e1" method="post" action="/my.policy"></form>`, "F5APM"},
+		{"https://idp.example.edu/idp/profile/SAML2/Unsolicited/SSO?execution=e1s1", `<input name="j_username" type="text">`, "Shibboleth"},
+	}
+
+	for _, tt := range tests {
+		loginURL, err := url.Parse(tt.loginURL)
+		require.Nil(t, err)
+
+		provider, err := ExtractProvider(loginURL, []byte(tt.page))
+		require.Nil(t, err, tt.loginURL)
+		require.Equal(t, tt.provider, provider, tt.loginURL)
+	}
+}
+
+func TestExtractProviderAmbiguous(t *testing.T) {
+
+	loginURL, err := url.Parse("https://example.okta.com/adfs/ls/")
+	require.Nil(t, err)
+
+	_, err = ExtractProvider(loginURL, []byte(`<html></html>`))
+	require.EqualError(t, err, "unable to detect the provider for https://example.okta.com/adfs/ls/, found clues for ADFS (/adfs/ls path); Okta (okta.com hostname)")
+}
+
+func TestExtractProviderUnknown(t *testing.T) {
+
+	loginURL, err := url.Parse("https://sso.example.com/login")
+	require.Nil(t, err)
+
+	_, err = ExtractProvider(loginURL, []byte(`<html></html>`))
+	require.EqualError(t, err, "unable to detect the provider for https://sso.example.com/login, no known markers found")
+}
+
+func TestDetectProviderFollowsRedirects(t *testing.T) {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/auth/realms/example/protocol/saml", http.StatusFound)
+	})
+	mux.HandleFunc("/auth/realms/example/protocol/saml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<form id="kc-form-login"></form>`))
+	})
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	provider, err := DetectProvider(ts.URL)
+	require.Nil(t, err)
+	require.Equal(t, "KeyCloak", provider)
+}
@@ -2,27 +2,58 @@ package credentials
 
 import (
 	"fmt"
+	"net/url"
+	"strings"
 
 	"github.com/versent/saml2aws/pkg/creds"
 )
 
-// LookupCredentials lookup an existing set of credentials and validate it.
+// LookupCredentials lookup an existing set of credentials and validate it. When the login details already have
+// a username the password saved for that user is used, falling back to the one saved for the IdP by older
+// versions, so IDP accounts which log into the same IdP as different users don't use each other's password.
 func LookupCredentials(loginDetails *creds.LoginDetails) error {
 
+	if loginDetails.Username != "" {
+		_, password, err := CurrentHelper.Get(userServerURL(loginDetails.URL, loginDetails.Username))
+		if err == nil {
+			loginDetails.Password = password
+			return nil
+		}
+		if !IsErrCredentialsNotFound(err) {
+			return err
+		}
+	}
+
 	username, password, err := CurrentHelper.Get(fmt.Sprintf("%s", loginDetails.URL))
 	if err != nil {
 		return err
 	}
 
+	if loginDetails.Username != "" && loginDetails.Username != username {
+		return ErrCredentialsNotFound
+	}
+
 	loginDetails.Username = username
 	loginDetails.Password = password
 
 	return nil
 }
 
-// SaveCredentials save the user credentials.
+// SaveCredentials save the user credentials, both for the user of the IdP and as the latest credentials used
+// for the IdP, which are looked up when the username isn't known.
 func SaveCredentials(url, username, password string) error {
 
+	if username != "" {
+		err := CurrentHelper.Add(&Credentials{
+			ServerURL: userServerURL(url, username),
+			Username:  username,
+			Secret:    password,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	creds := &Credentials{
 		ServerURL: fmt.Sprintf("%s", url),
 		Username:  username,
@@ -31,3 +62,17 @@ func SaveCredentials(url, username, password string) error {
 
 	return CurrentHelper.Add(creds)
 }
+
+// userServerURL the key of the password saved for the user of the IdP. The username is added to the path as the
+// keychain on macOS only distinguishes entries by the scheme, host, port and path of the url.
+func userServerURL(idpURL, username string) string {
+	u, err := url.Parse(idpURL)
+	if err != nil {
+		return idpURL
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + username
+	u.RawPath = ""
+
+	return u.String()
+}
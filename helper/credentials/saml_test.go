@@ -0,0 +1,75 @@
+package credentials
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/creds"
+)
+
+// memoryHelper a credentials store held in memory
+type memoryHelper map[string]*Credentials
+
+func (h memoryHelper) Add(creds *Credentials) error {
+	h[creds.ServerURL] = creds
+	return nil
+}
+
+func (h memoryHelper) Delete(serverURL string) error {
+	delete(h, serverURL)
+	return nil
+}
+
+func (h memoryHelper) Get(serverURL string) (string, string, error) {
+	creds, ok := h[serverURL]
+	if !ok {
+		return "", "", ErrCredentialsNotFound
+	}
+	return creds.Username, creds.Secret, nil
+}
+
+func (h memoryHelper) List() (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+func TestSaveCredentialsPerUser(t *testing.T) {
+
+	helper := memoryHelper{}
+
+	current := CurrentHelper
+	CurrentHelper = helper
+	defer func() { CurrentHelper = current }()
+
+	require.Nil(t, SaveCredentials("https://id.example.com", "alice", "alice-password"))
+	require.Nil(t, SaveCredentials("https://id.example.com", "bob", "bob-password"))
+
+	// switching back to the first user still finds their password
+	loginDetails := &creds.LoginDetails{URL: "https://id.example.com", Username: "alice"}
+	require.Nil(t, LookupCredentials(loginDetails))
+	require.Equal(t, "alice-password", loginDetails.Password)
+
+	// without a username the latest credentials saved for the IdP are used
+	loginDetails = &creds.LoginDetails{URL: "https://id.example.com"}
+	require.Nil(t, LookupCredentials(loginDetails))
+	require.Equal(t, "bob", loginDetails.Username)
+	require.Equal(t, "bob-password", loginDetails.Password)
+}
+
+func TestLookupCredentialsSavedForIdP(t *testing.T) {
+
+	// saved by an older version, keyed by the url alone
+	helper := memoryHelper{"https://id.example.com": {ServerURL: "https://id.example.com", Username: "alice", Secret: "alice-password"}}
+
+	current := CurrentHelper
+	CurrentHelper = helper
+	defer func() { CurrentHelper = current }()
+
+	loginDetails := &creds.LoginDetails{URL: "https://id.example.com", Username: "alice"}
+	require.Nil(t, LookupCredentials(loginDetails))
+	require.Equal(t, "alice-password", loginDetails.Password)
+
+	loginDetails = &creds.LoginDetails{URL: "https://id.example.com", Username: "bob"}
+	require.Equal(t, ErrCredentialsNotFound, LookupCredentials(loginDetails))
+
+	require.Equal(t, "https://id.example.com/adfs/ls/alice@example.com", userServerURL("https://id.example.com/adfs/ls/", "alice@example.com"))
+}
@@ -1,17 +1,15 @@
 package saml2aws
 
 import (
-	"bufio"
 	"fmt"
 	"net/url"
-	"os"
-	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
-	"github.com/segmentio/go-prompt"
 	"github.com/versent/saml2aws/pkg/cfg"
 	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/prompter"
+	"github.com/versent/saml2aws/pkg/provider"
 )
 
 // PromptForConfigurationDetails prompt the user to present their hostname, username and mfa
@@ -56,9 +54,19 @@ func PromptForLoginDetails(loginDetails *creds.LoginDetails) error {
 
 	fmt.Println("To use saved password just hit enter.")
 
-	loginDetails.Username = promptFor("Username [%s]", loginDetails.Username)
+	// the username is only prompted for on a terminal, otherwise the configured or default one is used
+	if prompter.Interactive() {
+		loginDetails.Username = promptFor("Username [%s]", loginDetails.Username)
+	} else if loginDetails.Username == "" {
+		return errors.New("no username was configured or supplied and stdin isn't a terminal to prompt for one, set it with --username or " + creds.UsernameEnvVar)
+	}
+
+	enteredPassword, err := prompter.ActivePrompter.Password("Password")
+	if err != nil {
+		return errors.Wrap(err, "error reading password")
+	}
 
-	if enteredPassword := prompt.PasswordMasked("Password"); enteredPassword != "" {
+	if enteredPassword != "" {
 		loginDetails.Password = enteredPassword
 	}
 
@@ -67,79 +75,45 @@ func PromptForLoginDetails(loginDetails *creds.LoginDetails) error {
 	return nil
 }
 
-// PromptForAWSRoleSelection present a list of roles to the user for selection
+// PromptForAWSRoleSelection present a list of roles to the user for selection with the active prompter
 func PromptForAWSRoleSelection(accounts []*AWSAccount) (*AWSRole, error) {
 
-	reader := bufio.NewReader(os.Stdin)
-
-	fmt.Println("Please choose the role you would like to assume: ")
-
 	roles := []*AWSRole{}
+	labels := []string{}
 
 	for _, account := range accounts {
-		fmt.Println(account.Name)
 		for _, role := range account.Roles {
-			fmt.Println("[", len(roles), "]: ", role.Name)
-			fmt.Println()
 			roles = append(roles, role)
+			labels = append(labels, fmt.Sprintf("%s / %s", account.Name, role.Name))
 		}
 	}
 
-	fmt.Print("Selection: ")
-	selectedRoleIndex, _ := reader.ReadString('\n')
-
-	v, err := strconv.Atoi(strings.TrimSpace(selectedRoleIndex))
-
+	index, err := provider.ChoiceIndex(labels, prompter.ActivePrompter.Choice("Please choose the role you would like to assume", labels))
 	if err != nil {
-		return nil, fmt.Errorf("Unrecognised role index")
-	}
-
-	if v > len(roles) {
-		return nil, fmt.Errorf("You selected an invalid role index")
+		return nil, errors.Wrap(err, "error selecting role")
 	}
 
-	return roles[v], nil
+	return roles[index], nil
 }
 
+// promptForSelection choose one of the options with the active prompter, the default value is labelled as the
+// current choice
 func promptForSelection(prompt string, defaultValue string, options []string) (string, error) {
 
-	reader := bufio.NewReader(os.Stdin)
-
-	fmt.Println(prompt)
-
-	for i, val := range options {
-		fmt.Println("[", i, "]: ", val)
-		fmt.Println()
-	}
-
-	var v int
-	var err error
-
-	for {
-		if defaultValue != "" {
-			fmt.Print("Selection [" + defaultValue + "]: ")
-		} else {
-			fmt.Print("Selection: ")
-		}
-		selectedRoleIndex, _ := reader.ReadString('\n')
-
-		if strings.TrimSpace(selectedRoleIndex) == "" && defaultValue != "" {
-			return defaultValue, nil
-		}
-
-		v, err = strconv.Atoi(strings.TrimSpace(selectedRoleIndex))
-		if err != nil {
-			continue
-		}
-
-		if v >= 0 && v < len(options) {
-			break
+	labels := make([]string, len(options))
+	for i, option := range options {
+		labels[i] = option
+		if option == defaultValue {
+			labels[i] = option + " (current)"
 		}
+	}
 
-		fmt.Println("Invalid selection")
+	index, err := provider.ChoiceIndex(labels, prompter.ActivePrompter.Choice(prompt, labels))
+	if err != nil {
+		return "", err
 	}
 
-	return options[v], nil
+	return options[index], nil
 }
 
 func promptFor(promptString, defaultValue string) string {
@@ -147,7 +121,7 @@ func promptFor(promptString, defaultValue string) string {
 
 	// do while
 	for ok := true; ok; ok = strings.TrimSpace(defaultValue) == "" && strings.TrimSpace(val) == "" {
-		val = prompt.String(promptString, defaultValue)
+		val = prompter.ActivePrompter.String(promptString, defaultValue)
 	}
 
 	if val == "" {
@@ -162,7 +136,7 @@ func promptForURL(promptString, defaultValue string) string {
 
 	// do while
 	for {
-		rawURL = prompt.String(promptString, defaultValue)
+		rawURL = prompter.ActivePrompter.String(promptString, defaultValue)
 
 		if rawURL == "" {
 			rawURL = defaultValue
@@ -1,9 +1,13 @@
 package saml2aws
 
 import (
+	"io"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/versent/saml2aws/mocks"
 	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/prompter"
 )
 
 func TestLoginDetails_Validate(t *testing.T) {
@@ -36,3 +40,88 @@ func TestLoginDetails_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestPromptForLoginDetails(t *testing.T) {
+	pr := &mocks.Prompter{}
+	pr.Mock.On("String", "Username [%s]", "wolfeidau").Return("wolfeidau")
+	pr.Mock.On("Password", "Password").Return("testtestlol", nil)
+
+	active := prompter.ActivePrompter
+	prompter.SetPrompter(pr)
+	defer prompter.SetPrompter(active)
+
+	loginDetails := &creds.LoginDetails{URL: "https://id.example.com", Username: "wolfeidau"}
+
+	err := PromptForLoginDetails(loginDetails)
+	assert.Nil(t, err)
+	assert.Equal(t, &creds.LoginDetails{URL: "https://id.example.com", Username: "wolfeidau", Password: "testtestlol"}, loginDetails)
+}
+
+func TestPromptForLoginDetailsPasswordError(t *testing.T) {
+	pr := &mocks.Prompter{}
+	pr.Mock.On("String", "Username [%s]", "wolfeidau").Return("wolfeidau")
+	pr.Mock.On("Password", "Password").Return("", io.ErrUnexpectedEOF)
+
+	active := prompter.ActivePrompter
+	prompter.SetPrompter(pr)
+	defer prompter.SetPrompter(active)
+
+	loginDetails := &creds.LoginDetails{URL: "https://id.example.com", Username: "wolfeidau", Password: "saved"}
+
+	err := PromptForLoginDetails(loginDetails)
+	assert.EqualError(t, err, "error reading password: unexpected EOF")
+}
+
+func TestPromptForLoginDetailsNotTerminal(t *testing.T) {
+	if prompter.StdinIsTerminal() {
+		t.Skip("stdin is a terminal")
+	}
+
+	active := prompter.ActivePrompter
+	prompter.SetPrompter(prompter.NewCli())
+	defer prompter.SetPrompter(active)
+
+	err := PromptForLoginDetails(&creds.LoginDetails{URL: "https://id.example.com"})
+	assert.EqualError(t, err, "no username was configured or supplied and stdin isn't a terminal to prompt for one, set it with --username or SAML2AWS_USERNAME")
+}
+
+func TestPromptForAWSRoleSelection(t *testing.T) {
+
+	adminRole := &AWSRole{Name: "admin", RoleARN: "arn:aws:iam::000000000001:role/admin"}
+	readonlyRole := &AWSRole{Name: "readonly", RoleARN: "arn:aws:iam::000000000002:role/readonly"}
+
+	accounts := []*AWSAccount{
+		{Name: "Account: production (000000000001)", Roles: []*AWSRole{adminRole}},
+		{Name: "Account: 000000000002", Roles: []*AWSRole{readonlyRole}},
+	}
+	labels := []string{"Account: production (000000000001) / admin", "Account: 000000000002 / readonly"}
+
+	pr := &mocks.Prompter{}
+	pr.Mock.On("Choice", "Please choose the role you would like to assume", labels).Return(labels[1]).Once()
+	pr.Mock.On("Choice", "Please choose the role you would like to assume", labels).Return("Account: 000000000003 / admin").Once()
+
+	active := prompter.ActivePrompter
+	prompter.SetPrompter(pr)
+	defer prompter.SetPrompter(active)
+
+	role, err := PromptForAWSRoleSelection(accounts)
+	assert.Nil(t, err)
+	assert.Equal(t, readonlyRole, role)
+
+	_, err = PromptForAWSRoleSelection(accounts)
+	assert.EqualError(t, err, `error selecting role: "Account: 000000000003 / admin" isn't one of the options`)
+}
+
+func TestPromptForSelection(t *testing.T) {
+
+	pr := &mocks.Prompter{}
+	pr.Mock.On("Choice", "Please choose the provider", []string{"ADFS", "Okta (current)"}).Return("Okta (current)")
+
+	active := prompter.ActivePrompter
+	prompter.SetPrompter(pr)
+	defer prompter.SetPrompter(active)
+
+	selected, err := promptForSelection("Please choose the provider", "Okta", []string{"ADFS", "Okta"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Okta", selected)
+}
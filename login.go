@@ -0,0 +1,435 @@
+package saml2aws
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awscredentials "github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/provider"
+)
+
+// DefaultSessionDuration the duration in seconds of an STS session when neither the user or the IdP supply one
+const DefaultSessionDuration = 3600
+
+// MaxChainedSessionDuration the longest session in seconds STS allows for a role assumed with the credentials
+// of another role
+const MaxChainedSessionDuration = 3600
+
+// defaultChainedSessionName the session name for a chained role when neither the options or the assertion supply one
+const defaultChainedSessionName = "saml2aws"
+
+// timeNow the clock the expiry of the assertion is checked against
+var timeNow = time.Now
+
+// LoginOptions the settings used by Login, only the account and login details are required
+type LoginOptions struct {
+	// Account the IdP account, which chooses the provider and MFA along with the STS region and endpoint
+	Account *cfg.IDPAccount
+
+	// LoginDetails the username and password, along with the Duo MFA option and token
+	LoginDetails *creds.LoginDetails
+
+	// SAMLAssertion a base64 encoded assertion obtained elsewhere, such as from a browser, when supplied it is
+	// used rather than logging into the IdP so the login details aren't required
+	SAMLAssertion string
+
+	// MFA overrides the MFA configured in the account
+	MFA string
+
+	// RoleArn or RoleFilter, a regular expression, choose the role when the assertion grants more than one
+	RoleArn    string
+	RoleFilter string
+
+	// PrincipalArn the SAML provider the role is assumed through, required when the role is granted through
+	// several providers
+	PrincipalArn string
+
+	// RoleChain the ARNs of the roles to assume in turn, the first is assumed with the assertion, in place of
+	// the role chosen by RoleArn or RoleFilter, and each after it with AssumeRole using the credentials of
+	// the role before it. The credentials of the last role are returned.
+	RoleChain []string
+
+	// RoleChainSessionNames and RoleChainDurations the session name and duration in seconds of each role in
+	// the chain by position, the first role is skipped as its session is named by the assertion. Missing or
+	// empty entries use the session name from the assertion and the session duration, capped at the longest
+	// STS allows for a chained role.
+	RoleChainSessionNames []string
+	RoleChainDurations    []int64
+
+	// AllowedAccounts the ids of the accounts roles may be assumed in, overriding those configured in the
+	// account, when empty roles in any account may be assumed
+	AllowedAccounts []string
+
+	// SessionDuration the duration requested in seconds, capped at the duration allowed by the IdP
+	SessionDuration int64
+
+	// Profile if supplied the credentials are also saved to this profile in the shared credentials file
+	Profile string
+
+	// Provider and STS replace the clients built from the account, ChainedSTS replaces the client built
+	// from the credentials of the previous role for each role in the chain after the first
+	Provider   SAMLClient
+	STS        stsiface.STSAPI
+	ChainedSTS func(credentials *awsconfig.AWSCredentials) (stsiface.STSAPI, error)
+
+	// Context when supplied is passed to providers which implement ContextSAMLClient, such as Okta and
+	// Shibboleth, so cancelling it gives up waiting for MFA to be approved
+	Context context.Context
+}
+
+// LoadLoginOptions read the named IdP account from a saml2aws configuration file, such as the default
+// ~/.saml2aws, returning options which log in with it. The password is left for the caller to supply. The
+// role_filter of the account is applied by Login from the account, narrowing the roles to choose from.
+func LoadLoginOptions(configFile, idpAccountName string) (*LoginOptions, error) {
+
+	cfgm, err := cfg.NewConfigManager(configFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load configuration")
+	}
+
+	account, err := cfgm.LoadVerifyIDPAccount(idpAccountName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = account.Validate()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to validate account")
+	}
+
+	return &LoginOptions{
+		Account:         account,
+		LoginDetails:    &creds.LoginDetails{URL: account.URL, Username: account.Username},
+		RoleArn:         account.RoleArn,
+		SessionDuration: account.SessionDuration,
+	}, nil
+}
+
+// Login authenticate with the IdP, choose the role granted by the assertion and request credentials for it
+// from STS. Nothing is prompted for, so the role must be chosen by the options if more than one is granted.
+func Login(opts LoginOptions) (*awsconfig.AWSCredentials, error) {
+
+	if opts.Account == nil || (opts.LoginDetails == nil && opts.SAMLAssertion == "") {
+		return nil, errors.New("an account and login details are required")
+	}
+
+	account := *opts.Account
+	if opts.MFA != "" {
+		account.MFA = opts.MFA
+	}
+
+	samlAssertion := opts.SAMLAssertion
+	if samlAssertion == "" {
+		var err error
+		samlAssertion, err = authenticate(&account, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := provider.ValidateSAMLResponse(samlAssertion)
+	if err != nil {
+		return nil, err
+	}
+
+	assertion, err := ParseSAMLAssertion(samlAssertion)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing saml assertion")
+	}
+
+	err = assertion.CheckExpiry(timeNow())
+	if err != nil {
+		return nil, err
+	}
+
+	// STS takes the session name from the assertion, so fail early with a clearer error than STS returns
+	err = ValidateRoleSessionName(assertion.RoleSessionName)
+	if err != nil {
+		return nil, errors.Wrap(err, "error validating role session name")
+	}
+
+	awsRoles, err := ParseAWSRoles(assertion.Roles)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing aws roles")
+	}
+
+	allowedAccounts := opts.AllowedAccounts
+	if len(allowedAccounts) == 0 {
+		allowedAccounts, err = ParseAllowedAccounts(account.AllowedAccounts)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing allowed accounts")
+		}
+	}
+
+	awsRoles, err = AllowedRoles(awsRoles, allowedAccounts, opts.PrincipalArn)
+	if err != nil {
+		return nil, err
+	}
+
+	// the roles later in the chain aren't granted by the assertion, so check them before assuming any role
+	err = CheckAllowedAccounts(opts.RoleChain, allowedAccounts)
+	if err != nil {
+		return nil, err
+	}
+
+	roleArn := opts.RoleArn
+	if len(opts.RoleChain) > 0 {
+		roleArn = opts.RoleChain[0]
+	}
+
+	// the role filter of the account narrows the roles to choose from, unless the options choose the role
+	if roleArn == "" && opts.RoleFilter == "" {
+		awsRoles, err = NarrowRoles(awsRoles, account.RoleFilter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	role, err := selectRole(awsRoles, roleArn, opts.RoleFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	svc := opts.STS
+	if svc == nil {
+		svc, err = NewRoleSTS(&account, role.RoleARN)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	requested := opts.SessionDuration
+	if requested == 0 {
+		requested = account.SessionDuration
+	}
+
+	result, err := AssumeRoleWithSAML(svc, role, samlAssertion, ResolveSessionDuration(requested, assertion.SessionDuration))
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := result.Credentials
+
+	for hop := 1; hop < len(opts.RoleChain); hop++ {
+		credentials, err = assumeChainedRole(&account, opts, hop, credentials, assertion.RoleSessionName, requested)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error assuming role %s in the chain", opts.RoleChain[hop])
+		}
+	}
+
+	if opts.Profile != "" {
+		err = awsconfig.NewSharedCredentials(opts.Profile).SaveCredentials(credentials)
+		if err != nil {
+			return nil, errors.Wrap(err, "error saving credentials")
+		}
+	}
+
+	return credentials, nil
+}
+
+// authenticate login to the IdP of the account and return the SAML assertion
+func authenticate(account *cfg.IDPAccount, opts LoginOptions) (string, error) {
+
+	var samlAssertion string
+	var err error
+
+	client := opts.Provider
+	if client == nil {
+		client, err = NewSAMLClient(account)
+		if err != nil {
+			return "", errors.Wrap(err, "error building IdP client")
+		}
+	}
+
+	if contextClient, ok := client.(ContextSAMLClient); ok && opts.Context != nil {
+		samlAssertion, err = contextClient.AuthenticateContext(opts.Context, opts.LoginDetails)
+	} else {
+		samlAssertion, err = client.Authenticate(opts.LoginDetails)
+	}
+	if err != nil {
+		return "", provider.RedactError(errors.Wrap(err, "error authenticating to IdP"))
+	}
+
+	if samlAssertion == "" {
+		return "", errors.New("response did not contain a valid SAML assertion")
+	}
+
+	return samlAssertion, nil
+}
+
+// assumeChainedRole assume the role at the position in the chain using the credentials of the role before it
+func assumeChainedRole(account *cfg.IDPAccount, opts LoginOptions, hop int, previous *awsconfig.AWSCredentials, roleSessionName string, requested int64) (*awsconfig.AWSCredentials, error) {
+
+	var svc stsiface.STSAPI
+	var err error
+
+	if opts.ChainedSTS != nil {
+		svc, err = opts.ChainedSTS(previous)
+	} else {
+		svc, err = newChainedSTS(account, previous, opts.RoleChain[hop])
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create session")
+	}
+
+	if hop < len(opts.RoleChainSessionNames) && opts.RoleChainSessionNames[hop] != "" {
+		roleSessionName = opts.RoleChainSessionNames[hop]
+	}
+	if roleSessionName == "" {
+		roleSessionName = defaultChainedSessionName
+	}
+
+	if hop < len(opts.RoleChainDurations) && opts.RoleChainDurations[hop] > 0 {
+		requested = opts.RoleChainDurations[hop]
+	}
+
+	resp, err := svc.AssumeRole(&sts.AssumeRoleInput{
+		RoleArn:         aws.String(opts.RoleChain[hop]),
+		RoleSessionName: aws.String(roleSessionName),
+		DurationSeconds: aws.Int64(ResolveSessionDuration(requested, MaxChainedSessionDuration)),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving STS credentials")
+	}
+
+	return convertCredentials(resp.Credentials), nil
+}
+
+// NewRoleSTS an STS client for assuming the role, in the region and with the endpoint of the account or the
+// partition of the role
+func NewRoleSTS(account *cfg.IDPAccount, roleARN string) (stsiface.STSAPI, error) {
+	sess, err := session.NewSession(BuildRoleSTSConfig(account, roleARN))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create session")
+	}
+
+	return sts.New(sess), nil
+}
+
+// newChainedSTS an STS client for the account, or the partition of the role, using the credentials of the previous
+// role in the chain
+func newChainedSTS(account *cfg.IDPAccount, previous *awsconfig.AWSCredentials, roleARN string) (stsiface.STSAPI, error) {
+	config := BuildRoleSTSConfig(account, roleARN).WithCredentials(
+		awscredentials.NewStaticCredentials(previous.AWSAccessKey, previous.AWSSecretKey, previous.AWSSessionToken))
+
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return sts.New(sess), nil
+}
+
+func convertCredentials(stsCreds *sts.Credentials) *awsconfig.AWSCredentials {
+	return &awsconfig.AWSCredentials{
+		AWSAccessKey:     aws.StringValue(stsCreds.AccessKeyId),
+		AWSSecretKey:     aws.StringValue(stsCreds.SecretAccessKey),
+		AWSSessionToken:  aws.StringValue(stsCreds.SessionToken),
+		AWSSecurityToken: aws.StringValue(stsCreds.SessionToken),
+		Expires:          aws.TimeValue(stsCreds.Expiration),
+	}
+}
+
+// selectRole choose the role by ARN or filter, which is only optional when a single role is granted
+func selectRole(awsRoles []*AWSRole, roleArn, roleFilter string) (*AWSRole, error) {
+	if len(awsRoles) == 0 {
+		return nil, errors.New("no roles available, please check you are permitted to assume roles for the AWS service")
+	}
+
+	if roleArn != "" {
+		return LocateRole(awsRoles, roleArn)
+	}
+
+	if roleFilter != "" {
+		var err error
+		awsRoles, err = FilterRoles(awsRoles, nil, roleFilter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(awsRoles) != 1 {
+		return nil, fmt.Errorf("%d roles available, choose one with a role arn or filter", len(awsRoles))
+	}
+
+	return awsRoles[0], nil
+}
+
+// ResolveSessionDuration use the duration requested by the user if supplied, otherwise the one supplied
+// by the IdP in the assertion, never exceeding the duration the IdP allows
+func ResolveSessionDuration(requested, assertionDuration int64) int64 {
+	if requested > 0 && (assertionDuration == 0 || requested < assertionDuration) {
+		return requested
+	}
+
+	if assertionDuration > 0 {
+		return assertionDuration
+	}
+
+	return DefaultSessionDuration
+}
+
+// BuildSTSConfig the config for STS in the region, and with the endpoint if one is supplied, of the account
+func BuildSTSConfig(account *cfg.IDPAccount) *aws.Config {
+	config := aws.NewConfig().WithRegion(account.STSRegion())
+
+	if account.STSEndpoint != "" {
+		config = config.WithEndpoint(account.STSEndpoint)
+	}
+
+	return config
+}
+
+// stsPartition the region and STS endpoint used to assume roles in a partition
+type stsPartition struct {
+	region   string
+	endpoint string
+}
+
+// stsPartitions the partitions whose roles can't be assumed through the global STS endpoint
+var stsPartitions = map[string]stsPartition{
+	"aws-us-gov": {region: "us-gov-west-1", endpoint: "https://sts.us-gov-west-1.amazonaws.com"},
+	"aws-cn":     {region: "cn-north-1", endpoint: "https://sts.cn-north-1.amazonaws.com.cn"},
+}
+
+// PartitionSTS the region and STS endpoint for the partition of the role ARN, such as arn:aws-us-gov for GovCloud,
+// roles in the aws partition use the global endpoint which the region resolves to so the endpoint is empty
+func PartitionSTS(roleARN string) (string, string) {
+	// arn:partition:iam::account-id:role/role-name
+	tokens := strings.SplitN(roleARN, ":", 3)
+	if len(tokens) == 3 {
+		if partition, ok := stsPartitions[tokens[1]]; ok {
+			return partition.region, partition.endpoint
+		}
+	}
+
+	return cfg.DefaultRegion, ""
+}
+
+// BuildRoleSTSConfig the config for STS used to assume the role, when the account sets neither the region or
+// endpoint they are taken from the partition of the role, so roles in GovCloud or China are assumed without
+// configuring STS for them
+func BuildRoleSTSConfig(account *cfg.IDPAccount, roleARN string) *aws.Config {
+	if account.Region != "" || account.STSEndpoint != "" {
+		return BuildSTSConfig(account)
+	}
+
+	region, endpoint := PartitionSTS(roleARN)
+
+	config := aws.NewConfig().WithRegion(region)
+	if endpoint != "" {
+		config = config.WithEndpoint(endpoint)
+	}
+
+	return config
+}
@@ -49,3 +49,38 @@ func (_m *Prompter) StringRequired(pr string) string {
 
 	return r0
 }
+
+// String provides a mock function with given fields: pr, defaultValue
+func (_m *Prompter) String(pr string, defaultValue string) string {
+	ret := _m.Called(pr, defaultValue)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string, string) string); ok {
+		r0 = rf(pr, defaultValue)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// Password provides a mock function with given fields: pr
+func (_m *Prompter) Password(pr string) (string, error) {
+	ret := _m.Called(pr)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string) string); ok {
+		r0 = rf(pr)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(pr)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
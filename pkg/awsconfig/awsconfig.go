@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/mitchellh/go-homedir"
 
@@ -22,10 +23,16 @@ var (
 
 // AWSCredentials represents the set of attributes used to authenticate to AWS with a short lived session
 type AWSCredentials struct {
-	AWSAccessKey     string `ini:"aws_access_key_id"`
-	AWSSecretKey     string `ini:"aws_secret_access_key"`
-	AWSSessionToken  string `ini:"aws_session_token"`
-	AWSSecurityToken string `ini:"aws_security_token"`
+	AWSAccessKey     string    `ini:"aws_access_key_id"`
+	AWSSecretKey     string    `ini:"aws_secret_access_key"`
+	AWSSessionToken  string    `ini:"aws_session_token"`
+	AWSSecurityToken string    `ini:"aws_security_token"`
+	Expires          time.Time `ini:"x_security_token_expires"`
+}
+
+// ValidFor whether the credentials remain valid for longer than the skew, those without an expiry never do
+func (c *AWSCredentials) ValidFor(skew time.Duration) bool {
+	return time.Now().Add(skew).Before(c.Expires)
 }
 
 // CredentialsProvider loads aws credentials file
@@ -61,6 +68,16 @@ func (p *CredentialsProvider) CredsExists() (bool, error) {
 
 // Save persist the credentials
 func (p *CredentialsProvider) Save(id, secret, token string) error {
+	return p.SaveCredentials(&AWSCredentials{
+		AWSAccessKey:     id,
+		AWSSecretKey:     secret,
+		AWSSessionToken:  token,
+		AWSSecurityToken: token,
+	})
+}
+
+// SaveCredentials persist the credentials along with their expiry
+func (p *CredentialsProvider) SaveCredentials(awsCreds *AWSCredentials) error {
 	filename, err := p.filename()
 	if err != nil {
 		return err
@@ -69,39 +86,49 @@ func (p *CredentialsProvider) Save(id, secret, token string) error {
 	err = p.ensureConfigExists()
 	if err != nil {
 		if os.IsNotExist(err) {
-			return createAndSaveProfile(filename, p.Profile, id, secret, token)
+			return createAndSaveProfile(filename, p.Profile, awsCreds)
 		}
 		return errors.Wrap(err, "unable to load file")
 	}
 
-	return saveProfile(filename, p.Profile, id, secret, token)
+	return saveProfile(filename, p.Profile, awsCreds)
 }
 
 // Load load the aws credentials file
 func (p *CredentialsProvider) Load() (string, string, string, error) {
-	filename, err := p.filename()
+	awsCreds, err := p.LoadCredentials()
 	if err != nil {
 		return "", "", "", err
 	}
 
+	return awsCreds.AWSAccessKey, awsCreds.AWSSecretKey, awsCreds.AWSSecurityToken, nil
+}
+
+// LoadCredentials load the credentials along with their expiry from the aws credentials file
+func (p *CredentialsProvider) LoadCredentials() (*AWSCredentials, error) {
+	filename, err := p.filename()
+	if err != nil {
+		return nil, err
+	}
+
 	config, err := ini.Load(filename)
 	if err != nil {
-		return "", "", "", err
+		return nil, err
 	}
 
 	iniProfile, err := config.GetSection(p.Profile)
 	if err != nil {
-		return "", "", "", ErrCredentialsNotFound
+		return nil, ErrCredentialsNotFound
 	}
 
 	awsCreds := new(AWSCredentials)
 
 	err = iniProfile.MapTo(awsCreds)
 	if err != nil {
-		return "", "", "", ErrCredentialsNotFound
+		return nil, ErrCredentialsNotFound
 	}
 
-	return awsCreds.AWSAccessKey, awsCreds.AWSSecretKey, awsCreds.AWSSecurityToken, nil
+	return awsCreds, nil
 }
 
 // ensureConfigExists verify that the config file exists
@@ -150,7 +177,7 @@ func (p *CredentialsProvider) filename() (string, error) {
 	return p.Filename, nil
 }
 
-func createAndSaveProfile(filename, profile, id, secret, token string) error {
+func createAndSaveProfile(filename, profile string, awsCreds *AWSCredentials) error {
 
 	dirPath := filepath.Dir(filename)
 
@@ -164,10 +191,10 @@ func createAndSaveProfile(filename, profile, id, secret, token string) error {
 		return errors.Wrapf(err, "unable to create configuration")
 	}
 
-	return saveProfile(filename, profile, id, secret, token)
+	return saveProfile(filename, profile, awsCreds)
 }
 
-func saveProfile(filename, profile, id, secret, token string) error {
+func saveProfile(filename, profile string, awsCreds *AWSCredentials) error {
 	config, err := ini.Load(filename)
 	if err != nil {
 		return err
@@ -177,12 +204,7 @@ func saveProfile(filename, profile, id, secret, token string) error {
 		return err
 	}
 
-	err = iniProfile.ReflectFrom(&AWSCredentials{
-		AWSAccessKey:     id,
-		AWSSecretKey:     secret,
-		AWSSessionToken:  token,
-		AWSSecurityToken: token,
-	})
+	err = iniProfile.ReflectFrom(awsCreds)
 	if err != nil {
 		return err
 	}
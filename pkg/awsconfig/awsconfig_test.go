@@ -3,6 +3,7 @@ package awsconfig
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -27,3 +28,28 @@ func TestUpdateSamlConfig(t *testing.T) {
 
 	os.Remove(".credentials")
 }
+
+func TestSaveCredentialsWithExpiry(t *testing.T) {
+	os.Remove(".credentials")
+
+	sharedCreds := &CredentialsProvider{".credentials", "saml"}
+
+	expires := time.Date(2018, 1, 20, 4, 14, 20, 0, time.UTC)
+
+	err := sharedCreds.SaveCredentials(&AWSCredentials{
+		AWSAccessKey:     "testid",
+		AWSSecretKey:     "testsecret",
+		AWSSessionToken:  "testtoken",
+		AWSSecurityToken: "testtoken",
+		Expires:          expires,
+	})
+	assert.Nil(t, err)
+
+	awsCreds, err := sharedCreds.LoadCredentials()
+	assert.Nil(t, err)
+	assert.Equal(t, "testid", awsCreds.AWSAccessKey)
+	assert.Equal(t, "testtoken", awsCreds.AWSSessionToken)
+	assert.True(t, expires.Equal(awsCreds.Expires))
+
+	os.Remove(".credentials")
+}
@@ -0,0 +1,156 @@
+package awsconfig
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultCacheFile the default path of the file STS credentials are cached in between logins
+	DefaultCacheFile = "~/.saml2aws-cache"
+
+	// DefaultCacheSkew cached credentials expiring within this are not reused
+	DefaultCacheSkew = 5 * time.Minute
+
+	// cacheFileMode the cache holds live credentials so only the owner can read them
+	cacheFileMode = 0600
+)
+
+// CacheIdentity the IdP account and user which logged in to obtain cached credentials, credentials are only
+// reused by the same identity
+type CacheIdentity struct {
+	IdpAccount string
+	URL        string
+	Username   string
+}
+
+// CachedCredentials the credentials issued by STS for a role along with the profile they were saved to
+type CachedCredentials struct {
+	Identity    CacheIdentity
+	Profile     string
+	RoleARN     string
+	Credentials *AWSCredentials
+}
+
+// CredentialsCache caches the credentials issued by STS for each identity, profile and role until they expire
+type CredentialsCache struct {
+	Filename string
+	Identity CacheIdentity
+}
+
+// NewCredentialsCache helper to create the credentials cache for the identity
+func NewCredentialsCache(filename string, identity CacheIdentity) *CredentialsCache {
+	return &CredentialsCache{
+		Filename: filename,
+		Identity: identity,
+	}
+}
+
+// Lookup return the credentials cached for the identity and profile which remain valid for longer than the skew,
+// if a role is supplied they must also have been issued for that role, nil is returned when there are none
+func (c *CredentialsCache) Lookup(profile, roleARN string, skew time.Duration) (*CachedCredentials, error) {
+
+	entries, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var found *CachedCredentials
+
+	for _, entry := range entries {
+		if entry.Identity != c.Identity || entry.Profile != profile || (roleARN != "" && entry.RoleARN != roleARN) {
+			continue
+		}
+
+		if !validFor(entry, skew) {
+			continue
+		}
+
+		// use the credentials which last longest when a role isn't supplied
+		if found == nil || entry.Credentials.Expires.After(found.Credentials.Expires) {
+			found = entry
+		}
+	}
+
+	return found, nil
+}
+
+// Store cache the credentials issued to the identity for the profile and role, dropping any which have expired
+func (c *CredentialsCache) Store(profile, roleARN string, awsCreds *AWSCredentials) error {
+
+	entries, err := c.read()
+	if err != nil {
+		return err
+	}
+
+	cached := map[string]*CachedCredentials{}
+	for key, entry := range entries {
+		if validFor(entry, 0) {
+			cached[key] = entry
+		}
+	}
+
+	cached[cacheKey(c.Identity, profile, roleARN)] = &CachedCredentials{
+		Identity:    c.Identity,
+		Profile:     profile,
+		RoleARN:     roleARN,
+		Credentials: awsCreds,
+	}
+
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return errors.Wrap(err, "error encoding credentials cache")
+	}
+
+	filename, err := homedir.Expand(c.Filename)
+	if err != nil {
+		return errors.Wrap(err, "error expanding credentials cache path")
+	}
+
+	err = ioutil.WriteFile(filename, data, cacheFileMode)
+	if err != nil {
+		return errors.Wrap(err, "error writing credentials cache")
+	}
+
+	// WriteFile only applies the mode when creating the file
+	return os.Chmod(filename, cacheFileMode)
+}
+
+func (c *CredentialsCache) read() (map[string]*CachedCredentials, error) {
+
+	entries := map[string]*CachedCredentials{}
+
+	filename, err := homedir.Expand(c.Filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "error expanding credentials cache path")
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading credentials cache")
+	}
+
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding credentials cache")
+	}
+
+	return entries, nil
+}
+
+func cacheKey(identity CacheIdentity, profile, roleARN string) string {
+	return strings.Join([]string{identity.IdpAccount, identity.URL, identity.Username, profile, roleARN}, "|")
+}
+
+func validFor(entry *CachedCredentials, skew time.Duration) bool {
+	return entry.Credentials != nil && entry.Credentials.ValidFor(skew)
+}
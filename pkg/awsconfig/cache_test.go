@@ -0,0 +1,91 @@
+package awsconfig
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentialsCache(t *testing.T) {
+	os.Remove(".cache")
+	defer os.Remove(".cache")
+
+	cache := NewCredentialsCache(".cache", CacheIdentity{IdpAccount: "default", URL: "https://id.example.com", Username: "user@example.com"})
+
+	cached, err := cache.Lookup("saml", "", DefaultCacheSkew)
+	assert.Nil(t, err)
+	assert.Nil(t, cached)
+
+	devCreds := &AWSCredentials{AWSAccessKey: "devid", Expires: time.Now().Add(time.Hour)}
+	prodCreds := &AWSCredentials{AWSAccessKey: "prodid", Expires: time.Now().Add(2 * time.Hour)}
+	expiringCreds := &AWSCredentials{AWSAccessKey: "expiringid", Expires: time.Now().Add(time.Minute)}
+
+	assert.Nil(t, cache.Store("saml", "arn:aws:iam::000000000001:role/Development", devCreds))
+	assert.Nil(t, cache.Store("saml", "arn:aws:iam::000000000001:role/Production", prodCreds))
+	assert.Nil(t, cache.Store("other", "arn:aws:iam::000000000001:role/Development", expiringCreds))
+
+	info, err := os.Stat(".cache")
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	cached, err = cache.Lookup("saml", "arn:aws:iam::000000000001:role/Development", DefaultCacheSkew)
+	assert.Nil(t, err)
+	assert.Equal(t, "devid", cached.Credentials.AWSAccessKey)
+
+	// the credentials lasting longest are used when a role isn't supplied
+	cached, err = cache.Lookup("saml", "", DefaultCacheSkew)
+	assert.Nil(t, err)
+	assert.Equal(t, "arn:aws:iam::000000000001:role/Production", cached.RoleARN)
+
+	// credentials expiring within the skew aren't reused
+	cached, err = cache.Lookup("other", "", DefaultCacheSkew)
+	assert.Nil(t, err)
+	assert.Nil(t, cached)
+
+	cached, err = cache.Lookup("saml", "arn:aws:iam::000000000002:role/Development", DefaultCacheSkew)
+	assert.Nil(t, err)
+	assert.Nil(t, cached)
+}
+
+func TestCredentialsCacheDropsExpired(t *testing.T) {
+	os.Remove(".cache")
+	defer os.Remove(".cache")
+
+	cache := NewCredentialsCache(".cache", CacheIdentity{IdpAccount: "default", URL: "https://id.example.com", Username: "user@example.com"})
+
+	assert.Nil(t, cache.Store("saml", "arn:aws:iam::000000000001:role/Development", &AWSCredentials{Expires: time.Now().Add(-time.Minute)}))
+	assert.Nil(t, cache.Store("saml", "arn:aws:iam::000000000001:role/Production", &AWSCredentials{Expires: time.Now().Add(time.Hour)}))
+
+	entries, err := cache.read()
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestCredentialsCacheIdentity(t *testing.T) {
+	os.Remove(".cache")
+	defer os.Remove(".cache")
+
+	identity := CacheIdentity{IdpAccount: "default", URL: "https://id.example.com", Username: "user@example.com"}
+
+	cache := NewCredentialsCache(".cache", identity)
+	assert.Nil(t, cache.Store("saml", "arn:aws:iam::000000000001:role/Development", &AWSCredentials{AWSAccessKey: "userid", Expires: time.Now().Add(time.Hour)}))
+
+	// credentials issued to one user aren't reused by another logging in to the same profile and role
+	other := NewCredentialsCache(".cache", CacheIdentity{IdpAccount: "default", URL: "https://id.example.com", Username: "other@example.com"})
+
+	cached, err := other.Lookup("saml", "arn:aws:iam::000000000001:role/Development", DefaultCacheSkew)
+	assert.Nil(t, err)
+	assert.Nil(t, cached)
+
+	assert.Nil(t, other.Store("saml", "arn:aws:iam::000000000001:role/Development", &AWSCredentials{AWSAccessKey: "otherid", Expires: time.Now().Add(time.Hour)}))
+
+	cached, err = cache.Lookup("saml", "arn:aws:iam::000000000001:role/Development", DefaultCacheSkew)
+	assert.Nil(t, err)
+	assert.Equal(t, "userid", cached.Credentials.AWSAccessKey)
+
+	cached, err = NewCredentialsCache(".cache", CacheIdentity{IdpAccount: "other", URL: identity.URL, Username: identity.Username}).Lookup("saml", "", DefaultCacheSkew)
+	assert.Nil(t, err)
+	assert.Nil(t, cached)
+}
@@ -0,0 +1,170 @@
+package awsconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+
+	ini "gopkg.in/ini.v1"
+)
+
+const (
+	// DefaultOutputFormat the format credentials are written in when one isn't supplied
+	DefaultOutputFormat = "ini"
+
+	// outputFileMode the output holds live credentials so only the owner can read them
+	outputFileMode = 0600
+)
+
+// Formatter renders the credentials for the profile in the format expected by the tool consuming them
+type Formatter func(profile string, awsCreds *AWSCredentials) ([]byte, error)
+
+var formatters = map[string]Formatter{
+	"ini":  formatINI,
+	"json": formatJSON,
+	"env":  formatEnv,
+}
+
+// OutputFormats the names of the supported output formats
+func OutputFormats() []string {
+	var names []string
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// OutputTarget writes credentials to a file of their own, in a format other tools can consume, rather
+// than merging them into the shared credentials file
+type OutputTarget struct {
+	Filename string
+	Profile  string
+	format   Formatter
+}
+
+// NewOutputTarget helper to create an output target writing the profile in the named format to the file
+func NewOutputTarget(filename, format, profile string) (*OutputTarget, error) {
+	if format == "" {
+		format = DefaultOutputFormat
+	}
+
+	formatter, ok := formatters[format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported output format %s, expected one of %v", format, OutputFormats())
+	}
+
+	return &OutputTarget{Filename: filename, Profile: profile, format: formatter}, nil
+}
+
+// Save replace the file with the credentials, the file is written to a temporary file in the same
+// directory which is renamed over it so readers never see a partially written file
+func (t *OutputTarget) Save(awsCreds *AWSCredentials) error {
+
+	data, err := t.format(t.Profile, awsCreds)
+	if err != nil {
+		return errors.Wrap(err, "error formatting credentials")
+	}
+
+	filename, err := homedir.Expand(t.Filename)
+	if err != nil {
+		return errors.Wrap(err, "error expanding output path")
+	}
+
+	return writeFileAtomic(filename, data, outputFileMode)
+}
+
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename))
+	if err != nil {
+		return errors.Wrap(err, "error creating temporary file")
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "error writing temporary file")
+	}
+
+	// TempFile creates the file readable only by the owner, this also applies any other mode
+	err = os.Chmod(tmp.Name(), perm)
+	if err != nil {
+		return errors.Wrap(err, "error setting file mode")
+	}
+
+	err = os.Rename(tmp.Name(), filename)
+	if err != nil {
+		return errors.Wrapf(err, "error replacing %s", filename)
+	}
+
+	return nil
+}
+
+// formatINI a credentials file containing only the profile
+func formatINI(profile string, awsCreds *AWSCredentials) ([]byte, error) {
+	config := ini.Empty()
+
+	iniProfile, err := config.NewSection(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	err = iniProfile.ReflectFrom(awsCreds)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	_, err = config.WriteTo(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// formatJSON the credentials in the form returned by an AWS credential_process
+func formatJSON(profile string, awsCreds *AWSCredentials) ([]byte, error) {
+	return json.MarshalIndent(struct {
+		Version         int
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		SessionToken    string
+		Expiration      string
+	}{
+		Version:         1,
+		AccessKeyID:     awsCreds.AWSAccessKey,
+		SecretAccessKey: awsCreds.AWSSecretKey,
+		SessionToken:    awsCreds.AWSSessionToken,
+		Expiration:      awsCreds.Expires.UTC().Format(time.RFC3339),
+	}, "", "  ")
+}
+
+// formatEnv the credentials as the environment variables read by the AWS SDKs, one per line
+func formatEnv(profile string, awsCreds *AWSCredentials) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintf(buf, "AWS_ACCESS_KEY_ID=%s\n", awsCreds.AWSAccessKey)
+	fmt.Fprintf(buf, "AWS_SECRET_ACCESS_KEY=%s\n", awsCreds.AWSSecretKey)
+	fmt.Fprintf(buf, "AWS_SESSION_TOKEN=%s\n", awsCreds.AWSSessionToken)
+	fmt.Fprintf(buf, "AWS_SECURITY_TOKEN=%s\n", awsCreds.AWSSecurityToken)
+	fmt.Fprintf(buf, "AWS_CREDENTIAL_EXPIRATION=%s\n", awsCreds.Expires.UTC().Format(time.RFC3339))
+
+	return buf.Bytes(), nil
+}
@@ -1,8 +1,11 @@
 package cfg
 
 import (
+	"fmt"
 	"net/url"
 	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/mitchellh/go-homedir"
 	"github.com/pkg/errors"
@@ -19,6 +22,10 @@ const (
 	// DefaultAmazonWebservicesURN URN used when authenticating to aws using SAML
 	// NOTE: This only needs to be changed to log into GovCloud
 	DefaultAmazonWebservicesURN = "urn:amazon:webservices"
+
+	// DefaultRegion region used when calling STS which resolves to the global endpoint sts.amazonaws.com
+	// NOTE: This only needs to be changed to assume roles in GovCloud or China
+	DefaultRegion = "aws-global"
 )
 
 // IDPAccount saml IDP account
@@ -28,8 +35,37 @@ type IDPAccount struct {
 	Provider             string `ini:"provider"`
 	MFA                  string `ini:"mfa"`
 	SkipVerify           bool   `ini:"skip_verify"`
+	CertificatePin       string `ini:"certificate_pin"`
+	DisablePublicSuffix  bool   `ini:"disable_public_suffix"`
+	LocalAddress         string `ini:"local_address"`
+	IPv4Only             bool   `ini:"ipv4_only"`
+	AcceptLanguage       string `ini:"accept_language"`
+	HTTPHeaders          string `ini:"http_headers"`
+	MaxBodySize          int64  `ini:"max_body_size"`
 	Timeout              int    `ini:"timeout"`
 	AmazonWebservicesURN string `ini:"aws_urn"`
+	Region               string `ini:"region"`
+	STSEndpoint          string `ini:"sts_endpoint"`
+	SessionDuration      int64  `ini:"aws_session_duration"`
+	RoleArn              string `ini:"role_arn"`
+	RoleFilter           string `ini:"role_filter"`
+	HTTPAttempts         int    `ini:"http_attempts"`
+	DuoRememberDevice    bool   `ini:"duo_remember_device"`
+	DuoPushTimeout       int    `ini:"duo_push_timeout"`
+	PushFallback         bool   `ini:"push_fallback"`
+	MFARemember          bool   `ini:"mfa_remember"`
+	AllowUnknownFactors  bool   `ini:"allow_unknown_factors"`
+	CookieFile           string `ini:"cookie_file"`
+	KeyCloakRealm        string `ini:"keycloak_realm"`
+	KeyCloakClient       string `ini:"keycloak_client"`
+	AccountAliases       string `ini:"account_aliases"`
+	AllowedAccounts      string `ini:"allowed_accounts"`
+	CacheSkew            int    `ini:"credentials_cache_skew"`
+	F5ResourcePath       string `ini:"f5_resource_path"`
+	OktaAppURL           string `ini:"okta_app_url"`
+	OktaSelectApp        bool   `ini:"okta_select_app"`
+	ADFSDomain           string `ini:"adfs_domain"`
+	BrowserCallbackPort  int    `ini:"browser_callback_port"`
 }
 
 // Validate validate the required / expected fields are set
@@ -51,9 +87,72 @@ func (ia *IDPAccount) Validate() error {
 		return errors.New("MFA empty in idp account")
 	}
 
+	if ia.STSEndpoint != "" && ia.Region == "" {
+		return errors.New("Region empty in idp account, it is required when an STS endpoint is supplied")
+	}
+
+	if ia.RoleArn != "" && ia.RoleFilter != "" {
+		return errors.New("Role ARN and role filter both set in idp account, only one of them can choose the role")
+	}
+
+	_, err = ia.ParseHTTPHeaders()
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// ParseHTTPHeaders the extra headers sent with every request to the IdP, supplied as a comma separated list
+// of name=value pairs such as X-Corp-Token=abc123
+func (ia *IDPAccount) ParseHTTPHeaders() (map[string]string, error) {
+	headers := map[string]string{}
+
+	if strings.TrimSpace(ia.HTTPHeaders) == "" {
+		return headers, nil
+	}
+
+	for _, header := range strings.Split(ia.HTTPHeaders, ",") {
+		tokens := strings.SplitN(header, "=", 2)
+		name := strings.TrimSpace(tokens[0])
+		if len(tokens) != 2 || name == "" {
+			return nil, errors.Errorf("invalid http header %q in idp account, expected name=value", strings.TrimSpace(header))
+		}
+
+		headers[name] = strings.TrimSpace(tokens[1])
+	}
+
+	return headers, nil
+}
+
+// String the account with the values of the http headers redacted, as they may be secrets, for debug logging
+func (ia *IDPAccount) String() string {
+	type plainAccount IDPAccount
+
+	account := plainAccount(*ia)
+
+	if headers, err := ia.ParseHTTPHeaders(); err == nil && len(headers) > 0 {
+		names := make([]string, 0, len(headers))
+		for name := range headers {
+			names = append(names, name+"=REDACTED")
+		}
+		sort.Strings(names)
+		account.HTTPHeaders = strings.Join(names, ",")
+	} else if ia.HTTPHeaders != "" {
+		account.HTTPHeaders = "REDACTED"
+	}
+
+	return fmt.Sprintf("%+v", account)
+}
+
+// STSRegion the region used when calling STS, defaulting to the global endpoint
+func (ia *IDPAccount) STSRegion() string {
+	if ia.Region == "" {
+		return DefaultRegion
+	}
+	return ia.Region
+}
+
 // NewIDPAccount Create an idp account and fill in any default fields with sane values
 func NewIDPAccount() *IDPAccount {
 	return &IDPAccount{
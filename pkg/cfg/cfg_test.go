@@ -88,3 +88,63 @@ func TestNewConfigManagerSave(t *testing.T) {
 	os.Remove(throwAwayConfig)
 
 }
+
+func TestIDPAccountValidateRegion(t *testing.T) {
+
+	idpAccount := &IDPAccount{
+		URL:         "https://id.whatever.com",
+		MFA:         "Auto",
+		Provider:    "Okta",
+		STSEndpoint: "https://sts.us-gov-west-1.amazonaws.com",
+	}
+
+	require.Error(t, idpAccount.Validate())
+
+	idpAccount.Region = "us-gov-west-1"
+	require.Nil(t, idpAccount.Validate())
+	require.Equal(t, "us-gov-west-1", idpAccount.STSRegion())
+
+	require.Equal(t, DefaultRegion, NewIDPAccount().STSRegion())
+}
+
+func TestIDPAccountValidateRole(t *testing.T) {
+
+	idpAccount := &IDPAccount{
+		URL:      "https://id.whatever.com",
+		MFA:      "Auto",
+		Provider: "Okta",
+		RoleArn:  "arn:aws:iam::123123123123:role/Admin",
+	}
+
+	require.Nil(t, idpAccount.Validate())
+
+	idpAccount.RoleFilter = "NonProd"
+	require.EqualError(t, idpAccount.Validate(), "Role ARN and role filter both set in idp account, only one of them can choose the role")
+}
+
+func TestIDPAccountParseHTTPHeaders(t *testing.T) {
+
+	idpAccount := &IDPAccount{HTTPHeaders: "X-Corp-Token=YWJjMTIz==, X-Region = apac"}
+
+	headers, err := idpAccount.ParseHTTPHeaders()
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"X-Corp-Token": "YWJjMTIz==", "X-Region": "apac"}, headers)
+
+	idpAccount.HTTPHeaders = "X-Corp-Token"
+	_, err = idpAccount.ParseHTTPHeaders()
+	require.EqualError(t, err, `invalid http header "X-Corp-Token" in idp account, expected name=value`)
+
+	idpAccount = &IDPAccount{URL: "https://id.example.com", Provider: "Okta", MFA: "Auto", HTTPHeaders: "=abc"}
+	require.Error(t, idpAccount.Validate())
+}
+
+func TestIDPAccountStringRedactsHeaders(t *testing.T) {
+
+	idpAccount := &IDPAccount{URL: "https://id.example.com", HTTPHeaders: "X-Region=apac,X-Corp-Token=abc123"}
+
+	s := idpAccount.String()
+	require.Contains(t, s, "URL:https://id.example.com")
+	require.Contains(t, s, "HTTPHeaders:X-Corp-Token=REDACTED,X-Region=REDACTED")
+	require.NotContains(t, s, "abc123")
+	require.NotContains(t, s, "apac")
+}
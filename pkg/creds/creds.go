@@ -4,9 +4,12 @@ import "errors"
 
 // LoginDetails used to authenticate
 type LoginDetails struct {
-	Username string
-	Password string
-	URL      string
+	Username     string
+	Password     string
+	URL          string
+	DuoMFAOption string // push, passcode or phone, when empty the user is prompted
+	MFAToken     string // passcode used when the mfa option is passcode
+	PromptMFA    bool   // prompt for the mfa option even if one was remembered
 }
 
 // Validate validate the login details
@@ -0,0 +1,84 @@
+package creds
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/prompter"
+)
+
+// PasswordEnvVar the environment variable the password can be supplied in
+const PasswordEnvVar = "SAML2AWS_PASSWORD"
+
+// ReadPassword populate the password in the login details without it appearing in argv, the first
+// source which is enabled is used in this order of precedence:
+//
+// 1. the file descriptor passwordFd, when it is greater than zero
+// 2. stdin when passwordStdin is set, the password isn't echoed if stdin is a terminal
+// 3. the SAML2AWS_PASSWORD environment variable, when it is set and the login details don't have a password,
+// so a password supplied with the --password flag isn't replaced
+//
+// The password is left unchanged when none of these are enabled.
+func ReadPassword(loginDetails *LoginDetails, passwordFd int, passwordStdin bool) error {
+
+	switch {
+	case passwordFd > 0:
+		f := os.NewFile(uintptr(passwordFd), fmt.Sprintf("fd%d", passwordFd))
+		if f == nil {
+			return fmt.Errorf("invalid password file descriptor %d", passwordFd)
+		}
+		defer f.Close()
+
+		password, err := readPasswordLine(f)
+		if err != nil {
+			return errors.Wrapf(err, "error reading password from file descriptor %d", passwordFd)
+		}
+		loginDetails.Password = password
+
+	case passwordStdin:
+		password, err := readPasswordStdin()
+		if err != nil {
+			return errors.Wrap(err, "error reading password from stdin")
+		}
+		loginDetails.Password = password
+
+	case loginDetails.Password == "":
+		if password, ok := os.LookupEnv(PasswordEnvVar); ok {
+			loginDetails.Password = password
+		}
+	}
+
+	return nil
+}
+
+func readPasswordStdin() (string, error) {
+	password, err := prompter.PromptPassword("Password")
+	if err != nil {
+		return "", err
+	}
+
+	if password == "" {
+		return "", errors.New("empty password")
+	}
+
+	return password, nil
+}
+
+// readPasswordLine read the password from the first line of the reader
+func readPasswordLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("empty password")
+	}
+
+	return password, nil
+}
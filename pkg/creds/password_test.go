@@ -0,0 +1,67 @@
+package creds
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPasswordFromFd(t *testing.T) {
+
+	r, w, err := os.Pipe()
+	require.Nil(t, err)
+
+	_, err = w.WriteString("s3cret\n")
+	require.Nil(t, err)
+	w.Close()
+
+	os.Setenv(PasswordEnvVar, "fromenv")
+	defer os.Unsetenv(PasswordEnvVar)
+
+	ld := &LoginDetails{}
+
+	err = ReadPassword(ld, int(r.Fd()), false)
+	require.Nil(t, err)
+	require.Equal(t, "s3cret", ld.Password)
+}
+
+func TestReadPasswordFromEnv(t *testing.T) {
+
+	os.Setenv(PasswordEnvVar, "fromenv")
+	defer os.Unsetenv(PasswordEnvVar)
+
+	ld := &LoginDetails{}
+
+	err := ReadPassword(ld, 0, false)
+	require.Nil(t, err)
+	require.Equal(t, "fromenv", ld.Password)
+
+	// a password which has already been supplied, such as with the flag, isn't replaced
+	ld = &LoginDetails{Password: "fromflag"}
+
+	err = ReadPassword(ld, 0, false)
+	require.Nil(t, err)
+	require.Equal(t, "fromflag", ld.Password)
+}
+
+func TestReadPasswordUnchanged(t *testing.T) {
+
+	os.Unsetenv(PasswordEnvVar)
+
+	ld := &LoginDetails{Password: "saved"}
+
+	err := ReadPassword(ld, 0, false)
+	require.Nil(t, err)
+	require.Equal(t, "saved", ld.Password)
+}
+
+func TestReadPasswordLine(t *testing.T) {
+
+	r, w, err := os.Pipe()
+	require.Nil(t, err)
+	w.Close()
+
+	_, err = readPasswordLine(r)
+	require.EqualError(t, err, "empty password")
+}
@@ -0,0 +1,43 @@
+package creds
+
+import (
+	"os"
+	"os/user"
+)
+
+// UsernameEnvVar the environment variable the username is taken from when none is configured or supplied
+const UsernameEnvVar = "SAML2AWS_USERNAME"
+
+// UsernameSource supplies a default username, returning an empty string when it has none
+type UsernameSource func() string
+
+// DefaultUsernameSources the sources of the username when none is configured or supplied, tried in order, the
+// environment and then the OS user. Callers can replace them, an empty list leaves the username to be prompted for.
+var DefaultUsernameSources = []UsernameSource{EnvUsername, OSUsername}
+
+// EnvUsername the username set in SAML2AWS_USERNAME
+func EnvUsername() string {
+	return os.Getenv(UsernameEnvVar)
+}
+
+// OSUsername the name of the current OS user, on windows this includes the domain as DOMAIN\user which is what
+// IdPs using windows integrated authentication, such as ADFS, expect
+func OSUsername() string {
+	u, err := user.Current()
+	if err != nil {
+		return ""
+	}
+
+	return u.Username
+}
+
+// DefaultUsername set the username from the first of the sources which has one, unless it is already set
+func (ld *LoginDetails) DefaultUsername(sources []UsernameSource) {
+	for _, source := range sources {
+		if ld.Username != "" {
+			return
+		}
+
+		ld.Username = source()
+	}
+}
@@ -0,0 +1,40 @@
+package creds
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultUsername(t *testing.T) {
+
+	empty := func() string { return "" }
+	env := func() string { return "env.user@example.com" }
+	osUser := func() string { return "CORP\\jsmith" }
+
+	ld := &LoginDetails{}
+	ld.DefaultUsername([]UsernameSource{empty, env, osUser})
+	require.Equal(t, "env.user@example.com", ld.Username)
+
+	ld = &LoginDetails{}
+	ld.DefaultUsername([]UsernameSource{empty, osUser})
+	require.Equal(t, "CORP\\jsmith", ld.Username)
+
+	// a username already set takes precedence over all the sources
+	ld = &LoginDetails{Username: "configured@example.com"}
+	ld.DefaultUsername([]UsernameSource{env, osUser})
+	require.Equal(t, "configured@example.com", ld.Username)
+
+	ld = &LoginDetails{}
+	ld.DefaultUsername(nil)
+	require.Equal(t, "", ld.Username)
+}
+
+func TestEnvUsername(t *testing.T) {
+
+	os.Setenv(UsernameEnvVar, "env.user@example.com")
+	defer os.Unsetenv(UsernameEnvVar)
+
+	require.Equal(t, "env.user@example.com", EnvUsername())
+}
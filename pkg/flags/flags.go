@@ -1,6 +1,11 @@
 package flags
 
-import "github.com/versent/saml2aws/pkg/cfg"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/versent/saml2aws/pkg/cfg"
+)
 
 // CommonFlags flags common to all of the `saml2aws` commands (except `help`)
 type CommonFlags struct {
@@ -10,9 +15,19 @@ type CommonFlags struct {
 	URL                  string
 	Username             string
 	RoleArn              string
+	PrincipalArn         string
 	AmazonWebservicesURN string
+	Region               string
+	STSEndpoint          string
+	SessionDuration      int64
 	SkipPrompt           bool
 	SkipVerify           bool
+	DuoRememberDevice    bool
+	PushFallback         bool
+	MFARemember          bool
+	CookieFile           string
+	AccountAliases       string
+	AllowedAccounts      string
 }
 
 // RoleSupplied role arn has been passed as a flag
@@ -22,13 +37,31 @@ func (cf *CommonFlags) RoleSupplied() bool {
 
 // LoginExecFlags flags for the Login / Exec commands
 type LoginExecFlags struct {
-	CommonFlags *CommonFlags
-	Profile     string
-	Password    string
+	CommonFlags   *CommonFlags
+	Profile       string
+	Password      string
+	PasswordStdin bool
+	PasswordFd    int
+	RoleArns      []string
+	RoleFilter    string
+	DuoMFAOption  string
+	MFAToken      string
+	SkipCache     bool
+	PromptMFA     bool
+	OutputFile    string
+	OutputFormat  string
+	SAMLAssertion string
+	CheckIdP      bool
+}
+
+// MultipleRolesSupplied a list of role arns or a role filter has been passed as a flag
+func (lf *LoginExecFlags) MultipleRolesSupplied() bool {
+	return len(lf.RoleArns) > 0 || lf.RoleFilter != ""
 }
 
-// ApplyFlagOverrides overrides IDPAccount with command line settings
-func ApplyFlagOverrides(commonFlags *CommonFlags, account *cfg.IDPAccount) {
+// ApplyFlagOverrides overrides IDPAccount with command line settings, the allowed accounts can only be narrowed
+// by the flags so an error is returned when none of those supplied are allowed by the account
+func ApplyFlagOverrides(commonFlags *CommonFlags, account *cfg.IDPAccount) error {
 	if commonFlags.URL != "" {
 		account.URL = commonFlags.URL
 	}
@@ -52,4 +85,73 @@ func ApplyFlagOverrides(commonFlags *CommonFlags, account *cfg.IDPAccount) {
 	if commonFlags.AmazonWebservicesURN != "" {
 		account.AmazonWebservicesURN = commonFlags.AmazonWebservicesURN
 	}
+
+	if commonFlags.Region != "" {
+		account.Region = commonFlags.Region
+	}
+
+	if commonFlags.STSEndpoint != "" {
+		account.STSEndpoint = commonFlags.STSEndpoint
+	}
+
+	if commonFlags.SessionDuration != 0 {
+		account.SessionDuration = commonFlags.SessionDuration
+	}
+
+	if commonFlags.DuoRememberDevice {
+		account.DuoRememberDevice = commonFlags.DuoRememberDevice
+	}
+
+	if commonFlags.MFARemember {
+		account.MFARemember = commonFlags.MFARemember
+	}
+
+	if commonFlags.PushFallback {
+		account.PushFallback = commonFlags.PushFallback
+	}
+
+	if commonFlags.CookieFile != "" {
+		account.CookieFile = commonFlags.CookieFile
+	}
+
+	if commonFlags.AccountAliases != "" {
+		account.AccountAliases = commonFlags.AccountAliases
+	}
+
+	if commonFlags.AllowedAccounts != "" {
+		allowedAccounts, err := narrowAllowedAccounts(account.AllowedAccounts, commonFlags.AllowedAccounts)
+		if err != nil {
+			return err
+		}
+		account.AllowedAccounts = allowedAccounts
+	}
+
+	return nil
+}
+
+// narrowAllowedAccounts the supplied accounts which the configured accounts allow, all are allowed when none are
+// configured
+func narrowAllowedAccounts(configured, supplied string) (string, error) {
+	if strings.TrimSpace(configured) == "" {
+		return supplied, nil
+	}
+
+	allowed := map[string]bool{}
+	for _, accountID := range strings.Split(configured, ",") {
+		allowed[strings.TrimSpace(accountID)] = true
+	}
+
+	narrowed := []string{}
+	for _, accountID := range strings.Split(supplied, ",") {
+		accountID = strings.TrimSpace(accountID)
+		if allowed[accountID] {
+			narrowed = append(narrowed, accountID)
+		}
+	}
+
+	if len(narrowed) == 0 {
+		return "", fmt.Errorf("none of the allowed accounts supplied are allowed by the account: %s", configured)
+	}
+
+	return strings.Join(narrowed, ","), nil
 }
@@ -27,6 +27,18 @@ func TestRoleSuppliedIsFalseWithEmptyRole(t *testing.T) {
 	assert.Equal(t, expected, actual)
 }
 
+func TestMultipleRolesSupplied(t *testing.T) {
+
+	loginFlags := &LoginExecFlags{CommonFlags: &CommonFlags{}}
+	assert.False(t, loginFlags.MultipleRolesSupplied())
+
+	loginFlags.RoleArns = []string{"arn:aws:iam::456456456456:role/myrole"}
+	assert.True(t, loginFlags.MultipleRolesSupplied())
+
+	loginFlags = &LoginExecFlags{CommonFlags: &CommonFlags{}, RoleFilter: "myrole"}
+	assert.True(t, loginFlags.MultipleRolesSupplied())
+}
+
 func TestOverrideAllFlags(t *testing.T) {
 
 	commonFlags := &CommonFlags{
@@ -36,6 +48,8 @@ func TestOverrideAllFlags(t *testing.T) {
 		URL:                  "https://id.example.com",
 		Username:             "myuser",
 		AmazonWebservicesURN: "urn:amazon:webservices",
+		Region:               "us-gov-west-1",
+		STSEndpoint:          "https://sts.us-gov-west-1.amazonaws.com",
 	}
 	idpa := &cfg.IDPAccount{
 		Provider:             "Ping",
@@ -53,8 +67,10 @@ func TestOverrideAllFlags(t *testing.T) {
 		URL:                  "https://id.example.com",
 		Username:             "myuser",
 		AmazonWebservicesURN: "urn:amazon:webservices",
+		Region:               "us-gov-west-1",
+		STSEndpoint:          "https://sts.us-gov-west-1.amazonaws.com",
 	}
-	ApplyFlagOverrides(commonFlags, idpa)
+	assert.Nil(t, ApplyFlagOverrides(commonFlags, idpa))
 
 	assert.Equal(t, expected, idpa)
 }
@@ -86,7 +102,25 @@ func TestNoOverrides(t *testing.T) {
 		Username:             "test123",
 		AmazonWebservicesURN: "urn:govcloud:webservices",
 	}
-	ApplyFlagOverrides(commonFlags, idpa)
+	assert.Nil(t, ApplyFlagOverrides(commonFlags, idpa))
 
 	assert.Equal(t, expected, idpa)
 }
+
+func TestApplyFlagOverridesNarrowsAllowedAccounts(t *testing.T) {
+
+	idpa := &cfg.IDPAccount{AllowedAccounts: "123123123123,456456456456"}
+	assert.Nil(t, ApplyFlagOverrides(&CommonFlags{AllowedAccounts: "456456456456, 789789789789"}, idpa))
+	assert.Equal(t, "456456456456", idpa.AllowedAccounts)
+
+	// the flag can't allow accounts the account doesn't
+	idpa = &cfg.IDPAccount{AllowedAccounts: "123123123123"}
+	err := ApplyFlagOverrides(&CommonFlags{AllowedAccounts: "789789789789"}, idpa)
+	assert.EqualError(t, err, "none of the allowed accounts supplied are allowed by the account: 123123123123")
+	assert.Equal(t, "123123123123", idpa.AllowedAccounts)
+
+	// without any configured the flag is used as is
+	idpa = &cfg.IDPAccount{}
+	assert.Nil(t, ApplyFlagOverrides(&CommonFlags{AllowedAccounts: "789789789789"}, idpa))
+	assert.Equal(t, "789789789789", idpa.AllowedAccounts)
+}
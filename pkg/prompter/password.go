@@ -0,0 +1,43 @@
+package prompter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// PromptPassword prompt for a password without echoing it when stdin is a terminal, otherwise the password
+// is read from the first line of stdin so it can be piped in. The prompt is written to stderr.
+func PromptPassword(label string) (string, error) {
+	return readPassword(os.Stdin, os.Stderr, label)
+}
+
+// StdinIsTerminal whether stdin is a terminal the user can be prompted on
+func StdinIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+func readPassword(in *os.File, out io.Writer, label string) (string, error) {
+	fd := int(in.Fd())
+
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprintf(out, "%s: ", label)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(out)
+	if err != nil {
+		return "", err
+	}
+
+	return string(password), nil
+}
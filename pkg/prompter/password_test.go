@@ -0,0 +1,36 @@
+package prompter
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPasswordNotTerminal(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.Nil(t, err)
+	defer r.Close()
+
+	_, err = w.WriteString("secret\nignored\n")
+	require.Nil(t, err)
+	w.Close()
+
+	out := &bytes.Buffer{}
+
+	password, err := readPassword(r, out, "Password")
+	require.Nil(t, err)
+	require.Equal(t, "secret", password)
+	require.Empty(t, out.String())
+}
+
+func TestReadPasswordError(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.Nil(t, err)
+	w.Close()
+	r.Close()
+
+	_, err = readPassword(r, &bytes.Buffer{}, "Password")
+	require.NotNil(t, err)
+}
@@ -7,6 +7,27 @@ type Prompter interface {
 	RequestSecurityCode(pattern string) string
 	Choice(prompt string, options []string) string
 	StringRequired(pr string) string
+	String(pr string, defaultValue string) string
+	Password(pr string) (string, error)
+}
+
+// ActivePrompter the prompter used by the commands and the providers built after it is set, replace it
+// with SetPrompter to supply the answers when there is no terminal
+var ActivePrompter = NewCli()
+
+// SetPrompter replace the active prompter
+func SetPrompter(pr Prompter) {
+	ActivePrompter = pr
+}
+
+// Interactive whether the active prompter can ask the user, the cli prompter needs stdin to be a terminal while
+// a prompter set with SetPrompter supplies its own answers
+func Interactive() bool {
+	if _, ok := ActivePrompter.(*CliPrompter); !ok {
+		return true
+	}
+
+	return StdinIsTerminal()
 }
 
 // CliPrompter used to prompt for cli input
@@ -33,3 +54,18 @@ func (cli *CliPrompter) Choice(pr string, options []string) string {
 func (cli *CliPrompter) StringRequired(pr string) string {
 	return prompt.StringRequired(pr)
 }
+
+// String prompt for a string, the prompt is formatted with the default value which is returned when
+// nothing is entered
+func (cli *CliPrompter) String(pr string, defaultValue string) string {
+	val := prompt.String(pr, defaultValue)
+	if val == "" {
+		return defaultValue
+	}
+	return val
+}
+
+// Password prompt for a password without echoing it
+func (cli *CliPrompter) Password(pr string) (string, error) {
+	return PromptPassword(pr)
+}
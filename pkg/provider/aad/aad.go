@@ -0,0 +1,368 @@
+package aad
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/dump"
+	"github.com/versent/saml2aws/pkg/provider"
+)
+
+const (
+	// pushAuthMethod the Microsoft Authenticator "Approve sign-in request" notification
+	pushAuthMethod = "PhoneAppNotification"
+
+	// maxLoginSteps the number of pages followed after the password is posted before giving up
+	maxLoginSteps = 5
+
+	// maxPollAttempts the number of times the push notification is polled before giving up
+	maxPollAttempts = 60
+)
+
+var logger = logrus.WithField("provider", "aad")
+
+// Client wrapper around Azure AD
+type Client struct {
+	client       *provider.HTTPClient
+	pollInterval time.Duration
+}
+
+// loginConfig the settings Azure AD embeds in each page of the login flow as $Config
+type loginConfig struct {
+	URLPost              string      `json:"urlPost"`
+	URLGetCredentialType string      `json:"urlGetCredentialType"`
+	URLBeginAuth         string      `json:"urlBeginAuth"`
+	URLEndAuth           string      `json:"urlEndAuth"`
+	FlowToken            string      `json:"sFT"`
+	Ctx                  string      `json:"sCtx"`
+	Canary               string      `json:"canary"`
+	CorrelationID        string      `json:"correlationId"`
+	SessionID            string      `json:"sessionId"`
+	Pgid                 string      `json:"pgid"`
+	ErrorCode            string      `json:"sErrorCode"`
+	ErrorText            string      `json:"sErrTxt"`
+	UserProofs           []userProof `json:"arrUserProofs"`
+}
+
+// userProof an MFA method registered by the user
+type userProof struct {
+	AuthMethodID string `json:"authMethodId"`
+	IsDefault    bool   `json:"isDefault"`
+	Display      string `json:"display"`
+}
+
+// credentialTypeResponse the result of the GetCredentialType probe for the username
+type credentialTypeResponse struct {
+	IfExistsResult int `json:"IfExistsResult"`
+	Credentials    struct {
+		FederationRedirectURL string `json:"FederationRedirectUrl"`
+	} `json:"Credentials"`
+}
+
+// mfaResponse the result of beginning or polling an MFA request
+type mfaResponse struct {
+	Success      bool   `json:"Success"`
+	ResultValue  string `json:"ResultValue"`
+	Message      string `json:"Message"`
+	AuthMethodID string `json:"AuthMethodId"`
+	Retry        bool   `json:"Retry"`
+	FlowToken    string `json:"FlowToken"`
+	Ctx          string `json:"Ctx"`
+	SessionID    string `json:"SessionId"`
+}
+
+// New create a new Azure AD client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
+
+	client, err := provider.NewHTTPClientForAccount(tr, idpAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		client:       client,
+		pollInterval: 2 * time.Second,
+	}, nil
+}
+
+// Authenticate logs into Azure AD and returns a SAML response
+func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	res, err := ac.client.Get(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	loginPage, err := provider.ReadPage(res)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	// an existing session skips straight to the assertion
+	if samlAssertion, err := loginPage.ExtractSAMLResponse(); err != provider.ErrSAMLResponseNotFound {
+		return samlAssertion, err
+	}
+
+	config, err := extractConfig(loginPage)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing login page")
+	}
+
+	err = ac.checkCredentialType(loginPage, config, loginDetails.Username)
+	if err != nil {
+		return "", err
+	}
+
+	current, err := ac.client.SubmitForm(loginPage.URL, config.URLPost, url.Values{
+		"login":        {loginDetails.Username},
+		"loginfmt":     {loginDetails.Username},
+		"passwd":       {loginDetails.Password},
+		"type":         {"11"},
+		"ctx":          {config.Ctx},
+		"flowToken":    {config.FlowToken},
+		"canary":       {config.Canary},
+		"hpgrequestid": {config.SessionID},
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error posting password")
+	}
+
+	for step := 0; step < maxLoginSteps; step++ {
+
+		if samlAssertion, err := current.ExtractSAMLResponse(); err != provider.ErrSAMLResponseNotFound {
+			return samlAssertion, err
+		}
+
+		config, err = extractConfig(current)
+		if err != nil {
+			return "", errors.Wrap(err, "error parsing login page")
+		}
+
+		if config.ErrorCode != "" {
+			return "", fmt.Errorf("login failed with error %s: %s", config.ErrorCode, config.ErrorText)
+		}
+
+		switch {
+		case config.Pgid == "KmsiInterrupt":
+			current, err = ac.postKmsi(current, config)
+		case len(config.UserProofs) > 0:
+			current, err = ac.processMfa(current, config, loginDetails.Username)
+		default:
+			return "", fmt.Errorf("unexpected login page %q", config.Pgid)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", errors.New("unable to locate SAMLResponse after completing the login flow")
+}
+
+// checkCredentialType probe the username to ensure it is managed by Azure AD rather than federated elsewhere
+func (ac *Client) checkCredentialType(loginPage *provider.Page, config *loginConfig, username string) error {
+
+	credentialType := new(credentialTypeResponse)
+
+	err := ac.postJSON(loginPage.URL, config.URLGetCredentialType, config, map[string]interface{}{
+		"username":            username,
+		"isOtherIdpSupported": true,
+		"originalRequest":     config.Ctx,
+		"flowToken":           config.FlowToken,
+	}, credentialType)
+	if err != nil {
+		return errors.Wrap(err, "error checking credential type")
+	}
+
+	if credentialType.Credentials.FederationRedirectURL != "" {
+		return fmt.Errorf("%s is federated to %s which isn't supported", username, credentialType.Credentials.FederationRedirectURL)
+	}
+
+	if credentialType.IfExistsResult == 1 {
+		return fmt.Errorf("%s was not found in Azure AD", username)
+	}
+
+	return nil
+}
+
+// postKmsi answer the "Stay signed in?" prompt
+func (ac *Client) postKmsi(current *provider.Page, config *loginConfig) (*provider.Page, error) {
+
+	next, err := ac.client.SubmitForm(current.URL, config.URLPost, url.Values{
+		"LoginOptions": {"1"},
+		"type":         {"28"},
+		"ctx":          {config.Ctx},
+		"flowToken":    {config.FlowToken},
+		"canary":       {config.Canary},
+		"hpgrequestid": {config.SessionID},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error posting stay signed in response")
+	}
+
+	return next, nil
+}
+
+// processMfa send an "Approve sign-in request" notification and wait for the user to approve it
+func (ac *Client) processMfa(current *provider.Page, config *loginConfig, username string) (*provider.Page, error) {
+
+	if !supportsPush(config.UserProofs) {
+		return nil, fmt.Errorf("unsupported MFA method %s, only %s is supported", defaultProof(config.UserProofs), pushAuthMethod)
+	}
+
+	begin := new(mfaResponse)
+
+	err := ac.postJSON(current.URL, config.URLBeginAuth, config, map[string]interface{}{
+		"AuthMethodId": pushAuthMethod,
+		"Method":       "BeginAuth",
+		"ctx":          config.Ctx,
+		"flowToken":    config.FlowToken,
+	}, begin)
+	if err != nil {
+		return nil, errors.Wrap(err, "error beginning MFA")
+	}
+
+	if !begin.Success {
+		return nil, fmt.Errorf("error beginning MFA: %s", begin.Message)
+	}
+
+	fmt.Fprintf(provider.Output, "\nWaiting for approval, please check your Microsoft Authenticator app ...")
+
+	end := begin
+
+	for poll := 1; ; poll++ {
+
+		if poll > maxPollAttempts {
+			fmt.Fprintf(provider.Output, " Timeout\n")
+			return nil, errors.New("User did not accept MFA in time")
+		}
+
+		time.Sleep(ac.pollInterval)
+
+		next := new(mfaResponse)
+
+		err = ac.postJSON(current.URL, config.URLEndAuth, config, map[string]interface{}{
+			"AuthMethodId": pushAuthMethod,
+			"Method":       "EndAuth",
+			"SessionId":    end.SessionID,
+			"FlowToken":    end.FlowToken,
+			"Ctx":          end.Ctx,
+			"PollCount":    poll,
+		}, next)
+		if err != nil {
+			return nil, errors.Wrap(err, "error polling MFA")
+		}
+
+		end = next
+
+		if end.Success {
+			fmt.Fprintf(provider.Output, " Approved\n\n")
+			break
+		}
+
+		if !end.Retry {
+			fmt.Fprintf(provider.Output, " Error\n")
+			return nil, fmt.Errorf("MFA failed: %s", end.ResultValue)
+		}
+
+		fmt.Fprintf(provider.Output, ".")
+	}
+
+	next, err := ac.client.SubmitForm(current.URL, config.URLPost, url.Values{
+		"type":          {"22"},
+		"request":       {end.Ctx},
+		"mfaAuthMethod": {pushAuthMethod},
+		"login":         {username},
+		"flowToken":     {end.FlowToken},
+		"canary":        {config.Canary},
+		"hpgrequestid":  {config.SessionID},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error completing MFA")
+	}
+
+	return next, nil
+}
+
+func (ac *Client) postJSON(base *url.URL, action string, config *loginConfig, body interface{}, out interface{}) error {
+
+	submitURL, err := base.Parse(action)
+	if err != nil {
+		return errors.Wrap(err, "error building submit url")
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "error encoding request")
+	}
+
+	req, err := http.NewRequest("POST", submitURL.String(), bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "error building request")
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("canary", config.Canary)
+	req.Header.Add("client-request-id", config.CorrelationID)
+	req.Header.Add("hpgrequestid", config.SessionID)
+
+	res, err := ac.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error retrieving response")
+	}
+	defer res.Body.Close()
+
+	logger.WithField("status", res.StatusCode).WithField("url", submitURL).WithField("res", dump.ResponseString(res)).Debug("POST")
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s from %s", res.Status, submitURL)
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// extractConfig decode the $Config object assigned in the page script
+func extractConfig(p *provider.Page) (*loginConfig, error) {
+
+	start := bytes.Index(p.Data, []byte("$Config="))
+	if start == -1 {
+		return nil, errors.New("unable to locate $Config in page")
+	}
+
+	config := new(loginConfig)
+
+	err := json.NewDecoder(bytes.NewReader(p.Data[start+len("$Config="):])).Decode(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding $Config")
+	}
+
+	return config, nil
+}
+
+func supportsPush(proofs []userProof) bool {
+	for _, proof := range proofs {
+		if proof.AuthMethodID == pushAuthMethod {
+			return true
+		}
+	}
+	return false
+}
+
+func defaultProof(proofs []userProof) string {
+	for _, proof := range proofs {
+		if proof.IsDefault {
+			return proof.AuthMethodID
+		}
+	}
+	return proofs[0].AuthMethodID
+}
@@ -0,0 +1,135 @@
+package aad
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/provider/replay"
+)
+
+const (
+	exampleLoginURL      = "https://login.microsoftonline.com/a1b2c3d4-0000-0000-0000-000000000000/saml2?SAMLRequest=fZJNT8MwDIbvSPyHKPeu7"
+	exampleLoginPath     = "/a1b2c3d4-0000-0000-0000-000000000000/saml2"
+	examplePostPath      = "/a1b2c3d4-0000-0000-0000-000000000000/login"
+	exampleSAMLAssertion = "PHNhbWxwOlJlc3BvbnNlIHhtbG5zOnNhbWxwPSJ1cm46b2FzaXM6bmFtZXM6dGM6U0FNTDoyLjA6cHJvdG9jb2wiLz4="
+)
+
+var exampleLoginDetails = &creds.LoginDetails{URL: exampleLoginURL, Username: "isaac.brock@example.com", Password: "test123"}
+
+func newTestClient(t *testing.T, tr *replay.Transport) *Client {
+	ac, err := New(&cfg.IDPAccount{})
+	require.Nil(t, err)
+
+	ac.client.Transport = tr
+	ac.pollInterval = 0
+
+	return ac
+}
+
+func TestClient_Authenticate(t *testing.T) {
+
+	tr := replay.New()
+	require.Nil(t, tr.AddFile("GET", exampleLoginPath, 200, "text/html", "example/login.html"))
+	require.Nil(t, tr.AddFile("POST", "/common/GetCredentialType", 200, "application/json", "example/credential-type.json"))
+	require.Nil(t, tr.AddFile("POST", examplePostPath, 200, "text/html", "example/kmsi.html"))
+	require.Nil(t, tr.AddFile("POST", "/kmsi", 200, "text/html", "example/saml.html"))
+
+	ac := newTestClient(t, tr)
+
+	samlAssertion, err := ac.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+
+	credentialType := map[string]interface{}{}
+	require.Nil(t, json.Unmarshal(tr.Requests()[1].Body, &credentialType))
+	require.Equal(t, "isaac.brock@example.com", credentialType["username"])
+	require.Equal(t, "AQABAAEAAAD-flow-token-1", credentialType["flowToken"])
+	require.Equal(t, "canary-1", tr.Requests()[1].Header.Get("canary"))
+
+	login, err := url.ParseQuery(string(tr.Requests()[2].Body))
+	require.Nil(t, err)
+	require.Equal(t, "isaac.brock@example.com", login.Get("login"))
+	require.Equal(t, "test123", login.Get("passwd"))
+	require.Equal(t, "AQABAAEAAAD-flow-token-1", login.Get("flowToken"))
+
+	kmsi, err := url.ParseQuery(string(tr.Requests()[3].Body))
+	require.Nil(t, err)
+	require.Equal(t, "1", kmsi.Get("LoginOptions"))
+	require.Equal(t, "AQABAAEAAAD-flow-token-6", kmsi.Get("flowToken"))
+}
+
+func TestClient_AuthenticatePushMfa(t *testing.T) {
+
+	tr := replay.New()
+	require.Nil(t, tr.AddFile("GET", exampleLoginPath, 200, "text/html", "example/login.html"))
+	require.Nil(t, tr.AddFile("POST", "/common/GetCredentialType", 200, "application/json", "example/credential-type.json"))
+	require.Nil(t, tr.AddFile("POST", examplePostPath, 200, "text/html", "example/mfa.html"))
+	require.Nil(t, tr.AddFile("POST", "/common/SAS/BeginAuth", 200, "application/json", "example/begin-auth.json"))
+	require.Nil(t, tr.AddFile("POST", "/common/SAS/EndAuth", 200, "application/json", "example/end-auth-pending.json"))
+	require.Nil(t, tr.AddFile("POST", "/common/SAS/EndAuth", 200, "application/json", "example/end-auth-success.json"))
+	require.Nil(t, tr.AddFile("POST", "/common/SAS/ProcessAuth", 200, "text/html", "example/kmsi.html"))
+	require.Nil(t, tr.AddFile("POST", "/kmsi", 200, "text/html", "example/saml.html"))
+
+	ac := newTestClient(t, tr)
+
+	samlAssertion, err := ac.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+
+	poll := map[string]interface{}{}
+	require.Nil(t, json.Unmarshal(tr.Requests()[5].Body, &poll))
+	require.Equal(t, "EndAuth", poll["Method"])
+	require.Equal(t, "AQABAAEAAAD-flow-token-4", poll["FlowToken"])
+	require.Equal(t, float64(2), poll["PollCount"])
+
+	processAuth, err := url.ParseQuery(string(tr.Requests()[6].Body))
+	require.Nil(t, err)
+	require.Equal(t, "PhoneAppNotification", processAuth.Get("mfaAuthMethod"))
+	require.Equal(t, "AQABAAEAAAD-flow-token-5", processAuth.Get("flowToken"))
+}
+
+func TestClient_AuthenticatePushMfaDenied(t *testing.T) {
+
+	tr := replay.New()
+	require.Nil(t, tr.AddFile("GET", exampleLoginPath, 200, "text/html", "example/login.html"))
+	require.Nil(t, tr.AddFile("POST", "/common/GetCredentialType", 200, "application/json", "example/credential-type.json"))
+	require.Nil(t, tr.AddFile("POST", examplePostPath, 200, "text/html", "example/mfa.html"))
+	require.Nil(t, tr.AddFile("POST", "/common/SAS/BeginAuth", 200, "application/json", "example/begin-auth.json"))
+	require.Nil(t, tr.AddFile("POST", "/common/SAS/EndAuth", 200, "application/json", "example/end-auth-denied.json"))
+
+	ac := newTestClient(t, tr)
+
+	_, err := ac.Authenticate(exampleLoginDetails)
+	require.EqualError(t, err, "MFA failed: PhoneAppDenied")
+}
+
+func TestClient_AuthenticateBadPassword(t *testing.T) {
+
+	tr := replay.New()
+	require.Nil(t, tr.AddFile("GET", exampleLoginPath, 200, "text/html", "example/login.html"))
+	require.Nil(t, tr.AddFile("POST", "/common/GetCredentialType", 200, "application/json", "example/credential-type.json"))
+	require.Nil(t, tr.AddFile("POST", examplePostPath, 200, "text/html", "example/bad-password.html"))
+
+	ac := newTestClient(t, tr)
+
+	_, err := ac.Authenticate(exampleLoginDetails)
+	require.EqualError(t, err, "login failed with error 50126: Your account or password is incorrect.")
+}
+
+func TestClient_AuthenticateFederated(t *testing.T) {
+
+	tr := replay.New()
+	require.Nil(t, tr.AddFile("GET", exampleLoginPath, 200, "text/html", "example/login.html"))
+	require.Nil(t, tr.AddFile("POST", "/common/GetCredentialType", 200, "application/json", "example/credential-type-federated.json"))
+
+	ac := newTestClient(t, tr)
+
+	_, err := ac.Authenticate(exampleLoginDetails)
+	require.EqualError(t, err, "isaac.brock@example.com is federated to https://adfs.example.com/adfs/ls/?username=isaac.brock%40example.com which isn't supported")
+}
@@ -3,11 +3,11 @@ package adfs
 import (
 	"crypto/tls"
 	"fmt"
-	"log"
 	"net/http"
 	"net/url"
 	"strings"
 
+	"github.com/Azure/go-ntlmssp"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -27,23 +27,26 @@ type Client struct {
 	prompter   prompter.Prompter
 }
 
-// New create a new ADFS client
+// New create a new ADFS client, the transport answers NTLM or Negotiate challenges from servers using windows
+// integrated authentication, other servers are logged into using their form
 func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
-	tr := &http.Transport{
-		Proxy:           http.ProxyFromEnvironment,
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: idpAccount.SkipVerify, Renegotiation: tls.RenegotiateFreelyAsClient},
+	tr := &ntlmssp.Negotiator{
+		RoundTripper: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: idpAccount.SkipVerify, Renegotiation: tls.RenegotiateFreelyAsClient},
+		},
 	}
 
-	client, err := provider.NewHTTPClient(tr)
+	client, err := provider.NewHTTPClientForAccount(tr, idpAccount)
 	if err != nil {
-		return nil, errors.Wrap(err, "error building http client")
+		return nil, err
 	}
 
 	return &Client{
 		client:     client,
 		idpAccount: idpAccount,
-		prompter:   prompter.NewCli(),
+		prompter:   prompter.ActivePrompter,
 	}, nil
 }
 
@@ -55,16 +58,33 @@ func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 
 	adfsURL := fmt.Sprintf("%s/adfs/ls/IdpInitiatedSignOn.aspx?loginToRp=%s", loginDetails.URL, ac.idpAccount.AmazonWebservicesURN)
 
-	res, err := ac.client.Get(adfsURL)
+	req, err := http.NewRequest("GET", adfsURL, nil)
+	if err != nil {
+		return samlAssertion, errors.Wrap(err, "error building form request")
+	}
+
+	// the credentials are only sent by the transport when the server challenges with NTLM or Negotiate
+	req.SetBasicAuth(ntlmUsername(loginDetails.Username, ac.idpAccount.ADFSDomain), loginDetails.Password)
+
+	res, err := ac.client.Do(req)
 	if err != nil {
 		return samlAssertion, errors.Wrap(err, "error retieving form")
 	}
 
-	doc, err := goquery.NewDocumentFromResponse(res)
+	if res.StatusCode == http.StatusUnauthorized {
+		return samlAssertion, fmt.Errorf("windows integrated authentication to ADFS failed (%s), check the username, password and domain", res.Header.Get("WWW-Authenticate"))
+	}
+
+	doc, err := provider.NewDocumentFromResponse(res)
 	if err != nil {
 		return samlAssertion, errors.Wrap(err, "failed to build document from response")
 	}
 
+	// windows integrated authentication goes straight to the SAML response
+	if samlAssertion, err := provider.ExtractSAMLResponse(doc); err != provider.ErrSAMLResponseNotFound {
+		return samlAssertion, err
+	}
+
 	authForm := url.Values{}
 
 	doc.Find("input").Each(func(i int, s *goquery.Selection) {
@@ -85,7 +105,7 @@ func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 
 	//log.Printf("id authentication url: %s", authSubmitURL)
 
-	req, err := http.NewRequest("POST", authSubmitURL, strings.NewReader(authForm.Encode()))
+	req, err = http.NewRequest("POST", authSubmitURL, strings.NewReader(authForm.Encode()))
 	if err != nil {
 		return samlAssertion, errors.Wrap(err, "error building authentication request")
 	}
@@ -111,33 +131,19 @@ func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 	}
 
 	// just parse the response whether res is from the login form or MFA form
-	doc, err = goquery.NewDocumentFromResponse(res)
+	doc, err = provider.NewDocumentFromResponse(res)
 	if err != nil {
 		return samlAssertion, errors.Wrap(err, "error retrieving login response body")
 	}
 
-	doc.Find("input").Each(func(i int, s *goquery.Selection) {
-		name, ok := s.Attr("name")
-		if !ok {
-			log.Fatalf("unable to locate IDP authentication form submit URL")
-		}
-		if name == "SAMLResponse" {
-			val, ok := s.Attr("value")
-			if !ok {
-				log.Fatalf("unable to locate saml assertion value")
-			}
-			samlAssertion = val
-		}
-	})
-
-	return samlAssertion, nil
+	return provider.ExtractSAMLResponse(doc)
 }
 
 // vipMFA when supplied with the the form response document attempt to extract the VIP mfa related field
 // then use that to trigger a submit of the MFA security token
 func (ac *Client) vipMFA(authSubmitURL string, res *http.Response) (*http.Response, error) {
 
-	doc, err := goquery.NewDocumentFromResponse(res)
+	doc, err := provider.NewDocumentFromResponse(res)
 	if err != nil {
 		return nil, errors.Wrap(err, "error retrieving saml response body")
 	}
@@ -183,6 +189,16 @@ func (ac *Client) vipMFA(authSubmitURL string, res *http.Response) (*http.Respon
 	return res, nil
 }
 
+// ntlmUsername qualify the username with the domain for NTLM, unless it already includes one either as
+// DOMAIN\user or as a user principal name
+func ntlmUsername(username, domain string) string {
+	if domain == "" || strings.ContainsAny(username, `\@`) {
+		return username
+	}
+
+	return domain + `\` + username
+}
+
 func updateFormData(authForm url.Values, s *goquery.Selection, user *creds.LoginDetails) {
 	name, ok := s.Attr("name")
 	//	log.Printf("name = %s ok = %v", name, ok)
@@ -0,0 +1,35 @@
+package adfs
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+)
+
+func TestNtlmUsername(t *testing.T) {
+	require.Equal(t, "user", ntlmUsername("user", ""))
+	require.Equal(t, `EXAMPLE\user`, ntlmUsername("user", "EXAMPLE"))
+	require.Equal(t, `OTHER\user`, ntlmUsername(`OTHER\user`, "EXAMPLE"))
+	require.Equal(t, "user@example.com", ntlmUsername("user@example.com", "EXAMPLE"))
+}
+
+func TestAuthenticateIntegrated(t *testing.T) {
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/adfs/ls/IdpInitiatedSignOn.aspx", r.URL.Path)
+		fmt.Fprint(w, `<html><body><form method="POST" action="https://signin.aws.amazon.com/saml"><input type="hidden" name="SAMLResponse" value="PHNhbWxwOlJlc3BvbnNlLz4=" /></form></body></html>`)
+	}))
+	defer ts.Close()
+
+	ac, err := New(&cfg.IDPAccount{SkipVerify: true, AmazonWebservicesURN: "urn:amazon:webservices"})
+	require.Nil(t, err)
+
+	samlAssertion, err := ac.Authenticate(&creds.LoginDetails{URL: ts.URL, Username: "user", Password: "test123"})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlLz4=", samlAssertion)
+}
@@ -0,0 +1,250 @@
+package auth0
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/dump"
+	"github.com/versent/saml2aws/pkg/prompter"
+	"github.com/versent/saml2aws/pkg/provider"
+)
+
+// defaultConnection the database connection Auth0 creates for each tenant, used when the login page doesn't name one
+const defaultConnection = "Username-Password-Authentication"
+
+var logger = logrus.WithField("provider", "auth0")
+
+// configPattern the login page passes its settings to Lock as base64 encoded json
+var configPattern = regexp.MustCompile(`atob\('([^']+)'\)`)
+
+// Client wrapper around Auth0
+type Client struct {
+	client       *provider.HTTPClient
+	prompter     prompter.Prompter
+	pollInterval time.Duration
+}
+
+// loginConfig the settings the Auth0 login page passes to Lock
+type loginConfig struct {
+	ClientID    string `json:"clientID"`
+	CallbackURL string `json:"callbackURL"`
+	Tenant      string `json:"auth0Tenant"`
+	ExtraParams struct {
+		Protocol     string `json:"protocol"`
+		ResponseType string `json:"response_type"`
+		Connection   string `json:"connection"`
+		Csrf         string `json:"_csrf"`
+		IntState     string `json:"_intstate"`
+		State        string `json:"state"`
+	} `json:"extraParams"`
+}
+
+// loginRequest the credentials posted to /usernamepassword/login
+type loginRequest struct {
+	ClientID     string `json:"client_id"`
+	RedirectURI  string `json:"redirect_uri"`
+	Tenant       string `json:"tenant"`
+	ResponseType string `json:"response_type"`
+	Connection   string `json:"connection"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	Protocol     string `json:"protocol"`
+	Csrf         string `json:"_csrf"`
+	IntState     string `json:"_intstate"`
+	State        string `json:"state"`
+	SSO          bool   `json:"sso"`
+}
+
+// New create a new Auth0 client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
+
+	client, err := provider.NewHTTPClientForAccount(tr, idpAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		client:       client,
+		prompter:     prompter.ActivePrompter,
+		pollInterval: 2 * time.Second,
+	}, nil
+}
+
+// Authenticate logs into Auth0 and returns a SAML response
+func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	res, err := ac.client.Get(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	logger.WithField("status", res.StatusCode).WithField("url", loginDetails.URL).WithField("res", dump.ResponseString(res)).Debug("GET")
+
+	loginPage, err := provider.ReadPage(res)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	config, err := extractConfig(loginPage)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing login page")
+	}
+
+	current, err := ac.postLogin(loginPage, config, loginDetails)
+	if err != nil {
+		return "", err
+	}
+
+	// the credentials are exchanged for the assertion by posting the hidden callback form
+	current, err = ac.postHiddenForm(current)
+	if err != nil {
+		return "", errors.Wrap(err, "error posting login callback")
+	}
+
+	if samlAssertion, err := current.ExtractSAMLResponse(); err != provider.ErrSAMLResponseNotFound {
+		return samlAssertion, err
+	}
+
+	guardian, ok := extractGuardianConfig(current)
+	if !ok {
+		return "", errors.New("unable to locate SAMLResponse")
+	}
+
+	current, err = ac.verifyGuardian(current, guardian, loginDetails)
+	if err != nil {
+		return "", err
+	}
+
+	samlAssertion, err := current.ExtractSAMLResponse()
+	if err == provider.ErrSAMLResponseNotFound {
+		return "", errors.New("unable to locate SAMLResponse after completing MFA")
+	}
+
+	return samlAssertion, err
+}
+
+// postLogin post the credentials along with the state issued by the login page
+func (ac *Client) postLogin(loginPage *provider.Page, config *loginConfig, loginDetails *creds.LoginDetails) (*provider.Page, error) {
+
+	connection := config.ExtraParams.Connection
+	if connection == "" {
+		connection = defaultConnection
+	}
+
+	data, err := json.Marshal(&loginRequest{
+		ClientID:     config.ClientID,
+		RedirectURI:  config.CallbackURL,
+		Tenant:       config.Tenant,
+		ResponseType: config.ExtraParams.ResponseType,
+		Connection:   connection,
+		Username:     loginDetails.Username,
+		Password:     loginDetails.Password,
+		Protocol:     config.ExtraParams.Protocol,
+		Csrf:         config.ExtraParams.Csrf,
+		IntState:     config.ExtraParams.IntState,
+		State:        config.ExtraParams.State,
+		SSO:          true,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error encoding login request")
+	}
+
+	loginURL, err := loginPage.URL.Parse("/usernamepassword/login")
+	if err != nil {
+		return nil, errors.Wrap(err, "error building login url")
+	}
+
+	req, err := http.NewRequest("POST", loginURL.String(), bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building login request")
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+
+	res, err := ac.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving login response")
+	}
+
+	logger.WithField("status", res.StatusCode).WithField("url", loginURL).WithField("res", dump.ResponseString(res)).Debug("POST")
+
+	current, err := provider.ReadPage(res)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving login response")
+	}
+
+	if res.StatusCode != http.StatusOK {
+		description := gjson.GetBytes(current.Data, "description").String()
+		if description == "" {
+			description = res.Status
+		}
+		return nil, fmt.Errorf("login failed: %s", description)
+	}
+
+	return current, nil
+}
+
+// postHiddenForm submit the form which the page would submit automatically, such as the callback
+// holding the wa, wresult and wctx fields
+func (ac *Client) postHiddenForm(current *provider.Page) (*provider.Page, error) {
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(current.Data))
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing page")
+	}
+
+	form := doc.Find("form").First()
+	if form.Length() == 0 {
+		return nil, errors.New("unable to locate form")
+	}
+
+	action, _ := form.Attr("action")
+
+	values := url.Values{}
+
+	form.Find("input").Each(func(i int, s *goquery.Selection) {
+		if name, ok := s.Attr("name"); ok {
+			val, _ := s.Attr("value")
+			values.Set(name, val)
+		}
+	})
+
+	return ac.client.SubmitForm(current.URL, action, values)
+}
+
+// extractConfig decode the settings passed to Lock by the login page
+func extractConfig(p *provider.Page) (*loginConfig, error) {
+
+	match := configPattern.FindSubmatch(p.Data)
+	if match == nil {
+		return nil, errors.New("unable to locate login config in page")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(string(match[1]))
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding login config")
+	}
+
+	config := new(loginConfig)
+
+	err = json.Unmarshal(data, config)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding login config")
+	}
+
+	return config, nil
+}
@@ -0,0 +1,260 @@
+package auth0
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/dump"
+	"github.com/versent/saml2aws/pkg/provider"
+)
+
+const (
+	// maxPollAttempts the number of times the push notification is polled before giving up
+	maxPollAttempts = 60
+
+	guardianPush = "push"
+	guardianOTP  = "otp"
+)
+
+// guardianOptions the labels shown when choosing a Guardian authentication method
+var guardianOptions = map[string]string{
+	guardianPush: "Guardian push notification",
+	guardianOTP:  "One-time password",
+}
+
+var (
+	requestTokenPattern  = regexp.MustCompile(`"requestToken"\s*:\s*"([^"]+)"`)
+	postActionURLPattern = regexp.MustCompile(`"postActionURL"\s*:\s*"([^"]+)"`)
+	mfaServerURLPattern  = regexp.MustCompile(`"mfaServerUrl"\s*:\s*"([^"]+)"`)
+)
+
+// guardianConfig the settings the Auth0 MFA page passes to the Guardian widget
+type guardianConfig struct {
+	RequestToken  string
+	PostActionURL string
+	MfaServerURL  string
+}
+
+// startFlowResponse the transaction started with the Guardian server
+type startFlowResponse struct {
+	TransactionToken string `json:"transaction_token"`
+	DeviceAccount    struct {
+		Methods []string `json:"available_authentication_methods"`
+	} `json:"device_account"`
+}
+
+// transactionState the state of the Guardian transaction, the token is the signature posted back to Auth0
+type transactionState struct {
+	State string `json:"state"`
+	Token string `json:"token"`
+}
+
+// verifyGuardian complete the Guardian MFA with a push notification or one-time password and post the
+// resulting signature back to Auth0
+func (ac *Client) verifyGuardian(current *provider.Page, config *guardianConfig, loginDetails *creds.LoginDetails) (*provider.Page, error) {
+
+	flow := new(startFlowResponse)
+
+	_, err := ac.postGuardian(config, "/api/start-flow", config.RequestToken, map[string]string{"state_transport": "polling"}, flow)
+	if err != nil {
+		return nil, errors.Wrap(err, "error starting guardian flow")
+	}
+
+	method, err := ac.selectGuardianMethod(flow.DeviceAccount.Methods, loginDetails)
+	if err != nil {
+		return nil, err
+	}
+
+	var signature string
+
+	switch method {
+	case guardianPush:
+		signature, err = ac.verifyGuardianPush(config, flow.TransactionToken)
+	case guardianOTP:
+		signature, err = ac.verifyGuardianOTP(config, flow.TransactionToken, loginDetails)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := ac.client.SubmitForm(current.URL, config.PostActionURL, url.Values{"signature": {signature}})
+	if err != nil {
+		return nil, errors.Wrap(err, "error posting guardian signature")
+	}
+
+	return next, nil
+}
+
+// selectGuardianMethod use a one-time password when one was supplied, otherwise prompt when the user has
+// enrolled more than one method
+func (ac *Client) selectGuardianMethod(methods []string, loginDetails *creds.LoginDetails) (string, error) {
+
+	options := []string{}
+	for _, method := range methods {
+		if _, ok := guardianOptions[method]; ok {
+			options = append(options, method)
+		}
+	}
+
+	switch {
+	case len(options) == 0:
+		return "", fmt.Errorf("no supported guardian authentication method in %v", methods)
+	case len(options) == 1:
+		return options[0], nil
+	case loginDetails.MFAToken != "":
+		return guardianOTP, nil
+	}
+
+	labels := make([]string, len(options))
+	for i, option := range options {
+		labels[i] = guardianOptions[option]
+	}
+
+	index, ok, err := provider.MFAIndex(len(labels))
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return options[index], nil
+	}
+
+	index, err = provider.ChoiceIndex(labels, ac.prompter.Choice("Select a Guardian MFA option", labels))
+	if err != nil {
+		return "", errors.Wrap(err, "error selecting Guardian MFA option")
+	}
+
+	return options[index], nil
+}
+
+func (ac *Client) verifyGuardianPush(config *guardianConfig, transactionToken string) (string, error) {
+
+	_, err := ac.postGuardian(config, "/api/send-push-notification", transactionToken, nil, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "error sending push notification")
+	}
+
+	fmt.Fprintf(provider.Output, "\nWaiting for approval, please check your Guardian app ...")
+
+	for poll := 1; poll <= maxPollAttempts; poll++ {
+
+		time.Sleep(ac.pollInterval)
+
+		state := new(transactionState)
+
+		_, err = ac.postGuardian(config, "/api/transaction-state", transactionToken, nil, state)
+		if err != nil {
+			return "", errors.Wrap(err, "error polling guardian transaction")
+		}
+
+		switch state.State {
+		case "accepted":
+			fmt.Fprintf(provider.Output, " Approved\n\n")
+			return state.Token, nil
+		case "rejected":
+			fmt.Fprintf(provider.Output, " Rejected\n")
+			return "", errors.New("MFA rejected")
+		}
+
+		fmt.Fprintf(provider.Output, ".")
+	}
+
+	fmt.Fprintf(provider.Output, " Timeout\n")
+
+	return "", errors.New("User did not accept MFA in time")
+}
+
+func (ac *Client) verifyGuardianOTP(config *guardianConfig, transactionToken string, loginDetails *creds.LoginDetails) (string, error) {
+
+	code := loginDetails.MFAToken
+	if code == "" {
+		code = ac.prompter.RequestSecurityCode("000000")
+	}
+
+	status, err := ac.postGuardian(config, "/api/verify-otp", transactionToken, map[string]string{"type": "manual_input", "code": code}, nil)
+	if err != nil {
+		if status == http.StatusForbidden || status == http.StatusBadRequest {
+			return "", errors.New("invalid one-time password")
+		}
+		return "", errors.Wrap(err, "error verifying one-time password")
+	}
+
+	state := new(transactionState)
+
+	_, err = ac.postGuardian(config, "/api/transaction-state", transactionToken, nil, state)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving guardian transaction")
+	}
+
+	if state.State != "accepted" {
+		return "", fmt.Errorf("MFA not accepted, state: %s", state.State)
+	}
+
+	return state.Token, nil
+}
+
+// postGuardian post to the Guardian api authorized with the token, decoding any response into out
+func (ac *Client) postGuardian(config *guardianConfig, path, token string, body interface{}, out interface{}) (int, error) {
+
+	data := []byte("{}")
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return 0, errors.Wrap(err, "error encoding request")
+		}
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimSuffix(config.MfaServerURL, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return 0, errors.Wrap(err, "error building request")
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Authorization", "Bearer "+token)
+
+	res, err := ac.client.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "error retrieving response")
+	}
+	defer res.Body.Close()
+
+	logger.WithField("status", res.StatusCode).WithField("url", req.URL).WithField("res", dump.ResponseString(res)).Debug("POST")
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNoContent {
+		return res.StatusCode, fmt.Errorf("unexpected status %s from %s", res.Status, req.URL)
+	}
+
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		return res.StatusCode, nil
+	}
+
+	return res.StatusCode, json.NewDecoder(res.Body).Decode(out)
+}
+
+// extractGuardianConfig locate the settings passed to the Guardian widget, which is only on the MFA page
+func extractGuardianConfig(p *provider.Page) (*guardianConfig, bool) {
+
+	config := &guardianConfig{}
+
+	for pattern, field := range map[*regexp.Regexp]*string{
+		requestTokenPattern:  &config.RequestToken,
+		postActionURLPattern: &config.PostActionURL,
+		mfaServerURLPattern:  &config.MfaServerURL,
+	} {
+		match := pattern.FindSubmatch(p.Data)
+		if match == nil {
+			return nil, false
+		}
+		*field = string(match[1])
+	}
+
+	return config, true
+}
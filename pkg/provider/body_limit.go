@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"fmt"
+	"io"
+)
+
+// BodyTooLargeError returned when reading a response body larger than the limit of the client
+type BodyTooLargeError struct {
+	URL   string
+	Limit int64
+}
+
+func (e BodyTooLargeError) Error() string {
+	return fmt.Sprintf("the response from %s is larger than the limit of %d bytes", e.URL, e.Limit)
+}
+
+// limitedBody a response body which fails once more than the limit has been read, rather than truncating it
+// which could be mistaken for a complete page
+type limitedBody struct {
+	io.ReadCloser
+	url       string
+	limit     int64
+	remaining int64
+}
+
+func (lb *limitedBody) Read(p []byte) (int, error) {
+	if lb.remaining <= 0 {
+		// the body may end exactly at the limit
+		var b [1]byte
+		n, err := lb.ReadCloser.Read(b[:])
+		if n > 0 {
+			return 0, BodyTooLargeError{URL: lb.url, Limit: lb.limit}
+		}
+		return 0, err
+	}
+
+	if int64(len(p)) > lb.remaining {
+		p = p[:lb.remaining]
+	}
+
+	n, err := lb.ReadCloser.Read(p)
+	lb.remaining -= int64(n)
+
+	return n, err
+}
+
+// SetMaxBodySize fail reading response bodies larger than the size in bytes, a size of zero removes the limit
+func (client *HTTPClient) SetMaxBodySize(size int64) {
+	client.defaultHeaders().maxBodySize = size
+}
@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/provider/replay"
+)
+
+func TestSetMaxBodySize(t *testing.T) {
+
+	page := bytes.Repeat([]byte("a"), 64)
+
+	tr := replay.New().
+		Add("GET", "/", 200, "text/html", page).
+		Add("GET", "/", 200, "text/html", page).
+		Add("GET", "/", 200, "text/html", page)
+
+	client, err := NewHTTPClient(tr)
+	require.Nil(t, err)
+
+	// a body exactly at the limit is read in full
+	client.SetMaxBodySize(64)
+
+	res, err := client.Get("https://idp.example.com/")
+	require.Nil(t, err)
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.Nil(t, err)
+	require.Equal(t, page, body)
+
+	client.SetMaxBodySize(63)
+
+	res, err = client.Get("https://idp.example.com/")
+	require.Nil(t, err)
+
+	_, err = ioutil.ReadAll(res.Body)
+	require.Equal(t, BodyTooLargeError{URL: "https://idp.example.com/", Limit: 63}, err)
+	require.EqualError(t, err, "the response from https://idp.example.com/ is larger than the limit of 63 bytes")
+
+	client.SetMaxBodySize(0)
+
+	res, err = client.Get("https://idp.example.com/")
+	require.Nil(t, err)
+
+	body, err = ioutil.ReadAll(res.Body)
+	require.Nil(t, err)
+	require.Len(t, body, 64)
+}
@@ -0,0 +1,113 @@
+package browser
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/provider"
+)
+
+const (
+	// DefaultTimeout how long to wait for the login to be completed in the browser
+	DefaultTimeout = 5 * time.Minute
+
+	// callbackPath the path of the local ACS the IdP posts the SAML response to
+	callbackPath = "/saml"
+
+	// callbackPlaceholder replaced in the login url with the escaped url of the local ACS, for IdPs which
+	// accept the ACS as a parameter
+	callbackPlaceholder = "{acs}"
+)
+
+var logger = logrus.WithField("provider", "browser")
+
+// Client logs in using the system browser, capturing the SAML response the IdP posts to a server on localhost.
+// This suits IdPs whose login pages rely on javascript, the IdP app must allow the local ACS url.
+type Client struct {
+	port     int
+	timeout  time.Duration
+	openURL  func(string) error
+	complete string
+}
+
+// New create a new browser client, the local ACS listens on the callback port in the account or a random one
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+	return &Client{
+		port:     idpAccount.BrowserCallbackPort,
+		timeout:  DefaultTimeout,
+		openURL:  openURL,
+		complete: "Login complete, you can close this window and return to saml2aws.",
+	}, nil
+}
+
+// Authenticate open the login url in the browser and wait for the IdP to post the SAML response to the local ACS
+func (bc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", bc.port))
+	if err != nil {
+		return "", errors.Wrap(err, "error starting the local ACS")
+	}
+
+	callbackURL := fmt.Sprintf("http://%s%s", listener.Addr().String(), callbackPath)
+
+	assertions := make(chan string, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(callbackPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "the SAML response must be posted", http.StatusMethodNotAllowed)
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, "unable to read the SAML response", http.StatusBadRequest)
+			return
+		}
+
+		samlAssertion := strings.Join(strings.Fields(r.PostForm.Get("SAMLResponse")), "")
+
+		err = provider.ValidateSAMLResponse(samlAssertion)
+		if err != nil {
+			logger.WithError(err).Debug("invalid SAML response posted to the local ACS")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		fmt.Fprintln(w, bc.complete)
+
+		select {
+		case assertions <- samlAssertion:
+		default:
+		}
+	})
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer server.Close()
+
+	loginURL := strings.Replace(loginDetails.URL, callbackPlaceholder, url.QueryEscape(callbackURL), -1)
+
+	fmt.Fprintf(provider.Output, "Complete the login in the browser, the SAML response will be received at %s\n", callbackURL)
+
+	err = bc.openURL(loginURL)
+	if err != nil {
+		logger.WithError(err).Debug("unable to open the browser")
+		fmt.Fprintf(provider.Output, "Unable to open the browser, please open %s\n", loginURL)
+	}
+
+	select {
+	case samlAssertion := <-assertions:
+		return samlAssertion, nil
+	case <-time.After(bc.timeout):
+		return "", fmt.Errorf("the SAML response wasn't received at %s within %v, check the IdP app allows it as an ACS url", callbackURL, bc.timeout)
+	}
+}
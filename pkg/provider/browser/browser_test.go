@@ -0,0 +1,65 @@
+package browser
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+)
+
+func TestAuthenticate(t *testing.T) {
+
+	bc, err := New(&cfg.IDPAccount{})
+	require.Nil(t, err)
+
+	statuses := make(chan int, 3)
+
+	bc.openURL = func(loginURL string) error {
+		u, err := url.Parse(loginURL)
+		require.Nil(t, err)
+
+		callbackURL := u.Query().Get("acs")
+
+		go func() {
+			res, err := http.Get(callbackURL)
+			require.Nil(t, err)
+			statuses <- res.StatusCode
+
+			for _, value := range []string{"U2Vzc2lvbiBleHBpcmVk", "PHNhbWxwOlJl\nc3BvbnNlLz4="} {
+				res, err = http.PostForm(callbackURL, url.Values{"SAMLResponse": {value}})
+				require.Nil(t, err)
+				statuses <- res.StatusCode
+			}
+		}()
+
+		return nil
+	}
+
+	samlAssertion, err := bc.Authenticate(&creds.LoginDetails{URL: "https://idp.example.com/sso?acs={acs}"})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlLz4=", samlAssertion)
+
+	require.Equal(t, http.StatusMethodNotAllowed, <-statuses)
+	require.Equal(t, http.StatusBadRequest, <-statuses)
+	require.Equal(t, http.StatusOK, <-statuses)
+}
+
+func TestAuthenticateTimeout(t *testing.T) {
+
+	bc, err := New(&cfg.IDPAccount{})
+	require.Nil(t, err)
+
+	bc.timeout = 10 * time.Millisecond
+	bc.openURL = func(string) error {
+		return errors.New("no browser")
+	}
+
+	_, err = bc.Authenticate(&creds.LoginDetails{URL: "https://idp.example.com/sso"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "the SAML response wasn't received at http://127.0.0.1:")
+}
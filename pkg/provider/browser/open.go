@@ -0,0 +1,9 @@
+// +build !darwin,!windows
+
+package browser
+
+import "os/exec"
+
+func openURL(u string) error {
+	return exec.Command("xdg-open", u).Start()
+}
@@ -0,0 +1,7 @@
+package browser
+
+import "os/exec"
+
+func openURL(u string) error {
+	return exec.Command("open", u).Start()
+}
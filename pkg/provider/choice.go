@@ -0,0 +1,15 @@
+package provider
+
+import "fmt"
+
+// ChoiceIndex the position of the option chosen with a prompter, it is an error for the choice not to be one of
+// the options, such as when a prompter set with SetPrompter answers with something else
+func ChoiceIndex(options []string, choice string) (int, error) {
+	for i, option := range options {
+		if option == choice {
+			return i, nil
+		}
+	}
+
+	return -1, fmt.Errorf("%q isn't one of the options", choice)
+}
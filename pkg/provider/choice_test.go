@@ -0,0 +1,21 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChoiceIndex(t *testing.T) {
+
+	options := []string{"OKTA PUSH", "OKTA TOTP"}
+
+	index, err := ChoiceIndex(options, "OKTA TOTP")
+	require.Nil(t, err)
+	require.Equal(t, 1, index)
+
+	// an unknown choice isn't taken to be the first option
+	index, err = ChoiceIndex(options, "SMS")
+	require.EqualError(t, err, `"SMS" isn't one of the options`)
+	require.Equal(t, -1, index)
+}
@@ -0,0 +1,216 @@
+package provider
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+)
+
+// DefaultCookieFile the default path of the file used to persist cookies between invocations
+const DefaultCookieFile = "~/.saml2aws-cookies"
+
+// cookieFileMode cookies may hold session or device tokens so only the owner can read them
+const cookieFileMode = 0600
+
+// LoadCookies load the cookies previously saved for the host of the url into the jar, a missing file is not an error
+func LoadCookies(path string, jar http.CookieJar, u *url.URL) error {
+
+	saved, err := readCookieFile(path)
+	if err != nil {
+		return err
+	}
+
+	cookies, ok := saved[u.Host]
+	if !ok {
+		return nil
+	}
+
+	jar.SetCookies(u, unexpiredCookies(cookies, time.Now()))
+
+	return nil
+}
+
+// SaveCookies save the cookies held in the jar for the host of the url, merging them with those saved for other hosts.
+// The expiry, domain, path and flags of the cookies are only known for the jars of the clients built by this package,
+// the cookies of other jars are saved as session cookies.
+func SaveCookies(path string, jar http.CookieJar, u *url.URL) error {
+
+	saved, err := readCookieFile(path)
+	if err != nil {
+		return err
+	}
+
+	cookies := jar.Cookies(u)
+	if recorder, ok := jar.(*recordingJar); ok {
+		cookies = recorder.recorded(u)
+	}
+
+	saved[u.Host] = unexpiredCookies(cookies, time.Now())
+
+	return writeCookieFile(path, saved)
+}
+
+// ClearCookies remove the cookies saved for the host of the url, leaving those saved for other hosts
+func ClearCookies(path string, u *url.URL) error {
+
+	saved, err := readCookieFile(path)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := saved[u.Host]; !ok {
+		return nil
+	}
+
+	delete(saved, u.Host)
+
+	return writeCookieFile(path, saved)
+}
+
+// recordingJar a cookie jar which keeps the attributes of the cookies set from responses, as the jar only returns
+// their names and values, so they can be saved with their expiry, domain, path and flags
+type recordingJar struct {
+	http.CookieJar
+
+	mu      sync.Mutex
+	cookies map[string][]*http.Cookie // the cookies set by each host
+}
+
+func newRecordingJar(jar http.CookieJar) *recordingJar {
+	return &recordingJar{CookieJar: jar, cookies: map[string][]*http.Cookie{}}
+}
+
+func (j *recordingJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.CookieJar.SetCookies(u, cookies)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+
+	for _, cookie := range cookies {
+		recorded := *cookie
+
+		// a relative max age is kept as the time it expires, so it still applies once the cookie is reloaded
+		if recorded.MaxAge > 0 {
+			recorded.Expires = now.Add(time.Duration(recorded.MaxAge) * time.Second)
+			recorded.MaxAge = 0
+		}
+		recorded.Raw = ""
+		recorded.RawExpires = ""
+		recorded.Unparsed = nil
+
+		kept := []*http.Cookie{}
+		for _, existing := range j.cookies[u.Host] {
+			if existing.Name != recorded.Name || existing.Domain != recorded.Domain || existing.Path != recorded.Path {
+				kept = append(kept, existing)
+			}
+		}
+
+		// a negative max age or an expiry in the past deletes the cookie
+		if recorded.MaxAge == 0 && (recorded.Expires.IsZero() || recorded.Expires.After(now)) {
+			kept = append(kept, &recorded)
+		}
+
+		j.cookies[u.Host] = kept
+	}
+}
+
+// recorded the cookies set for the host of the url, or for a domain it is in, which the jar still holds
+func (j *recordingJar) recorded(u *url.URL) []*http.Cookie {
+	held := map[string]bool{}
+	for _, cookie := range j.CookieJar.Cookies(u) {
+		held[cookie.Name] = true
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	cookies := []*http.Cookie{}
+	for host, hostCookies := range j.cookies {
+		for _, cookie := range hostCookies {
+			if !held[cookie.Name] {
+				continue
+			}
+			if host == u.Host || (cookie.Domain != "" && domainMatch(u.Hostname(), cookie.Domain)) {
+				cookies = append(cookies, cookie)
+			}
+		}
+	}
+
+	return cookies
+}
+
+// domainMatch whether the host is the domain of a cookie or one of its subdomains
+func domainMatch(host, domain string) bool {
+	domain = strings.TrimPrefix(strings.ToLower(domain), ".")
+	host = strings.ToLower(host)
+
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// unexpiredCookies drop the cookies whose expiry has passed, session cookies don't have one and are kept
+func unexpiredCookies(cookies []*http.Cookie, now time.Time) []*http.Cookie {
+	unexpired := []*http.Cookie{}
+	for _, cookie := range cookies {
+		if cookie.Expires.IsZero() || cookie.Expires.After(now) {
+			unexpired = append(unexpired, cookie)
+		}
+	}
+
+	return unexpired
+}
+
+func writeCookieFile(path string, saved map[string][]*http.Cookie) error {
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return errors.Wrap(err, "error encoding cookies")
+	}
+
+	filename, err := homedir.Expand(path)
+	if err != nil {
+		return errors.Wrap(err, "error expanding cookie file path")
+	}
+
+	err = ioutil.WriteFile(filename, data, cookieFileMode)
+	if err != nil {
+		return errors.Wrap(err, "error writing cookie file")
+	}
+
+	// WriteFile only applies the mode when creating the file
+	return os.Chmod(filename, cookieFileMode)
+}
+
+func readCookieFile(path string) (map[string][]*http.Cookie, error) {
+
+	saved := map[string][]*http.Cookie{}
+
+	filename, err := homedir.Expand(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error expanding cookie file path")
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return saved, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading cookie file")
+	}
+
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding cookie file")
+	}
+
+	return saved, nil
+}
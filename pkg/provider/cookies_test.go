@@ -0,0 +1,163 @@
+package provider
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveAndLoadCookies(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cookieFile := filepath.Join(dir, "cookies")
+	oktaURL := &url.URL{Scheme: "https", Host: "example.okta.com"}
+	duoURL := &url.URL{Scheme: "https", Host: "api-1234abcd.duosecurity.com"}
+
+	jar, err := cookiejar.New(nil)
+	require.Nil(t, err)
+	jar.SetCookies(oktaURL, []*http.Cookie{{Name: "sid", Value: "okta-session"}})
+	jar.SetCookies(duoURL, []*http.Cookie{{Name: "remember", Value: "duo-device"}})
+
+	require.Nil(t, SaveCookies(cookieFile, jar, oktaURL))
+	require.Nil(t, SaveCookies(cookieFile, jar, duoURL))
+
+	info, err := os.Stat(cookieFile)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	loaded, err := cookiejar.New(nil)
+	require.Nil(t, err)
+	require.Nil(t, LoadCookies(cookieFile, loaded, duoURL))
+
+	require.Len(t, loaded.Cookies(oktaURL), 0)
+	require.Equal(t, []*http.Cookie{{Name: "remember", Value: "duo-device"}}, loaded.Cookies(duoURL))
+
+	require.Nil(t, LoadCookies(cookieFile, loaded, oktaURL))
+	require.Equal(t, []*http.Cookie{{Name: "sid", Value: "okta-session"}}, loaded.Cookies(oktaURL))
+}
+
+func TestLoadCookiesMissingFile(t *testing.T) {
+
+	jar, err := cookiejar.New(nil)
+	require.Nil(t, err)
+
+	u := &url.URL{Scheme: "https", Host: "example.okta.com"}
+
+	require.Nil(t, LoadCookies("/nonexistent/saml2aws-cookies", jar, u))
+	require.Len(t, jar.Cookies(u), 0)
+}
+
+func TestClearCookies(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cookieFile := filepath.Join(dir, "cookies")
+	oktaURL := &url.URL{Scheme: "https", Host: "example.okta.com"}
+	duoURL := &url.URL{Scheme: "https", Host: "api-1234abcd.duosecurity.com"}
+
+	jar, err := cookiejar.New(nil)
+	require.Nil(t, err)
+	jar.SetCookies(oktaURL, []*http.Cookie{{Name: "sid", Value: "okta-session"}})
+	jar.SetCookies(duoURL, []*http.Cookie{{Name: "remember", Value: "duo-device"}})
+
+	require.Nil(t, SaveCookies(cookieFile, jar, oktaURL))
+	require.Nil(t, SaveCookies(cookieFile, jar, duoURL))
+
+	require.Nil(t, ClearCookies(cookieFile, oktaURL))
+
+	loaded, err := cookiejar.New(nil)
+	require.Nil(t, err)
+	require.Nil(t, LoadCookies(cookieFile, loaded, oktaURL))
+	require.Nil(t, LoadCookies(cookieFile, loaded, duoURL))
+
+	require.Len(t, loaded.Cookies(oktaURL), 0)
+	require.Len(t, loaded.Cookies(duoURL), 1)
+
+	require.Nil(t, ClearCookies("/nonexistent/saml2aws-cookies", oktaURL))
+}
+
+func TestSaveCookiesKeepsAttributes(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cookieFile := filepath.Join(dir, "cookies")
+	duoURL := &url.URL{Scheme: "https", Host: "api-1234abcd.duosecurity.com"}
+
+	jar, err := NewCookieJar(false)
+	require.Nil(t, err)
+
+	expires := time.Now().Add(30 * 24 * time.Hour).UTC().Truncate(time.Second)
+
+	jar.SetCookies(duoURL, []*http.Cookie{
+		{Name: "remember", Value: "duo-device", Domain: "duosecurity.com", Path: "/", Expires: expires, Secure: true, HttpOnly: true},
+		{Name: "trusted", Value: "duo-browser", MaxAge: 3600},
+		{Name: "session", Value: "duo-session"},
+	})
+
+	require.Nil(t, SaveCookies(cookieFile, jar, duoURL))
+
+	saved, err := readCookieFile(cookieFile)
+	require.Nil(t, err)
+	require.Len(t, saved[duoURL.Host], 3)
+
+	byName := map[string]*http.Cookie{}
+	for _, cookie := range saved[duoURL.Host] {
+		byName[cookie.Name] = cookie
+	}
+
+	require.Equal(t, "duosecurity.com", byName["remember"].Domain)
+	require.Equal(t, "/", byName["remember"].Path)
+	require.True(t, byName["remember"].Secure)
+	require.True(t, byName["remember"].HttpOnly)
+	require.True(t, expires.Equal(byName["remember"].Expires))
+
+	// the max age is kept as the time the cookie expires
+	require.Equal(t, 0, byName["trusted"].MaxAge)
+	require.False(t, byName["trusted"].Expires.IsZero())
+
+	require.True(t, byName["session"].Expires.IsZero())
+}
+
+func TestLoadCookiesSkipsExpired(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cookieFile := filepath.Join(dir, "cookies")
+	duoURL := &url.URL{Scheme: "https", Host: "api-1234abcd.duosecurity.com"}
+
+	require.Nil(t, writeCookieFile(cookieFile, map[string][]*http.Cookie{
+		duoURL.Host: {
+			{Name: "remember", Value: "duo-device", Expires: time.Now().Add(-time.Hour)},
+			{Name: "session", Value: "duo-session"},
+		},
+	}))
+
+	loaded, err := NewCookieJar(false)
+	require.Nil(t, err)
+	require.Nil(t, LoadCookies(cookieFile, loaded, duoURL))
+	require.Equal(t, []*http.Cookie{{Name: "session", Value: "duo-session"}}, loaded.Cookies(duoURL))
+
+	// the expired cookie is dropped from the file when it is saved again
+	require.Nil(t, SaveCookies(cookieFile, loaded, duoURL))
+
+	saved, err := readCookieFile(cookieFile)
+	require.Nil(t, err)
+	require.Len(t, saved[duoURL.Host], 1)
+	require.Equal(t, "session", saved[duoURL.Host][0].Name)
+}
@@ -0,0 +1,96 @@
+package provider
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+)
+
+// maxBodySnippetLength the most of the body included in the error for a response which isn't a page
+const maxBodySnippetLength = 200
+
+// NewDocumentFromResponse parse the page in the response and close its body, when the IdP responds with something
+// other than a page, such as JSON or an empty body, the error includes the content type and a snippet of the body
+// to help identify where the login ended up
+func NewDocumentFromResponse(res *http.Response) (*goquery.Document, error) {
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving body from response")
+	}
+
+	err = CheckHTML(res, body)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing document")
+	}
+
+	if res.Request != nil {
+		doc.Url = res.Request.URL
+	}
+
+	return doc, nil
+}
+
+// CheckHTML return an error describing the response when its body is empty or its content type isn't html, a
+// response without a content type is assumed to be html
+func CheckHTML(res *http.Response, body []byte) error {
+	contentType := res.Header.Get("Content-Type")
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		return fmt.Errorf("expected a page from %s but the response was empty, status: %d content type: %q", responseURL(res), res.StatusCode, contentType)
+	}
+
+	if contentType == "" {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml") {
+		return nil
+	}
+
+	return fmt.Errorf("expected a page from %s but received %q, status: %d body: %q", responseURL(res), contentType, res.StatusCode, bodySnippet(body))
+}
+
+// bodySnippet the leading text of the body with whitespace collapsed and any tokens redacted
+func bodySnippet(body []byte) string {
+	return Snippet(RedactSecrets(string(body)), maxBodySnippetLength)
+}
+
+// Snippet the leading text with whitespace collapsed, cut to at most max characters for including in errors
+func Snippet(text string, max int) string {
+	text = strings.Join(strings.Fields(text), " ")
+
+	// cut on a character boundary so a multi-byte character isn't split
+	runes := []rune(text)
+	if len(runes) > max {
+		return string(runes[:max]) + "..."
+	}
+
+	return text
+}
+
+// responseURL the url requested, without the query which may hold tokens
+func responseURL(res *http.Response) string {
+	if res.Request == nil || res.Request.URL == nil {
+		return "the IdP"
+	}
+
+	u := *res.Request.URL
+	u.RawQuery = ""
+	u.Fragment = ""
+
+	return u.String()
+}
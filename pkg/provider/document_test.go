@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/provider/replay"
+)
+
+func TestNewDocumentFromResponse(t *testing.T) {
+
+	tr := replay.New().
+		Add("GET", "/sso", 200, "text/html; charset=utf-8", []byte("<html><head><title>Sign In</title></head></html>")).
+		Add("GET", "/sso", 200, "", []byte("<html><head><title>Sign In</title></head></html>")).
+		Add("GET", "/sso", 200, "application/json", []byte(`{"errorCode":"E0000011","stateToken":"00abc123"}`)).
+		Add("GET", "/sso", 200, "text/html", []byte(" \n"))
+
+	client, err := NewHTTPClient(tr)
+	require.Nil(t, err)
+
+	for i := 0; i < 2; i++ {
+		res, err := client.Get("https://idp.example.com/sso")
+		require.Nil(t, err)
+
+		doc, err := NewDocumentFromResponse(res)
+		require.Nil(t, err)
+		require.Equal(t, "Sign In", doc.Find("title").Text())
+		require.Equal(t, "https://idp.example.com/sso", doc.Url.String())
+	}
+
+	res, err := client.Get("https://idp.example.com/sso?token=secret")
+	require.Nil(t, err)
+
+	_, err = NewDocumentFromResponse(res)
+	require.EqualError(t, err, `expected a page from https://idp.example.com/sso but received "application/json", status: 200 body: "{\"errorCode\":\"E0000011\",\"stateToken\":\"REDACTED\"}"`)
+
+	res, err = client.Get("https://idp.example.com/sso")
+	require.Nil(t, err)
+
+	_, err = NewDocumentFromResponse(res)
+	require.EqualError(t, err, `expected a page from https://idp.example.com/sso but the response was empty, status: 200 content type: "text/html"`)
+}
+
+func TestSnippet(t *testing.T) {
+	require.Equal(t, "Sign in to continue", Snippet("  Sign in\n\t to   continue ", 200))
+	require.Equal(t, "Sign...", Snippet("Sign in to continue", 4))
+
+	// multi-byte characters aren't split
+	require.Equal(t, "Connexion réu...", Snippet("Connexion réussie", 13))
+}
@@ -0,0 +1,412 @@
+package duo
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/prompter"
+	"github.com/versent/saml2aws/pkg/provider"
+)
+
+var logger = logrus.WithField("provider", "duo")
+
+const (
+	// DefaultPollInterval the time waited between checks of whether a push or phone call was answered
+	DefaultPollInterval = 2 * time.Second
+
+	// maxPollInterval the longest the poll interval backs off to while a push remains unanswered
+	maxPollInterval = 10 * time.Second
+
+	// DefaultPushTimeout the time waited for a push or phone call to be answered before giving up
+	DefaultPushTimeout = 60 * time.Second
+)
+
+// mfaOptions the duo factors which can be selected, keyed by the name used to select them non-interactively
+var mfaOptions = map[string]string{
+	"passcode": "Passcode",
+	"push":     "Duo Push",
+	"phone":    "Phone Call",
+}
+
+// Client drives the Duo Web flow which IdPs embed in their login pages
+type Client struct {
+	client   *provider.HTTPClient
+	prompter prompter.Prompter
+
+	// RememberDevice ask Duo to remember the device, persisting its cookies in CookieFile
+	RememberDevice bool
+	CookieFile     string
+
+	// MFACallback if set supplies the passcode rather than prompting for it
+	MFACallback provider.MFACallback
+
+	// OnStatus if set is passed the progress of the verification, such as waiting for a push, rather than
+	// it being printed
+	OnStatus provider.StatusCallback
+
+	// PollInterval the time waited between checks of whether a push or phone call was answered
+	PollInterval time.Duration
+
+	// PushTimeout the time waited overall for a push or phone call to be answered
+	PushTimeout time.Duration
+
+	// PushFallback prompt for a passcode when a push or phone call isn't answered in time, rather than failing
+	PushFallback bool
+}
+
+// pushTimeoutError returned when a push or phone call isn't answered within the push timeout
+type pushTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e *pushTimeoutError) Error() string {
+	return fmt.Sprintf("Duo push not approved in time, gave up after %s", e.timeout)
+}
+
+// New create a new Duo client sharing the http client, and so the cookies, and the prompter of the IdP client
+func New(client *provider.HTTPClient, prompter prompter.Prompter) *Client {
+	return &Client{
+		client:       client,
+		prompter:     prompter,
+		CookieFile:   provider.DefaultCookieFile,
+		PollInterval: DefaultPollInterval,
+		PushTimeout:  DefaultPushTimeout,
+	}
+}
+
+// splitSignature split the signed request into the TX part sent to Duo and the APP part returned to the IdP
+func splitSignature(duoSignature string) (string, string, error) {
+	parts := strings.Split(duoSignature, ":")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.New("invalid duo signature, expected TX and APP parts separated by a colon")
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// Verify complete the Duo verification for the signed request issued by the IdP, returning the signed
+// response which the IdP expects to be posted back to it as sig_response. The parent is the url of the
+// IdP page which would host the Duo iframe.
+func (dc *Client) Verify(duoHost, duoSignature, parent string, loginDetails *creds.LoginDetails) (string, error) {
+	return dc.VerifyContext(context.Background(), duoHost, duoSignature, parent, loginDetails)
+}
+
+// VerifyContext complete the Duo verification as Verify does, giving up when the context is cancelled, such as
+// when the user cancels the login in an app while waiting for a push. The progress of the push is passed to
+// OnStatus until it is approved, denied or times out. A cancel returns straight away, even mid request, though as
+// the Duo frame has no call to withdraw a push it remains on the device until it expires.
+func (dc *Client) VerifyContext(ctx context.Context, duoHost, duoSignature, parent string, loginDetails *creds.LoginDetails) (string, error) {
+	duoTx, duoApp, err := splitSignature(duoSignature)
+	if err != nil {
+		return "", err
+	}
+
+	duoURL := &url.URL{Scheme: "https", Host: duoHost}
+
+	if dc.RememberDevice {
+		err := provider.LoadCookies(dc.CookieFile, dc.client.Jar, duoURL)
+		if err != nil {
+			logger.WithError(err).Warn("unable to load duo cookies")
+		}
+	}
+
+	// initiate duo mfa to get sid
+	duoSubmitURL := fmt.Sprintf("https://%s/frame/web/v1/auth", duoHost)
+
+	duoForm := url.Values{}
+	duoForm.Add("parent", parent)
+	duoForm.Add("java_version", "")
+	duoForm.Add("java_version", "")
+	duoForm.Add("flash_version", "")
+	duoForm.Add("screen_resolution_width", "3008")
+	duoForm.Add("screen_resolution_height", "1692")
+	duoForm.Add("color_depth", "24")
+
+	req, err := http.NewRequest("POST", duoSubmitURL, strings.NewReader(duoForm.Encode()))
+	if err != nil {
+		return "", errors.Wrap(err, "error building authentication request")
+	}
+	req = req.WithContext(ctx)
+	q := req.URL.Query()
+	q.Add("tx", duoTx)
+	req.URL.RawQuery = q.Encode()
+
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	// only retried when rate limited, as each attempt starts another duo transaction
+	res, err := dc.client.DoWithRateLimitRetry(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving verify response")
+	}
+
+	//try to extract sid, or the cookie when duo has remembered this device
+	doc, err := provider.NewDocumentFromResponse(res)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing document")
+	}
+
+	duoTxCookie, remembered := doc.Find("input[name=\"js_cookie\"]").Attr("value")
+	if remembered {
+		provider.ReportStatus(dc.OnStatus, provider.StatusMFAVerified, "remembered device", "Device remembered by Duo, skipping MFA\n")
+		duoTxCookie = html.UnescapeString(duoTxCookie)
+	} else {
+		duoTxCookie, err = dc.verify(ctx, duoHost, doc, loginDetails)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if dc.RememberDevice {
+		err = provider.SaveCookies(dc.CookieFile, dc.client.Jar, duoURL)
+		if err != nil {
+			logger.WithError(err).Warn("unable to save duo cookies")
+		}
+	}
+
+	return fmt.Sprintf("%s:%s", duoTxCookie, duoApp), nil
+}
+
+// verify prompt the user for the duo factor to use, then wait for it to be verified and return the duo cookie
+func (dc *Client) verify(ctx context.Context, duoHost string, doc *goquery.Document, loginDetails *creds.LoginDetails) (string, error) {
+
+	duoSID, ok := doc.Find("input[name=\"sid\"]").Attr("value")
+	if !ok {
+		return "", errors.New("unable to locate duo sid")
+	}
+	duoSID = html.UnescapeString(duoSID)
+
+	//prompt for mfa type unless one was supplied
+	duoMfaOption, err := dc.selectMfaOption(loginDetails.DuoMFAOption)
+	if err != nil {
+		return "", err
+	}
+
+	var token string
+
+	if duoMfaOption == "Passcode" {
+		token, err = dc.passcode(loginDetails)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	duoTxCookie, err := dc.submitFactor(ctx, duoHost, duoSID, doc, duoMfaOption, token)
+	if _, timedOut := err.(*pushTimeoutError); timedOut && dc.PushFallback {
+		provider.ReportStatus(dc.OnStatus, provider.StatusMFAFailed, err.Error(), "Duo push not approved in time, falling back to a passcode\n")
+
+		token, err = dc.passcode(loginDetails)
+		if err != nil {
+			return "", err
+		}
+
+		return dc.submitFactor(ctx, duoHost, duoSID, doc, "Passcode", token)
+	}
+
+	return duoTxCookie, err
+}
+
+// passcode the users duo passcode, supplied with the login details or by the callback, otherwise prompted for
+func (dc *Client) passcode(loginDetails *creds.LoginDetails) (string, error) {
+	//get users DUO MFA Token
+	token := loginDetails.MFAToken
+	if token == "" && dc.MFACallback != nil {
+		var err error
+		token, err = dc.MFACallback("Passcode")
+		if err != nil {
+			return "", errors.Wrap(err, "error requesting passcode")
+		}
+	}
+	if token == "" {
+		token = dc.prompter.StringRequired("Enter passcode")
+	}
+
+	return token, nil
+}
+
+// submitFactor send the mfa request for the factor then wait for it to be verified, returning the duo cookie
+func (dc *Client) submitFactor(ctx context.Context, duoHost, duoSID string, doc *goquery.Document, duoMfaOption, token string) (string, error) {
+
+	// send mfa auth request
+	duoSubmitURL := fmt.Sprintf("https://%s/frame/prompt", duoHost)
+
+	duoForm := url.Values{}
+	duoForm.Add("sid", duoSID)
+	duoForm.Add("device", "phone1")
+	duoForm.Add("factor", duoMfaOption)
+	duoForm.Add("out_of_date", "false")
+	if duoMfaOption == "Passcode" {
+		duoForm.Add("passcode", token)
+	}
+	if dc.RememberDevice {
+		if doc.Find("input[name=\"dampen_choice\"]").Length() > 0 {
+			duoForm.Add("dampen_choice", "true")
+		} else {
+			logger.Warn("Duo policy does not allow this device to be remembered")
+		}
+	}
+
+	req, err := http.NewRequest("POST", duoSubmitURL, strings.NewReader(duoForm.Encode()))
+	if err != nil {
+		return "", errors.Wrap(err, "error building authentication request")
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := dc.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving verify response")
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body from response")
+	}
+
+	resp := string(body)
+
+	duoTxStat := gjson.Get(resp, "stat").String()
+	duoTxID := gjson.Get(resp, "response.txid").String()
+	if duoTxStat != "OK" {
+		return "", fmt.Errorf("error authenticating mfa device: %s (%s)", gjson.Get(resp, "message").String(), gjson.Get(resp, "message_enum").String())
+	}
+
+	return dc.pollDuoStatus(ctx, duoHost, duoSID, duoTxID)
+}
+
+// pollDuoStatus wait for the factor to be verified, reporting each status duo gives to OnStatus, and return the
+// duo cookie. It gives up when the factor is denied, isn't answered within the push timeout or the context is
+// cancelled.
+func (dc *Client) pollDuoStatus(ctx context.Context, duoHost, duoSID, duoTxID string) (string, error) {
+
+	duoSubmitURL := fmt.Sprintf("https://%s/frame/status", duoHost)
+
+	duoForm := url.Values{}
+	duoForm.Add("sid", duoSID)
+	duoForm.Add("txid", duoTxID)
+
+	interval := dc.PollInterval
+	deadline := time.Now().Add(dc.PushTimeout)
+
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequest("POST", duoSubmitURL, strings.NewReader(duoForm.Encode()))
+		if err != nil {
+			return "", errors.Wrap(err, "error building authentication request")
+		}
+		req = req.WithContext(ctx)
+
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+		// only the first request is retried, after that the poll repeats it anyway
+		var res *http.Response
+		if attempt == 1 {
+			res, err = dc.client.DoWithRetry(req)
+		} else {
+			res, err = dc.client.Do(req)
+		}
+		if err != nil {
+			// a cancel while the status is being checked aborts the request, rather than waiting for its response
+			if ctx.Err() != nil {
+				return "", errors.Wrap(ctx.Err(), "gave up waiting for duo")
+			}
+			return "", errors.Wrap(err, "error retrieving verify response")
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return "", errors.Wrap(err, "error retrieving body from response")
+		}
+
+		resp := string(body)
+
+		dc.reportResult(resp)
+
+		// a passcode is accepted or rejected straight away, a push or phone call is pending until it is answered
+		switch gjson.Get(resp, "response.result").String() {
+		case "SUCCESS":
+			return gjson.Get(resp, "response.cookie").String(), nil
+		case "FAILURE":
+			return "", statusError(resp)
+		}
+
+		if attempt > 1 {
+			interval = nextPollInterval(interval, gjson.Get(resp, "response.status_code").String())
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			return "", &pushTimeoutError{timeout: dc.PushTimeout}
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", errors.Wrap(ctx.Err(), "gave up waiting for duo")
+		case <-time.After(interval):
+		}
+	}
+}
+
+// reportResult report the status duo gave for a factor, which is pending until it succeeds or fails
+func (dc *Client) reportResult(resp string) {
+	status := gjson.Get(resp, "response.status").String()
+
+	stage := provider.StatusPushPending
+	switch gjson.Get(resp, "response.result").String() {
+	case "SUCCESS":
+		stage = provider.StatusMFAVerified
+	case "FAILURE":
+		stage = provider.StatusMFAFailed
+	}
+
+	provider.ReportStatus(dc.OnStatus, stage, status, status+"\n")
+}
+
+// statusError the reason duo gave for rejecting the device, such as the push being denied
+func statusError(resp string) error {
+	return fmt.Errorf("failed to authenticate device: %s (status code: %s)",
+		gjson.Get(resp, "response.status").String(), gjson.Get(resp, "response.status_code").String())
+}
+
+// nextPollInterval back off while the push is still waiting to be answered, to avoid being rate limited
+func nextPollInterval(interval time.Duration, statusCode string) time.Duration {
+	if statusCode != "pushed" {
+		return interval
+	}
+
+	interval += interval / 2
+	if interval > maxPollInterval {
+		return maxPollInterval
+	}
+
+	return interval
+}
+
+// selectMfaOption resolve the duo factor from the supplied option, prompting the user if it is empty
+func (dc *Client) selectMfaOption(option string) (string, error) {
+	if option != "" {
+		duoMfaOption, ok := mfaOptions[strings.ToLower(option)]
+		if !ok {
+			return "", fmt.Errorf("unsupported duo mfa option: %s", option)
+		}
+		return duoMfaOption, nil
+	}
+
+	//only supporting push, phone call or passcode for now
+	options := []string{
+		"Passcode",
+		"Duo Push",
+		"Phone Call",
+	}
+
+	return dc.prompter.Choice("Select a DUO MFA Option", options), nil
+}
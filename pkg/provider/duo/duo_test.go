@@ -0,0 +1,245 @@
+package duo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/mocks"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/provider"
+	"github.com/versent/saml2aws/pkg/provider/replay"
+)
+
+const (
+	exampleDuoAuth   = `<html><body><form><input type="hidden" name="sid" value="exampleSid"></form></body></html>`
+	exampleDuoPrompt = `{"stat":"OK","response":{"txid":"exampleTxid"}}`
+	exampleDuoPushed = `{"stat":"OK","response":{"status_code":"pushed","status":"Pushed a login request to your device..."}}`
+)
+
+func TestSelectMfaOption(t *testing.T) {
+
+	pr := &mocks.Prompter{}
+	pr.Mock.On("Choice", "Select a DUO MFA Option", []string{"Passcode", "Duo Push", "Phone Call"}).Return("Phone Call")
+
+	dc := New(nil, pr)
+
+	option, err := dc.selectMfaOption("push")
+	require.Nil(t, err)
+	require.Equal(t, "Duo Push", option)
+
+	option, err = dc.selectMfaOption("Passcode")
+	require.Nil(t, err)
+	require.Equal(t, "Passcode", option)
+
+	_, err = dc.selectMfaOption("sms")
+	require.Error(t, err)
+
+	option, err = dc.selectMfaOption("")
+	require.Nil(t, err)
+	require.Equal(t, "Phone Call", option)
+}
+
+func TestSplitSignature(t *testing.T) {
+
+	tx, app, err := splitSignature("TX|dHhfc2ln|1516421660:APP|YXBwX3NpZw==|1516425260")
+	require.Nil(t, err)
+	require.Equal(t, "TX|dHhfc2ln|1516421660", tx)
+	require.Equal(t, "APP|YXBwX3NpZw==|1516425260", app)
+
+	for _, sig := range []string{"", "TX|dHhfc2ln|1516421660", "TX|dHhfc2ln|1516421660:", ":APP|YXBwX3NpZw==|1516425260"} {
+		_, _, err = splitSignature(sig)
+		require.EqualError(t, err, "invalid duo signature, expected TX and APP parts separated by a colon", sig)
+	}
+}
+
+func TestVerifyPollsUntilApproved(t *testing.T) {
+
+	tr := replay.New().
+		Add("POST", "/frame/web/v1/auth", 200, "text/html", []byte(exampleDuoAuth)).
+		Add("POST", "/frame/prompt", 200, "application/json", []byte(exampleDuoPrompt)).
+		Add("POST", "/frame/status", 200, "application/json", []byte(exampleDuoPushed)).
+		Add("POST", "/frame/status", 200, "application/json", []byte(exampleDuoPushed)).
+		Add("POST", "/frame/status", 200, "application/json", []byte(`{"stat":"OK","response":{"status_code":"allow","status":"Success. Logging you in...","result":"SUCCESS","cookie":"AUTH|example"}}`))
+
+	client, err := provider.NewHTTPClient(tr)
+	require.Nil(t, err)
+
+	var stages []string
+
+	dc := New(client, &mocks.Prompter{})
+	dc.PollInterval = time.Millisecond
+	dc.OnStatus = func(stage, detail string) {
+		stages = append(stages, stage)
+	}
+
+	sig, err := dc.Verify("api-example.duosecurity.com", "TX|example:APP|example", "https://idp.example.com/", &creds.LoginDetails{DuoMFAOption: "push"})
+	require.Nil(t, err)
+	require.Equal(t, "AUTH|example:APP|example", sig)
+	require.Equal(t, 0, tr.Remaining())
+	require.Equal(t, []string{provider.StatusPushPending, provider.StatusPushPending, provider.StatusMFAVerified}, stages)
+}
+
+func TestVerifyPushDenied(t *testing.T) {
+
+	tr := replay.New().
+		Add("POST", "/frame/web/v1/auth", 200, "text/html", []byte(exampleDuoAuth)).
+		Add("POST", "/frame/prompt", 200, "application/json", []byte(exampleDuoPrompt)).
+		Add("POST", "/frame/status", 200, "application/json", []byte(exampleDuoPushed)).
+		Add("POST", "/frame/status", 200, "application/json", []byte(`{"stat":"OK","response":{"status_code":"deny","status":"Login request denied.","result":"FAILURE"}}`))
+
+	client, err := provider.NewHTTPClient(tr)
+	require.Nil(t, err)
+
+	dc := New(client, &mocks.Prompter{})
+	dc.PollInterval = time.Millisecond
+
+	_, err = dc.Verify("api-example.duosecurity.com", "TX|example:APP|example", "https://idp.example.com/", &creds.LoginDetails{DuoMFAOption: "push"})
+	require.Error(t, err)
+	require.Equal(t, "failed to authenticate device: Login request denied. (status code: deny)", err.Error())
+}
+
+func TestVerifyPromptFailed(t *testing.T) {
+
+	tr := replay.New().
+		Add("POST", "/frame/web/v1/auth", 200, "text/html", []byte(exampleDuoAuth)).
+		Add("POST", "/frame/prompt", 200, "application/json", []byte(`{"stat":"FAIL","message":"Incorrect passcode. Please try again.","message_enum":44}`))
+
+	client, err := provider.NewHTTPClient(tr)
+	require.Nil(t, err)
+
+	dc := New(client, &mocks.Prompter{})
+
+	_, err = dc.Verify("api-example.duosecurity.com", "TX|example:APP|example", "https://idp.example.com/", &creds.LoginDetails{DuoMFAOption: "passcode", MFAToken: "123456"})
+	require.EqualError(t, err, "error authenticating mfa device: Incorrect passcode. Please try again. (44)")
+	require.Equal(t, 0, tr.Remaining())
+}
+
+func TestVerifyContextCancelled(t *testing.T) {
+
+	tr := replay.New().
+		Add("POST", "/frame/web/v1/auth", 200, "text/html", []byte(exampleDuoAuth)).
+		Add("POST", "/frame/prompt", 200, "application/json", []byte(exampleDuoPrompt)).
+		Add("POST", "/frame/status", 200, "application/json", []byte(exampleDuoPushed)).
+		Add("POST", "/frame/status", 200, "application/json", []byte(exampleDuoPushed))
+
+	client, err := provider.NewHTTPClient(tr)
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var details []string
+
+	dc := New(client, &mocks.Prompter{})
+	dc.PollInterval = time.Hour
+	dc.PushTimeout = 2 * time.Hour
+	dc.OnStatus = func(stage, detail string) {
+		details = append(details, detail)
+		cancel()
+	}
+
+	_, err = dc.VerifyContext(ctx, "api-example.duosecurity.com", "TX|example:APP|example", "https://idp.example.com/", &creds.LoginDetails{DuoMFAOption: "push"})
+	require.EqualError(t, err, "gave up waiting for duo: context canceled")
+	require.Equal(t, []string{"Pushed a login request to your device..."}, details)
+	require.Equal(t, 1, tr.Remaining())
+}
+
+func TestNextPollInterval(t *testing.T) {
+	require.Equal(t, 3*time.Second, nextPollInterval(2*time.Second, "pushed"))
+	require.Equal(t, maxPollInterval, nextPollInterval(8*time.Second, "pushed"))
+	require.Equal(t, 2*time.Second, nextPollInterval(2*time.Second, "calling"))
+}
+
+func TestVerifyPushTimeout(t *testing.T) {
+
+	tr := replay.New().
+		Add("POST", "/frame/web/v1/auth", 200, "text/html", []byte(exampleDuoAuth)).
+		Add("POST", "/frame/prompt", 200, "application/json", []byte(exampleDuoPrompt)).
+		Add("POST", "/frame/status", 200, "application/json", []byte(exampleDuoPushed)).
+		Add("POST", "/frame/status", 200, "application/json", []byte(exampleDuoPushed))
+
+	client, err := provider.NewHTTPClient(tr)
+	require.Nil(t, err)
+
+	dc := New(client, &mocks.Prompter{})
+	dc.PollInterval = 10 * time.Millisecond
+	dc.PushTimeout = 20 * time.Millisecond
+
+	_, err = dc.Verify("api-example.duosecurity.com", "TX|example:APP|example", "https://idp.example.com/", &creds.LoginDetails{DuoMFAOption: "push"})
+	require.Error(t, err)
+	require.Equal(t, "Duo push not approved in time, gave up after 20ms", err.Error())
+	require.Equal(t, 0, tr.Remaining())
+}
+
+func TestVerifyPushFallback(t *testing.T) {
+
+	tr := replay.New().
+		Add("POST", "/frame/web/v1/auth", 200, "text/html", []byte(exampleDuoAuth)).
+		Add("POST", "/frame/prompt", 200, "application/json", []byte(exampleDuoPrompt)).
+		Add("POST", "/frame/status", 200, "application/json", []byte(exampleDuoPushed)).
+		Add("POST", "/frame/status", 200, "application/json", []byte(exampleDuoPushed)).
+		Add("POST", "/frame/prompt", 200, "application/json", []byte(exampleDuoPrompt)).
+		Add("POST", "/frame/status", 200, "application/json", []byte(`{"stat":"OK","response":{"status_code":"allow","status":"Success. Logging you in...","result":"SUCCESS","cookie":"AUTH|example"}}`))
+
+	client, err := provider.NewHTTPClient(tr)
+	require.Nil(t, err)
+
+	pr := &mocks.Prompter{}
+	pr.Mock.On("StringRequired", "Enter passcode").Return("123456")
+
+	dc := New(client, pr)
+	dc.PollInterval = 10 * time.Millisecond
+	dc.PushTimeout = 20 * time.Millisecond
+	dc.PushFallback = true
+
+	sig, err := dc.Verify("api-example.duosecurity.com", "TX|example:APP|example", "https://idp.example.com/", &creds.LoginDetails{DuoMFAOption: "push"})
+	require.Nil(t, err)
+	require.Equal(t, "AUTH|example:APP|example", sig)
+	require.Equal(t, 0, tr.Remaining())
+
+	fallback, err := url.ParseQuery(string(tr.Requests()[4].Body))
+	require.Nil(t, err)
+	require.Equal(t, "Passcode", fallback.Get("factor"))
+	require.Equal(t, "123456", fallback.Get("passcode"))
+}
+
+func TestVerifyContextCancelledMidRequest(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// released before the server is closed, as the handler doesn't see the client cancel the request
+	done := make(chan struct{})
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/frame/web/v1/auth":
+			w.Write([]byte(exampleDuoAuth))
+		case "/frame/prompt":
+			w.Write([]byte(exampleDuoPrompt))
+		case "/frame/status":
+			// cancel while duo holds the status request open, as it does while waiting for a push
+			cancel()
+			<-done
+		}
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	client, err := provider.NewHTTPClient(provider.NewDefaultTransport(true))
+	require.Nil(t, err)
+
+	dc := New(client, &mocks.Prompter{})
+
+	start := time.Now()
+
+	_, err = dc.VerifyContext(ctx, strings.TrimPrefix(ts.URL, "https://"), "TX|example:APP|example", "https://idp.example.com/", &creds.LoginDetails{DuoMFAOption: "push"})
+	require.EqualError(t, err, "gave up waiting for duo: context canceled")
+	require.True(t, time.Since(start) < time.Second)
+}
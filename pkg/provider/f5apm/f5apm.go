@@ -0,0 +1,173 @@
+package f5apm
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/dump"
+	"github.com/versent/saml2aws/pkg/provider"
+)
+
+const (
+	// logonFormSelector the logon form APM injects into the access policy
+	logonFormSelector = "form#auth_form"
+
+	// maxLoginSteps the number of pages followed before giving up on finding the assertion
+	maxLoginSteps = 5
+)
+
+var logger = logrus.WithField("provider", "f5apm")
+
+// Client wrapper around F5 BIG-IP APM
+type Client struct {
+	client       *provider.HTTPClient
+	resourcePath string
+}
+
+// New create a new F5 BIG-IP APM client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
+
+	client, err := provider.NewHTTPClientForAccount(tr, idpAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		client:       client,
+		resourcePath: idpAccount.F5ResourcePath,
+	}, nil
+}
+
+// Authenticate logs into F5 BIG-IP APM and returns a SAML response
+func (fc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	resourceURL, err := buildResourceURL(loginDetails.URL, fc.resourcePath)
+	if err != nil {
+		return "", err
+	}
+
+	// requesting the SAML resource redirects to /my.policy which starts the APM session
+	doc, err := fc.get(resourceURL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	loginSubmitted := false
+	resourceRequested := false
+
+	for step := 0; step < maxLoginSteps; step++ {
+
+		if samlAssertion, err := provider.ExtractSAMLResponse(doc); err != provider.ErrSAMLResponseNotFound {
+			return samlAssertion, err
+		}
+
+		switch {
+		case doc.Find(logonFormSelector).Length() > 0:
+			if loginSubmitted {
+				return "", fmt.Errorf("login failed: %s", strings.TrimSpace(doc.Find("#credentials_table_postheader").Text()))
+			}
+			loginSubmitted = true
+			doc, err = fc.postLogonForm(doc, loginDetails)
+			if err != nil {
+				return "", err
+			}
+		case strings.Contains(doc.Text(), "Access was denied by the access policy"):
+			return "", errors.New("access was denied by the APM access policy")
+		case loginSubmitted && !resourceRequested:
+			// the session is established but APM landed on its own page, such as the webtop, so
+			// request the SAML resource again now the MRHSession cookie is set
+			resourceRequested = true
+			doc, err = fc.get(resourceURL)
+			if err != nil {
+				return "", errors.Wrap(err, "error retrieving SAML resource")
+			}
+		default:
+			return "", errors.New("unable to locate SAMLResponse")
+		}
+	}
+
+	return "", errors.New("unable to locate SAMLResponse after completing the access policy")
+}
+
+func (fc *Client) postLogonForm(doc *goquery.Document, loginDetails *creds.LoginDetails) (*goquery.Document, error) {
+
+	form := doc.Find(logonFormSelector).First()
+
+	action, _ := form.Attr("action")
+
+	submitURL, err := doc.Url.Parse(action)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing logon form action")
+	}
+
+	values := url.Values{}
+
+	// keep the hidden fields APM injects, such as vhost
+	form.Find("input").Each(func(i int, s *goquery.Selection) {
+		if name, ok := s.Attr("name"); ok {
+			val, _ := s.Attr("value")
+			values.Set(name, val)
+		}
+	})
+
+	values.Set("username", loginDetails.Username)
+	values.Set("password", loginDetails.Password)
+
+	req, err := http.NewRequest("POST", submitURL.String(), strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building logon request")
+	}
+
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := fc.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error posting logon form")
+	}
+
+	logger.WithField("status", res.StatusCode).WithField("url", submitURL).WithField("res", dump.ResponseString(res)).Debug("POST")
+
+	return provider.NewDocumentFromResponse(res)
+}
+
+func (fc *Client) get(resourceURL string) (*goquery.Document, error) {
+
+	res, err := fc.client.Get(resourceURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving page")
+	}
+
+	logger.WithField("status", res.StatusCode).WithField("url", resourceURL).WithField("res", dump.ResponseString(res)).Debug("GET")
+
+	return provider.NewDocumentFromResponse(res)
+}
+
+// buildResourceURL resolve the path of the SAML resource on the APM virtual server, the url is used as
+// is when no path is configured
+func buildResourceURL(virtualServerURL, resourcePath string) (string, error) {
+
+	if resourcePath == "" {
+		return virtualServerURL, nil
+	}
+
+	base, err := url.Parse(virtualServerURL)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing virtual server url")
+	}
+
+	resourceURL, err := base.Parse(resourcePath)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing resource path")
+	}
+
+	return resourceURL.String(), nil
+}
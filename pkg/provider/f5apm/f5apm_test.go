@@ -0,0 +1,104 @@
+package f5apm
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/provider/replay"
+)
+
+const (
+	exampleURL           = "https://apm.example.com"
+	exampleResourcePath  = "/saml/idp/res?id=/Common/aws-saml-resource"
+	exampleSAMLAssertion = "PHNhbWxwOlJlc3BvbnNlIHhtbG5zOnNhbWxwPSJ1cm46b2FzaXM6bmFtZXM6dGM6U0FNTDoyLjA6cHJvdG9jb2wiLz4="
+)
+
+var exampleLoginDetails = &creds.LoginDetails{URL: exampleURL, Username: "isaac.brock", Password: "test123"}
+
+func newTestClient(t *testing.T, tr *replay.Transport) *Client {
+	fc, err := New(&cfg.IDPAccount{F5ResourcePath: exampleResourcePath})
+	require.Nil(t, err)
+
+	fc.client.Transport = tr
+
+	return fc
+}
+
+func TestBuildResourceURL(t *testing.T) {
+
+	resourceURL, err := buildResourceURL(exampleURL, exampleResourcePath)
+	require.Nil(t, err)
+	require.Equal(t, "https://apm.example.com/saml/idp/res?id=/Common/aws-saml-resource", resourceURL)
+
+	resourceURL, err = buildResourceURL("https://apm.example.com/saml/idp/res?id=/Common/other", "")
+	require.Nil(t, err)
+	require.Equal(t, "https://apm.example.com/saml/idp/res?id=/Common/other", resourceURL)
+}
+
+func TestClient_Authenticate(t *testing.T) {
+
+	logon, err := ioutil.ReadFile("example/logon.html")
+	require.Nil(t, err)
+
+	tr := replay.New().
+		AddResponse(&replay.Response{
+			Method:     "GET",
+			Path:       "/saml/idp/res",
+			StatusCode: 200,
+			Header: http.Header{
+				"Content-Type": []string{"text/html"},
+				"Set-Cookie":   []string{"MRHSession=2b7f41c9e3a8d5f06c1e9b2d7a4f3e58; path=/; secure"},
+			},
+			Body: logon,
+		})
+	require.Nil(t, tr.AddFile("POST", "/my.policy", 200, "text/html", "example/saml.html"))
+
+	fc := newTestClient(t, tr)
+
+	samlAssertion, err := fc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+
+	req := tr.Requests()[1]
+	require.Contains(t, req.Header.Get("Cookie"), "MRHSession=2b7f41c9e3a8d5f06c1e9b2d7a4f3e58")
+
+	logonForm, err := url.ParseQuery(string(req.Body))
+	require.Nil(t, err)
+	require.Equal(t, "isaac.brock", logonForm.Get("username"))
+	require.Equal(t, "test123", logonForm.Get("password"))
+	require.Equal(t, "standard", logonForm.Get("vhost"))
+}
+
+func TestClient_AuthenticateRequestsResourceAfterWebtop(t *testing.T) {
+
+	tr := replay.New()
+	require.Nil(t, tr.AddFile("GET", "/saml/idp/res", 200, "text/html", "example/logon.html"))
+	require.Nil(t, tr.AddFile("POST", "/my.policy", 200, "text/html", "example/webtop.html"))
+	require.Nil(t, tr.AddFile("GET", "/saml/idp/res", 200, "text/html", "example/saml.html"))
+
+	fc := newTestClient(t, tr)
+
+	samlAssertion, err := fc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+	require.Equal(t, "/Common/aws-saml-resource", tr.Requests()[2].URL.Query().Get("id"))
+}
+
+func TestClient_AuthenticateBadPassword(t *testing.T) {
+
+	tr := replay.New()
+	require.Nil(t, tr.AddFile("GET", "/saml/idp/res", 200, "text/html", "example/logon.html"))
+	require.Nil(t, tr.AddFile("POST", "/my.policy", 200, "text/html", "example/bad-logon.html"))
+
+	fc := newTestClient(t, tr)
+
+	_, err := fc.Authenticate(exampleLoginDetails)
+	require.EqualError(t, err, "login failed: The username or password is not correct. Please try again.")
+}
@@ -0,0 +1,212 @@
+package googleapps
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/dump"
+	"github.com/versent/saml2aws/pkg/prompter"
+	"github.com/versent/saml2aws/pkg/provider"
+)
+
+const (
+	// loginFormSelector the form used for both the email and password pages
+	loginFormSelector = "form#gaia_loginform"
+
+	// challengeFormSelector the form used for each 2-step verification challenge
+	challengeFormSelector = "form#challenge"
+
+	// maxChallenges the number of 2-step verification challenges answered before giving up
+	maxChallenges = 3
+)
+
+var logger = logrus.WithField("provider", "googleapps")
+
+// Client wrapper around Google Apps.
+type Client struct {
+	client   *provider.HTTPClient
+	prompter prompter.Prompter
+}
+
+// New create a new Google Apps Client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
+
+	client, err := provider.NewHTTPClientForAccount(tr, idpAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		client:   client,
+		prompter: prompter.ActivePrompter,
+	}, nil
+}
+
+// Authenticate logs into Google Apps and returns a SAML response
+func (gc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	doc, err := gc.get(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	emailURL, emailForm, err := extractForm(doc, loginFormSelector)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing login page")
+	}
+
+	// the assertion is posted by the page at the continue url once the user is signed in
+	continueURL := emailForm.Get("continue")
+
+	emailForm.Set("Email", loginDetails.Username)
+
+	doc, err = gc.post(emailURL, emailForm)
+	if err != nil {
+		return "", errors.Wrap(err, "error posting email")
+	}
+
+	passwordURL, passwordForm, err := extractForm(doc, loginFormSelector)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing password page")
+	}
+
+	passwordForm.Set("Email", loginDetails.Username)
+	passwordForm.Set("Passwd", loginDetails.Password)
+
+	doc, err = gc.post(passwordURL, passwordForm)
+	if err != nil {
+		return "", errors.Wrap(err, "error posting password")
+	}
+
+	if errMsg := strings.TrimSpace(doc.Find("#errormsg_0_Passwd").Text()); errMsg != "" {
+		return "", fmt.Errorf("login failed: %s", errMsg)
+	}
+
+	for i := 0; i < maxChallenges && doc.Find(challengeFormSelector).Length() > 0; i++ {
+		doc, err = gc.answerChallenge(doc)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if samlAssertion, err := extractSAMLResponse(doc); err != provider.ErrSAMLResponseNotFound {
+		return samlAssertion, err
+	}
+
+	if continueURL == "" {
+		return "", errors.New("unable to locate SAMLResponse or continue url")
+	}
+
+	doc, err = gc.get(continueURL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving continue page")
+	}
+
+	return extractSAMLResponse(doc)
+}
+
+// answerChallenge submit the 2-step verification challenge, prompting for a code or waiting for the
+// user to approve the Google prompt on their phone
+func (gc *Client) answerChallenge(doc *goquery.Document) (*goquery.Document, error) {
+
+	challengeURL, challengeForm, err := extractForm(doc, challengeFormSelector)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing challenge page")
+	}
+
+	switch {
+	case doc.Find("input[name=\"Pin\"]").Length() > 0:
+		challengeForm.Set("Pin", gc.prompter.RequestSecurityCode("000000"))
+	case doc.Find("input[name=\"totpPin\"]").Length() > 0:
+		challengeForm.Set("totpPin", gc.prompter.RequestSecurityCode("000000"))
+	case strings.Contains(challengeURL, "/challenge/az/"):
+		// the response is held until the prompt is answered
+		fmt.Fprintln(provider.Output, "Open the Google app and tap \"Yes\" on the prompt to sign in ...")
+	default:
+		return nil, fmt.Errorf("unsupported 2-step verification challenge %s", challengeURL)
+	}
+
+	doc, err = gc.post(challengeURL, challengeForm)
+	if err != nil {
+		return nil, errors.Wrap(err, "error posting challenge response")
+	}
+
+	return doc, nil
+}
+
+func (gc *Client) get(loginURL string) (*goquery.Document, error) {
+
+	res, err := gc.client.Get(loginURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving page")
+	}
+
+	logger.WithField("status", res.StatusCode).WithField("url", loginURL).WithField("res", dump.ResponseString(res)).Debug("GET")
+
+	return provider.NewDocumentFromResponse(res)
+}
+
+func (gc *Client) post(submitURL string, form url.Values) (*goquery.Document, error) {
+
+	req, err := http.NewRequest("POST", submitURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building request")
+	}
+
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := gc.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving response")
+	}
+
+	logger.WithField("status", res.StatusCode).WithField("url", submitURL).WithField("res", dump.ResponseString(res)).Debug("POST")
+
+	return provider.NewDocumentFromResponse(res)
+}
+
+// extractForm locate the form with the selector returning the absolute url it submits to along with
+// the values of its named inputs
+func extractForm(doc *goquery.Document, selector string) (string, url.Values, error) {
+
+	form := doc.Find(selector).First()
+	if form.Length() == 0 {
+		return "", nil, fmt.Errorf("unable to locate %s", selector)
+	}
+
+	action, ok := form.Attr("action")
+	if !ok {
+		return "", nil, fmt.Errorf("unable to locate %s submit url", selector)
+	}
+
+	submitURL, err := doc.Url.Parse(action)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "error parsing %s submit url", selector)
+	}
+
+	values := url.Values{}
+
+	form.Find("input").Each(func(i int, s *goquery.Selection) {
+		name, ok := s.Attr("name")
+		if !ok {
+			return
+		}
+		val, _ := s.Attr("value")
+		values.Set(name, val)
+	})
+
+	return submitURL.String(), values, nil
+}
+
+func extractSAMLResponse(doc *goquery.Document) (string, error) {
+	return provider.ExtractSAMLResponse(doc)
+}
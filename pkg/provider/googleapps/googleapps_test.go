@@ -0,0 +1,112 @@
+package googleapps
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/mocks"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/provider/replay"
+)
+
+const (
+	exampleLoginURL      = "https://accounts.google.com/o/saml2/initsso?idpid=C01abcd23&spid=123456789012&forceauthn=false"
+	exampleSAMLAssertion = "PHNhbWxwOlJlc3BvbnNlIHhtbG5zOnNhbWxwPSJ1cm46b2FzaXM6bmFtZXM6dGM6U0FNTDoyLjA6cHJvdG9jb2wiLz4="
+)
+
+var exampleLoginDetails = &creds.LoginDetails{URL: exampleLoginURL, Username: "isaac.brock@example.com", Password: "test123"}
+
+func newTestClient(t *testing.T, tr *replay.Transport) *Client {
+	gc, err := New(&cfg.IDPAccount{})
+	require.Nil(t, err)
+
+	gc.client.Transport = tr
+
+	return gc
+}
+
+func TestClient_Authenticate(t *testing.T) {
+
+	tr := replay.New()
+	require.Nil(t, tr.AddFile("GET", "/o/saml2/initsso", 200, "text/html", "example/login.html"))
+	require.Nil(t, tr.AddFile("POST", "/signin/v1/lookup", 200, "text/html", "example/password.html"))
+	require.Nil(t, tr.AddFile("POST", "/signin/challenge/sl/password", 200, "text/html", "example/signed-in.html"))
+	require.Nil(t, tr.AddFile("GET", "/o/saml2/continue", 200, "text/html", "example/saml.html"))
+
+	gc := newTestClient(t, tr)
+
+	samlAssertion, err := gc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+
+	emailForm, err := url.ParseQuery(string(tr.Requests()[1].Body))
+	require.Nil(t, err)
+	require.Equal(t, "isaac.brock@example.com", emailForm.Get("Email"))
+	require.Equal(t, "cGn4K6ux3iM", emailForm.Get("GALX"))
+
+	passwordForm, err := url.ParseQuery(string(tr.Requests()[2].Body))
+	require.Nil(t, err)
+	require.Equal(t, "test123", passwordForm.Get("Passwd"))
+	require.Equal(t, "AEThLlx0fVoZ", passwordForm.Get("SessionState"))
+
+	require.Equal(t, "C01abcd23", tr.Requests()[3].URL.Query().Get("idpid"))
+}
+
+func TestClient_AuthenticateTotp(t *testing.T) {
+
+	tr := replay.New()
+	require.Nil(t, tr.AddFile("GET", "/o/saml2/initsso", 200, "text/html", "example/login.html"))
+	require.Nil(t, tr.AddFile("POST", "/signin/v1/lookup", 200, "text/html", "example/password.html"))
+	require.Nil(t, tr.AddFile("POST", "/signin/challenge/sl/password", 200, "text/html", "example/totp.html"))
+	require.Nil(t, tr.AddFile("POST", "/signin/challenge/totp/2", 200, "text/html", "example/saml.html"))
+
+	pr := &mocks.Prompter{}
+	pr.Mock.On("RequestSecurityCode", "000000").Return("123456")
+
+	gc := newTestClient(t, tr)
+	gc.prompter = pr
+
+	samlAssertion, err := gc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+
+	challengeForm, err := url.ParseQuery(string(tr.Requests()[3].Body))
+	require.Nil(t, err)
+	require.Equal(t, "123456", challengeForm.Get("Pin"))
+	require.Equal(t, "AM3QAYbvOO2d", challengeForm.Get("TL"))
+	require.Equal(t, "https://accounts.google.com/signin/challenge/totp/2", tr.Requests()[3].URL.String())
+}
+
+func TestClient_AuthenticatePrompt(t *testing.T) {
+
+	tr := replay.New()
+	require.Nil(t, tr.AddFile("GET", "/o/saml2/initsso", 200, "text/html", "example/login.html"))
+	require.Nil(t, tr.AddFile("POST", "/signin/v1/lookup", 200, "text/html", "example/password.html"))
+	require.Nil(t, tr.AddFile("POST", "/signin/challenge/sl/password", 200, "text/html", "example/prompt.html"))
+	require.Nil(t, tr.AddFile("POST", "/signin/challenge/az/4", 200, "text/html", "example/signed-in.html"))
+	require.Nil(t, tr.AddFile("GET", "/o/saml2/continue", 200, "text/html", "example/saml.html"))
+
+	gc := newTestClient(t, tr)
+
+	samlAssertion, err := gc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+}
+
+func TestClient_AuthenticateBadPassword(t *testing.T) {
+
+	tr := replay.New()
+	require.Nil(t, tr.AddFile("GET", "/o/saml2/initsso", 200, "text/html", "example/login.html"))
+	require.Nil(t, tr.AddFile("POST", "/signin/v1/lookup", 200, "text/html", "example/password.html"))
+	require.Nil(t, tr.AddFile("POST", "/signin/challenge/sl/password", 200, "text/html", "example/bad-password.html"))
+
+	gc := newTestClient(t, tr)
+
+	_, err := gc.Authenticate(exampleLoginDetails)
+	require.EqualError(t, err, "login failed: Wrong password. Try again.")
+}
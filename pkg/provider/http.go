@@ -1,16 +1,48 @@
 package provider
 
 import (
+	"context"
 	"crypto/tls"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"time"
 
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/versent/saml2aws/pkg/cfg"
 	"golang.org/x/net/publicsuffix"
 )
 
+const (
+	// DefaultAttempts the default number of attempts made by DoWithRetry
+	DefaultAttempts = 3
+
+	// DefaultRetryDelay the delay before the first retry, this is doubled for each subsequent retry
+	DefaultRetryDelay = 500 * time.Millisecond
+
+	// MaxRetryAfter the longest delay requested by a rate limited response which DoWithRetry will wait for
+	MaxRetryAfter = time.Minute
+
+	// DefaultMaxBodySize the largest response body in bytes which is read, the IdP pages and json responses are
+	// far smaller so a larger one is from a misbehaving endpoint
+	DefaultMaxBodySize = 5 << 20
+)
+
 // HTTPClient saml2aws http client which extends the existing client
 type HTTPClient struct {
 	http.Client
+
+	// Attempts the maximum number of attempts made by DoWithRetry, values less than one make a single attempt
+	Attempts int
+
+	// RetryDelay the delay before the first retry made by DoWithRetry
+	RetryDelay time.Duration
+
+	publicSuffixList cookiejar.PublicSuffixList
 }
 
 // NewDefaultTransport configure a transport with the TLS skip verify option
@@ -21,11 +53,226 @@ func NewDefaultTransport(skipVerify bool) http.RoundTripper {
 	}
 }
 
+// ConnectionPool tuning of the idle connections kept by the transport, for services which authenticate many users.
+// A zero value leaves the transport default in place.
+type ConnectionPool struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+}
+
+// SetConnectionPool apply the pool settings to the transport, an error is returned when the transport has been
+// replaced with one other than a http.Transport
+func (client *HTTPClient) SetConnectionPool(pool ConnectionPool) error {
+	httpTransport, err := client.httpTransport()
+	if err != nil {
+		return errors.Wrap(err, "unable to configure the connection pool")
+	}
+
+	if pool.MaxIdleConns > 0 {
+		httpTransport.MaxIdleConns = pool.MaxIdleConns
+	}
+
+	if pool.MaxIdleConnsPerHost > 0 {
+		httpTransport.MaxIdleConnsPerHost = pool.MaxIdleConnsPerHost
+	}
+
+	if pool.IdleConnTimeout > 0 {
+		httpTransport.IdleConnTimeout = pool.IdleConnTimeout
+	}
+
+	return nil
+}
+
+// SetSkipVerify skip verification of the server certificates, or verify them again, an error is returned when
+// the transport has been replaced with one other than a http.Transport
+func (client *HTTPClient) SetSkipVerify(skipVerify bool) error {
+	httpTransport, err := client.httpTransport()
+	if err != nil {
+		return errors.Wrap(err, "unable to configure certificate verification")
+	}
+
+	if httpTransport.TLSClientConfig == nil {
+		httpTransport.TLSClientConfig = &tls.Config{}
+	}
+
+	httpTransport.TLSClientConfig.InsecureSkipVerify = skipVerify
+
+	return nil
+}
+
+// SetProxy send the requests through the proxy rather than the one set in the environment, an error is returned
+// when the transport has been replaced with one other than a http.Transport
+func (client *HTTPClient) SetProxy(proxyURL *url.URL) error {
+	httpTransport, err := client.httpTransport()
+	if err != nil {
+		return errors.Wrap(err, "unable to configure the proxy")
+	}
+
+	httpTransport.Proxy = http.ProxyURL(proxyURL)
+
+	return nil
+}
+
+// Dialer how the transport connects to the IdP, for multi-homed hosts where the default route doesn't reach it
+type Dialer struct {
+	// LocalAddress the IP address of the interface to connect from
+	LocalAddress string
+
+	// IPv4Only connect over IPv4 even when the IdP also has IPv6 addresses
+	IPv4Only bool
+}
+
+// SetDialer connect from the local address, or only over IPv4, an error is returned when the address isn't an IP
+// or the transport has been replaced with one other than a http.Transport
+func (client *HTTPClient) SetDialer(dialer Dialer) error {
+	httpTransport, err := client.httpTransport()
+	if err != nil {
+		return errors.Wrap(err, "unable to configure the dialer")
+	}
+
+	netDialer := &net.Dialer{}
+
+	if dialer.LocalAddress != "" {
+		ip := net.ParseIP(dialer.LocalAddress)
+		if ip == nil {
+			return errors.Errorf("invalid local address %s, it must be an IP address", dialer.LocalAddress)
+		}
+
+		netDialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+
+	httpTransport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if dialer.IPv4Only && network == "tcp" {
+			network = "tcp4"
+		}
+
+		return netDialer.DialContext(ctx, network, addr)
+	}
+
+	return nil
+}
+
+// httpTransport the http.Transport beneath the user agent, unless it has been replaced
+func (client *HTTPClient) httpTransport() (*http.Transport, error) {
+	tr := client.Transport
+	if uat, ok := tr.(*userAgentTransport); ok {
+		tr = uat.tr
+	}
+
+	httpTransport, ok := tr.(*http.Transport)
+	if !ok {
+		return nil, errors.Errorf("transport %T isn't a http.Transport", tr)
+	}
+
+	return httpTransport, nil
+}
+
 // NewHTTPClient configure the default http client used by the providers
 func NewHTTPClient(tr http.RoundTripper) (*HTTPClient, error) {
 
+	jar, err := newCookieJar(publicsuffix.List)
+	if err != nil {
+		return nil, err
+	}
+
+	client := http.Client{Transport: &userAgentTransport{tr: tr, userAgent: DefaultUserAgent, acceptLanguage: DefaultAcceptLanguage, maxBodySize: DefaultMaxBodySize}, Jar: jar}
+
+	return &HTTPClient{Client: client, Attempts: DefaultAttempts, RetryDelay: DefaultRetryDelay, publicSuffixList: publicsuffix.List}, nil
+}
+
+// NewHTTPClientForAccount configure the http client for the transport with the settings of the IdP account which
+// apply to every provider, the public suffix list, language, body size limit and extra headers
+func NewHTTPClientForAccount(tr http.RoundTripper, idpAccount *cfg.IDPAccount) (*HTTPClient, error) {
+
+	client, err := NewHTTPClient(tr)
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	if idpAccount.DisablePublicSuffix {
+		err = client.DisablePublicSuffixList()
+		if err != nil {
+			return nil, errors.Wrap(err, "error building cookie jar")
+		}
+	}
+
+	err = client.SetAccountHeaders(idpAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// SetAccountHeaders set the language, body size limit and extra headers of the IdP account on every request,
+// which wraps the transport so is applied again when the transport is replaced
+func (client *HTTPClient) SetAccountHeaders(idpAccount *cfg.IDPAccount) error {
+
+	if idpAccount.AcceptLanguage != "" {
+		client.SetAcceptLanguage(idpAccount.AcceptLanguage)
+	}
+
+	if idpAccount.MaxBodySize > 0 {
+		client.SetMaxBodySize(idpAccount.MaxBodySize)
+	}
+
+	if idpAccount.HTTPHeaders != "" {
+		headers, err := idpAccount.ParseHTTPHeaders()
+		if err != nil {
+			return err
+		}
+		client.SetHeaders(headers)
+	}
+
+	return nil
+}
+
+// UseHTTPClient take the transport, timeout and cookie jar from the supplied client, for callers which need full
+// control of TLS, proxies and timeouts. The default headers are still set on each request, the cookie jar is kept
+// when the client doesn't have one as the logins depend on cookies, and redirects remain managed by the providers.
+func (client *HTTPClient) UseHTTPClient(hc *http.Client) {
+	client.defaultHeaders().tr = hc.Transport
+	client.Timeout = hc.Timeout
+
+	if hc.Jar != nil {
+		client.Jar = hc.Jar
+	}
+}
+
+// ResetCookies discard all the cookies held by the client
+func (client *HTTPClient) ResetCookies() error {
+
+	jar, err := newCookieJar(client.publicSuffixList)
+	if err != nil {
+		return err
+	}
+
+	client.Jar = jar
+
+	return nil
+}
+
+// DisablePublicSuffixList replace the cookie jar with one which doesn't use the public suffix list, so cookies
+// set for the domain of an IdP on a private TLD, such as example.corp, are kept
+func (client *HTTPClient) DisablePublicSuffixList() error {
+	client.publicSuffixList = nil
+
+	return client.ResetCookies()
+}
+
+// NewCookieJar a cookie jar using the public suffix list, unless it is disabled for IdPs on private TLDs
+func NewCookieJar(disablePublicSuffixList bool) (http.CookieJar, error) {
+	if disablePublicSuffixList {
+		return newCookieJar(nil)
+	}
+
+	return newCookieJar(publicsuffix.List)
+}
+
+func newCookieJar(list cookiejar.PublicSuffixList) (http.CookieJar, error) {
 	options := &cookiejar.Options{
-		PublicSuffixList: publicsuffix.List,
+		PublicSuffixList: list,
 	}
 
 	jar, err := cookiejar.New(options)
@@ -33,9 +280,137 @@ func NewHTTPClient(tr http.RoundTripper) (*HTTPClient, error) {
 		return nil, err
 	}
 
-	client := http.Client{Transport: tr, Jar: jar}
+	return newRecordingJar(jar), nil
+}
+
+// DoWithRetry send the request, retrying with exponential backoff on transport errors and 5xx responses, and
+// after the delay requested by the server when rate limited. This should only be used for requests which are safe to repeat.
+// Once the context of the request is cancelled it isn't retried, nor is the delay before a retry waited out.
+func (client *HTTPClient) DoWithRetry(req *http.Request) (*http.Response, error) {
+	return client.doWithRetry(req, shouldRetry)
+}
+
+// DoWithRateLimitRetry send the request, retrying only when it is rate limited, as the server rejected it without
+// acting on it. This is for requests which aren't safe to repeat, such as those which send a push or count
+// towards the lockout of the user, where a transport error or 5xx response may have come after it was acted on.
+func (client *HTTPClient) DoWithRateLimitRetry(req *http.Request) (*http.Response, error) {
+	return client.doWithRetry(req, isRateLimited)
+}
+
+func (client *HTTPClient) doWithRetry(req *http.Request, shouldRetry func(*http.Response, error) bool) (*http.Response, error) {
+
+	delay := client.RetryDelay
+
+	for attempt := 1; ; attempt++ {
+
+		if attempt > 1 {
+			err := rewindBody(req)
+			if err != nil {
+				return nil, errors.Wrap(err, "error rewinding request body")
+			}
+		}
+
+		res, err := client.Do(req)
+		if !shouldRetry(res, err) || attempt >= client.Attempts || !canRewind(req) || req.Context().Err() != nil {
+			return res, err
+		}
+
+		wait := delay
+
+		if err == nil && res.StatusCode == http.StatusTooManyRequests {
+			if retryAfter, ok := parseRetryAfter(res.Header.Get("Retry-After"), time.Now()); ok {
+				if retryAfter > MaxRetryAfter {
+					return res, nil
+				}
+				wait = retryAfter
+			}
+
+			fmt.Fprintf(Output, "Rate limited by %s, retrying in %v\n", req.URL.Host, wait)
+		}
+
+		if err == nil {
+			res.Body.Close()
+		}
+
+		logrus.WithField("url", req.URL.String()).WithField("attempt", attempt).WithError(err).Debug("retrying request")
+
+		err = Wait(req.Context(), wait)
+		if err != nil {
+			return nil, errors.Wrap(err, "gave up retrying request")
+		}
+
+		delay *= 2
+	}
+}
+
+// Wait for the duration before polling or retrying, returning the error of the context if it is cancelled first
+func Wait(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+func shouldRetry(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= http.StatusInternalServerError
+}
+
+func isRateLimited(res *http.Response, err error) bool {
+	return err == nil && res.StatusCode == http.StatusTooManyRequests
+}
+
+// parseRetryAfter parse the Retry-After header which is either a number of seconds or a http date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	if at.Before(now) {
+		return 0, true
+	}
+
+	return at.Sub(now), true
+}
+
+func canRewind(req *http.Request) bool {
+	return req.Body == nil || req.GetBody != nil
+}
+
+func rewindBody(req *http.Request) error {
+	if req.Body == nil {
+		return nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+
+	req.Body = body
 
-	return &HTTPClient{client}, nil
+	return nil
 }
 
 // DisableFollowRedirect disable redirects
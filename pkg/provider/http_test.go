@@ -0,0 +1,327 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/provider/replay"
+)
+
+func TestDoWithRetry(t *testing.T) {
+
+	tr := replay.New().
+		Add("POST", "/api/v1/authn", 503, "text/plain", []byte("unavailable")).
+		Add("POST", "/api/v1/authn", 200, "application/json", []byte(`{"status":"SUCCESS"}`))
+
+	client, err := NewHTTPClient(tr)
+	require.Nil(t, err)
+	client.RetryDelay = 0
+
+	req, err := http.NewRequest("POST", "https://example.okta.com/api/v1/authn", strings.NewReader(`{"username":"test"}`))
+	require.Nil(t, err)
+
+	res, err := client.DoWithRetry(req)
+	require.Nil(t, err)
+	require.Equal(t, 200, res.StatusCode)
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.Nil(t, err)
+	require.Equal(t, `{"status":"SUCCESS"}`, string(body))
+
+	require.Len(t, tr.Requests(), 2)
+	require.Equal(t, `{"username":"test"}`, string(tr.Requests()[1].Body))
+}
+
+func TestDoWithRetryGivesUp(t *testing.T) {
+
+	tr := replay.New().
+		Add("GET", "/login", 503, "text/plain", []byte("unavailable")).
+		Add("GET", "/login", 502, "text/plain", []byte("bad gateway")).
+		Add("GET", "/login", 200, "text/plain", []byte("ok"))
+
+	client, err := NewHTTPClient(tr)
+	require.Nil(t, err)
+	client.Attempts = 2
+	client.RetryDelay = 0
+
+	req, err := http.NewRequest("GET", "https://example.okta.com/login", nil)
+	require.Nil(t, err)
+
+	res, err := client.DoWithRetry(req)
+	require.Nil(t, err)
+	require.Equal(t, 502, res.StatusCode)
+	require.Equal(t, 1, tr.Remaining())
+}
+
+func TestDoWithRetryClientError(t *testing.T) {
+
+	tr := replay.New().
+		Add("GET", "/login", 404, "text/plain", []byte("not found"))
+
+	client, err := NewHTTPClient(tr)
+	require.Nil(t, err)
+	client.RetryDelay = 0
+
+	req, err := http.NewRequest("GET", "https://example.okta.com/login", nil)
+	require.Nil(t, err)
+
+	res, err := client.DoWithRetry(req)
+	require.Nil(t, err)
+	require.Equal(t, 404, res.StatusCode)
+	require.Len(t, tr.Requests(), 1)
+}
+
+func TestDoWithRetryRateLimited(t *testing.T) {
+
+	tr := replay.New().
+		AddResponse(&replay.Response{
+			Method:     "POST",
+			Path:       "/api/v1/authn",
+			StatusCode: 429,
+			Header:     http.Header{"Retry-After": []string{"0"}},
+			Body:       []byte(`{"errorCode":"E0000047","errorSummary":"API call exceeded rate limit due to too many requests."}`),
+		}).
+		Add("POST", "/api/v1/authn", 200, "application/json", []byte(`{"status":"SUCCESS"}`))
+
+	out := &bytes.Buffer{}
+	Output = out
+	defer func() { Output = os.Stderr }()
+
+	client, err := NewHTTPClient(tr)
+	require.Nil(t, err)
+
+	req, err := http.NewRequest("POST", "https://example.okta.com/api/v1/authn", strings.NewReader(`{"username":"test"}`))
+	require.Nil(t, err)
+
+	res, err := client.DoWithRetry(req)
+	require.Nil(t, err)
+	require.Equal(t, 200, res.StatusCode)
+	require.Len(t, tr.Requests(), 2)
+	require.Equal(t, "Rate limited by example.okta.com, retrying in 0s\n", out.String())
+}
+
+func TestDoWithRetryRateLimitedTooLong(t *testing.T) {
+
+	tr := replay.New().
+		AddResponse(&replay.Response{
+			Method:     "GET",
+			Path:       "/login",
+			StatusCode: 429,
+			Header:     http.Header{"Retry-After": []string{"3600"}},
+		})
+
+	client, err := NewHTTPClient(tr)
+	require.Nil(t, err)
+
+	req, err := http.NewRequest("GET", "https://example.okta.com/login", nil)
+	require.Nil(t, err)
+
+	res, err := client.DoWithRetry(req)
+	require.Nil(t, err)
+	require.Equal(t, 429, res.StatusCode)
+	require.Len(t, tr.Requests(), 1)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+
+	now := time.Date(2018, 1, 20, 4, 14, 20, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		delay time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, true},
+		{"-1", 0, false},
+		{"Sat, 20 Jan 2018 04:14:50 GMT", 30 * time.Second, true},
+		{"Sat, 20 Jan 2018 04:14:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		delay, ok := parseRetryAfter(tt.value, now)
+		require.Equal(t, tt.ok, ok, tt.value)
+		require.Equal(t, tt.delay, delay, tt.value)
+	}
+}
+
+func TestDisablePublicSuffixList(t *testing.T) {
+
+	// github.io is on the public suffix list so cookies can't be set for the whole domain
+	u := &url.URL{Scheme: "https", Host: "sso.github.io"}
+	other := &url.URL{Scheme: "https", Host: "adfs.github.io"}
+	cookies := []*http.Cookie{{Name: "MSISAuth", Value: "session", Domain: "github.io"}}
+
+	client, err := NewHTTPClient(http.DefaultTransport)
+	require.Nil(t, err)
+
+	client.Jar.SetCookies(u, cookies)
+	require.Len(t, client.Jar.Cookies(other), 0)
+
+	require.Nil(t, client.DisablePublicSuffixList())
+
+	client.Jar.SetCookies(u, cookies)
+	require.Len(t, client.Jar.Cookies(other), 1)
+
+	// the list stays disabled when the cookies are reset
+	require.Nil(t, client.ResetCookies())
+
+	client.Jar.SetCookies(u, cookies)
+	require.Len(t, client.Jar.Cookies(other), 1)
+}
+
+func TestNewHTTPClientForAccount(t *testing.T) {
+
+	tr := replay.New().
+		Add("GET", "/", 200, "text/html", []byte("<html></html>"))
+
+	client, err := NewHTTPClientForAccount(tr, &cfg.IDPAccount{AcceptLanguage: "de-DE", HTTPHeaders: "X-Corp-Token=abc123", DisablePublicSuffix: true})
+	require.Nil(t, err)
+	require.Nil(t, client.publicSuffixList)
+
+	req, err := http.NewRequest("GET", "https://idp.example.com/", nil)
+	require.Nil(t, err)
+
+	_, err = client.Do(req)
+	require.Nil(t, err)
+
+	require.Equal(t, "de-DE", tr.Requests()[0].Header.Get("Accept-Language"))
+	require.Equal(t, "abc123", tr.Requests()[0].Header.Get("X-Corp-Token"))
+
+	_, err = NewHTTPClientForAccount(tr, &cfg.IDPAccount{HTTPHeaders: "X-Corp-Token"})
+	require.EqualError(t, err, `invalid http header "X-Corp-Token" in idp account, expected name=value`)
+}
+
+func TestSetConnectionPool(t *testing.T) {
+
+	client, err := NewHTTPClient(NewDefaultTransport(false))
+	require.Nil(t, err)
+
+	require.Nil(t, client.SetConnectionPool(ConnectionPool{MaxIdleConns: 200, MaxIdleConnsPerHost: 50, IdleConnTimeout: 90 * time.Second}))
+
+	tr := client.Transport.(*userAgentTransport).tr.(*http.Transport)
+	require.Equal(t, 200, tr.MaxIdleConns)
+	require.Equal(t, 50, tr.MaxIdleConnsPerHost)
+	require.Equal(t, 90*time.Second, tr.IdleConnTimeout)
+
+	// zero values keep the current settings
+	require.Nil(t, client.SetConnectionPool(ConnectionPool{MaxIdleConnsPerHost: 10}))
+	require.Equal(t, 200, tr.MaxIdleConns)
+	require.Equal(t, 10, tr.MaxIdleConnsPerHost)
+
+	client.Transport = replay.New()
+	require.EqualError(t, client.SetConnectionPool(ConnectionPool{MaxIdleConns: 200}), "unable to configure the connection pool: transport *replay.Transport isn't a http.Transport")
+}
+
+func TestSetDialer(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.RemoteAddr))
+	}))
+	defer ts.Close()
+
+	client, err := NewHTTPClient(NewDefaultTransport(false))
+	require.Nil(t, err)
+
+	require.Nil(t, client.SetDialer(Dialer{LocalAddress: "127.0.0.1", IPv4Only: true}))
+
+	res, err := client.Get(ts.URL)
+	require.Nil(t, err)
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(string(body), "127.0.0.1:"))
+
+	require.EqualError(t, client.SetDialer(Dialer{LocalAddress: "eth0"}), "invalid local address eth0, it must be an IP address")
+
+	client.Transport = replay.New()
+	require.EqualError(t, client.SetDialer(Dialer{IPv4Only: true}), "unable to configure the dialer: transport *replay.Transport isn't a http.Transport")
+}
+
+func TestUseHTTPClient(t *testing.T) {
+
+	client, err := NewHTTPClient(NewDefaultTransport(false))
+	require.Nil(t, err)
+
+	jar := client.Jar
+	tr := replay.New().Add("GET", "/", 200, "text/html", []byte("<html></html>"))
+
+	client.UseHTTPClient(&http.Client{Transport: tr, Timeout: 30 * time.Second})
+	require.Equal(t, 30*time.Second, client.Timeout)
+
+	// a jar is required by the logins so it is kept when the client doesn't supply one
+	require.True(t, jar == client.Jar)
+
+	_, err = client.Get("https://idp.example.com/")
+	require.Nil(t, err)
+	require.Equal(t, DefaultUserAgent, tr.Requests()[0].Header.Get("User-Agent"))
+
+	suppliedJar, err := NewCookieJar(false)
+	require.Nil(t, err)
+
+	client.UseHTTPClient(&http.Client{Jar: suppliedJar})
+	require.True(t, suppliedJar == client.Jar)
+}
+
+func TestDoWithRetryCancelled(t *testing.T) {
+
+	tr := replay.New().
+		Add("GET", "/login", 503, "text/plain", []byte("unavailable")).
+		Add("GET", "/login", 503, "text/plain", []byte("unavailable")).
+		Add("GET", "/login", 200, "text/plain", []byte("ok"))
+
+	client, err := NewHTTPClient(tr)
+	require.Nil(t, err)
+	client.RetryDelay = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	req, err := http.NewRequest("GET", "https://example.okta.com/login", nil)
+	require.Nil(t, err)
+
+	// the delay before the retry is cut short by the cancel
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	_, err = client.DoWithRetry(req.WithContext(ctx))
+	require.EqualError(t, err, "gave up retrying request: context canceled")
+	require.Equal(t, 2, tr.Remaining())
+
+	// once cancelled the request isn't retried
+	res, err := client.DoWithRetry(req.WithContext(ctx))
+	require.Nil(t, err)
+	require.Equal(t, 503, res.StatusCode)
+	require.Equal(t, 1, tr.Remaining())
+}
+
+func TestDoWithRateLimitRetry(t *testing.T) {
+
+	tr := replay.New().
+		AddResponse(&replay.Response{Method: "POST", Path: "/api/v1/authn/factors/sms/verify", StatusCode: 429, Header: http.Header{"Retry-After": []string{"0"}}, Body: []byte("rate limited")}).
+		Add("POST", "/api/v1/authn/factors/sms/verify", 503, "text/plain", []byte("unavailable")).
+		Add("POST", "/api/v1/authn/factors/sms/verify", 200, "application/json", []byte(`{"status":"MFA_CHALLENGE"}`))
+
+	client, err := NewHTTPClient(tr)
+	require.Nil(t, err)
+	client.RetryDelay = 0
+
+	req, err := http.NewRequest("POST", "https://example.okta.com/api/v1/authn/factors/sms/verify", strings.NewReader(`{"stateToken":"abc"}`))
+	require.Nil(t, err)
+
+	// the rate limited request is retried, the 5xx isn't as the sms may have been sent
+	res, err := client.DoWithRateLimitRetry(req)
+	require.Nil(t, err)
+	require.Equal(t, 503, res.StatusCode)
+	require.Equal(t, 1, tr.Remaining())
+}
@@ -4,22 +4,22 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/pkg/errors"
-	"github.com/segmentio/go-prompt"
 	"github.com/versent/saml2aws/pkg/cfg"
 	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/prompter"
 	"github.com/versent/saml2aws/pkg/provider"
 )
 
 // Client is a wrapper representing a JumpCloud SAML client
 type Client struct {
-	client *provider.HTTPClient
+	client   *provider.HTTPClient
+	prompter prompter.Prompter
 }
 
 // New creates a new JumpCloud client
@@ -27,13 +27,14 @@ func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
 	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
 
-	client, err := provider.NewHTTPClient(tr)
+	client, err := provider.NewHTTPClientForAccount(tr, idpAccount)
 	if err != nil {
-		return nil, errors.Wrap(err, "error building http client")
+		return nil, err
 	}
 
 	return &Client{
-		client: client,
+		client:   client,
+		prompter: prompter.ActivePrompter,
 	}, nil
 }
 
@@ -51,7 +52,7 @@ func (jc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 		return samlAssertion, errors.Wrap(err, "error retieving form")
 	}
 
-	doc, err := goquery.NewDocumentFromResponse(res)
+	doc, err := provider.NewDocumentFromResponse(res)
 	if err != nil {
 		return samlAssertion, errors.Wrap(err, "failed to build document from response")
 	}
@@ -108,7 +109,7 @@ func (jc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 	jc.client.EnableFollowRedirect()
 
 	if mfaRequired {
-		token := prompt.StringRequired("MFA Token")
+		token := jc.prompter.StringRequired("MFA Token")
 		authForm.Add("otp", token)
 
 		req, err = http.NewRequest("POST", authSubmitURL, strings.NewReader(authForm.Encode()))
@@ -134,21 +135,7 @@ func (jc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 		return samlAssertion, errors.Wrap(err, "error parsing document")
 	}
 
-	doc.Find("input").Each(func(i int, s *goquery.Selection) {
-		name, ok := s.Attr("name")
-		if !ok {
-			log.Fatalf("unable to locate IDP authentication form submit URL")
-		}
-		if name == "SAMLResponse" {
-			val, ok := s.Attr("value")
-			if !ok {
-				log.Fatalf("unable to locate saml assertion value")
-			}
-			samlAssertion = val
-		}
-	})
-
-	return samlAssertion, nil
+	return provider.ExtractSAMLResponse(doc)
 }
 
 func updateJumpCloudForm(authForm url.Values, s *goquery.Selection, user *creds.LoginDetails) {
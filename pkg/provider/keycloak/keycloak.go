@@ -3,7 +3,6 @@ package keycloak
 import (
 	"bytes"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"strings"
@@ -20,12 +19,17 @@ import (
 	"fmt"
 )
 
+// defaultClient the IdP initiated SSO url name commonly given to the AWS client
+const defaultClient = "amazon-aws"
+
 var logger = logrus.WithField("provider", "keycloak")
 
 // Client wrapper around KeyCloak.
 type Client struct {
-	client   *provider.HTTPClient
-	prompter prompter.Prompter
+	client      *provider.HTTPClient
+	prompter    prompter.Prompter
+	realm       string // when set the login url is built from the realm and client
+	realmClient string
 }
 
 // New create a new KeyCloakClient
@@ -33,14 +37,16 @@ func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
 	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
 
-	client, err := provider.NewHTTPClient(tr)
+	client, err := provider.NewHTTPClientForAccount(tr, idpAccount)
 	if err != nil {
-		return nil, errors.Wrap(err, "error building http client")
+		return nil, err
 	}
 
 	return &Client{
-		client:   client,
-		prompter: prompter.NewCli(),
+		client:      client,
+		prompter:    prompter.ActivePrompter,
+		realm:       idpAccount.KeyCloakRealm,
+		realmClient: idpAccount.KeyCloakClient,
 	}, nil
 }
 
@@ -53,8 +59,8 @@ func (kc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 	}
 
 	data, err := kc.postLoginForm(authSubmitURL, authForm)
-	if authSubmitURL == "" {
-		return "", fmt.Errorf("error submitting login form")
+	if err != nil {
+		return "", errors.Wrap(err, "error submitting login form")
 	}
 
 	doc, err := goquery.NewDocumentFromReader(bytes.NewBuffer(data))
@@ -74,35 +80,24 @@ func (kc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 		}
 	}
 
-	var samlAssertion string
-
-	doc.Find("input").Each(func(i int, s *goquery.Selection) {
-		name, ok := s.Attr("name")
-		if !ok {
-			log.Fatalf("unable to locate IDP authentication form submit URL")
-		}
-		if name == "SAMLResponse" {
-			val, ok := s.Attr("value")
-			if !ok {
-				log.Fatalf("unable to locate saml assertion value")
-			}
-			samlAssertion = val
-		}
-	})
-
-	return samlAssertion, nil
+	return provider.ExtractSAMLResponse(doc)
 }
 
 func (kc *Client) getLoginForm(loginDetails *creds.LoginDetails) (string, url.Values, error) {
 
-	res, err := kc.client.Get(loginDetails.URL)
+	loginURL, err := buildLoginURL(loginDetails.URL, kc.realm, kc.realmClient)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "error building login url")
+	}
+
+	res, err := kc.client.Get(loginURL)
 	if err != nil {
 		return "", nil, errors.Wrap(err, "error retrieving form")
 	}
 
-	logger.WithField("status", res.StatusCode).WithField("url", loginDetails.URL).WithField("res", dump.ResponseString(res)).Debug("GET")
+	logger.WithField("status", res.StatusCode).WithField("url", loginURL).WithField("res", dump.ResponseString(res)).Debug("GET")
 
-	doc, err := goquery.NewDocumentFromResponse(res)
+	doc, err := provider.NewDocumentFromResponse(res)
 	if err != nil {
 		return "", nil, errors.Wrap(err, "failed to build document from response")
 	}
@@ -171,7 +166,7 @@ func (kc *Client) postTotpForm(totpSubmitURL string, doc *goquery.Document) (*go
 
 	logger.WithField("status", res.StatusCode).WithField("url", totpSubmitURL).WithField("res", dump.ResponseString(res)).Debug("POST")
 
-	doc, err = goquery.NewDocumentFromResponse(res)
+	doc, err = provider.NewDocumentFromResponse(res)
 	if err != nil {
 		return nil, errors.Wrap(err, "error reading totp form response")
 	}
@@ -179,6 +174,33 @@ func (kc *Client) postTotpForm(totpSubmitURL string, doc *goquery.Document) (*go
 	return doc, nil
 }
 
+// buildLoginURL use the IdP initiated SSO url for the realm and client when a realm is supplied, otherwise the url as is
+func buildLoginURL(idpURL, realm, client string) (string, error) {
+
+	if realm == "" {
+		return idpURL, nil
+	}
+
+	base, err := url.Parse(idpURL)
+	if err != nil {
+		return "", err
+	}
+
+	if client == "" {
+		client = defaultClient
+	}
+
+	loginURL := &url.URL{
+		Scheme: base.Scheme,
+		Host:   base.Host,
+		Path:   fmt.Sprintf("/auth/realms/%s/protocol/saml/clients/%s", realm, client),
+	}
+
+	return loginURL.String(), nil
+}
+
+// extractSubmitURL the form action carries the execution and session code tokens for the login flow
+// in its query, so it is submitted to as is
 func extractSubmitURL(doc *goquery.Document) (string, error) {
 
 	var submitURL string
@@ -238,6 +260,10 @@ func updateOTPFormData(otpForm url.Values, s *goquery.Selection, token string) {
 	lname := strings.ToLower(name)
 	if strings.Contains(lname, "totp") {
 		otpForm.Add(name, token)
+	} else if inputType, _ := s.Attr("type"); inputType == "hidden" {
+		// pass through any hidden fields such as the execution token
+		val, _ := s.Attr("value")
+		otpForm.Add(name, val)
 	}
 
 }
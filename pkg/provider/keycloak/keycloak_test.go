@@ -96,3 +96,48 @@ func TestClient_containsTotpForm(t *testing.T) {
 
 	require.True(t, containsTotpForm(doc))
 }
+
+func TestBuildLoginURL(t *testing.T) {
+
+	loginURL, err := buildLoginURL("https://id.example.com/auth/realms/master/protocol/saml/clients/amazon-aws", "", "")
+	require.Nil(t, err)
+	require.Equal(t, "https://id.example.com/auth/realms/master/protocol/saml/clients/amazon-aws", loginURL)
+
+	loginURL, err = buildLoginURL("https://id.example.com", "staff", "")
+	require.Nil(t, err)
+	require.Equal(t, "https://id.example.com/auth/realms/staff/protocol/saml/clients/amazon-aws", loginURL)
+
+	loginURL, err = buildLoginURL("https://id.example.com/ignored", "staff", "aws-prod")
+	require.Nil(t, err)
+	require.Equal(t, "https://id.example.com/auth/realms/staff/protocol/saml/clients/aws-prod", loginURL)
+}
+
+func TestClient_totpFormRoundTripsTokens(t *testing.T) {
+
+	page := `<form id="kc-totp-login-form" action="https://id.example.com/auth/realms/master/login-actions/authenticate?session_code=1SYK2D1kwKyOO7JyriHDfP&amp;execution=a718db5b-6d9e-40a2-a895-4f4505e6f464&amp;client_id=urn%3Aamazon%3Awebservices&amp;tab_id=x5AqLi8TL1Y" method="post">
+		<input type="hidden" name="execution" value="a718db5b-6d9e-40a2-a895-4f4505e6f464" />
+		<input id="totp" name="totp" autocomplete="off" type="text" />
+		<input name="login" id="kc-login" type="submit" value="Log in"/>
+	</form>`
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewBufferString(page))
+	require.Nil(t, err)
+
+	submitURL, err := extractSubmitURL(doc)
+	require.Nil(t, err)
+
+	u, err := url.Parse(submitURL)
+	require.Nil(t, err)
+	require.Equal(t, "1SYK2D1kwKyOO7JyriHDfP", u.Query().Get("session_code"))
+	require.Equal(t, "a718db5b-6d9e-40a2-a895-4f4505e6f464", u.Query().Get("execution"))
+
+	otpForm := url.Values{}
+	doc.Find("input").Each(func(i int, s *goquery.Selection) {
+		updateOTPFormData(otpForm, s, "123456")
+	})
+
+	require.Equal(t, url.Values{
+		"execution": []string{"a718db5b-6d9e-40a2-a895-4f4505e6f464"},
+		"totp":      []string{"123456"},
+	}, otpForm)
+}
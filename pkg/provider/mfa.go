@@ -0,0 +1,36 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MFAIndexEnvVar the environment variable which chooses the mfa option by its number in the list prompted with,
+// for automation which knows the order the IdP offers the options in
+const MFAIndexEnvVar = "SAML2AWS_MFA_INDEX"
+
+// MFACallback supplies the code for an MFA factor, for example from the UI of an app embedding saml2aws,
+// rather than prompting for it on the terminal. The factor type identifies which factor the code is for.
+type MFACallback func(factorType string) (string, error)
+
+// MFAIndex the position of the mfa option chosen with MFAIndexEnvVar from the count of options offered, ok is
+// false when the variable isn't set so the user should be prompted
+func MFAIndex(count int) (index int, ok bool, err error) {
+	value := strings.TrimSpace(os.Getenv(MFAIndexEnvVar))
+	if value == "" {
+		return 0, false, nil
+	}
+
+	index, err = strconv.Atoi(value)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid %s %q, it must be the number of an mfa option", MFAIndexEnvVar, value)
+	}
+
+	if index < 0 || index >= count {
+		return 0, false, fmt.Errorf("%s %d is out of range, there are %d mfa options numbered from 0", MFAIndexEnvVar, index, count)
+	}
+
+	return index, true, nil
+}
@@ -0,0 +1,86 @@
+package provider
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+)
+
+// DefaultMFAChoiceFile the default path of the file remembering the mfa factor chosen for each IdP host and user
+const DefaultMFAChoiceFile = "~/.saml2aws-mfa"
+
+// mfaChoiceFileMode the choices identify users so only the owner can read them
+const mfaChoiceFileMode = 0600
+
+// LoadMFAChoice load the mfa factor previously chosen by the user at the host, an empty string is returned
+// when there isn't one, a missing file is not an error
+func LoadMFAChoice(path, host, username string) (string, error) {
+
+	saved, err := readMFAChoiceFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return saved[mfaChoiceKey(host, username)], nil
+}
+
+// SaveMFAChoice save the mfa factor chosen by the user at the host, merging it with those saved for others
+func SaveMFAChoice(path, host, username, factor string) error {
+
+	saved, err := readMFAChoiceFile(path)
+	if err != nil {
+		return err
+	}
+
+	saved[mfaChoiceKey(host, username)] = factor
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return errors.Wrap(err, "error encoding mfa choices")
+	}
+
+	filename, err := homedir.Expand(path)
+	if err != nil {
+		return errors.Wrap(err, "error expanding mfa choice file path")
+	}
+
+	err = ioutil.WriteFile(filename, data, mfaChoiceFileMode)
+	if err != nil {
+		return errors.Wrap(err, "error writing mfa choice file")
+	}
+
+	// WriteFile only applies the mode when creating the file
+	return os.Chmod(filename, mfaChoiceFileMode)
+}
+
+func mfaChoiceKey(host, username string) string {
+	return host + "/" + username
+}
+
+func readMFAChoiceFile(path string) (map[string]string, error) {
+
+	saved := map[string]string{}
+
+	filename, err := homedir.Expand(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error expanding mfa choice file path")
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return saved, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading mfa choice file")
+	}
+
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding mfa choice file")
+	}
+
+	return saved, nil
+}
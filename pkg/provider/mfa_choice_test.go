@@ -0,0 +1,38 @@
+package provider
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveAndLoadMFAChoice(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	choiceFile := filepath.Join(dir, "mfa")
+
+	factor, err := LoadMFAChoice(choiceFile, "example.okta.com", "isaac.brock@example.com")
+	require.Nil(t, err)
+	require.Empty(t, factor)
+
+	require.Nil(t, SaveMFAChoice(choiceFile, "example.okta.com", "isaac.brock@example.com", "opf3hkfocI4JTLAju0g4"))
+	require.Nil(t, SaveMFAChoice(choiceFile, "example.okta.com", "modest.mouse@example.com", "sms193zUBEROPBNZKPPE"))
+
+	info, err := os.Stat(choiceFile)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	factor, err = LoadMFAChoice(choiceFile, "example.okta.com", "isaac.brock@example.com")
+	require.Nil(t, err)
+	require.Equal(t, "opf3hkfocI4JTLAju0g4", factor)
+
+	factor, err = LoadMFAChoice(choiceFile, "other.okta.com", "isaac.brock@example.com")
+	require.Nil(t, err)
+	require.Empty(t, factor)
+}
@@ -0,0 +1,33 @@
+package provider
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMFAIndex(t *testing.T) {
+
+	os.Unsetenv(MFAIndexEnvVar)
+
+	_, ok, err := MFAIndex(3)
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	os.Setenv(MFAIndexEnvVar, "2")
+	defer os.Unsetenv(MFAIndexEnvVar)
+
+	index, ok, err := MFAIndex(3)
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.Equal(t, 2, index)
+
+	_, _, err = MFAIndex(2)
+	require.EqualError(t, err, "SAML2AWS_MFA_INDEX 2 is out of range, there are 2 mfa options numbered from 0")
+
+	os.Setenv(MFAIndexEnvVar, "sms")
+
+	_, _, err = MFAIndex(2)
+	require.EqualError(t, err, `invalid SAML2AWS_MFA_INDEX "sms", it must be the number of an mfa option`)
+}
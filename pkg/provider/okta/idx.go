@@ -0,0 +1,375 @@
+package okta
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/provider"
+)
+
+const (
+	// idxContentType the content type of the identity engine idx api
+	idxContentType = "application/ion+json; okta-version=1.0.0"
+
+	// maxIdxSteps the number of idx remediations followed, excluding polls, before giving up
+	maxIdxSteps = 10
+
+	// maxIdxPolls the number of times a push is polled before giving up
+	maxIdxPolls = 60
+
+	// defaultIdxPollInterval used when okta doesn't say how long to wait before polling again
+	defaultIdxPollInterval = 4 * time.Second
+)
+
+// idxRemediations the remediations which can be completed, in the order they are preferred when okta offers
+// more than one, such as a challenge along with the option of selecting a different authenticator
+var idxRemediations = []string{"challenge-poll", "challenge-authenticator", "identify", "select-authenticator-authenticate"}
+
+// stateTokenRegexp the state token embedded in the sign in page of identity engine orgs
+var stateTokenRegexp = regexp.MustCompile(`var stateToken = '([^']+)'`)
+
+// identityEngine check whether the org is on the identity engine, which replaces the authn api with the
+// idx api, orgs which don't report their pipeline are treated as classic
+func (oc *Client) identityEngine(oktaOrgHost string) bool {
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("https://%s/.well-known/okta-organization", oktaOrgHost), nil)
+	if err != nil {
+		return false
+	}
+
+	req.Header.Add("Accept", "application/json")
+
+	res, err := oc.client.Do(req)
+	if err != nil {
+		logger.WithError(err).Debug("unable to determine the okta pipeline")
+		return false
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil || res.StatusCode != http.StatusOK {
+		return false
+	}
+
+	return gjson.Get(string(body), "pipeline").String() == "idx"
+}
+
+// authenticateIdx login by following the remediations of the idx api, starting with the state token of the
+// sign in page the app redirects to
+func (oc *Client) authenticateIdx(ctx context.Context, oktaURL *url.URL, loginDetails *creds.LoginDetails) (*provider.SAMLForm, error) {
+
+	req, err := http.NewRequest("GET", oc.redirectURL(oktaURL), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error building app request")
+	}
+	req = req.WithContext(ctx)
+
+	res, err := oc.client.DoWithRetry(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving app response")
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving body from response")
+	}
+
+	stateToken, err := extractStateToken(string(body))
+	if err != nil {
+		// an existing okta session goes straight to the SAML form, or the app chosen by the user
+		if oc.selectApp {
+			return oc.appSAMLForm(oktaURL.Host)
+		}
+		return parseSAMLForm(res.StatusCode, body)
+	}
+
+	resp, err := oc.postIdx(ctx, fmt.Sprintf("https://%s/idp/idx/introspect", oktaURL.Host), map[string]interface{}{"stateToken": stateToken})
+	if err != nil {
+		return nil, errors.Wrap(err, "error introspecting state token")
+	}
+
+	// the factor okta challenged for, other than the password
+	var mfaFactor string
+
+	for steps, polls := 0, 0; steps < maxIdxSteps && polls < maxIdxPolls; {
+
+		if message := idxErrorMessage(resp); message != "" {
+			return nil, fmt.Errorf("okta login failed: %s", message)
+		}
+
+		if successURL := gjson.Get(resp, "success.href").String(); successURL != "" {
+			form, err := oc.redirectSuccess(ctx, successURL)
+			if err != nil {
+				return nil, err
+			}
+
+			form.MFAUsed = mfaFactor != ""
+			form.MFAFactor = mfaFactor
+
+			return form, nil
+		}
+
+		remediation, ok := findIdxRemediation(resp)
+		if !ok {
+			return nil, fmt.Errorf("unsupported okta identity engine step, remediations: %s", idxRemediationNames(resp))
+		}
+
+		stateHandle := gjson.Get(resp, "stateHandle").String()
+		answer := map[string]interface{}{"stateHandle": stateHandle}
+
+		switch name := remediation.Get("name").String(); name {
+		case "identify":
+			answer["identifier"] = loginDetails.Username
+			if idxField(remediation, "credentials").Exists() {
+				answer["credentials"] = map[string]string{"passcode": loginDetails.Password}
+			}
+
+		case "challenge-authenticator":
+			if authenticatorType := idxAuthenticatorType(resp); authenticatorType != "password" {
+				mfaFactor = "OKTA " + strings.ToUpper(authenticatorType)
+				provider.ReportStatus(oc.onStatus, provider.StatusMFARequired, mfaFactor, "")
+			}
+
+			passCode, err := oc.idxPassCode(resp, loginDetails)
+			if err != nil {
+				return nil, err
+			}
+			answer["credentials"] = map[string]string{"passcode": passCode}
+
+		case "select-authenticator-authenticate":
+			authenticator, err := oc.selectIdxAuthenticator(remediation)
+			if err != nil {
+				return nil, err
+			}
+			answer["authenticator"] = authenticator
+
+		case "challenge-poll":
+			mfaFactor = IdentifierPushMfa
+			if polls == 0 {
+				provider.ReportStatus(oc.onStatus, provider.StatusPushPending, IdentifierPushMfa, "\nWaiting for approval, please check your Okta Verify app ...")
+			} else {
+				provider.ReportStatus(oc.onStatus, provider.StatusPushPending, IdentifierPushMfa, ".")
+			}
+			err = provider.Wait(ctx, idxPollInterval(remediation))
+			if err != nil {
+				return nil, errors.Wrap(err, "gave up waiting for push approval")
+			}
+			polls++
+		}
+
+		if remediation.Get("name").String() != "challenge-poll" {
+			steps++
+		}
+
+		resp, err = oc.postIdx(ctx, remediation.Get("href").String(), answer)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error completing okta %s", remediation.Get("name").String())
+		}
+
+		if remediation.Get("name").String() == "identify" {
+			provider.ReportStatus(oc.onStatus, provider.StatusAuthSubmitted, loginDetails.Username, "")
+		}
+	}
+
+	return nil, errors.New("okta identity engine login didn't complete")
+}
+
+// redirectSuccess follow the success redirect of a completed login to the SAML form of the app
+func (oc *Client) redirectSuccess(ctx context.Context, successURL string) (*provider.SAMLForm, error) {
+
+	req, err := http.NewRequest("GET", successURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error building success redirect request")
+	}
+	req = req.WithContext(ctx)
+
+	res, err := oc.client.DoWithRetry(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving success redirect response")
+	}
+
+	if oc.selectApp {
+		res.Body.Close()
+		return oc.appSAMLForm(res.Request.URL.Host)
+	}
+
+	return extractSAMLForm(res)
+}
+
+// idxPassCode the password when okta challenges for it, otherwise the code sent or generated by the authenticator
+func (oc *Client) idxPassCode(resp string, loginDetails *creds.LoginDetails) (string, error) {
+
+	authenticatorType := idxAuthenticatorType(resp)
+	if authenticatorType == "password" {
+		return loginDetails.Password, nil
+	}
+
+	verifyCode, err := oc.requestCode("OKTA "+strings.ToUpper(authenticatorType), "Enter verification code")
+	if err != nil {
+		return "", errors.Wrap(err, "error requesting verification code")
+	}
+
+	return verifyCode, nil
+}
+
+// selectIdxAuthenticator choose the authenticator used for mfa, prompting if there is more than one, and
+// return the values of its form, such as the id and the method
+func (oc *Client) selectIdxAuthenticator(remediation gjson.Result) (map[string]string, error) {
+
+	options := idxField(remediation, "authenticator").Get("options").Array()
+	if len(options) == 0 {
+		return nil, errors.New("no okta authenticators available")
+	}
+
+	var labels []string
+	for _, option := range options {
+		labels = append(labels, option.Get("label").String())
+	}
+
+	selected := 0
+	if len(labels) > 1 {
+		index, ok, err := provider.MFAIndex(len(labels))
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			selected = index
+		} else {
+			selected, err = provider.ChoiceIndex(labels, oc.prompter.Choice("Select which MFA option to use", labels))
+			if err != nil {
+				return nil, errors.Wrap(err, "error selecting MFA option")
+			}
+		}
+	}
+
+	authenticator := map[string]string{}
+	for _, field := range options[selected].Get("value.form.value").Array() {
+		name := field.Get("name").String()
+
+		switch {
+		case field.Get("value").Exists():
+			authenticator[name] = field.Get("value").String()
+		case field.Get("options.0.value").Exists():
+			// the method, such as sms or a voice call for a phone, defaults to the first offered
+			authenticator[name] = field.Get("options.0.value").String()
+		}
+	}
+
+	return authenticator, nil
+}
+
+// postIdx post the answer to a step of the idx api and return the response, error responses are returned
+// as they describe the failure
+func (oc *Client) postIdx(ctx context.Context, idxURL string, answer map[string]interface{}) (string, error) {
+
+	idxBody := new(bytes.Buffer)
+	err := json.NewEncoder(idxBody).Encode(answer)
+	if err != nil {
+		return "", errors.Wrap(err, "error encoding idx request")
+	}
+
+	req, err := http.NewRequest("POST", idxURL, idxBody)
+	if err != nil {
+		return "", errors.Wrap(err, "error building idx request")
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Add("Content-Type", idxContentType)
+	req.Header.Add("Accept", idxContentType)
+
+	res, err := oc.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving idx response")
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body from response")
+	}
+
+	return string(body), nil
+}
+
+// extractStateToken find the state token in the sign in page, which escapes it for javascript
+func extractStateToken(page string) (string, error) {
+	matches := stateTokenRegexp.FindStringSubmatch(page)
+	if len(matches) < 2 {
+		return "", errors.New("unable to locate okta state token")
+	}
+
+	return strings.Replace(matches[1], `\x2D`, "-", -1), nil
+}
+
+// idxAuthenticatorType the type of the authenticator being challenged, such as password or phone
+func idxAuthenticatorType(resp string) string {
+	if authenticatorType := gjson.Get(resp, "currentAuthenticatorEnrollment.value.type").String(); authenticatorType != "" {
+		return authenticatorType
+	}
+
+	return gjson.Get(resp, "currentAuthenticator.value.type").String()
+}
+
+func findIdxRemediation(resp string) (gjson.Result, bool) {
+	remediations := gjson.Get(resp, "remediation.value").Array()
+
+	for _, name := range idxRemediations {
+		for _, remediation := range remediations {
+			if remediation.Get("name").String() == name {
+				return remediation, true
+			}
+		}
+	}
+
+	return gjson.Result{}, false
+}
+
+func idxRemediationNames(resp string) string {
+	var names []string
+	for _, remediation := range gjson.Get(resp, "remediation.value").Array() {
+		names = append(names, remediation.Get("name").String())
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func idxField(remediation gjson.Result, name string) gjson.Result {
+	for _, field := range remediation.Get("value").Array() {
+		if field.Get("name").String() == name {
+			return field
+		}
+	}
+
+	return gjson.Result{}
+}
+
+// idxErrorMessage the messages okta returns when an answer is rejected, such as an incorrect password
+func idxErrorMessage(resp string) string {
+	var messages []string
+	for _, message := range gjson.Get(resp, "messages.value").Array() {
+		if message.Get("class").String() == "ERROR" {
+			messages = append(messages, message.Get("message").String())
+		}
+	}
+
+	return strings.Join(messages, ", ")
+}
+
+func idxPollInterval(remediation gjson.Result) time.Duration {
+	if refresh := remediation.Get("refresh"); refresh.Exists() {
+		return time.Duration(refresh.Int()) * time.Millisecond
+	}
+
+	return defaultIdxPollInterval
+}
@@ -0,0 +1,140 @@
+package okta
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/mocks"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/provider/replay"
+)
+
+const exampleStateHandle = "02tYS1NHhCPLcOpT3GByBBRHmGU63p7LGRXJx5cOvp-tJZg"
+
+// newIdxTransport a replay transport for an org on the identity engine which redirects to its sign in page
+func newIdxTransport(t *testing.T) *replay.Transport {
+	tr := replay.New().Add("GET", "/.well-known/okta-organization", 200, "application/json", []byte(`{"id":"00o1n8sbwArJ7OQRw406","pipeline":"idx"}`))
+	require.Nil(t, tr.AddFile("GET", "/home/amazon_aws/0oa3ecigppJ0ZKlQe0h8/272", 200, "text/html", "example/idx-signin.html"))
+	require.Nil(t, tr.AddFile("POST", "/idp/idx/introspect", 200, "application/ion+json", "example/idx-identify.json"))
+
+	return tr
+}
+
+func TestClient_AuthenticateIdx(t *testing.T) {
+
+	tr := newIdxTransport(t)
+	require.Nil(t, tr.AddFile("POST", "/idp/idx/identify", 200, "application/ion+json", "example/idx-select-authenticator.json"))
+	require.Nil(t, tr.AddFile("POST", "/idp/idx/challenge", 200, "application/ion+json", "example/idx-challenge-phone.json"))
+	require.Nil(t, tr.AddFile("POST", "/idp/idx/challenge/answer", 200, "application/ion+json", "example/idx-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/token/redirect", 200, "text/html", "example/saml.html"))
+
+	pr := &mocks.Prompter{}
+	pr.Mock.On("Choice", "Select which MFA option to use", []string{"Email", "Phone"}).Return("Phone")
+	pr.Mock.On("StringRequired", "Enter verification code").Return("123456")
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+	oc.prompter = pr
+
+	form, err := oc.AuthenticateForm(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, form.SAMLResponse)
+	require.True(t, form.MFAUsed)
+	require.Equal(t, "OKTA PHONE", form.MFAFactor)
+	require.Equal(t, 0, tr.Remaining())
+
+	introspect := map[string]string{}
+	require.Nil(t, json.Unmarshal(tr.Requests()[2].Body, &introspect))
+	require.Equal(t, exampleStateHandle, introspect["stateToken"])
+
+	identify := struct {
+		StateHandle string            `json:"stateHandle"`
+		Identifier  string            `json:"identifier"`
+		Credentials map[string]string `json:"credentials"`
+	}{}
+	require.Nil(t, json.Unmarshal(tr.Requests()[3].Body, &identify))
+	require.Equal(t, exampleStateHandle, identify.StateHandle)
+	require.Equal(t, "isaac.brock@example.com", identify.Identifier)
+	require.Equal(t, map[string]string{"passcode": "test123"}, identify.Credentials)
+
+	challenge := struct {
+		Authenticator map[string]string `json:"authenticator"`
+	}{}
+	require.Nil(t, json.Unmarshal(tr.Requests()[4].Body, &challenge))
+	require.Equal(t, map[string]string{
+		"id":           "aut3ecigppJ0ZKlQe0h8",
+		"methodType":   "sms",
+		"enrollmentId": "paeb0oNGTSWTBKOLGLNR",
+	}, challenge.Authenticator)
+
+	answer := struct {
+		Credentials map[string]string `json:"credentials"`
+	}{}
+	require.Nil(t, json.Unmarshal(tr.Requests()[5].Body, &answer))
+	require.Equal(t, map[string]string{"passcode": "123456"}, answer.Credentials)
+	require.Equal(t, idxContentType, tr.Requests()[5].Header.Get("Content-Type"))
+}
+
+func TestClient_AuthenticateIdxInvalidPassword(t *testing.T) {
+
+	tr := newIdxTransport(t)
+	require.Nil(t, tr.AddFile("POST", "/idp/idx/identify", 200, "application/ion+json", "example/idx-invalid-password.json"))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.Error(t, err)
+	require.Equal(t, "okta login failed: Password is incorrect", err.Error())
+	require.Equal(t, 0, tr.Remaining())
+}
+
+// contextTransport fail requests whose context is done, as a real transport would, which the replay transport doesn't
+type contextTransport struct {
+	tr http.RoundTripper
+}
+
+func (ct contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	return ct.tr.RoundTrip(req)
+}
+
+func TestClient_AuthenticateIdxContextCancelled(t *testing.T) {
+
+	tr := newIdxTransport(t)
+	require.Nil(t, tr.AddFile("POST", "/idp/idx/identify", 200, "application/ion+json", "example/idx-select-authenticator.json"))
+	require.Nil(t, tr.AddFile("POST", "/idp/idx/challenge", 200, "application/ion+json", "example/idx-challenge-phone.json"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the login is cancelled while choosing the mfa option, so the challenge isn't posted
+	pr := &mocks.Prompter{}
+	pr.Mock.On("Choice", "Select which MFA option to use", []string{"Email", "Phone"}).Run(func(mock.Arguments) { cancel() }).Return("Phone")
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(contextTransport{tr: tr}))
+	require.Nil(t, err)
+	oc.prompter = pr
+
+	_, err = oc.AuthenticateContext(ctx, exampleLoginDetails)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "context canceled")
+	require.Equal(t, 1, tr.Remaining())
+}
+
+func TestExtractStateToken(t *testing.T) {
+
+	stateToken, err := extractStateToken(`var stateToken = '02abc\x2Ddef';`)
+	require.Nil(t, err)
+	require.Equal(t, "02abc-def", stateToken)
+
+	_, err = extractStateToken("<html></html>")
+	require.Error(t, err)
+}
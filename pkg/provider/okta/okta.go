@@ -2,15 +2,15 @@ package okta
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"html"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
 	"time"
 
-	prompt "github.com/segmentio/go-prompt"
 	"github.com/sirupsen/logrus"
 	"github.com/versent/saml2aws/pkg/dump"
 	"github.com/versent/saml2aws/pkg/prompter"
@@ -21,6 +21,7 @@ import (
 	"github.com/versent/saml2aws/pkg/cfg"
 	"github.com/versent/saml2aws/pkg/creds"
 	"github.com/versent/saml2aws/pkg/provider"
+	"github.com/versent/saml2aws/pkg/provider/duo"
 
 	"encoding/json"
 )
@@ -30,23 +31,98 @@ const (
 	IdentifierSmsMfa  = "OKTA SMS"
 	IdentifierPushMfa = "OKTA PUSH"
 	IdentifierTotpMfa = "GOOGLE TOKEN:SOFTWARE:TOTP"
+	IdentifierCallMfa = "OKTA CALL"
+
+	// IdentifierQuestionMfa the security question, only used when it is the only factor enrolled as it is weak
+	IdentifierQuestionMfa = "OKTA QUESTION"
+
+	// IdentifierOktaTotpMfa the passcode generated by Okta Verify, only used when falling back from a push
+	IdentifierOktaTotpMfa = "OKTA TOKEN:SOFTWARE:TOTP"
+)
+
+// maxSnippetLength the maximum amount of page text included in errors
+const maxSnippetLength = 200
+
+// samlRetries the number of times the app is requested again when okta serves an interstitial page, such as while
+// it sets up the account, rather than the SAML form
+const samlRetries = 2
+
+// samlRetryDelay the time waited before requesting the app again after an interstitial page
+var samlRetryDelay = 2 * time.Second
+
+// pushPollInterval how long to wait between polls of a push verification which is still waiting for approval
+var pushPollInterval = time.Second
+
+// interstitialPattern matches the text of the pages okta shows while it finishes setting up the account
+var interstitialPattern = regexp.MustCompile(`(?i)(setting up|set up|finish setting up) your account|account setup`)
+
+// interstitialError the SAML form wasn't found as okta served an interstitial page, the form follows once okta
+// has finished with it
+type interstitialError struct {
+	error
+}
+
+const (
+	// maxSmsAttempts the number of sms codes which can be entered before giving up
+	maxSmsAttempts = 3
+
+	// maxCallAttempts the number of codes from a voice call which can be entered before giving up
+	maxCallAttempts = 2
+
+	// smsResendAnswer entered instead of the code to have okta send a new sms
+	smsResendAnswer = "resend"
+
+	// errorCodeInvalidPassCode returned by okta when the code entered doesn't match
+	errorCodeInvalidPassCode = "E0000068"
+
+	// duoParentPath the path of the okta sign in page which hosts the duo iframe
+	duoParentPath = "/signin/verify/duo/web"
+
+	// xsrfTokenCookie the cookie some orgs set the xsrf token in, rather than embedding it in the page
+	xsrfTokenCookie = "xsrf-token"
 )
 
 var logger = logrus.WithField("provider", "okta")
 
+// ErrOIDCApp returned when the okta app uses OpenID Connect, such as one fronting AWS IAM Identity Center, rather
+// than posting a SAML assertion which STS can exchange for credentials
+var ErrOIDCApp = errors.New("the okta app uses OpenID Connect rather than SAML, saml2aws needs a SAML app such as AWS Account Federation, for AWS IAM Identity Center use aws sso login")
+
+// sessionCookies the cookies okta establishes a session with, sid for the classic engine and idx for the identity engine
+var sessionCookies = []string{"sid", "idx"}
+
 var (
 	supportedMfaOptions = map[string]string{
 		IdentifierDuoMfa:  "DUO MFA authentication",
 		IdentifierSmsMfa:  "SMS MFA authentication",
 		IdentifierPushMfa: "PUSH MFA authentication",
 		IdentifierTotpMfa: "TOTP MFA authentication",
+		IdentifierCallMfa: "Voice call MFA authentication",
 	}
 )
 
-// OktaClient is a wrapper representing a Okta SAML client
+// awsAppName the name of the AWS SAML app in the app links of an Okta user
+const awsAppName = "amazon_aws"
+
+// OktaClient is a wrapper representing a Okta SAML client. A client isn't safe for concurrent logins as
+// they would share cookies, use Clone to create a client with its own cookies for each login.
 type Client struct {
-	client   *provider.HTTPClient
-	prompter prompter.Prompter
+	idpAccount     *cfg.IDPAccount
+	opts           []Option
+	client         *provider.HTTPClient
+	prompter       prompter.Prompter
+	rememberDevice bool
+	persistCookies bool
+	cookieFile     string
+	appURL         string
+	selectApp      bool
+	mfaCallback    provider.MFACallback
+	onStatus       provider.StatusCallback
+	userAgent      string
+	mfaChoiceFile  string
+	connectionPool *provider.ConnectionPool
+	skipVerify     *bool
+	proxyURL       *url.URL
 }
 
 // AuthRequest represents an mfa okta request
@@ -59,143 +135,817 @@ type AuthRequest struct {
 type VerifyRequest struct {
 	StateToken string `json:"stateToken"`
 	PassCode   string `json:"passCode,omitempty"`
+	Answer     string `json:"answer,omitempty"`
+}
+
+// Option configures optional behaviour of the Okta client
+type Option func(*Client)
+
+// WithTransport replace the transport used by the http client, this enables recorded Okta and Duo
+// responses to be replayed when testing
+func WithTransport(tr http.RoundTripper) Option {
+	return func(oc *Client) {
+		oc.client.Transport = tr
+	}
+}
+
+// WithHTTPClient send the requests to Okta and Duo using the transport and timeout of the supplied client, for full
+// control of TLS, proxies and timeouts. A cookie jar is kept when the client doesn't have one.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(oc *Client) {
+		oc.client.UseHTTPClient(hc)
+	}
+}
+
+// WithMFACallback obtain the SMS and TOTP codes from the callback rather than prompting for them, the
+// callback is also used for Duo passcodes
+func WithMFACallback(callback provider.MFACallback) Option {
+	return func(oc *Client) {
+		oc.mfaCallback = callback
+	}
+}
+
+// WithStatusCallback pass the progress of the login, such as waiting for a push to be approved, to the callback
+// rather than printing it
+func WithStatusCallback(callback provider.StatusCallback) Option {
+	return func(oc *Client) {
+		oc.onStatus = callback
+	}
+}
+
+// WithUserAgent send the user agent with the requests to Okta and Duo rather than the default browser like one,
+// for device trust policies based on the user agent
+func WithUserAgent(userAgent string) Option {
+	return func(oc *Client) {
+		oc.userAgent = userAgent
+	}
+}
+
+// WithConnectionPool tune the idle connections kept by the transport, for services which log in many users
+// through the one client
+func WithConnectionPool(pool provider.ConnectionPool) Option {
+	return func(oc *Client) {
+		oc.connectionPool = &pool
+	}
+}
+
+// WithSkipVerify skip verification of the certificates of Okta and Duo, or verify them, overriding the account
+func WithSkipVerify(skipVerify bool) Option {
+	return func(oc *Client) {
+		oc.skipVerify = &skipVerify
+	}
+}
+
+// WithTimeout the time limit of each request to Okta and Duo, a zero timeout means no limit
+func WithTimeout(timeout time.Duration) Option {
+	return func(oc *Client) {
+		oc.client.Timeout = timeout
+	}
+}
+
+// WithProxy send the requests to Okta and Duo through the proxy rather than the one set in the environment
+func WithProxy(proxyURL *url.URL) Option {
+	return func(oc *Client) {
+		oc.proxyURL = proxyURL
+	}
 }
 
 // New creates a new Okta client
-func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+func New(idpAccount *cfg.IDPAccount, opts ...Option) (*Client, error) {
 
 	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
 
-	client, err := provider.NewHTTPClient(tr)
+	client, err := provider.NewHTTPClientForAccount(tr, idpAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	if idpAccount.LocalAddress != "" || idpAccount.IPv4Only {
+		err = client.SetDialer(provider.Dialer{LocalAddress: idpAccount.LocalAddress, IPv4Only: idpAccount.IPv4Only})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if idpAccount.CertificatePin != "" {
+		err = client.SetCertificatePin(idpAccount.URL, idpAccount.CertificatePin)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if idpAccount.HTTPAttempts > 0 {
+		client.Attempts = idpAccount.HTTPAttempts
+	}
+
+	oc := &Client{
+		idpAccount:     idpAccount,
+		opts:           opts,
+		client:         client,
+		prompter:       prompter.ActivePrompter,
+		rememberDevice: idpAccount.DuoRememberDevice,
+		cookieFile:     provider.DefaultCookieFile,
+		appURL:         idpAccount.OktaAppURL,
+		selectApp:      idpAccount.OktaSelectApp,
+		userAgent:      provider.DefaultUserAgent,
+		mfaChoiceFile:  provider.DefaultMFAChoiceFile,
+	}
+
+	if idpAccount.CookieFile != "" {
+		oc.persistCookies = true
+		oc.cookieFile = idpAccount.CookieFile
+	}
+
+	for _, opt := range opts {
+		opt(oc)
+	}
+
+	if oc.connectionPool != nil {
+		err = oc.client.SetConnectionPool(*oc.connectionPool)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if oc.skipVerify != nil {
+		err = oc.client.SetSkipVerify(*oc.skipVerify)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if oc.proxyURL != nil {
+		err = oc.client.SetProxy(oc.proxyURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// applied after the options so they also wrap a replaced transport
+	oc.client.SetUserAgent(oc.userAgent)
+
+	err = oc.client.SetAccountHeaders(idpAccount)
 	if err != nil {
-		return nil, errors.Wrap(err, "error building http client")
+		return nil, err
 	}
 
-	return &Client{
-		client:   client,
-		prompter: prompter.NewCli(),
-	}, nil
+	if oc.persistCookies {
+		oktaURL, err := url.Parse(idpAccount.URL)
+		if err != nil {
+			return nil, errors.Wrap(err, "error building oktaURL")
+		}
+
+		err = provider.LoadCookies(oc.cookieFile, oc.client.Jar, &url.URL{Scheme: "https", Host: oktaURL.Host})
+		if err != nil {
+			logger.WithError(err).Warn("unable to load okta cookies")
+		}
+	}
+
+	return oc, nil
+}
+
+// Clone create a client with the same configuration and prompter but its own cookie jar, the options are
+// applied after those the client was created with
+func (oc *Client) Clone(opts ...Option) (*Client, error) {
+	clone, err := New(oc.idpAccount, append(append([]Option{}, oc.opts...), opts...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	clone.prompter = oc.prompter
+
+	return clone, nil
 }
 
 // Authenticate logs into Okta and returns a SAML response
 func (oc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
-	var samlAssertion string
+	return oc.AuthenticateContext(context.Background(), loginDetails)
+}
+
+// AuthenticateContext logs into Okta as Authenticate does, giving up waiting for MFA when the context is cancelled
+func (oc *Client) AuthenticateContext(ctx context.Context, loginDetails *creds.LoginDetails) (string, error) {
+	form, err := oc.AuthenticateFormContext(ctx, loginDetails)
+	if err != nil {
+		return "", err
+	}
+
+	return form.SAMLResponse, nil
+}
+
+// AuthenticateForm logs into Okta and returns the SAML response along with the ACS URL it is posted to,
+// without any handling specific to AWS
+func (oc *Client) AuthenticateForm(loginDetails *creds.LoginDetails) (*provider.SAMLForm, error) {
+	return oc.AuthenticateFormContext(context.Background(), loginDetails)
+}
+
+// AuthenticateFormContext logs into Okta as AuthenticateForm does, giving up waiting for MFA when the context
+// is cancelled
+func (oc *Client) AuthenticateFormContext(ctx context.Context, loginDetails *creds.LoginDetails) (*provider.SAMLForm, error) {
 
 	oktaURL, err := url.Parse(loginDetails.URL)
 	if err != nil {
-		return samlAssertion, errors.Wrap(err, "error building oktaURL")
+		return nil, errors.Wrap(err, "error building oktaURL")
+	}
+
+	var form *provider.SAMLForm
+
+	if oc.identityEngine(oktaURL.Host) {
+		form, err = oc.authenticateIdx(ctx, oktaURL, loginDetails)
+	} else {
+		form, err = oc.authenticateClassic(ctx, oktaURL, loginDetails)
+	}
+	if err != nil {
+		// the errors may quote okta responses, which are logged by callers
+		return nil, provider.RedactError(err)
+	}
+
+	provider.ReportStatus(oc.onStatus, provider.StatusSAMLReceived, form.Action, "")
+
+	if oc.persistCookies {
+		err = provider.SaveCookies(oc.cookieFile, oc.client.Jar, &url.URL{Scheme: "https", Host: oktaURL.Host})
+		if err != nil {
+			logger.WithError(err).Warn("unable to save okta cookies")
+		}
+	}
+
+	return form, nil
+}
+
+// Logout end the Okta session for the account and discard the cookies held by the client, along with any
+// persisted for the Okta host, so the next login needs the password and MFA again. The cookies are discarded
+// even when the session can't be ended, the error ending it is returned afterwards.
+func (oc *Client) Logout() error {
+
+	oktaURL, err := url.Parse(oc.idpAccount.URL)
+	if err != nil {
+		return errors.Wrap(err, "error building oktaURL")
+	}
+
+	sessionErr := oc.endSession(oktaURL)
+
+	err = oc.client.ResetCookies()
+	if err != nil {
+		return errors.Wrap(err, "error discarding cookies")
+	}
+
+	if oc.persistCookies {
+		err = provider.ClearCookies(oc.cookieFile, &url.URL{Scheme: "https", Host: oktaURL.Host})
+		if err != nil {
+			return errors.Wrap(err, "error clearing persisted cookies")
+		}
+	}
+
+	return sessionErr
+}
+
+// endSession delete the current Okta session using the session cookie
+func (oc *Client) endSession(oktaURL *url.URL) error {
+
+	sessionURL := fmt.Sprintf("https://%s/api/v1/sessions/me", oktaURL.Host)
+
+	req, err := http.NewRequest("DELETE", sessionURL, nil)
+	if err != nil {
+		return errors.Wrap(err, "error building logout request")
+	}
+
+	req.Header.Add("Accept", "application/json")
+
+	res, err := oc.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error ending okta session")
+	}
+	defer res.Body.Close()
+
+	logger.WithField("status", res.StatusCode).WithField("sessionURL", sessionURL).WithField("res", dump.ResponseString(res)).Debug("DELETE")
+
+	// okta responds with not found when there is no session to end
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("error ending okta session, unexpected status %s", res.Status)
+	}
+
+	return nil
+}
+
+// authenticateClassic login using the authn api of orgs which aren't on the identity engine
+func (oc *Client) authenticateClassic(ctx context.Context, oktaURL *url.URL, loginDetails *creds.LoginDetails) (*provider.SAMLForm, error) {
+
+	oktaOrgHost := oktaURL.Host
+
+	//authenticate via okta api
+	authReq := AuthRequest{Username: loginDetails.Username, Password: loginDetails.Password}
+	authBody := new(bytes.Buffer)
+	err := json.NewEncoder(authBody).Encode(authReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "error encoding authreq")
+	}
+
+	authSubmitURL := fmt.Sprintf("https://%s/api/v1/authn", oktaOrgHost)
+
+	req, err := http.NewRequest("POST", authSubmitURL, authBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "error building authentication request")
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/json")
+
+	// only retried when rate limited, as each attempt counts towards the lockout of the user
+	res, err := oc.client.DoWithRateLimitRetry(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving auth response")
+	}
+
+	logger.WithField("status", res.StatusCode).WithField("authSubmitURL", authSubmitURL).WithField("res", dump.ResponseString(res)).Debug("POST")
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving body from response")
+	}
+
+	resp := string(body)
+
+	provider.ReportStatus(oc.onStatus, provider.StatusAuthSubmitted, loginDetails.Username, "")
+
+	authStatus := gjson.Get(resp, "status").String()
+
+	switch authStatus {
+	case "PASSWORD_EXPIRED":
+		return nil, fmt.Errorf("your Okta password has expired, please reset it by logging into https://%s in a browser", oktaOrgHost)
+
+	case "MFA_ENROLL":
+		// enrolling a factor isn't supported, it needs the Okta sign in page to set up the factor
+		return nil, fmt.Errorf("your Okta account requires an MFA factor to be enrolled, please set one up by logging into https://%s in a browser", oktaOrgHost)
+
+	case "PASSWORD_WARN":
+		fmt.Fprintf(provider.Output, "Warning: your Okta password expires in %d day(s), please change it by logging into https://%s in a browser\n",
+			gjson.Get(resp, "_embedded.policy.expiration.passwordExpireDays").Int(), oktaOrgHost)
+
+		// skip changing the password, which continues the transaction with mfa if required
+		resp, err = oc.postVerify(gjson.Get(resp, "_links.skip.href").String(), VerifyRequest{StateToken: gjson.Get(resp, "stateToken").String()})
+		if err != nil {
+			return nil, errors.Wrap(err, "error skipping password warning")
+		}
+
+		authStatus = gjson.Get(resp, "status").String()
+	}
+
+	oktaSessionToken := gjson.Get(resp, "sessionToken").String()
+
+	var mfaFactor string
+
+	// mfa required
+	if authStatus == "MFA_REQUIRED" {
+		mfaOption, err := selectMfa(oc, resp, oktaOrgHost, loginDetails)
+		if err != nil {
+			return nil, errors.Wrap(err, "error verifying MFA")
+		}
+		mfaFactor = parseMfaIdentifer(resp, mfaOption)
+
+		provider.ReportStatus(oc.onStatus, provider.StatusMFARequired, mfaFactor, "")
+
+		oktaSessionToken, err = verifyMfa(ctx, oc, oktaOrgHost, loginDetails, resp, mfaOption)
+		if err != nil {
+			return nil, errors.Wrap(err, "error verifying MFA")
+		}
+	}
+
+	redirectURL := oc.redirectURL(oktaURL)
+	if oc.selectApp {
+		// the apps are listed using the session, so it is established before one is chosen
+		redirectURL = fmt.Sprintf("https://%s/", oktaOrgHost)
+	}
+
+	if oktaSessionToken != "" {
+		//now call saml endpoint
+		oktaSessionRedirectURL := fmt.Sprintf("https://%s/login/sessionCookieRedirect", oktaOrgHost)
+
+		req, err = http.NewRequest("GET", oktaSessionRedirectURL, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "error building authentication request")
+		}
+		q := req.URL.Query()
+		q.Add("checkAccountSetupComplete", "true")
+		q.Add("token", oktaSessionToken)
+		q.Add("redirectUrl", redirectURL)
+		req.URL.RawQuery = q.Encode()
+	} else {
+		// some responses establish the session with a cookie rather than returning a token, without either
+		// the app returns the sign in page
+		if !oc.hasSessionCookie(oktaOrgHost) {
+			return nil, fmt.Errorf("okta authentication didn't complete, no session token was returned with status %s", authStatus)
+		}
+
+		logger.Debug("no session token returned, using the okta session cookie")
+
+		req, err = http.NewRequest("GET", redirectURL, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "error building app request")
+		}
+	}
+
+	res, err = oc.client.DoWithRetry(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving verify response")
+	}
+
+	var form *provider.SAMLForm
+	if oc.selectApp {
+		res.Body.Close()
+		form, err = oc.appSAMLForm(oktaOrgHost)
+	} else {
+		form, err = oc.extractSAMLFormWithRetry(res, redirectURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	form.MFAUsed = mfaFactor != ""
+	form.MFAFactor = mfaFactor
+
+	return form, nil
+}
+
+// hasSessionCookie whether the jar holds an okta session cookie for the org
+func (oc *Client) hasSessionCookie(oktaOrgHost string) bool {
+	for _, cookie := range oc.client.Jar.Cookies(&url.URL{Scheme: "https", Host: oktaOrgHost, Path: "/"}) {
+		for _, name := range sessionCookies {
+			if cookie.Name == name && cookie.Value != "" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// appSAMLForm login to the AWS app chosen by the user, using the okta session
+func (oc *Client) appSAMLForm(oktaOrgHost string) (*provider.SAMLForm, error) {
+
+	linkURL, err := oc.chooseApp(oktaOrgHost)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", linkURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error building app request")
+	}
+
+	res, err := oc.client.DoWithRetry(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving app response")
+	}
+
+	return oc.extractSAMLFormWithRetry(res, linkURL)
+}
+
+// extractSAMLFormWithRetry extract the SAML form, when okta serves an interstitial page instead the app url is
+// requested again, using the session, a couple of times before giving up
+func (oc *Client) extractSAMLFormWithRetry(res *http.Response, appURL string) (*provider.SAMLForm, error) {
+	for attempt := 1; ; attempt++ {
+		form, err := extractSAMLForm(res)
+
+		interstitial, ok := err.(*interstitialError)
+		if !ok {
+			return form, err
+		}
+
+		if attempt > samlRetries {
+			return nil, interstitial.error
+		}
+
+		logger.WithField("attempt", attempt).Debug("okta served an interstitial page rather than the saml form, retrying")
+
+		time.Sleep(samlRetryDelay)
+
+		req, err := http.NewRequest("GET", appURL, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "error building app request")
+		}
+
+		res, err = oc.client.DoWithRetry(req)
+		if err != nil {
+			return nil, errors.Wrap(err, "error retrieving app response")
+		}
+	}
+}
+
+// chooseApp list the AWS apps assigned to the user, prompting for which to login to when there is more than
+// one, and return the link which starts the SSO to it
+func (oc *Client) chooseApp(oktaOrgHost string) (string, error) {
+
+	appLinksURL := fmt.Sprintf("https://%s/api/v1/users/me/appLinks", oktaOrgHost)
+
+	req, err := http.NewRequest("GET", appLinksURL, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "error building app links request")
 	}
 
-	oktaOrgHost := oktaURL.Host
+	req.Header.Add("Accept", "application/json")
+
+	res, err := oc.client.DoWithRetry(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving app links")
+	}
+
+	logger.WithField("status", res.StatusCode).WithField("appLinksURL", appLinksURL).WithField("res", dump.ResponseString(res)).Debug("GET")
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body from response")
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error listing okta apps, status: %d error: %s", res.StatusCode, gjson.Get(string(body), "errorSummary").String())
+	}
+
+	var labels, links []string
+	seen := map[string]bool{}
+
+	for _, app := range gjson.Parse(string(body)).Array() {
+		if app.Get("appName").String() != awsAppName {
+			continue
+		}
+
+		// apps for different account groups may be given the same label
+		label := app.Get("label").String()
+		if seen[label] {
+			label = fmt.Sprintf("%s (%s)", label, app.Get("appInstanceId").String())
+		}
+		seen[label] = true
+
+		labels = append(labels, label)
+		links = append(links, app.Get("linkUrl").String())
+	}
+
+	switch len(labels) {
+	case 0:
+		return "", errors.New("no AWS apps are assigned to this user in Okta, please ask your Okta administrator to assign one")
+	case 1:
+		return links[0], nil
+	}
+
+	index, err := provider.ChoiceIndex(labels, oc.prompter.Choice("Select which AWS app to login to", labels))
+	if err != nil {
+		return "", errors.Wrap(err, "error selecting AWS app")
+	}
+
+	return links[index], nil
+}
+
+// redirectURL the SAML app the session is redirected to once authenticated, this is the configured
+// app SSO URL, which may be a path on the Okta org, otherwise the URL used to login
+func (oc *Client) redirectURL(oktaURL *url.URL) string {
+	if oc.appURL == "" {
+		return oktaURL.String()
+	}
+
+	appURL, err := url.Parse(oc.appURL)
+	if err != nil {
+		logger.WithError(err).Warn("invalid okta app url, redirecting to the login url")
+		return oktaURL.String()
+	}
+
+	return oktaURL.ResolveReference(appURL).String()
+}
+
+// extractSAMLForm try to extract the SAMLResponse from the auto post form, when it is missing the error
+// includes the status code and a snippet of the page, or the content type when the response isn't a page,
+// to help identify what went wrong
+func extractSAMLForm(res *http.Response) (*provider.SAMLForm, error) {
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving body from response")
+	}
+
+	form, err := parseSAMLForm(res.StatusCode, body)
+	if err != nil && res.Request != nil && oidcAuthorizationResponse(res.Request.URL.Query()) {
+		// the app redirected back to its client with an authorization code rather than posting an assertion
+		return nil, ErrOIDCApp
+	}
+
+	// a response which isn't a page, such as json from an api, is described rather than searched for a form
+	if err != nil {
+		if htmlErr := provider.CheckHTML(res, body); htmlErr != nil {
+			return nil, htmlErr
+		}
+	}
+
+	return form, err
+}
+
+func parseSAMLForm(statusCode int, body []byte) (*provider.SAMLForm, error) {
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing document")
+	}
+
+	input, samlAssertion, err := provider.FindSAMLResponse(doc)
+	if err == provider.ErrSAMLResponseNotFound {
+		if oidcAuthorizationResponse(formValues(doc.Find("form").First())) {
+			return nil, ErrOIDCApp
+		}
+
+		title := strings.TrimSpace(doc.Find("title").Text())
+
+		// okta forbids the redirect to apps which aren't assigned to the user with an error page
+		errorContent := doc.Find(".error-content")
+		if errorContent.Length() > 0 && statusCode == http.StatusForbidden {
+			return nil, fmt.Errorf("AWS app is not assigned to this user in Okta, please ask your Okta administrator to assign it: %s (error code: %s, status: %d title: %q)",
+				strings.TrimSpace(errorContent.Find(".error-description").Text()), strings.TrimSpace(errorContent.Find(".error-code span").Text()), statusCode, title)
+		}
+
+		err = fmt.Errorf("unable to locate saml response, status: %d title: %q page: %q", statusCode, title, provider.Snippet(doc.Find("body").Text(), maxSnippetLength))
+		if interstitialPattern.MatchString(title) || interstitialPattern.MatchString(doc.Find("body").Text()) {
+			return nil, &interstitialError{err}
+		}
+
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	form := input.Closest("form")
+	relayState, _ := form.Find("input[name=\"RelayState\"]").Attr("value")
+	action, _ := form.Attr("action")
+
+	return &provider.SAMLForm{SAMLResponse: samlAssertion, RelayState: relayState, Action: action}, nil
+}
+
+// oidcAuthorizationResponse whether the values are those an OpenID Connect authorization server returns to
+// its client, a code or id token along with the state
+func oidcAuthorizationResponse(values url.Values) bool {
+	return values.Get("state") != "" && (values.Get("code") != "" || values.Get("id_token") != "")
+}
+
+// formValues the values of the named inputs of the form
+func formValues(form *goquery.Selection) url.Values {
+	values := url.Values{}
+
+	form.Find("input[name]").Each(func(i int, s *goquery.Selection) {
+		name, _ := s.Attr("name")
+		value, _ := s.Attr("value")
+		values.Add(name, value)
+	})
+
+	return values
+}
+
+func parseMfaIdentifer(json string, arrayPosition int) string {
+	mfaProvider := gjson.Get(json, fmt.Sprintf("_embedded.factors.%d.provider", arrayPosition)).String()
+	factorType := strings.ToUpper(gjson.Get(json, fmt.Sprintf("_embedded.factors.%d.factorType", arrayPosition)).String())
+	return fmt.Sprintf("%s %s", mfaProvider, factorType)
+}
+
+// allowUnknownFactor whether a factor saml2aws doesn't support can be tried with a passcode, this is opt-in and
+// needs the factor to have a verify link. The security question is known, and is answered rather than verified
+// with a passcode, so it is never treated as unknown.
+func (oc *Client) allowUnknownFactor(resp string, arrayPosition int) bool {
+	if !oc.idpAccount.AllowUnknownFactors {
+		return false
+	}
+
+	identifier := parseMfaIdentifer(resp, arrayPosition)
+	if identifier == IdentifierQuestionMfa {
+		return false
+	}
+
+	if _, ok := supportedMfaOptions[identifier]; ok {
+		return false
+	}
+
+	return gjson.Get(resp, fmt.Sprintf("_embedded.factors.%d._links.verify.href", arrayPosition)).String() != ""
+}
+
+// factorUsable whether the factor can be verified, okta lists factors which are still being enrolled or have been
+// suspended with a status other than active, and those without a verify link can't be verified at all. This is
+// decided from the factors okta returned, as the only call which checks a factor is its verify, which would send
+// the push, sms or call.
+func factorUsable(resp string, arrayPosition int) bool {
+	factor := gjson.Get(resp, fmt.Sprintf("_embedded.factors.%d", arrayPosition))
+
+	if factor.Get("_links.verify.href").String() == "" {
+		return false
+	}
+
+	status := factor.Get("status").String()
+
+	return status == "" || status == "ACTIVE"
+}
+
+// parseMfaProfile the phone number or email the factor sends codes to, which okta masks
+func parseMfaProfile(json string, arrayPosition int) string {
+	profile := gjson.Get(json, fmt.Sprintf("_embedded.factors.%d.profile", arrayPosition))
 
-	//authenticate via okta api
-	authReq := AuthRequest{Username: loginDetails.Username, Password: loginDetails.Password}
-	authBody := new(bytes.Buffer)
-	err = json.NewEncoder(authBody).Encode(authReq)
-	if err != nil {
-		return samlAssertion, errors.Wrap(err, "error encoding authreq")
+	if phoneNumber := profile.Get("phoneNumber").String(); phoneNumber != "" {
+		return phoneNumber
 	}
 
-	authSubmitURL := fmt.Sprintf("https://%s/api/v1/authn", oktaOrgHost)
+	return profile.Get("email").String()
+}
 
-	req, err := http.NewRequest("POST", authSubmitURL, authBody)
-	if err != nil {
-		return samlAssertion, errors.Wrap(err, "error building authentication request")
+// selectMfa choose the factor used for mfa, returning its position in the factors okta offers. When remembering
+// the mfa option the factor chosen last time is used without prompting, unless the login asks to prompt again.
+func selectMfa(oc *Client, resp, oktaOrgHost string, loginDetails *creds.LoginDetails) (int, error) {
+
+	// choose an mfa option if there are multiple supported factors enabled, unsupported factors are skipped
+	var factors []int
+	var mfaOptions []string
+	for i := range gjson.Get(resp, "_embedded.factors").Array() {
+		identifier := parseMfaIdentifer(resp, i)
+		label, ok := supportedMfaOptions[identifier]
+		if !ok && oc.allowUnknownFactor(resp, i) {
+			label, ok = fmt.Sprintf("%s passcode authentication", identifier), true
+		}
+		if !ok {
+			logger.WithField("mfaIdentifer", identifier).Debug("skipping unsupported MFA")
+			continue
+		}
+		if !factorUsable(resp, i) {
+			logger.WithField("mfaIdentifer", identifier).Debug("skipping MFA which isn't active")
+			continue
+		}
+		// the profile distinguishes factors of the same type, such as two phone numbers
+		if profile := parseMfaProfile(resp, i); profile != "" {
+			label = fmt.Sprintf("%s (%s)", label, profile)
+		}
+		factors = append(factors, i)
+		mfaOptions = append(mfaOptions, label)
 	}
 
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
+	if len(factors) == 0 {
+		// the security question is weak so it is only used when the user has no other factor enrolled
+		for i := range gjson.Get(resp, "_embedded.factors").Array() {
+			if parseMfaIdentifer(resp, i) == IdentifierQuestionMfa && factorUsable(resp, i) {
+				return i, nil
+			}
+		}
 
-	res, err := oc.client.Do(req)
-	if err != nil {
-		return samlAssertion, errors.Wrap(err, "error retrieving auth response")
+		return 0, errors.New("unsupported mfa provider")
 	}
 
-	logger.WithField("status", res.StatusCode).WithField("authSubmitURL", authSubmitURL).WithField("res", dump.ResponseString(res)).Debug("POST")
+	if len(mfaOptions) == 1 {
+		return factors[0], nil
+	}
 
-	body, err := ioutil.ReadAll(res.Body)
+	index, ok, err := provider.MFAIndex(len(mfaOptions))
 	if err != nil {
-		return samlAssertion, errors.Wrap(err, "error retrieving body from response")
+		return 0, err
+	}
+	if ok {
+		return factors[index], nil
 	}
 
-	resp := string(body)
-
-	authStatus := gjson.Get(resp, "status").String()
-	oktaSessionToken := gjson.Get(resp, "sessionToken").String()
+	remember := oc.idpAccount.MFARemember
 
-	// mfa required
-	if authStatus == "MFA_REQUIRED" {
-		oktaSessionToken, err = verifyMfa(oc, oktaOrgHost, resp)
+	if remember && !loginDetails.PromptMFA {
+		factorID, err := provider.LoadMFAChoice(oc.mfaChoiceFile, oktaOrgHost, loginDetails.Username)
 		if err != nil {
-			return samlAssertion, errors.Wrap(err, "error verifying MFA")
+			logger.WithError(err).Warn("unable to load the remembered mfa option")
 		}
-	}
 
-	//now call saml endpoint
-	oktaSessionRedirectURL := fmt.Sprintf("https://%s/login/sessionCookieRedirect", oktaOrgHost)
-
-	req, err = http.NewRequest("GET", oktaSessionRedirectURL, nil)
-	if err != nil {
-		return samlAssertion, errors.Wrap(err, "error building authentication request")
+		for i, factor := range factors {
+			if factorID != "" && gjson.Get(resp, fmt.Sprintf("_embedded.factors.%d.id", factor)).String() == factorID {
+				fmt.Fprintf(provider.Output, "Using remembered MFA option: %s\n", mfaOptions[i])
+				return factor, nil
+			}
+		}
 	}
-	q := req.URL.Query()
-	q.Add("checkAccountSetupComplete", "true")
-	q.Add("token", oktaSessionToken)
-	q.Add("redirectUrl", loginDetails.URL)
-	req.URL.RawQuery = q.Encode()
 
-	res, err = oc.client.Do(req)
+	index, err = provider.ChoiceIndex(mfaOptions, oc.prompter.Choice("Select which MFA option to use", mfaOptions))
 	if err != nil {
-		return samlAssertion, errors.Wrap(err, "error retrieving verify response")
+		return 0, errors.Wrap(err, "error selecting MFA option")
 	}
 
-	//try to extract SAMLResponse
-	doc, err := goquery.NewDocumentFromResponse(res)
-	if err != nil {
-		return samlAssertion, errors.Wrap(err, "error parsing document")
-	}
+	mfaOption := factors[index]
 
-	samlAssertion, ok := doc.Find("input[name=\"SAMLResponse\"]").Attr("value")
-	if !ok {
-		return samlAssertion, errors.Wrap(err, "unable to locate saml response")
+	if remember {
+		err := provider.SaveMFAChoice(oc.mfaChoiceFile, oktaOrgHost, loginDetails.Username, gjson.Get(resp, fmt.Sprintf("_embedded.factors.%d.id", mfaOption)).String())
+		if err != nil {
+			logger.WithError(err).Warn("unable to remember the mfa option")
+		}
 	}
 
-	return samlAssertion, nil
-}
-
-func parseMfaIdentifer(json string, arrayPosition int) string {
-	mfaProvider := gjson.Get(json, fmt.Sprintf("_embedded.factors.%d.provider", arrayPosition)).String()
-	factorType := strings.ToUpper(gjson.Get(json, fmt.Sprintf("_embedded.factors.%d.factorType", arrayPosition)).String())
-	return fmt.Sprintf("%s %s", mfaProvider, factorType)
+	return mfaOption, nil
 }
 
-func verifyMfa(oc *Client, oktaOrgHost string, resp string) (string, error) {
+func verifyMfa(ctx context.Context, oc *Client, oktaOrgHost string, loginDetails *creds.LoginDetails, resp string, mfaOption int) (string, error) {
 
 	stateToken := gjson.Get(resp, "stateToken").String()
 
-	// choose an mfa option if there are multiple enabled
-	mfaOption := 0
-	var mfaOptions []string
-	for i := range gjson.Get(resp, "_embedded.factors").Array() {
-		identifier := parseMfaIdentifer(resp, i)
-		if val, ok := supportedMfaOptions[identifier]; ok {
-			mfaOptions = append(mfaOptions, val)
-		} else {
-			mfaOptions = append(mfaOptions, "UNSUPPORTED: "+identifier)
-		}
-	}
-	if len(mfaOptions) > 1 {
-		mfaOption = prompt.Choose("Select which MFA option to use", mfaOptions)
-	}
-
 	factorID := gjson.Get(resp, fmt.Sprintf("_embedded.factors.%d.id", mfaOption)).String()
 	oktaVerify := gjson.Get(resp, fmt.Sprintf("_embedded.factors.%d._links.verify.href", mfaOption)).String()
 	mfaIdentifer := parseMfaIdentifer(resp, mfaOption)
 
 	logger.WithField("factorID", factorID).WithField("oktaVerify", oktaVerify).WithField("mfaIdentifer", mfaIdentifer).Debug("MFA")
 
-	if _, ok := supportedMfaOptions[mfaIdentifer]; !ok {
-		return "", errors.New("unsupported mfa provider")
+	// posting the question without an answer would count as a wrong answer, so it isn't challenged like the others
+	if mfaIdentifer == IdentifierQuestionMfa {
+		return oc.verifyQuestion(oktaVerify, stateToken, gjson.Get(resp, fmt.Sprintf("_embedded.factors.%d.profile.questionText", mfaOption)).String())
 	}
 
 	// get signature & callback
@@ -210,11 +960,14 @@ func verifyMfa(oc *Client, oktaOrgHost string, resp string) (string, error) {
 	if err != nil {
 		return "", errors.Wrap(err, "error building verify request")
 	}
+	req = req.WithContext(ctx)
 
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Accept", "application/json")
 
-	res, err := oc.client.Do(req)
+	// only retried when rate limited, as this challenges the factor and each attempt would send another push,
+	// sms or call
+	res, err := oc.client.DoWithRateLimitRetry(req)
 	if err != nil {
 		return "", errors.Wrap(err, "error retrieving verify response")
 	}
@@ -225,40 +978,46 @@ func verifyMfa(oc *Client, oktaOrgHost string, resp string) (string, error) {
 	if err != nil {
 		return "", errors.Wrap(err, "error retrieving body from response")
 	}
+
+	// the factors are kept for falling back to a passcode if a push isn't approved
+	authResp := resp
 	resp = string(body)
 
 	switch mfa := mfaIdentifer; mfa {
-	case IdentifierSmsMfa, IdentifierTotpMfa:
-		verifyCode := prompt.StringRequired("Enter verification code")
-		tokenReq := VerifyRequest{StateToken: stateToken, PassCode: verifyCode}
-		tokenBody := new(bytes.Buffer)
-		json.NewEncoder(tokenBody).Encode(tokenReq)
-
-		req, err = http.NewRequest("POST", oktaVerify, tokenBody)
+	case IdentifierSmsMfa:
+		// the verify request above is the challenge which sends the sms
+		err = checkChallenge(resp)
 		if err != nil {
-			return "", errors.Wrap(err, "error building token post request")
+			return "", errors.Wrap(err, "error sending sms challenge")
 		}
 
-		req.Header.Add("Content-Type", "application/json")
-		req.Header.Add("Accept", "application/json")
+		provider.ReportStatus(oc.onStatus, provider.StatusMFAChallengeSent, IdentifierSmsMfa, "")
 
-		res, err := oc.client.Do(req)
+		return oc.verifySmsPassCode(oktaVerify, stateToken)
+
+	case IdentifierCallMfa:
+		// the verify request above is the challenge which makes the call
+		err = checkChallenge(resp)
 		if err != nil {
-			return "", errors.Wrap(err, "error retrieving token post response")
+			return "", errors.Wrap(err, "error starting voice call challenge")
 		}
 
-		body, err := ioutil.ReadAll(res.Body)
+		provider.ReportStatus(oc.onStatus, provider.StatusMFAChallengeSent, IdentifierCallMfa, "")
+
+		return oc.verifyCallPassCode(oktaVerify, stateToken)
+
+	case IdentifierTotpMfa:
+
+		verifyCode, err := oc.requestCode(IdentifierTotpMfa, "Enter verification code")
 		if err != nil {
-			return "", errors.Wrap(err, "error retrieving body from response")
+			return "", errors.Wrap(err, "error requesting verification code")
 		}
 
-		resp = string(body)
-
-		return gjson.Get(resp, "sessionToken").String(), nil
+		return oc.verifyPassCode(oktaVerify, stateToken, verifyCode)
 
 	case IdentifierPushMfa:
 
-		fmt.Printf("\nWaiting for approval, please check your Okta Verify app ...")
+		provider.ReportStatus(oc.onStatus, provider.StatusPushPending, IdentifierPushMfa, "\nWaiting for approval, please check your Okta Verify app ...")
 
 		// loop until success, error, or timeout
 		for {
@@ -275,7 +1034,7 @@ func verifyMfa(oc *Client, oktaOrgHost string, resp string) (string, error) {
 
 			// on 'success' status
 			if gjson.Get(string(body), "status").String() == "SUCCESS" {
-				fmt.Printf(" Approved\n\n")
+				provider.ReportStatus(oc.onStatus, provider.StatusMFAVerified, IdentifierPushMfa, " Approved\n\n")
 				return gjson.Get(string(body), "sessionToken").String(), nil
 			}
 
@@ -283,20 +1042,26 @@ func verifyMfa(oc *Client, oktaOrgHost string, resp string) (string, error) {
 			switch gjson.Get(string(body), "factorResult").String() {
 
 			case "WAITING":
-				time.Sleep(1000)
-				fmt.Printf(".")
+				err = provider.Wait(ctx, pushPollInterval)
+				if err != nil {
+					return "", errors.Wrap(err, "gave up waiting for push approval")
+				}
+				provider.ReportStatus(oc.onStatus, provider.StatusPushPending, IdentifierPushMfa, ".")
 				logger.Debug("Waiting for user to authorize login")
 
 			case "TIMEOUT":
-				fmt.Printf(" Timeout\n")
+				provider.ReportStatus(oc.onStatus, provider.StatusMFAFailed, "TIMEOUT", " Timeout\n")
+				if oc.idpAccount.PushFallback {
+					return oc.verifyPassCodeFallback(authResp, stateToken)
+				}
 				return "", errors.New("User did not accept MFA in time")
 
 			case "REJECTED":
-				fmt.Printf(" Rejected\n")
+				provider.ReportStatus(oc.onStatus, provider.StatusMFAFailed, "REJECTED", " Rejected\n")
 				return "", errors.New("MFA rejected by user")
 
 			default:
-				fmt.Printf(" Error\n")
+				provider.ReportStatus(oc.onStatus, provider.StatusMFAFailed, gjson.Get(string(body), "factorResult").String(), " Error\n")
 				return "", errors.New("Unsupported response from Okta, please raise ticket with saml2aws")
 
 			}
@@ -304,84 +1069,41 @@ func verifyMfa(oc *Client, oktaOrgHost string, resp string) (string, error) {
 		}
 
 	case IdentifierDuoMfa:
-		duoHost := gjson.Get(resp, "_embedded.factor._embedded.verification.host").String()
-		duoSignature := gjson.Get(resp, "_embedded.factor._embedded.verification.signature").String()
-		duoSiguatres := strings.Split(duoSignature, ":")
-		//duoSignatures[0] = TX
-		//duoSignatures[1] = APP
-		duoCallback := gjson.Get(resp, "_embedded.factor._embedded.verification._links.complete.href").String()
-
-		// initiate duo mfa to get sid
-		duoSubmitURL := fmt.Sprintf("https://%s/frame/web/v1/auth", duoHost)
-
-		duoForm := url.Values{}
-		duoForm.Add("parent", fmt.Sprintf("https://%s/signin/verify/duo/web", oktaOrgHost))
-		duoForm.Add("java_version", "")
-		duoForm.Add("java_version", "")
-		duoForm.Add("flash_version", "")
-		duoForm.Add("screen_resolution_width", "3008")
-		duoForm.Add("screen_resolution_height", "1692")
-		duoForm.Add("color_depth", "24")
-
-		req, err = http.NewRequest("POST", duoSubmitURL, strings.NewReader(duoForm.Encode()))
-		if err != nil {
-			return "", errors.Wrap(err, "error building authentication request")
-		}
-		q := req.URL.Query()
-		q.Add("tx", duoSiguatres[0])
-		req.URL.RawQuery = q.Encode()
-
-		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		verification := verifiedFactor(resp, factorID).Get("_embedded.verification")
+		duoHost := verification.Get("host").String()
+		duoSignature := verification.Get("signature").String()
+		duoCallback := duoCallbackURL(verification, oktaOrgHost)
 
-		res, err = oc.client.Do(req)
-		if err != nil {
-			return "", errors.Wrap(err, "error retrieving verify response")
-		}
-
-		//try to extract sid
-		doc, err := goquery.NewDocumentFromResponse(res)
-		if err != nil {
-			return "", errors.Wrap(err, "error parsing document")
-		}
-
-		duoSID, ok := doc.Find("input[name=\"sid\"]").Attr("value")
-		if !ok {
-			return "", errors.Wrap(err, "unable to locate saml response")
+		if duoHost == "" || duoSignature == "" || duoCallback == "" {
+			return "", errors.New("okta duo verification is missing the duo host, signature or callback")
 		}
-		duoSID = html.UnescapeString(duoSID)
-
-		//prompt for mfa type
-		//only supporting push or passcode for now
-		var token string
 
-		var duoMfaOptions = []string{
-			"Passcode",
-			"Duo Push",
+		dc := duo.New(oc.client, oc.prompter)
+		dc.RememberDevice = oc.rememberDevice
+		dc.CookieFile = oc.cookieFile
+		dc.MFACallback = oc.mfaCallback
+		dc.OnStatus = oc.onStatus
+		dc.PushFallback = oc.idpAccount.PushFallback
+		if oc.idpAccount.DuoPushTimeout > 0 {
+			dc.PushTimeout = time.Duration(oc.idpAccount.DuoPushTimeout) * time.Second
 		}
 
-		duoMfaOption := prompt.Choose("Select a DUO MFA Option", duoMfaOptions)
-
-		if duoMfaOptions[duoMfaOption] == "Passcode" {
-			//get users DUO MFA Token
-			token = prompt.StringRequired("Enter passcode")
+		sigResponse, err := dc.VerifyContext(ctx, duoHost, duoSignature, duoParent(verification, oktaOrgHost), loginDetails)
+		if err != nil {
+			return "", err
 		}
 
-		// send mfa auth request
-		duoSubmitURL = fmt.Sprintf("https://%s/frame/prompt", duoHost)
-
-		duoForm = url.Values{}
-		duoForm.Add("sid", duoSID)
-		duoForm.Add("device", "phone1")
-		duoForm.Add("factor", duoMfaOptions[duoMfaOption])
-		duoForm.Add("out_of_date", "false")
-		if duoMfaOptions[duoMfaOption] == "Passcode" {
-			duoForm.Add("passcode", token)
-		}
+		// callback to okta with cookie
+		oktaForm := url.Values{}
+		oktaForm.Add("id", factorID)
+		oktaForm.Add("stateToken", stateToken)
+		oktaForm.Add("sig_response", sigResponse)
 
-		req, err = http.NewRequest("POST", duoSubmitURL, strings.NewReader(duoForm.Encode()))
+		req, err = http.NewRequest("POST", duoCallback, strings.NewReader(oktaForm.Encode()))
 		if err != nil {
 			return "", errors.Wrap(err, "error building authentication request")
 		}
+		req = req.WithContext(ctx)
 
 		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
@@ -395,29 +1117,26 @@ func verifyMfa(oc *Client, oktaOrgHost string, resp string) (string, error) {
 			return "", errors.Wrap(err, "error retrieving body from response")
 		}
 
-		resp = string(body)
-
-		duoTxStat := gjson.Get(resp, "stat").String()
-		duoTxID := gjson.Get(resp, "response.txid").String()
-		if duoTxStat != "OK" {
-			return "", errors.Wrap(err, "error authenticating mfa device")
-		}
+		xsrfToken := extractXsrfToken(res, body)
 
-		// get duo cookie
-		duoSubmitURL = fmt.Sprintf("https://%s/frame/status", duoHost)
+		// extract okta session token
 
-		duoForm = url.Values{}
-		duoForm.Add("sid", duoSID)
-		duoForm.Add("txid", duoTxID)
+		verifyReq = VerifyRequest{StateToken: stateToken}
+		verifyBody = new(bytes.Buffer)
+		json.NewEncoder(verifyBody).Encode(verifyReq)
 
-		req, err = http.NewRequest("POST", duoSubmitURL, strings.NewReader(duoForm.Encode()))
+		req, err = http.NewRequest("POST", oktaVerify, verifyBody)
 		if err != nil {
-			return "", errors.Wrap(err, "error building authentication request")
+			return "", errors.Wrap(err, "error building verify request")
 		}
 
-		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("Accept", "application/json")
+		if xsrfToken != "" {
+			req.Header.Add("X-Okta-XsrfToken", xsrfToken)
+		}
 
-		res, err = oc.client.Do(req)
+		res, err = oc.client.DoWithRetry(req)
 		if err != nil {
 			return "", errors.Wrap(err, "error retrieving verify response")
 		}
@@ -428,99 +1147,293 @@ func verifyMfa(oc *Client, oktaOrgHost string, resp string) (string, error) {
 		}
 
 		resp = string(body)
+		return gjson.Get(resp, "sessionToken").String(), nil
+	}
 
-		duoTxResult := gjson.Get(resp, "response.result").String()
-		duoTxCookie := gjson.Get(resp, "response.cookie").String()
+	if oc.allowUnknownFactor(authResp, mfaOption) {
+		// the factor is tried with the passcode contract most factors follow, as for TOTP
+		verifyCode, err := oc.requestCode(mfaIdentifer, "Enter verification code")
+		if err != nil {
+			return "", errors.Wrap(err, "error requesting verification code")
+		}
 
-		fmt.Println(gjson.Get(resp, "response.status").String())
+		return oc.verifyPassCode(oktaVerify, stateToken, verifyCode)
+	}
 
-		if duoTxResult != "SUCCESS" {
-			//poll as this is likely a push request
-			for {
-				time.Sleep(3 * time.Second)
+	// catch all
+	return "", errors.New("no mfa options provided")
 
-				req, err = http.NewRequest("POST", duoSubmitURL, strings.NewReader(duoForm.Encode()))
-				if err != nil {
-					return "", errors.Wrap(err, "error building authentication request")
-				}
+}
 
-				req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+// extractXsrfToken the token okta expects in the X-Okta-XsrfToken header, it is embedded in the page returned
+// by the duo callback, or set as a cookie by some orgs. It is empty when neither is present.
+func extractXsrfToken(res *http.Response, body []byte) string {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err == nil {
+		if token := strings.TrimSpace(doc.Find("#_xsrfToken").First().Text()); token != "" {
+			return token
+		}
+	}
 
-				res, err = oc.client.Do(req)
-				if err != nil {
-					return "", errors.Wrap(err, "error retrieving verify response")
-				}
+	for _, cookie := range res.Cookies() {
+		if strings.EqualFold(cookie.Name, xsrfTokenCookie) && cookie.Value != "" {
+			return cookie.Value
+		}
+	}
 
-				body, err = ioutil.ReadAll(res.Body)
-				if err != nil {
-					return "", errors.Wrap(err, "error retrieving body from response")
-				}
+	return ""
+}
+
+// duoParent the url of the okta page which would host the duo iframe. It is on the host of the links in the
+// verification of the factor, the callback or else the duo script, which differs from the org host when okta is
+// reached through a vanity domain or the org has several duo integrations. The verification has no link to the
+// page itself, so the path is that of the okta sign in page.
+func duoParent(verification gjson.Result, oktaOrgHost string) string {
+	parent := &url.URL{Scheme: "https", Host: oktaOrgHost, Path: duoParentPath}
+
+	for _, link := range []string{"_links.complete.href", "_links.script.href"} {
+		href, err := url.Parse(verification.Get(link).String())
+		if err == nil && href.Host != "" {
+			parent.Scheme = href.Scheme
+			parent.Host = href.Host
+			break
+		}
+	}
 
-				resp := string(body)
+	return parent.String()
+}
 
-				duoTxResult = gjson.Get(resp, "response.result").String()
-				duoTxCookie = gjson.Get(resp, "response.cookie").String()
+// duoCallbackURL the url the signed duo response is posted to, taken from the verification of the factor as orgs
+// with several duo integrations have a callback for each, a relative link is on the org host
+func duoCallbackURL(verification gjson.Result, oktaOrgHost string) string {
+	href := verification.Get("_links.complete.href").String()
+	if href == "" {
+		return ""
+	}
 
-				fmt.Println(gjson.Get(resp, "response.status").String())
+	callback, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
 
-				if duoTxResult == "FAILURE" {
-					return "", errors.Wrap(err, "failed to authenticate device")
-				}
+	return (&url.URL{Scheme: "https", Host: oktaOrgHost, Path: "/"}).ResolveReference(callback).String()
+}
 
-				if duoTxResult == "SUCCESS" {
-					break
-				}
-			}
+// verifyPassCodeFallback verify a passcode from an authenticator app enrolled alongside the push factor
+func (oc *Client) verifyPassCodeFallback(authResp, stateToken string) (string, error) {
+	for i := range gjson.Get(authResp, "_embedded.factors").Array() {
+		identifier := parseMfaIdentifer(authResp, i)
+		if identifier != IdentifierTotpMfa && identifier != IdentifierOktaTotpMfa {
+			continue
 		}
 
-		// callback to okta with cookie
-		oktaForm := url.Values{}
-		oktaForm.Add("id", factorID)
-		oktaForm.Add("stateToken", stateToken)
-		oktaForm.Add("sig_response", fmt.Sprintf("%s:%s", duoTxCookie, duoSiguatres[1]))
+		fmt.Fprintln(provider.Output, "Falling back to a passcode")
 
-		req, err = http.NewRequest("POST", duoCallback, strings.NewReader(oktaForm.Encode()))
+		verifyCode, err := oc.requestCode(identifier, "Enter verification code")
 		if err != nil {
-			return "", errors.Wrap(err, "error building authentication request")
+			return "", errors.Wrap(err, "error requesting verification code")
 		}
 
-		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		oktaVerify := gjson.Get(authResp, fmt.Sprintf("_embedded.factors.%d._links.verify.href", i)).String()
 
-		res, err = oc.client.Do(req)
+		return oc.verifyPassCode(oktaVerify, stateToken, verifyCode)
+	}
+
+	return "", errors.New("User did not accept MFA in time, and no passcode factor is enrolled to fall back to")
+}
+
+// verifyPassCode submit the code entered by the user to the factor verify link and return the session token
+func (oc *Client) verifyPassCode(oktaVerify, stateToken, passCode string) (string, error) {
+
+	resp, err := oc.postVerify(oktaVerify, VerifyRequest{StateToken: stateToken, PassCode: passCode})
+	if err != nil {
+		return "", err
+	}
+
+	if gjson.Get(resp, "status").String() != "SUCCESS" {
+		return "", fmt.Errorf("verification failed, %s", describeFailure(resp))
+	}
+
+	return gjson.Get(resp, "sessionToken").String(), nil
+}
+
+// verifyQuestion prompt for the answer to the security question without echoing it, the answer is obtained from the
+// mfa callback when there is one
+func (oc *Client) verifyQuestion(oktaVerify, stateToken, questionText string) (string, error) {
+
+	if questionText == "" {
+		questionText = "Security question"
+	}
+
+	var answer string
+	var err error
+	if oc.mfaCallback != nil {
+		answer, err = oc.mfaCallback(IdentifierQuestionMfa)
+	} else {
+		answer, err = oc.prompter.Password(questionText)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "error requesting security question answer")
+	}
+
+	resp, err := oc.postVerify(oktaVerify, VerifyRequest{StateToken: stateToken, Answer: answer})
+	if err != nil {
+		return "", err
+	}
+
+	if gjson.Get(resp, "status").String() != "SUCCESS" {
+		return "", fmt.Errorf("verification failed, %s", describeFailure(resp))
+	}
+
+	return gjson.Get(resp, "sessionToken").String(), nil
+}
+
+// verifySmsPassCode prompt for the code sent by sms, allowing a new code to be sent and a few wrong
+// codes to be entered before giving up
+func (oc *Client) verifySmsPassCode(oktaVerify, stateToken string) (string, error) {
+
+	for attempt := 1; ; {
+		verifyCode, err := oc.requestCode(IdentifierSmsMfa, fmt.Sprintf("Enter verification code, or %q to send a new code", smsResendAnswer))
 		if err != nil {
-			return "", errors.Wrap(err, "error retrieving verify response")
+			return "", errors.Wrap(err, "error requesting verification code")
 		}
 
-		// extract okta session token
+		if strings.EqualFold(strings.TrimSpace(verifyCode), smsResendAnswer) {
+			// posting the verify request without a code sends another sms
+			resp, err := oc.postVerify(oktaVerify, VerifyRequest{StateToken: stateToken})
+			if err != nil {
+				return "", err
+			}
 
-		verifyReq = VerifyRequest{StateToken: stateToken}
-		verifyBody = new(bytes.Buffer)
-		json.NewEncoder(verifyBody).Encode(verifyReq)
+			err = checkChallenge(resp)
+			if err != nil {
+				return "", errors.Wrap(err, "error resending sms challenge")
+			}
 
-		req, err = http.NewRequest("POST", oktaVerify, verifyBody)
+			fmt.Fprintln(provider.Output, "A new verification code has been sent")
+			continue
+		}
+
+		resp, err := oc.postVerify(oktaVerify, VerifyRequest{StateToken: stateToken, PassCode: verifyCode})
 		if err != nil {
-			return "", errors.Wrap(err, "error building verify request")
+			return "", err
 		}
 
-		req.Header.Add("Content-Type", "application/json")
-		req.Header.Add("Accept", "application/json")
-		req.Header.Add("X-Okta-XsrfToken", "")
+		if gjson.Get(resp, "status").String() == "SUCCESS" {
+			return gjson.Get(resp, "sessionToken").String(), nil
+		}
 
-		res, err = oc.client.Do(req)
+		if gjson.Get(resp, "errorCode").String() != errorCodeInvalidPassCode || attempt >= maxSmsAttempts {
+			return "", fmt.Errorf("verification failed, %s", describeFailure(resp))
+		}
+
+		fmt.Fprintf(provider.Output, "Invalid verification code, %d attempt(s) remaining\n", maxSmsAttempts-attempt)
+		attempt++
+	}
+}
+
+// verifyCallPassCode prompt for the code spoken in the voice call, allowing a mistyped code to be entered again
+func (oc *Client) verifyCallPassCode(oktaVerify, stateToken string) (string, error) {
+
+	for attempt := 1; ; attempt++ {
+		verifyCode, err := oc.requestCode(IdentifierCallMfa, "Enter the code from the voice call")
 		if err != nil {
-			return "", errors.Wrap(err, "error retrieving verify response")
+			return "", errors.Wrap(err, "error requesting verification code")
 		}
 
-		body, err = ioutil.ReadAll(res.Body)
+		resp, err := oc.postVerify(oktaVerify, VerifyRequest{StateToken: stateToken, PassCode: verifyCode})
 		if err != nil {
-			return "", errors.Wrap(err, "error retrieving body from response")
+			return "", err
 		}
 
-		resp = string(body)
-		return gjson.Get(resp, "sessionToken").String(), nil
+		if gjson.Get(resp, "status").String() == "SUCCESS" {
+			return gjson.Get(resp, "sessionToken").String(), nil
+		}
+
+		if gjson.Get(resp, "errorCode").String() != errorCodeInvalidPassCode || attempt >= maxCallAttempts {
+			return "", fmt.Errorf("verification failed, %s", describeFailure(resp))
+		}
+
+		fmt.Fprintln(provider.Output, "Invalid verification code, please try again")
+	}
+}
+
+// requestCode obtain the code for the factor from the callback if one was supplied, otherwise prompt for it
+func (oc *Client) requestCode(factorType, message string) (string, error) {
+	if oc.mfaCallback != nil {
+		return oc.mfaCallback(factorType)
 	}
 
-	// catch all
-	return "", errors.New("no mfa options provided")
+	return oc.prompter.StringRequired(message), nil
+}
+
+// postVerify post the verify request to okta returning the response body, this isn't retried as okta
+// sends an sms, or consumes the code, on each request
+func (oc *Client) postVerify(oktaVerify string, verifyReq VerifyRequest) (string, error) {
+
+	verifyBody := new(bytes.Buffer)
+	err := json.NewEncoder(verifyBody).Encode(verifyReq)
+	if err != nil {
+		return "", errors.Wrap(err, "error encoding token request")
+	}
+
+	req, err := http.NewRequest("POST", oktaVerify, verifyBody)
+	if err != nil {
+		return "", errors.Wrap(err, "error building token post request")
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/json")
+
+	res, err := oc.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving token post response")
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body from response")
+	}
+
+	return string(body), nil
+}
+
+// verifiedFactor the factor in a verify response, okta usually returns it under _embedded.factor but for some
+// factors uses the _embedded.factors array of the selection, in which case the factor with the id is used
+func verifiedFactor(resp, factorID string) gjson.Result {
+	if factor := gjson.Get(resp, "_embedded.factor"); factor.Exists() {
+		return factor
+	}
+
+	factors := gjson.Get(resp, "_embedded.factors").Array()
+	for _, factor := range factors {
+		if factor.Get("id").String() == factorID {
+			return factor
+		}
+	}
+
+	// a single factor is the one verified even if okta omits its id
+	if len(factors) == 1 {
+		return factors[0]
+	}
+
+	return gjson.Result{}
+}
+
+// checkChallenge verify okta accepted the challenge and is waiting for the code
+func checkChallenge(resp string) error {
+	if gjson.Get(resp, "factorResult").String() != "CHALLENGE" {
+		return fmt.Errorf("challenge failed, %s", describeFailure(resp))
+	}
+
+	return nil
+}
+
+// describeFailure summarise the status and any error in an okta response
+func describeFailure(resp string) string {
+	if errorSummary := gjson.Get(resp, "errorSummary").String(); errorSummary != "" {
+		return fmt.Sprintf("error: %s", errorSummary)
+	}
 
+	return fmt.Sprintf("status: %s factorResult: %s", gjson.Get(resp, "status").String(), gjson.Get(resp, "factorResult").String())
 }
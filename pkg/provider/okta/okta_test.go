@@ -0,0 +1,1460 @@
+package okta
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	"github.com/versent/saml2aws/mocks"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/provider"
+	"github.com/versent/saml2aws/pkg/provider/replay"
+)
+
+const (
+	exampleAppURL         = "https://example.okta.com/home/amazon_aws/0oa3ecigppJ0ZKlQe0h8/272"
+	exampleSAMLAssertion  = "PHNhbWxwOlJlc3BvbnNlIHhtbG5zOnNhbWxwPSJ1cm46b2FzaXM6bmFtZXM6dGM6U0FNTDoyLjA6cHJvdG9jb2wiLz4="
+	exampleVerifyPath     = "/api/v1/authn/factors/opf3hkfocI4JTLAju0g4/verify"
+	exampleSmsVerifyPath  = "/api/v1/authn/factors/sms193zUBEROPBNZKPPE/verify"
+	exampleCallVerifyPath = "/api/v1/authn/factors/clf193zUBEROPBNZKPPE/verify"
+	exampleCallPrompt     = "Enter the code from the voice call"
+	exampleSmsPrompt      = `Enter verification code, or "resend" to send a new code`
+)
+
+// newClassicTransport a replay transport for an org which reports it uses the classic authn api
+func newClassicTransport() *replay.Transport {
+	return replay.New().Add("GET", "/.well-known/okta-organization", 200, "application/json", []byte(`{"id":"00o1n8sbwArJ7OQRw406","pipeline":"v1"}`))
+}
+
+const exampleInterstitialPage = `<html><head><title>Setting up your account</title></head><body>Please wait while we finish setting up your account.</body></html>`
+
+var exampleLoginDetails = &creds.LoginDetails{URL: exampleAppURL, Username: "isaac.brock@example.com", Password: "test123"}
+
+func TestMain(m *testing.M) {
+	// the recorded push verifications are polled without waiting
+	pushPollInterval = 0
+
+	os.Exit(m.Run())
+}
+
+func TestClient_Authenticate(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+
+	samlAssertion, err := oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+
+	authReq := AuthRequest{}
+	require.Nil(t, json.Unmarshal(tr.Requests()[1].Body, &authReq))
+	require.Equal(t, AuthRequest{Username: "isaac.brock@example.com", Password: "test123"}, authReq)
+
+	redirect := tr.Requests()[2].URL.Query()
+	require.Equal(t, "20111vsTTmNOkNnzIP9Ct5R2ffrY8KCNmpgL3eqr0Zm8oAGrLeiWdXW", redirect.Get("token"))
+	require.Equal(t, exampleAppURL, redirect.Get("redirectUrl"))
+}
+
+func TestClient_AuthenticateRedirectsToAppURL(t *testing.T) {
+
+	tests := []struct {
+		appURL string
+		want   string
+	}{
+		{"/app/amazon_aws/exk5c0llc/sso/saml", "https://example.okta.com/app/amazon_aws/exk5c0llc/sso/saml"},
+		{"https://example.okta.com/app/amazon_aws/exk5c0llc/sso/saml", "https://example.okta.com/app/amazon_aws/exk5c0llc/sso/saml"},
+	}
+
+	for _, tt := range tests {
+		tr := newClassicTransport()
+		require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-success.json"))
+		require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+		oc, err := New(&cfg.IDPAccount{OktaAppURL: tt.appURL}, WithTransport(tr))
+		require.Nil(t, err)
+
+		loginDetails := &creds.LoginDetails{URL: "https://example.okta.com", Username: "isaac.brock@example.com", Password: "test123"}
+
+		samlAssertion, err := oc.Authenticate(loginDetails)
+		require.Nil(t, err)
+		require.Equal(t, exampleSAMLAssertion, samlAssertion)
+		require.Equal(t, tt.want, tr.Requests()[2].URL.Query().Get("redirectUrl"))
+	}
+}
+
+func TestClient_AuthenticateSelectsApp(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-success.json"))
+	tr.Add("GET", "/login/sessionCookieRedirect", 200, "text/html", []byte("<html><title>Okta</title></html>"))
+	require.Nil(t, tr.AddFile("GET", "/api/v1/users/me/appLinks", 200, "application/json", "example/app-links.json"))
+	require.Nil(t, tr.AddFile("GET", "/home/amazon_aws/0oa5ktxgpeLPpQmTD0h8/272", 200, "text/html", "example/saml.html"))
+
+	pr := &mocks.Prompter{}
+	pr.Mock.On("Choice", "Select which AWS app to login to", []string{"AWS Production", "AWS Sandbox"}).Return("AWS Sandbox")
+
+	oc, err := New(&cfg.IDPAccount{OktaSelectApp: true}, WithTransport(tr))
+	require.Nil(t, err)
+	oc.prompter = pr
+
+	samlAssertion, err := oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+
+	// the session is established with the org before the app is chosen
+	require.Equal(t, "https://example.okta.com/", tr.Requests()[2].URL.Query().Get("redirectUrl"))
+	pr.AssertExpectations(t)
+}
+
+func TestClient_AuthenticateUnknownAppChoice(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-success.json"))
+	tr.Add("GET", "/login/sessionCookieRedirect", 200, "text/html", []byte("<html><title>Okta</title></html>"))
+	require.Nil(t, tr.AddFile("GET", "/api/v1/users/me/appLinks", 200, "application/json", "example/app-links.json"))
+
+	// a choice which isn't one of the apps isn't taken to be the first app
+	pr := &mocks.Prompter{}
+	pr.Mock.On("Choice", "Select which AWS app to login to", []string{"AWS Production", "AWS Sandbox"}).Return("AWS Staging")
+
+	oc, err := New(&cfg.IDPAccount{OktaSelectApp: true}, WithTransport(tr))
+	require.Nil(t, err)
+	oc.prompter = pr
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `error selecting AWS app: "AWS Staging" isn't one of the options`)
+}
+
+func TestClient_AuthenticateSelectsAppNoneAssigned(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-success.json"))
+	tr.Add("GET", "/login/sessionCookieRedirect", 200, "text/html", []byte("<html><title>Okta</title></html>"))
+	tr.Add("GET", "/api/v1/users/me/appLinks", 200, "application/json", []byte("[]"))
+
+	oc, err := New(&cfg.IDPAccount{OktaSelectApp: true}, WithTransport(tr))
+	require.Nil(t, err)
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.EqualError(t, err, "no AWS apps are assigned to this user in Okta, please ask your Okta administrator to assign one")
+}
+
+func TestClient_AuthenticateMissingSessionToken(t *testing.T) {
+
+	tr := newClassicTransport()
+	tr.Add("POST", "/api/v1/authn", 200, "application/json", []byte(`{"status":"SUCCESS","_embedded":{}}`))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.EqualError(t, err, "okta authentication didn't complete, no session token was returned with status SUCCESS")
+
+	// the session cookie redirect isn't attempted
+	require.Len(t, tr.Requests(), 2)
+}
+
+func TestClient_AuthenticateSessionCookie(t *testing.T) {
+
+	tr := newClassicTransport().AddResponse(&replay.Response{
+		Method:     "POST",
+		Path:       "/api/v1/authn",
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": []string{"application/json"}, "Set-Cookie": []string{"sid=102xYzAbC; Path=/; Secure"}},
+		Body:       []byte(`{"status":"SUCCESS","_embedded":{}}`),
+	})
+	require.Nil(t, tr.AddFile("GET", "/home/amazon_aws/0oa3ecigppJ0ZKlQe0h8/272", 200, "text/html", "example/saml.html"))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+
+	samlAssertion, err := oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+
+	// the app is requested with the session cookie rather than through the session cookie redirect
+	require.Equal(t, "sid=102xYzAbC", tr.Requests()[2].Header.Get("Cookie"))
+}
+
+func TestClient_AuthenticateUserAgent(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr), WithUserAgent("ExampleBrowser/1.0"))
+	require.Nil(t, err)
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+
+	for _, req := range tr.Requests() {
+		require.Equal(t, "ExampleBrowser/1.0", req.Header.Get("User-Agent"))
+	}
+}
+
+func TestNewWithConnectionPool(t *testing.T) {
+
+	_, err := New(&cfg.IDPAccount{}, WithConnectionPool(provider.ConnectionPool{MaxIdleConnsPerHost: 50, IdleConnTimeout: time.Minute}))
+	require.Nil(t, err)
+
+	// a replaced transport can't be tuned
+	_, err = New(&cfg.IDPAccount{}, WithTransport(replay.New()), WithConnectionPool(provider.ConnectionPool{MaxIdleConnsPerHost: 50}))
+	require.Error(t, err)
+}
+
+func TestNewWithHTTPClient(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	oc, err := New(&cfg.IDPAccount{}, WithHTTPClient(&http.Client{Transport: tr, Timeout: 10 * time.Second}))
+	require.Nil(t, err)
+	require.NotNil(t, oc.client.Jar)
+	require.Equal(t, 10*time.Second, oc.client.Timeout)
+
+	samlAssertion, err := oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, provider.DefaultUserAgent, tr.Requests()[1].Header.Get("User-Agent"))
+}
+
+func TestNewWithOptions(t *testing.T) {
+
+	oc, err := New(&cfg.IDPAccount{}, WithTimeout(30*time.Second), WithUserAgent("ExampleBrowser/1.0"))
+	require.Nil(t, err)
+	require.Equal(t, 30*time.Second, oc.client.Timeout)
+	require.Equal(t, "ExampleBrowser/1.0", oc.userAgent)
+
+	// a replaced transport can't be configured
+	_, err = New(&cfg.IDPAccount{}, WithTransport(replay.New()), WithSkipVerify(true))
+	require.EqualError(t, err, "unable to configure certificate verification: transport *replay.Transport isn't a http.Transport")
+
+	_, err = New(&cfg.IDPAccount{}, WithTransport(replay.New()), WithProxy(&url.URL{Scheme: "http", Host: "proxy.example.com:3128"}))
+	require.EqualError(t, err, "unable to configure the proxy: transport *replay.Transport isn't a http.Transport")
+}
+
+func TestNewWithSkipVerify(t *testing.T) {
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	oc, err := New(&cfg.IDPAccount{}, WithSkipVerify(true))
+	require.Nil(t, err)
+
+	res, err := oc.client.Get(ts.URL)
+	require.Nil(t, err)
+	res.Body.Close()
+
+	// the option overrides the account
+	oc, err = New(&cfg.IDPAccount{SkipVerify: true}, WithSkipVerify(false))
+	require.Nil(t, err)
+
+	_, err = oc.client.Get(ts.URL)
+	require.Error(t, err)
+}
+
+func TestNewWithProxy(t *testing.T) {
+
+	var proxied string
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	require.Nil(t, err)
+
+	oc, err := New(&cfg.IDPAccount{}, WithProxy(proxyURL))
+	require.Nil(t, err)
+
+	res, err := oc.client.Get("http://example.okta.com/")
+	require.Nil(t, err)
+	res.Body.Close()
+
+	require.Equal(t, "http://example.okta.com/", proxied)
+}
+
+func TestClient_CloneIsolatesCookies(t *testing.T) {
+
+	// okta device cookies are scoped to the parent domain, so would be sent to every org sharing a jar
+	orgTransport := func(deviceToken string) *replay.Transport {
+		tr := newClassicTransport().AddResponse(&replay.Response{
+			Method:     "POST",
+			Path:       "/api/v1/authn",
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": []string{"application/json"}, "Set-Cookie": []string{"DT=" + deviceToken + "; Domain=okta.com; Path=/"}},
+			Body:       mustReadFile(t, "example/authn-success.json"),
+		})
+		require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+		return tr
+	}
+
+	oc, err := New(&cfg.IDPAccount{})
+	require.Nil(t, err)
+
+	orgs := []struct {
+		url         string
+		deviceToken string
+		tr          *replay.Transport
+	}{
+		{"https://first.okta.com/home/amazon_aws/0oa3ecigppJ0ZKlQe0h8/272", "first", orgTransport("first")},
+		{"https://second.okta.com/home/amazon_aws/0oa3ecigppJ0ZKlQe0h8/272", "second", orgTransport("second")},
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(orgs))
+
+	for i, org := range orgs {
+		clone, err := oc.Clone(WithTransport(org.tr))
+		require.Nil(t, err)
+
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			_, errs[i] = clone.Authenticate(&creds.LoginDetails{URL: url, Username: "isaac.brock@example.com", Password: "test123"})
+		}(i, org.url)
+	}
+
+	wg.Wait()
+
+	for i, org := range orgs {
+		require.Nil(t, errs[i])
+		require.Equal(t, 0, org.tr.Remaining())
+		require.Equal(t, "DT="+org.deviceToken, org.tr.Requests()[2].Header.Get("Cookie"))
+	}
+}
+
+func mustReadFile(t *testing.T, filename string) []byte {
+	data, err := ioutil.ReadFile(filename)
+	require.Nil(t, err)
+	return data
+}
+
+func TestClient_AuthenticateForm(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+
+	form, err := oc.AuthenticateForm(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, &provider.SAMLForm{SAMLResponse: exampleSAMLAssertion, Action: "https://signin.aws.amazon.com/saml"}, form)
+}
+
+func TestClient_AuthenticateFormMfaUsed(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-push.json"))
+	require.Nil(t, tr.AddFile("POST", exampleVerifyPath, 200, "application/json", "example/verify-push-waiting.json"))
+	require.Nil(t, tr.AddFile("POST", exampleVerifyPath, 200, "application/json", "example/verify-push-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+
+	form, err := oc.AuthenticateForm(exampleLoginDetails)
+	require.Nil(t, err)
+	require.True(t, form.MFAUsed)
+	require.Equal(t, IdentifierPushMfa, form.MFAFactor)
+}
+
+func TestClient_AuthenticateRetriesUnavailable(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-success.json"))
+	tr.Add("GET", "/login/sessionCookieRedirect", 503, "text/html", []byte("Service Unavailable"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+	oc.client.RetryDelay = 0
+
+	samlAssertion, err := oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+}
+
+func TestClient_AuthenticateDoesNotRetryLogin(t *testing.T) {
+
+	// the password may have been checked before the 503, so the login isn't repeated
+	tr := newClassicTransport().Add("POST", "/api/v1/authn", 503, "text/html", []byte("Service Unavailable"))
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-success.json"))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+	oc.client.RetryDelay = 0
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.Error(t, err)
+	require.Equal(t, 1, tr.Remaining())
+}
+
+func TestClient_AuthenticateSkipsInactiveMfa(t *testing.T) {
+
+	// the totp factor is still being enrolled and the sms factor has no verify link, so the push is used
+	// without prompting
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-inactive.json"))
+	require.Nil(t, tr.AddFile("POST", exampleVerifyPath, 200, "application/json", "example/verify-push-waiting.json"))
+	require.Nil(t, tr.AddFile("POST", exampleVerifyPath, 200, "application/json", "example/verify-push-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+	oc.prompter = &mocks.Prompter{}
+
+	samlAssertion, err := oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+}
+
+func TestClient_AuthenticatePushMfa(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-push.json"))
+	require.Nil(t, tr.AddFile("POST", exampleVerifyPath, 200, "application/json", "example/verify-push-waiting.json"))
+	require.Nil(t, tr.AddFile("POST", exampleVerifyPath, 200, "application/json", "example/verify-push-waiting.json"))
+	require.Nil(t, tr.AddFile("POST", exampleVerifyPath, 200, "application/json", "example/verify-push-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+
+	samlAssertion, err := oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+}
+
+func TestClient_AuthenticatePushMfaReportsStatus(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-push.json"))
+	require.Nil(t, tr.AddFile("POST", exampleVerifyPath, 200, "application/json", "example/verify-push-waiting.json"))
+	require.Nil(t, tr.AddFile("POST", exampleVerifyPath, 200, "application/json", "example/verify-push-waiting.json"))
+	require.Nil(t, tr.AddFile("POST", exampleVerifyPath, 200, "application/json", "example/verify-push-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	out := &bytes.Buffer{}
+	provider.Output = out
+	defer func() { provider.Output = os.Stderr }()
+
+	var stages []string
+	onStatus := func(stage, detail string) {
+		stages = append(stages, stage+" "+detail)
+	}
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr), WithStatusCallback(onStatus))
+	require.Nil(t, err)
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+
+	require.Equal(t, []string{
+		"auth-submitted isaac.brock@example.com",
+		"mfa-required OKTA PUSH",
+		"push-pending OKTA PUSH",
+		"push-pending OKTA PUSH",
+		"mfa-verified OKTA PUSH",
+		"saml-received https://signin.aws.amazon.com/saml",
+	}, stages)
+
+	// the progress is reported instead of printed
+	require.Empty(t, out.String())
+}
+
+func TestClient_AuthenticateContextCancelledDuringPush(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-push.json"))
+	require.Nil(t, tr.AddFile("POST", exampleVerifyPath, 200, "application/json", "example/verify-push-waiting.json"))
+	require.Nil(t, tr.AddFile("POST", exampleVerifyPath, 200, "application/json", "example/verify-push-waiting.json"))
+	require.Nil(t, tr.AddFile("POST", exampleVerifyPath, 200, "application/json", "example/verify-push-success.json"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the login is cancelled once the push is sent, as a user giving up on approving it would
+	onStatus := func(stage, detail string) {
+		if stage == provider.StatusPushPending {
+			cancel()
+		}
+	}
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr), WithStatusCallback(onStatus))
+	require.Nil(t, err)
+
+	_, err = oc.AuthenticateContext(ctx, exampleLoginDetails)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "gave up waiting for push approval: context canceled")
+
+	// the push isn't polled after the login is cancelled
+	require.True(t, tr.Remaining() >= 1)
+}
+
+func TestClient_AuthenticatePushMfaFallback(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-push-totp.json"))
+	require.Nil(t, tr.AddFile("POST", exampleVerifyPath, 200, "application/json", "example/verify-push-waiting.json"))
+	require.Nil(t, tr.AddFile("POST", exampleVerifyPath, 200, "application/json", "example/verify-push-timeout.json"))
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn/factors/ost3hkfocI4JTLAju0g4/verify", 200, "application/json", "example/verify-push-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	pr := &mocks.Prompter{}
+	pr.Mock.On("StringRequired", "Enter verification code").Return("123456")
+
+	oc, err := New(&cfg.IDPAccount{PushFallback: true}, WithTransport(tr))
+	require.Nil(t, err)
+	oc.prompter = pr
+
+	samlAssertion, err := oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+
+	verifyReq := VerifyRequest{}
+	require.Nil(t, json.Unmarshal(tr.Requests()[4].Body, &verifyReq))
+	require.Equal(t, VerifyRequest{StateToken: "007ucIX7PATyn94hsHfOLVaXAmOBkKHWnOOLG43bsb", PassCode: "123456"}, verifyReq)
+}
+
+func TestClient_AuthenticatePushMfaTimeout(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-push-totp.json"))
+	require.Nil(t, tr.AddFile("POST", exampleVerifyPath, 200, "application/json", "example/verify-push-waiting.json"))
+	require.Nil(t, tr.AddFile("POST", exampleVerifyPath, 200, "application/json", "example/verify-push-timeout.json"))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "User did not accept MFA in time")
+	require.Equal(t, 0, tr.Remaining())
+}
+
+func TestClient_AuthenticateSelectsOnlySupportedMfa(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-mixed.json"))
+	require.Nil(t, tr.AddFile("POST", exampleVerifyPath, 200, "application/json", "example/verify-push-waiting.json"))
+	require.Nil(t, tr.AddFile("POST", exampleVerifyPath, 200, "application/json", "example/verify-push-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	// no expectations are set so prompting for a factor fails the test
+	pr := &mocks.Prompter{}
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+	oc.prompter = pr
+
+	samlAssertion, err := oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+	pr.AssertExpectations(t)
+}
+
+func TestClient_AuthenticateUnknownFactor(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-unknown.json"))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.EqualError(t, err, "error verifying MFA: unsupported mfa provider")
+}
+
+func TestClient_AuthenticateAllowUnknownFactors(t *testing.T) {
+
+	verifyPath := "/api/v1/authn/factors/ykf193zUBEROPBNZKPPE/verify"
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-unknown.json"))
+	tr.Add("POST", verifyPath, 403, "application/json", []byte(`{"errorCode":"E0000082","errorSummary":"Each code can only be used once."}`))
+	require.Nil(t, tr.AddFile("POST", verifyPath, 200, "application/json", "example/verify-push-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	pr := &mocks.Prompter{}
+	pr.Mock.On("StringRequired", "Enter verification code").Return("cccjgjgkhcbb")
+
+	oc, err := New(&cfg.IDPAccount{AllowUnknownFactors: true}, WithTransport(tr))
+	require.Nil(t, err)
+	oc.prompter = pr
+
+	form, err := oc.AuthenticateForm(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, form.SAMLResponse)
+	require.Equal(t, "YUBICO TOKEN:HARDWARE", form.MFAFactor)
+	require.Equal(t, 0, tr.Remaining())
+
+	verifyReq := VerifyRequest{}
+	require.Nil(t, json.Unmarshal(tr.Requests()[3].Body, &verifyReq))
+	require.Equal(t, "cccjgjgkhcbb", verifyReq.PassCode)
+}
+
+func TestClient_AuthenticateQuestionMfa(t *testing.T) {
+
+	verifyPath := "/api/v1/authn/factors/ufs1pe3ISGKGPYKXRBKK/verify"
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-question.json"))
+	require.Nil(t, tr.AddFile("POST", verifyPath, 200, "application/json", "example/verify-push-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	pr := &mocks.Prompter{}
+	pr.Mock.On("Password", "What is your favorite piece of art?").Return("Nighthawks", nil)
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+	oc.prompter = pr
+
+	form, err := oc.AuthenticateForm(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, form.SAMLResponse)
+	require.Equal(t, IdentifierQuestionMfa, form.MFAFactor)
+	require.Equal(t, 0, tr.Remaining())
+
+	// the question is answered in the first verify request
+	verifyReq := VerifyRequest{}
+	require.Nil(t, json.Unmarshal(tr.Requests()[2].Body, &verifyReq))
+	require.Equal(t, "Nighthawks", verifyReq.Answer)
+	require.Empty(t, verifyReq.PassCode)
+}
+
+func TestClient_AuthenticateQuestionMfaAllowUnknownFactors(t *testing.T) {
+
+	verifyPath := "/api/v1/authn/factors/ufs1pe3ISGKGPYKXRBKK/verify"
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-question.json"))
+	require.Nil(t, tr.AddFile("POST", verifyPath, 200, "application/json", "example/verify-push-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	pr := &mocks.Prompter{}
+	pr.Mock.On("Password", "What is your favorite piece of art?").Return("Nighthawks", nil)
+
+	oc, err := New(&cfg.IDPAccount{AllowUnknownFactors: true}, WithTransport(tr))
+	require.Nil(t, err)
+	oc.prompter = pr
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+
+	// the question is still answered rather than verified as an unknown factor with a passcode
+	verifyReq := VerifyRequest{}
+	require.Nil(t, json.Unmarshal(tr.Requests()[2].Body, &verifyReq))
+	require.Equal(t, "Nighthawks", verifyReq.Answer)
+	require.Empty(t, verifyReq.PassCode)
+}
+
+func TestClient_AuthenticateQuestionMfaWrongAnswer(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-question.json"))
+	tr.Add("POST", "/api/v1/authn/factors/ufs1pe3ISGKGPYKXRBKK/verify", 403, "application/json", []byte(`{"errorCode":"E0000087","errorSummary":"The recovery question answer did not match our records."}`))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr), WithMFACallback(func(factorType string) (string, error) {
+		require.Equal(t, IdentifierQuestionMfa, factorType)
+		return "Starry Night", nil
+	}))
+	require.Nil(t, err)
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.EqualError(t, err, "error verifying MFA: verification failed, error: The recovery question answer did not match our records.")
+}
+
+func TestClient_AuthenticateUnexpectedRequest(t *testing.T) {
+
+	tr := newClassicTransport()
+	tr.Add("POST", "/api/v1/authn", http.StatusOK, "application/json", []byte(`{"status":"SUCCESS","sessionToken":"abc123"}`))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.Error(t, err)
+}
+
+func TestClient_AuthenticateAppNotAssigned(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 403, "text/html", "example/app-not-assigned.html"))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "AWS app is not assigned to this user in Okta")
+	require.Contains(t, err.Error(), "error code: E0000022")
+	require.Contains(t, err.Error(), "status: 403")
+	require.Contains(t, err.Error(), "Example - Error")
+	require.Contains(t, err.Error(), "You do not have permission")
+}
+
+func TestClient_AuthenticatePasswordExpired(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-password-expired.json"))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "password has expired")
+	require.Contains(t, err.Error(), "https://example.okta.com")
+	require.Equal(t, 0, tr.Remaining())
+}
+
+func TestClient_AuthenticateMfaEnroll(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-enroll.json"))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.Error(t, err)
+	require.Equal(t, "your Okta account requires an MFA factor to be enrolled, please set one up by logging into https://example.okta.com in a browser", err.Error())
+	require.Equal(t, 0, tr.Remaining())
+}
+
+func TestClient_AuthenticatePasswordWarn(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-password-warn.json"))
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn/skip", 200, "application/json", "example/authn-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	out := &bytes.Buffer{}
+	provider.Output = out
+	defer func() { provider.Output = os.Stderr }()
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+
+	samlAssertion, err := oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+	require.Contains(t, out.String(), "expires in 5 day(s)")
+
+	skipReq := VerifyRequest{}
+	require.Nil(t, json.Unmarshal(tr.Requests()[2].Body, &skipReq))
+	require.Equal(t, "007ucIX7PATyn94hsHfOLVaXAmOBkKHWnOOLG43bsb", skipReq.StateToken)
+}
+
+func TestClient_AuthenticateMissingSAMLResponse(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-success.json"))
+	tr.Add("GET", "/login/sessionCookieRedirect", 200, "text/html", []byte("<html><head><title>Example</title></head><body>Sign in</body></html>"))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unable to locate saml response")
+	require.Contains(t, err.Error(), "Sign in")
+}
+
+func TestClient_AuthenticateRedactsError(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-success.json"))
+	tr.Add("GET", "/login/sessionCookieRedirect", 200, "text/html", []byte(`<html><body>Sign in stateToken="00BClWr4T-mnIqPV8dHkOQ"</body></html>`))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `stateToken=\"REDACTED\"`)
+	require.NotContains(t, err.Error(), "00BClWr4T")
+}
+
+func TestClient_AuthenticateOIDCApp(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-success.json"))
+	tr.Add("GET", "/login/sessionCookieRedirect", 200, "text/html", []byte(`<html><body><form method="POST" action="https://example.awsapps.com/callback"><input type="hidden" name="code" value="Jd8xF0aEXAMPLE"/><input type="hidden" name="state" value="c2F2ZWQ"/></form></body></html>`))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.Equal(t, ErrOIDCApp, err)
+}
+
+func TestExtractSAMLFormOIDCRedirect(t *testing.T) {
+
+	req, err := http.NewRequest("GET", "https://example.awsapps.com/callback?code=Jd8xF0aEXAMPLE&state=c2F2ZWQ", nil)
+	require.Nil(t, err)
+
+	res := &http.Response{StatusCode: 200, Request: req, Body: ioutil.NopCloser(bytes.NewBufferString("<html><body>Signing in</body></html>"))}
+
+	_, err = extractSAMLForm(res)
+	require.Equal(t, ErrOIDCApp, err)
+}
+
+func TestExtractSAMLFormNotHTML(t *testing.T) {
+
+	req, err := http.NewRequest("GET", "https://example.okta.com/login/sessionCookieRedirect", nil)
+	require.Nil(t, err)
+
+	res := &http.Response{StatusCode: 200, Request: req, Header: http.Header{"Content-Type": []string{"application/json"}}, Body: ioutil.NopCloser(bytes.NewBufferString(`{"errorCode":"E0000006"}`))}
+
+	_, err = extractSAMLForm(res)
+	require.EqualError(t, err, `expected a page from https://example.okta.com/login/sessionCookieRedirect but received "application/json", status: 200 body: "{\"errorCode\":\"E0000006\"}"`)
+}
+
+func TestClient_AuthenticateInterstitial(t *testing.T) {
+
+	samlRetryDelay = time.Millisecond
+	defer func() { samlRetryDelay = 2 * time.Second }()
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-success.json"))
+	tr.Add("GET", "/login/sessionCookieRedirect", 200, "text/html", []byte(exampleInterstitialPage))
+	require.Nil(t, tr.AddFile("GET", "/home/amazon_aws/0oa3ecigppJ0ZKlQe0h8/272", 200, "text/html", "example/saml.html"))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+
+	samlAssertion, err := oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+}
+
+func TestClient_AuthenticateInterstitialGivesUp(t *testing.T) {
+
+	samlRetryDelay = time.Millisecond
+	defer func() { samlRetryDelay = 2 * time.Second }()
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-success.json"))
+	tr.Add("GET", "/login/sessionCookieRedirect", 200, "text/html", []byte(exampleInterstitialPage))
+	tr.Add("GET", "/home/amazon_aws/0oa3ecigppJ0ZKlQe0h8/272", 200, "text/html", []byte(exampleInterstitialPage))
+	tr.Add("GET", "/home/amazon_aws/0oa3ecigppJ0ZKlQe0h8/272", 200, "text/html", []byte(exampleInterstitialPage))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.EqualError(t, err, `unable to locate saml response, status: 200 title: "Setting up your account" page: "Please wait while we finish setting up your account."`)
+	require.Equal(t, 0, tr.Remaining())
+}
+
+func TestClient_AuthenticateInvalidSAMLResponse(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-success.json"))
+	tr.Add("GET", "/login/sessionCookieRedirect", 200, "text/html", []byte(`<html><body><form method="POST" action="https://signin.aws.amazon.com/saml"><input type="hidden" name="SAMLResponse" value="U0FNTCBlcnJvcg=="/></form></body></html>`))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.EqualError(t, err, "invalid SAML assertion received, the value isn't XML")
+}
+
+func TestClient_AuthenticateSmsMfa(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-sms.json"))
+	require.Nil(t, tr.AddFile("POST", exampleSmsVerifyPath, 200, "application/json", "example/verify-sms-challenge.json"))
+	require.Nil(t, tr.AddFile("POST", exampleSmsVerifyPath, 200, "application/json", "example/verify-push-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	pr := &mocks.Prompter{}
+	pr.Mock.On("StringRequired", exampleSmsPrompt).Return("123456")
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+	oc.prompter = pr
+
+	samlAssertion, err := oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+
+	challengeReq := VerifyRequest{}
+	require.Nil(t, json.Unmarshal(tr.Requests()[2].Body, &challengeReq))
+	require.Equal(t, VerifyRequest{StateToken: "007ucIX7PATyn94hsHfOLVaXAmOBkKHWnOOLG43bsb"}, challengeReq)
+
+	verifyReq := VerifyRequest{}
+	require.Nil(t, json.Unmarshal(tr.Requests()[3].Body, &verifyReq))
+	require.Equal(t, VerifyRequest{StateToken: "007ucIX7PATyn94hsHfOLVaXAmOBkKHWnOOLG43bsb", PassCode: "123456"}, verifyReq)
+}
+
+func TestClient_AuthenticateSmsMfaCallback(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-sms.json"))
+	require.Nil(t, tr.AddFile("POST", exampleSmsVerifyPath, 200, "application/json", "example/verify-sms-challenge.json"))
+	require.Nil(t, tr.AddFile("POST", exampleSmsVerifyPath, 200, "application/json", "example/verify-push-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	var factorTypes []string
+	callback := func(factorType string) (string, error) {
+		factorTypes = append(factorTypes, factorType)
+		return "123456", nil
+	}
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr), WithMFACallback(callback))
+	require.Nil(t, err)
+	// no expectations are set so prompting for the code fails the test
+	oc.prompter = &mocks.Prompter{}
+
+	samlAssertion, err := oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, []string{IdentifierSmsMfa}, factorTypes)
+
+	verifyReq := VerifyRequest{}
+	require.Nil(t, json.Unmarshal(tr.Requests()[3].Body, &verifyReq))
+	require.Equal(t, "123456", verifyReq.PassCode)
+}
+
+func TestClient_AuthenticateSmsMfaInvalidPassCode(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-sms.json"))
+	require.Nil(t, tr.AddFile("POST", exampleSmsVerifyPath, 200, "application/json", "example/verify-sms-challenge.json"))
+	require.Nil(t, tr.AddFile("POST", exampleSmsVerifyPath, 403, "application/json", "example/verify-invalid-passcode.json"))
+	require.Nil(t, tr.AddFile("POST", exampleSmsVerifyPath, 403, "application/json", "example/verify-invalid-passcode.json"))
+	require.Nil(t, tr.AddFile("POST", exampleSmsVerifyPath, 403, "application/json", "example/verify-invalid-passcode.json"))
+
+	pr := &mocks.Prompter{}
+	pr.Mock.On("StringRequired", exampleSmsPrompt).Return("000000")
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+	oc.prompter = pr
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid Passcode/Answer")
+	require.Equal(t, 0, tr.Remaining())
+	pr.AssertNumberOfCalls(t, "StringRequired", maxSmsAttempts)
+}
+
+func TestClient_AuthenticateSmsMfaResend(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-sms.json"))
+	require.Nil(t, tr.AddFile("POST", exampleSmsVerifyPath, 200, "application/json", "example/verify-sms-challenge.json"))
+	require.Nil(t, tr.AddFile("POST", exampleSmsVerifyPath, 200, "application/json", "example/verify-sms-challenge.json"))
+	require.Nil(t, tr.AddFile("POST", exampleSmsVerifyPath, 403, "application/json", "example/verify-invalid-passcode.json"))
+	require.Nil(t, tr.AddFile("POST", exampleSmsVerifyPath, 200, "application/json", "example/verify-push-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	pr := &mocks.Prompter{}
+	pr.Mock.On("StringRequired", exampleSmsPrompt).Return("resend").Once()
+	pr.Mock.On("StringRequired", exampleSmsPrompt).Return("000000").Once()
+	pr.Mock.On("StringRequired", exampleSmsPrompt).Return("123456").Once()
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+	oc.prompter = pr
+
+	samlAssertion, err := oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+
+	resendReq := VerifyRequest{}
+	require.Nil(t, json.Unmarshal(tr.Requests()[3].Body, &resendReq))
+	require.Equal(t, VerifyRequest{StateToken: "007ucIX7PATyn94hsHfOLVaXAmOBkKHWnOOLG43bsb"}, resendReq)
+
+	verifyReq := VerifyRequest{}
+	require.Nil(t, json.Unmarshal(tr.Requests()[5].Body, &verifyReq))
+	require.Equal(t, VerifyRequest{StateToken: "007ucIX7PATyn94hsHfOLVaXAmOBkKHWnOOLG43bsb", PassCode: "123456"}, verifyReq)
+}
+
+func TestClient_AuthenticateCallMfaRetry(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-call.json"))
+	require.Nil(t, tr.AddFile("POST", exampleCallVerifyPath, 200, "application/json", "example/verify-call-challenge.json"))
+	require.Nil(t, tr.AddFile("POST", exampleCallVerifyPath, 403, "application/json", "example/verify-invalid-passcode.json"))
+	require.Nil(t, tr.AddFile("POST", exampleCallVerifyPath, 200, "application/json", "example/verify-push-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	pr := &mocks.Prompter{}
+	pr.Mock.On("StringRequired", exampleCallPrompt).Return("000000").Once()
+	pr.Mock.On("StringRequired", exampleCallPrompt).Return("123456").Once()
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+	oc.prompter = pr
+
+	samlAssertion, err := oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+
+	verifyReq := VerifyRequest{}
+	require.Nil(t, json.Unmarshal(tr.Requests()[4].Body, &verifyReq))
+	require.Equal(t, VerifyRequest{StateToken: "007ucIX7PATyn94hsHfOLVaXAmOBkKHWnOOLG43bsb", PassCode: "123456"}, verifyReq)
+}
+
+func TestClient_AuthenticateCallMfaInvalidPassCode(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-call.json"))
+	require.Nil(t, tr.AddFile("POST", exampleCallVerifyPath, 200, "application/json", "example/verify-call-challenge.json"))
+	require.Nil(t, tr.AddFile("POST", exampleCallVerifyPath, 403, "application/json", "example/verify-invalid-passcode.json"))
+	require.Nil(t, tr.AddFile("POST", exampleCallVerifyPath, 403, "application/json", "example/verify-invalid-passcode.json"))
+
+	pr := &mocks.Prompter{}
+	pr.Mock.On("StringRequired", exampleCallPrompt).Return("000000")
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+	oc.prompter = pr
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid Passcode/Answer")
+	require.Equal(t, 0, tr.Remaining())
+	pr.AssertNumberOfCalls(t, "StringRequired", maxCallAttempts)
+}
+
+func TestClient_AuthenticateSmsMfaSelectsPhoneNumber(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-sms-multiple.json"))
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn/factors/sms2gt8gzgEBPUWBIFHN/verify", 200, "application/json", "example/verify-sms-challenge.json"))
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn/factors/sms2gt8gzgEBPUWBIFHN/verify", 200, "application/json", "example/verify-push-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	options := []string{
+		"SMS MFA authentication (+1 XXX-XXX-1337)",
+		"SMS MFA authentication (+61 XXX-XXX-4242)",
+	}
+
+	pr := &mocks.Prompter{}
+	pr.Mock.On("Choice", "Select which MFA option to use", options).Return(options[1])
+	pr.Mock.On("StringRequired", exampleSmsPrompt).Return("123456")
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+	oc.prompter = pr
+
+	samlAssertion, err := oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+}
+
+func TestClient_AuthenticateMfaIndexFromEnv(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-sms-multiple.json"))
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn/factors/sms2gt8gzgEBPUWBIFHN/verify", 200, "application/json", "example/verify-sms-challenge.json"))
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn/factors/sms2gt8gzgEBPUWBIFHN/verify", 200, "application/json", "example/verify-push-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	os.Setenv(provider.MFAIndexEnvVar, "1")
+	defer os.Unsetenv(provider.MFAIndexEnvVar)
+
+	// the factor isn't prompted for
+	pr := &mocks.Prompter{}
+	pr.Mock.On("StringRequired", exampleSmsPrompt).Return("123456")
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+	oc.prompter = pr
+
+	samlAssertion, err := oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+	pr.AssertExpectations(t)
+}
+
+func TestClient_AuthenticateMfaIndexOutOfRange(t *testing.T) {
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-sms-multiple.json"))
+
+	os.Setenv(provider.MFAIndexEnvVar, "2")
+	defer os.Unsetenv(provider.MFAIndexEnvVar)
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+	oc.prompter = &mocks.Prompter{}
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.EqualError(t, err, "error verifying MFA: SAML2AWS_MFA_INDEX 2 is out of range, there are 2 mfa options numbered from 0")
+}
+
+func TestDuoParent(t *testing.T) {
+
+	verification := gjson.Parse(`{
+		"signature": "TX|dHhfc2lnbmF0dXJl|1516421660:APP|YXBwX3NpZ25hdHVyZQ==|1516425260",
+		"host": "api-1234abcd.duosecurity.com",
+		"_links": {
+			"complete": {
+				"href": "https://login.example.com/api/v1/authn/factors/dsflnpo99zpfMyaij0g3/lifecycle/duoCallback"
+			}
+		}
+	}`)
+	require.Equal(t, "https://login.example.com/signin/verify/duo/web", duoParent(verification, "example.okta.com"))
+
+	// without a callback the parent is on the host of the duo script
+	verification = gjson.Parse(`{"_links":{"script":{"href":"https://login.example.com/js/sdk/duo.js"}}}`)
+	require.Equal(t, "https://login.example.com/signin/verify/duo/web", duoParent(verification, "example.okta.com"))
+
+	// without either link the parent is on the org host
+	require.Equal(t, "https://example.okta.com/signin/verify/duo/web", duoParent(gjson.Parse(`{}`), "example.okta.com"))
+}
+
+func TestDuoCallbackURL(t *testing.T) {
+
+	verification := gjson.Parse(`{"_links":{"complete":{"href":"https://login.example.com/api/v1/authn/factors/dsflnpo99zpfMyaij0g3/lifecycle/duoCallback"}}}`)
+	require.Equal(t, "https://login.example.com/api/v1/authn/factors/dsflnpo99zpfMyaij0g3/lifecycle/duoCallback", duoCallbackURL(verification, "example.okta.com"))
+
+	// a relative callback is on the org host
+	verification = gjson.Parse(`{"_links":{"complete":{"href":"/api/v1/authn/factors/dsflnpo99zpfMyaij0g3/lifecycle/duoCallback"}}}`)
+	require.Equal(t, "https://example.okta.com/api/v1/authn/factors/dsflnpo99zpfMyaij0g3/lifecycle/duoCallback", duoCallbackURL(verification, "example.okta.com"))
+	require.Equal(t, "https://example.okta.com/signin/verify/duo/web", duoParent(verification, "example.okta.com"))
+
+	require.Equal(t, "", duoCallbackURL(gjson.Parse(`{}`), "example.okta.com"))
+}
+
+func TestVerifiedFactor(t *testing.T) {
+
+	for _, fixture := range []string{"example/verify-duo-challenge.json", "example/verify-duo-challenge-factors.json"} {
+		data, err := ioutil.ReadFile(fixture)
+		require.Nil(t, err)
+
+		factor := verifiedFactor(string(data), "dsflnpo99zpfMyaij0g3")
+		require.Equal(t, "DUO", factor.Get("provider").String(), fixture)
+		require.Equal(t, "api-1234abcd.duosecurity.com", factor.Get("_embedded.verification.host").String(), fixture)
+	}
+
+	resp := `{"_embedded":{"factors":[{"id":"sms193zUBEROPBNZKPPE"},{"id":"dsflnpo99zpfMyaij0g3","provider":"DUO"}]}}`
+	require.Equal(t, "DUO", verifiedFactor(resp, "dsflnpo99zpfMyaij0g3").Get("provider").String())
+	require.False(t, verifiedFactor(resp, "opf3hkfocI4JTLAju0g4").Exists())
+	require.False(t, verifiedFactor(`{"status":"MFA_CHALLENGE"}`, "dsflnpo99zpfMyaij0g3").Exists())
+}
+
+func TestClient_AuthenticateRemembersMfaOption(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	options := []string{
+		"SMS MFA authentication (+1 XXX-XXX-1337)",
+		"SMS MFA authentication (+61 XXX-XXX-4242)",
+	}
+
+	login := func(pr *mocks.Prompter, loginDetails *creds.LoginDetails) {
+		tr := newClassicTransport()
+		require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-sms-multiple.json"))
+		require.Nil(t, tr.AddFile("POST", "/api/v1/authn/factors/sms2gt8gzgEBPUWBIFHN/verify", 200, "application/json", "example/verify-sms-challenge.json"))
+		require.Nil(t, tr.AddFile("POST", "/api/v1/authn/factors/sms2gt8gzgEBPUWBIFHN/verify", 200, "application/json", "example/verify-push-success.json"))
+		require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+		pr.Mock.On("StringRequired", exampleSmsPrompt).Return("123456")
+
+		oc, err := New(&cfg.IDPAccount{MFARemember: true}, WithTransport(tr))
+		require.Nil(t, err)
+		oc.prompter = pr
+		oc.mfaChoiceFile = filepath.Join(dir, "mfa")
+
+		_, err = oc.Authenticate(loginDetails)
+		require.Nil(t, err)
+		require.Equal(t, 0, tr.Remaining())
+	}
+
+	// the first login prompts and remembers the choice
+	pr := &mocks.Prompter{}
+	pr.Mock.On("Choice", "Select which MFA option to use", options).Return(options[1])
+	login(pr, exampleLoginDetails)
+	pr.AssertNumberOfCalls(t, "Choice", 1)
+
+	// which is used by the next without prompting
+	pr = &mocks.Prompter{}
+	login(pr, exampleLoginDetails)
+	pr.AssertNotCalled(t, "Choice", "Select which MFA option to use", options)
+
+	// unless the login asks to be prompted again
+	pr = &mocks.Prompter{}
+	pr.Mock.On("Choice", "Select which MFA option to use", options).Return(options[1])
+	promptDetails := *exampleLoginDetails
+	promptDetails.PromptMFA = true
+	login(pr, &promptDetails)
+	pr.AssertNumberOfCalls(t, "Choice", 1)
+}
+
+func TestClient_AuthenticateDuoRememberedDevice(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cookieFile := filepath.Join(dir, "cookies")
+	duoURL := &url.URL{Scheme: "https", Host: "api-1234abcd.duosecurity.com"}
+
+	jar, err := cookiejar.New(nil)
+	require.Nil(t, err)
+	jar.SetCookies(duoURL, []*http.Cookie{{Name: "duo-remember", Value: "abc123"}})
+	require.Nil(t, provider.SaveCookies(cookieFile, jar, duoURL))
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-duo.json"))
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn/factors/dsflnpo99zpfMyaij0g3/verify", 200, "application/json", "example/verify-duo-challenge.json"))
+	require.Nil(t, tr.AddFile("POST", "/frame/web/v1/auth", 200, "text/html", "example/duo-remembered.html"))
+	tr.Add("POST", "/api/v1/authn/factors/dsflnpo99zpfMyaij0g3/lifecycle/duoCallback", 200, "text/html", []byte(""))
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn/factors/dsflnpo99zpfMyaij0g3/verify", 200, "application/json", "example/verify-push-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	oc, err := New(&cfg.IDPAccount{DuoRememberDevice: true}, WithTransport(tr))
+	require.Nil(t, err)
+	oc.cookieFile = cookieFile
+
+	samlAssertion, err := oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+
+	require.Equal(t, "duo-remember=abc123", tr.Requests()[3].Header.Get("Cookie"))
+
+	duoAuth, err := url.ParseQuery(string(tr.Requests()[3].Body))
+	require.Nil(t, err)
+	require.Equal(t, "https://example.okta.com/signin/verify/duo/web", duoAuth.Get("parent"))
+
+	callback, err := url.ParseQuery(string(tr.Requests()[4].Body))
+	require.Nil(t, err)
+	require.Equal(t, "AUTH|aXNhYWMuYnJvY2tAZXhhbXBsZS5jb20=|1516421700:APP|YXBwX3NpZ25hdHVyZQ==|1516425260", callback.Get("sig_response"))
+
+	// the callback page had no xsrf token so the header is omitted rather than sent empty
+	_, ok := tr.Requests()[5].Header["X-Okta-Xsrftoken"]
+	require.False(t, ok)
+}
+
+func TestClient_AuthenticateDuoIntegrationHost(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cookieFile := filepath.Join(dir, "cookies")
+	duoURL := &url.URL{Scheme: "https", Host: "api-5678efgh.duosecurity.com"}
+
+	jar, err := cookiejar.New(nil)
+	require.Nil(t, err)
+	jar.SetCookies(duoURL, []*http.Cookie{{Name: "duo-remember", Value: "abc123"}})
+	require.Nil(t, provider.SaveCookies(cookieFile, jar, duoURL))
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-mfa-duo.json"))
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn/factors/dsflnpo99zpfMyaij0g3/verify", 200, "application/json", "example/verify-duo-challenge-integrations.json"))
+	require.Nil(t, tr.AddFile("POST", "/frame/web/v1/auth", 200, "text/html", "example/duo-remembered.html"))
+	tr.Add("POST", "/api/v1/authn/factors/dsflnpo99zpfMyaij0g3/lifecycle/duoCallback", 200, "text/html", []byte(""))
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn/factors/dsflnpo99zpfMyaij0g3/verify", 200, "application/json", "example/verify-push-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	oc, err := New(&cfg.IDPAccount{DuoRememberDevice: true}, WithTransport(tr))
+	require.Nil(t, err)
+	oc.cookieFile = cookieFile
+
+	samlAssertion, err := oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+
+	// the duo host, parent and callback are those of the verified factor rather than the first duo integration
+	require.Equal(t, "api-5678efgh.duosecurity.com", tr.Requests()[3].URL.Host)
+	require.Equal(t, "TX|dHhfc2lnbmF0dXJl|1516421660", tr.Requests()[3].URL.Query().Get("tx"))
+	require.Equal(t, "duo-remember=abc123", tr.Requests()[3].Header.Get("Cookie"))
+
+	duoAuth, err := url.ParseQuery(string(tr.Requests()[3].Body))
+	require.Nil(t, err)
+	require.Equal(t, "https://login.example.com/signin/verify/duo/web", duoAuth.Get("parent"))
+
+	require.Equal(t, "login.example.com", tr.Requests()[4].URL.Host)
+
+	callback, err := url.ParseQuery(string(tr.Requests()[4].Body))
+	require.Nil(t, err)
+	require.Equal(t, "dsflnpo99zpfMyaij0g3", callback.Get("id"))
+	require.Equal(t, "AUTH|aXNhYWMuYnJvY2tAZXhhbXBsZS5jb20=|1516421700:APP|YXBwX3NpZ25hdHVyZQ==|1516425260", callback.Get("sig_response"))
+}
+
+func TestExtractXsrfToken(t *testing.T) {
+
+	res := &http.Response{Header: http.Header{}}
+	page := []byte(`<html><body><span id="_xsrfToken">d3b9a0c6e7f1</span></body></html>`)
+	require.Equal(t, "d3b9a0c6e7f1", extractXsrfToken(res, page))
+
+	res.Header.Add("Set-Cookie", "xsrf-token=8f2e41c7; Path=/; Secure")
+	require.Equal(t, "8f2e41c7", extractXsrfToken(res, []byte("")))
+
+	require.Equal(t, "", extractXsrfToken(&http.Response{Header: http.Header{}}, []byte("<html></html>")))
+}
+
+func TestClient_AuthenticatePersistsCookies(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cookieFile := filepath.Join(dir, "cookies")
+	oktaURL := &url.URL{Scheme: "https", Host: "example.okta.com"}
+
+	jar, err := cookiejar.New(nil)
+	require.Nil(t, err)
+	jar.SetCookies(oktaURL, []*http.Cookie{{Name: "sid", Value: "okta-session"}})
+	require.Nil(t, provider.SaveCookies(cookieFile, jar, oktaURL))
+
+	tr := newClassicTransport()
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	oc, err := New(&cfg.IDPAccount{URL: exampleAppURL, CookieFile: cookieFile}, WithTransport(tr))
+	require.Nil(t, err)
+
+	oc.client.Jar.SetCookies(oktaURL, []*http.Cookie{{Name: "DT", Value: "device-token"}})
+
+	_, err = oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Contains(t, tr.Requests()[1].Header.Get("Cookie"), "sid=okta-session")
+
+	loaded, err := cookiejar.New(nil)
+	require.Nil(t, err)
+	require.Nil(t, provider.LoadCookies(cookieFile, loaded, oktaURL))
+	require.Len(t, loaded.Cookies(oktaURL), 2)
+
+	info, err := os.Stat(cookieFile)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestClient_Logout(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cookieFile := filepath.Join(dir, "cookies")
+	oktaURL := &url.URL{Scheme: "https", Host: "example.okta.com"}
+	duoURL := &url.URL{Scheme: "https", Host: "api-1234abcd.duosecurity.com"}
+
+	jar, err := cookiejar.New(nil)
+	require.Nil(t, err)
+	jar.SetCookies(oktaURL, []*http.Cookie{{Name: "sid", Value: "okta-session"}})
+	jar.SetCookies(duoURL, []*http.Cookie{{Name: "remember", Value: "duo-device"}})
+	require.Nil(t, provider.SaveCookies(cookieFile, jar, oktaURL))
+	require.Nil(t, provider.SaveCookies(cookieFile, jar, duoURL))
+
+	tr := replay.New().Add("DELETE", "/api/v1/sessions/me", 204, "application/json", nil)
+
+	oc, err := New(&cfg.IDPAccount{URL: exampleAppURL, CookieFile: cookieFile}, WithTransport(tr))
+	require.Nil(t, err)
+
+	require.Nil(t, oc.Logout())
+	require.Equal(t, 0, tr.Remaining())
+	require.Contains(t, tr.Requests()[0].Header.Get("Cookie"), "sid=okta-session")
+	require.Len(t, oc.client.Jar.Cookies(oktaURL), 0)
+
+	// the duo remembered device isn't part of the okta session so is kept
+	loaded, err := cookiejar.New(nil)
+	require.Nil(t, err)
+	require.Nil(t, provider.LoadCookies(cookieFile, loaded, oktaURL))
+	require.Nil(t, provider.LoadCookies(cookieFile, loaded, duoURL))
+	require.Len(t, loaded.Cookies(oktaURL), 0)
+	require.Len(t, loaded.Cookies(duoURL), 1)
+}
+
+func TestClient_LogoutUnexpectedStatus(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cookieFile := filepath.Join(dir, "cookies")
+	oktaURL := &url.URL{Scheme: "https", Host: "example.okta.com"}
+
+	jar, err := cookiejar.New(nil)
+	require.Nil(t, err)
+	jar.SetCookies(oktaURL, []*http.Cookie{{Name: "sid", Value: "okta-session"}})
+	require.Nil(t, provider.SaveCookies(cookieFile, jar, oktaURL))
+
+	tr := replay.New().Add("DELETE", "/api/v1/sessions/me", 403, "application/json", []byte(`{"errorCode":"E0000006"}`))
+
+	oc, err := New(&cfg.IDPAccount{URL: exampleAppURL, CookieFile: cookieFile}, WithTransport(tr))
+	require.Nil(t, err)
+
+	err = oc.Logout()
+	require.EqualError(t, err, "error ending okta session, unexpected status 403 Forbidden")
+
+	// the cookies are discarded even though the session couldn't be ended
+	require.Len(t, oc.client.Jar.Cookies(oktaURL), 0)
+
+	loaded, err := cookiejar.New(nil)
+	require.Nil(t, err)
+	require.Nil(t, provider.LoadCookies(cookieFile, loaded, oktaURL))
+	require.Len(t, loaded.Cookies(oktaURL), 0)
+}
+
+func TestClient_AuthenticateRateLimited(t *testing.T) {
+
+	tr := newClassicTransport().AddResponse(&replay.Response{
+		Method:     "POST",
+		Path:       "/api/v1/authn",
+		StatusCode: 429,
+		Header:     http.Header{"Content-Type": []string{"application/json"}, "Retry-After": []string{"0"}},
+		Body:       []byte(`{"errorCode":"E0000047","errorSummary":"API call exceeded rate limit due to too many requests."}`),
+	})
+	require.Nil(t, tr.AddFile("POST", "/api/v1/authn", 200, "application/json", "example/authn-success.json"))
+	require.Nil(t, tr.AddFile("GET", "/login/sessionCookieRedirect", 200, "text/html", "example/saml.html"))
+
+	oc, err := New(&cfg.IDPAccount{}, WithTransport(tr))
+	require.Nil(t, err)
+
+	samlAssertion, err := oc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+}
@@ -0,0 +1,10 @@
+package provider
+
+import (
+	"io"
+	"os"
+)
+
+// Output the writer providers report progress to, such as waiting for an MFA approval. This defaults to
+// stderr so it doesn't mix with credentials written to stdout, library users can redirect or discard it.
+var Output io.Writer = os.Stderr
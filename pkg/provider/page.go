@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/versent/saml2aws/pkg/dump"
+)
+
+// Page the url and content of a page in the login flow, for providers which read settings embedded in the
+// page as well as its forms
+type Page struct {
+	URL  *url.URL
+	Data []byte
+}
+
+// ReadPage read the page in the response and close its body
+func ReadPage(res *http.Response) (*Page, error) {
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving body from response")
+	}
+
+	return &Page{URL: res.Request.URL, Data: data}, nil
+}
+
+// SubmitForm post the form to the action, which is resolved against the url of the page it is on, and read
+// the page in the response
+func (client *HTTPClient) SubmitForm(base *url.URL, action string, form url.Values) (*Page, error) {
+
+	submitURL, err := base.Parse(action)
+	if err != nil {
+		return nil, errors.Wrap(err, "error building submit url")
+	}
+
+	req, err := http.NewRequest("POST", submitURL.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building request")
+	}
+
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving response")
+	}
+
+	logrus.WithField("status", res.StatusCode).WithField("url", submitURL).WithField("res", dump.ResponseString(res)).Debug("POST")
+
+	return ReadPage(res)
+}
+
+// ExtractSAMLResponse extract the assertion from the form on the page which posts it to AWS
+func (p *Page) ExtractSAMLResponse() (string, error) {
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(p.Data))
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing page")
+	}
+
+	return ExtractSAMLResponse(doc)
+}
@@ -0,0 +1,37 @@
+package provider
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/provider/replay"
+)
+
+func TestSubmitForm(t *testing.T) {
+
+	tr := replay.New().
+		Add("POST", "/login/callback", 200, "text/html", []byte(`<form><input name="SAMLResponse" value="PHNhbWxwOlJlc3BvbnNlLz4="/></form>`)).
+		Add("POST", "/login/callback", 200, "text/html", []byte(`<form><input name="wresult" value="x"/></form>`))
+
+	client, err := NewHTTPClient(tr)
+	require.Nil(t, err)
+
+	base, err := url.Parse("https://idp.example.com/login?state=abc")
+	require.Nil(t, err)
+
+	p, err := client.SubmitForm(base, "/login/callback", url.Values{"wa": {"wsignin1.0"}})
+	require.Nil(t, err)
+	require.Equal(t, "https://idp.example.com/login/callback", p.URL.String())
+	require.Equal(t, "wa=wsignin1.0", string(tr.Requests()[0].Body))
+
+	samlAssertion, err := p.ExtractSAMLResponse()
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlLz4=", samlAssertion)
+
+	p, err = client.SubmitForm(base, "/login/callback", url.Values{})
+	require.Nil(t, err)
+
+	_, err = p.ExtractSAMLResponse()
+	require.Equal(t, ErrSAMLResponseNotFound, err)
+}
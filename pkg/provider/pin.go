@@ -0,0 +1,93 @@
+package provider
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CertificatePinMismatchError returned when the certificate presented by the IdP isn't the pinned one
+type CertificatePinMismatchError struct {
+	Host        string
+	Fingerprint string
+}
+
+func (e *CertificatePinMismatchError) Error() string {
+	return "certificate presented by " + e.Host + " doesn't match the pinned certificate, its SHA-256 fingerprint is " + e.Fingerprint
+}
+
+// ParseCertificatePin the SHA-256 fingerprint of a certificate, as hex with or without colons between the bytes
+// as printed by openssl x509 -fingerprint -sha256
+func ParseCertificatePin(pin string) ([]byte, error) {
+	fingerprint, err := hex.DecodeString(strings.Replace(strings.TrimSpace(pin), ":", "", -1))
+	if err != nil || len(fingerprint) != sha256.Size {
+		return nil, errors.Errorf("invalid certificate pin %q, expected the hex SHA-256 fingerprint of the certificate", pin)
+	}
+
+	return fingerprint, nil
+}
+
+// SetCertificatePin only trust the IdP when its leaf certificate has the pinned SHA-256 fingerprint. Connections
+// to other hosts, such as Duo, are verified as usual, so when skip verify is set they fail as only the pinned
+// certificate is trusted without verification. An error is returned when the pin or url is invalid, or the
+// transport has been replaced with one other than a http.Transport.
+func (client *HTTPClient) SetCertificatePin(idpURL, pin string) error {
+	fingerprint, err := ParseCertificatePin(pin)
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(idpURL)
+	if err != nil || u.Hostname() == "" {
+		return errors.Errorf("unable to pin the certificate of %q, it isn't a url", idpURL)
+	}
+
+	httpTransport, err := client.httpTransport()
+	if err != nil {
+		return errors.Wrap(err, "unable to pin the certificate")
+	}
+
+	if httpTransport.TLSClientConfig == nil {
+		httpTransport.TLSClientConfig = &tls.Config{}
+	}
+
+	httpTransport.TLSClientConfig.VerifyPeerCertificate = verifyCertificatePin(u.Hostname(), fingerprint)
+
+	return nil
+}
+
+// verifyCertificatePin check the leaf certificate has the fingerprint when it is for the host, certificates for
+// other hosts must have been verified against the trusted CAs
+func verifyCertificatePin(host string, fingerprint []byte) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.Errorf("no certificate presented, expected the pinned certificate of %s", host)
+		}
+
+		leaf, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return errors.Wrap(err, "error parsing certificate")
+		}
+
+		if leaf.VerifyHostname(host) != nil {
+			if len(verifiedChains) == 0 {
+				return errors.Errorf("certificate for %s isn't trusted, only the pinned certificate of %s is trusted without verification", leaf.Subject.CommonName, host)
+			}
+
+			return nil
+		}
+
+		sum := sha256.Sum256(rawCerts[0])
+		if !bytes.Equal(sum[:], fingerprint) {
+			return &CertificatePinMismatchError{Host: host, Fingerprint: strings.ToUpper(hex.EncodeToString(sum[:]))}
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,80 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/provider/replay"
+)
+
+func TestParseCertificatePin(t *testing.T) {
+
+	fingerprint, err := ParseCertificatePin("AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89")
+	require.Nil(t, err)
+	require.Len(t, fingerprint, sha256.Size)
+
+	fingerprint, err = ParseCertificatePin(" abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789 ")
+	require.Nil(t, err)
+	require.Equal(t, byte(0xab), fingerprint[0])
+
+	for _, pin := range []string{"", "abcdef", "zz:cd:ef:01:23:45:67:89:ab:cd:ef:01:23:45:67:89:ab:cd:ef:01:23:45:67:89:ab:cd:ef:01:23:45:67:89"} {
+		_, err = ParseCertificatePin(pin)
+		require.Error(t, err, pin)
+	}
+}
+
+func TestSetCertificatePin(t *testing.T) {
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	sum := sha256.Sum256(ts.Certificate().Raw)
+	pin := hex.EncodeToString(sum[:])
+
+	// the test server certificate is self signed, so it is only trusted through the pin
+	client, err := NewHTTPClient(NewDefaultTransport(true))
+	require.Nil(t, err)
+	require.Nil(t, client.SetCertificatePin(ts.URL, pin))
+
+	res, err := client.Get(ts.URL)
+	require.Nil(t, err)
+	res.Body.Close()
+
+	client, err = NewHTTPClient(NewDefaultTransport(true))
+	require.Nil(t, err)
+	require.Nil(t, client.SetCertificatePin(ts.URL, strings.Repeat("00", sha256.Size)))
+
+	_, err = client.Get(ts.URL)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "certificate presented by 127.0.0.1 doesn't match the pinned certificate, its SHA-256 fingerprint is "+strings.ToUpper(pin))
+
+	require.EqualError(t, client.SetCertificatePin(ts.URL, "abcdef"), `invalid certificate pin "abcdef", expected the hex SHA-256 fingerprint of the certificate`)
+
+	client.Transport = replay.New()
+	require.EqualError(t, client.SetCertificatePin(ts.URL, pin), "unable to pin the certificate: transport *replay.Transport isn't a http.Transport")
+}
+
+func TestSetCertificatePinOtherHost(t *testing.T) {
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	// the test server certificate is for example.com, so as it isn't for the pinned host it must be verified,
+	// which the self signed certificate can't be
+	client, err := NewHTTPClient(NewDefaultTransport(true))
+	require.Nil(t, err)
+	require.Nil(t, client.SetCertificatePin("https://idp.example.corp/", strings.Repeat("00", sha256.Size)))
+
+	_, err = client.Get(ts.URL)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "only the pinned certificate of idp.example.corp is trusted without verification")
+}
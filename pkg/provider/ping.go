@@ -0,0 +1,116 @@
+package provider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultPingTimeout how long Ping waits for the IdP to respond
+const DefaultPingTimeout = 5 * time.Second
+
+// PingStatus why Ping couldn't reach the IdP
+type PingStatus string
+
+const (
+	// PingDNSFailure the host name of the IdP couldn't be resolved
+	PingDNSFailure PingStatus = "dns-failure"
+
+	// PingConnectFailure the IdP refused the connection or didn't respond in time
+	PingConnectFailure PingStatus = "connect-failure"
+
+	// PingTLSFailure the TLS handshake failed, such as when the certificate isn't trusted
+	PingTLSFailure PingStatus = "tls-failure"
+
+	// PingServerError the IdP responded with a 5xx status
+	PingServerError PingStatus = "server-error"
+)
+
+// PingError returned by Ping when the IdP can't be reached, Status classifies the failure
+type PingError struct {
+	Host       string
+	Status     PingStatus
+	StatusCode int
+	Err        error
+}
+
+func (e *PingError) Error() string {
+	switch e.Status {
+	case PingDNSFailure:
+		return fmt.Sprintf("can't reach %s, the host name couldn't be resolved, is the VPN connected? (%v)", e.Host, e.Err)
+	case PingConnectFailure:
+		return fmt.Sprintf("can't reach %s, is the VPN connected? (%v)", e.Host, e.Err)
+	case PingTLSFailure:
+		return fmt.Sprintf("can't establish a secure connection to %s, is a proxy intercepting the connection or the certificate untrusted? (%v)", e.Host, e.Err)
+	default:
+		return fmt.Sprintf("%s is unavailable, it responded with status %d", e.Host, e.StatusCode)
+	}
+}
+
+// Ping check the IdP can be reached, before logging in, by requesting the root of the host. Client errors such
+// as 404 are expected from the root of some IdPs so only server errors are reported. The error is a PingError
+// when the IdP can't be reached.
+func Ping(host string, skipVerify bool) error {
+	client := &http.Client{
+		Transport: NewDefaultTransport(skipVerify),
+		Timeout:   DefaultPingTimeout,
+		// the response to the root is enough to know the IdP is up
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return ping(client, (&url.URL{Scheme: "https", Host: host, Path: "/"}).String(), host)
+}
+
+func ping(client *http.Client, rootURL, host string) error {
+	req, err := http.NewRequest("GET", rootURL, nil)
+	if err != nil {
+		return errors.Wrap(err, "error building ping request")
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return &PingError{Host: host, Status: classifyPingError(err), Err: err}
+	}
+	res.Body.Close()
+
+	if res.StatusCode >= http.StatusInternalServerError {
+		return &PingError{Host: host, Status: PingServerError, StatusCode: res.StatusCode}
+	}
+
+	return nil
+}
+
+func classifyPingError(err error) PingStatus {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+
+	if opErr, ok := err.(*net.OpError); ok {
+		if _, ok := opErr.Err.(*net.DNSError); ok {
+			return PingDNSFailure
+		}
+	}
+
+	switch err.(type) {
+	case *net.DNSError:
+		return PingDNSFailure
+	case x509.UnknownAuthorityError, x509.HostnameError, x509.CertificateInvalidError, tls.RecordHeaderError:
+		return PingTLSFailure
+	}
+
+	// other handshake failures, such as an alert from the server, aren't typed
+	if strings.HasPrefix(err.Error(), "tls:") {
+		return PingTLSFailure
+	}
+
+	return PingConnectFailure
+}
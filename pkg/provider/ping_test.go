@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPing(t *testing.T) {
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/down/":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	host := strings.TrimPrefix(ts.URL, "https://")
+
+	// the root of the IdP not being found still shows it is up
+	require.Nil(t, ping(ts.Client(), ts.URL+"/", host))
+
+	err := ping(ts.Client(), ts.URL+"/down/", host)
+	require.Equal(t, &PingError{Host: host, Status: PingServerError, StatusCode: 503}, err)
+	require.Equal(t, host+" is unavailable, it responded with status 503", err.Error())
+
+	// the test server certificate isn't trusted by the default client
+	err = ping(&http.Client{}, ts.URL+"/", host)
+	require.Equal(t, PingTLSFailure, err.(*PingError).Status)
+
+	require.Nil(t, Ping(host, true))
+}
+
+func TestPingConnectFailure(t *testing.T) {
+
+	ts := httptest.NewServer(http.NotFoundHandler())
+	host := strings.TrimPrefix(ts.URL, "http://")
+	ts.Close()
+
+	err := ping(&http.Client{}, "http://"+host+"/", host)
+	require.Equal(t, PingConnectFailure, err.(*PingError).Status)
+	require.Contains(t, err.Error(), "is the VPN connected?")
+}
+
+func TestClassifyPingError(t *testing.T) {
+
+	err := ping(&http.Client{}, "https://idp.invalid/", "idp.invalid")
+	require.Equal(t, PingDNSFailure, err.(*PingError).Status)
+}
@@ -8,11 +8,11 @@ import (
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/pkg/errors"
-	prompt "github.com/segmentio/go-prompt"
 	"github.com/sirupsen/logrus"
 	"github.com/versent/saml2aws/pkg/cfg"
 	"github.com/versent/saml2aws/pkg/creds"
 	"github.com/versent/saml2aws/pkg/dump"
+	"github.com/versent/saml2aws/pkg/prompter"
 	"github.com/versent/saml2aws/pkg/provider"
 )
 
@@ -21,6 +21,7 @@ var logger = logrus.WithField("provider", "pingfed")
 // Client wrapper around PingFed + PingId enabling authentication and retrieval of assertions
 type Client struct {
 	client        *provider.HTTPClient
+	prompter      prompter.Prompter
 	idpAccount    *cfg.IDPAccount
 	authSubmitURL string
 	samlAssertion string
@@ -32,9 +33,9 @@ func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
 	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
 
-	client, err := provider.NewHTTPClient(tr)
+	client, err := provider.NewHTTPClientForAccount(tr, idpAccount)
 	if err != nil {
-		return nil, errors.Wrap(err, "error building http client")
+		return nil, err
 	}
 
 	//disable default behaviour to follow redirects as we use this to detect mfa
@@ -42,6 +43,7 @@ func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
 	return &Client{
 		client:      client,
+		prompter:    prompter.ActivePrompter,
 		idpAccount:  idpAccount,
 		mfaRequired: false,
 	}, nil
@@ -61,7 +63,7 @@ func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 		return "", errors.Wrap(err, "error retieving form")
 	}
 
-	doc, err := goquery.NewDocumentFromResponse(res)
+	doc, err := provider.NewDocumentFromResponse(res)
 	if err != nil {
 		return "", errors.Wrap(err, "failed to build document from response")
 	}
@@ -178,7 +180,7 @@ func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 		//if actionURL is OTP then prompt for token
 		//user has disabled swipe
 		if strings.Contains(actionURL, "/pingid/ppm/auth/otp") {
-			token := prompt.StringRequired("Enter passcode")
+			token := ac.prompter.StringRequired("Enter passcode")
 
 			//build request
 			otpReq := url.Values{}
@@ -229,16 +231,14 @@ func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 	}
 
 	//try to extract SAMLResponse
-	doc, err = goquery.NewDocumentFromResponse(res)
+	doc, err = provider.NewDocumentFromResponse(res)
 	if err != nil {
 		return "", errors.Wrap(err, "error parsing document")
 	}
 
-	var ok bool
-
-	ac.samlAssertion, ok = doc.Find("input[name=\"SAMLResponse\"]").Attr("value")
-	if !ok {
-		return "", errors.Wrap(err, "unable to locate saml response")
+	ac.samlAssertion, err = provider.ExtractSAMLResponse(doc)
+	if err != nil {
+		return "", err
 	}
 
 	logger.WithField("samlAssertion", ac.samlAssertion).Debug("SAMLResponse")
@@ -271,7 +271,7 @@ func extractFormData(res *http.Response) (url.Values, string, error) {
 	formData := url.Values{}
 	var actionURL string
 
-	doc, err := goquery.NewDocumentFromResponse(res)
+	doc, err := provider.NewDocumentFromResponse(res)
 	if err != nil {
 		return formData, actionURL, errors.Wrap(err, "failed to build document from response")
 	}
@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// redacted replaces the values of secrets in error messages
+const redacted = "REDACTED"
+
+var (
+	// sensitiveNames the fields of IdP responses and forms holding tokens, assertions and mfa codes
+	sensitiveNames = `stateToken|sessionToken|token|SAMLResponse|passCode|sig_response|js_cookie|cookie`
+
+	// sensitiveValueRegexp a sensitive field in json, a query string or a form post, such as "stateToken":"00x", the
+	// quotes may be escaped when the text was quoted with %q
+	sensitiveValueRegexp = regexp.MustCompile(`(?i)(\\?"?\b(?:` + sensitiveNames + `)\\?"?\s*[:=]\s*\\?"?)[^"\\&\s,;<>]+`)
+
+	// sensitiveInputRegexp a sensitive field in a html form, such as <input name="SAMLResponse" value="PHNh">
+	sensitiveInputRegexp = regexp.MustCompile(`(?i)(name=\\?["']?(?:` + sensitiveNames + `)\\?["']?[^>]*?\bvalue=\\?["']?)[^"'\\\s>]+`)
+
+	// duoSignatureRegexp the signed values duo returns, such as its cookie AUTH|dXNlcg==|1516421660
+	duoSignatureRegexp = regexp.MustCompile(`\b(?:AUTH|TX|APP)\|[^|\s"'&]+\|[^\s"'&,;<>]+`)
+)
+
+// redactedError an error whose message has had secrets removed, the cause is kept so it can still be matched
+// unless its own message holds secrets
+type redactedError struct {
+	message string
+	cause   error
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+// Cause the underlying cause of the error, which is replaced with an error carrying its redacted message when
+// it holds secrets, so they aren't recovered through errors.Cause
+func (e *redactedError) Cause() error {
+	cause := errors.Cause(e.cause)
+
+	message := RedactSecrets(cause.Error())
+	if message != cause.Error() {
+		return errors.New(message)
+	}
+
+	return cause
+}
+
+// RedactSecrets replace the values of tokens, SAML responses, passcodes and duo cookies in the text, such as a
+// response body quoted in an error
+func RedactSecrets(text string) string {
+	text = sensitiveInputRegexp.ReplaceAllString(text, "${1}"+redacted)
+	text = sensitiveValueRegexp.ReplaceAllString(text, "${1}"+redacted)
+	return duoSignatureRegexp.ReplaceAllString(text, redacted)
+}
+
+// RedactError remove secrets from the message of the error before it is returned to the caller, who may log it.
+// The error is returned unchanged when its message doesn't contain any.
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	message := RedactSecrets(err.Error())
+	if message == err.Error() {
+		return err
+	}
+
+	return &redactedError{message: message, cause: err}
+}
@@ -0,0 +1,41 @@
+package provider
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactSecrets(t *testing.T) {
+
+	body := `{"stateToken":"00BClWr4T-mnIqPV8dHkOQlwEIXxB4LLSfBVt7BxsM","status":"MFA_REQUIRED"}`
+	require.Equal(t, `{"stateToken":"REDACTED","status":"MFA_REQUIRED"}`, RedactSecrets(body))
+
+	require.Equal(t, "token=REDACTED&redirectUrl=https://example.okta.com", RedactSecrets("token=20111h0ZlxjyqJ&redirectUrl=https://example.okta.com"))
+	require.Equal(t, "sessionToken=REDACTED&checkAccountSetupComplete=true", RedactSecrets("sessionToken=20111h0ZlxjyqJ&checkAccountSetupComplete=true"))
+	require.Equal(t, `<input name="SAMLResponse" type="hidden" value="REDACTED"/>`, RedactSecrets(`<input name="SAMLResponse" type="hidden" value="PHNhbWxwOlJlc3BvbnNlLz4="/>`))
+	require.Equal(t, `passCode: REDACTED`, RedactSecrets(`passCode: 123456`))
+	require.Equal(t, `duo response REDACTED`, RedactSecrets(`duo response AUTH|dXNlcg==|1516421660:APP|YXBw|1516425260`))
+	require.Equal(t, `"cookie": "REDACTED"`, RedactSecrets(`"cookie": "AUTH|dXNlcg==|1516421660"`))
+	require.Equal(t, `page: "stateToken=\"REDACTED\""`, RedactSecrets(fmt.Sprintf("page: %q", `stateToken="00BClWr4T"`)))
+	require.Equal(t, "status: MFA_REQUIRED", RedactSecrets("status: MFA_REQUIRED"))
+}
+
+func TestRedactError(t *testing.T) {
+
+	require.Nil(t, RedactError(nil))
+
+	cause := errors.New("unsupported mfa provider")
+	require.True(t, cause == RedactError(cause))
+
+	err := RedactError(errors.Wrap(cause, fmt.Sprintf("unexpected response %s", `{"stateToken":"00BClWr4T"}`)))
+	require.EqualError(t, err, `unexpected response {"stateToken":"REDACTED"}: unsupported mfa provider`)
+	require.True(t, cause == errors.Cause(err))
+
+	// a cause holding secrets isn't returned as it would reveal them
+	err = RedactError(errors.Wrap(errors.New(`unexpected response {"stateToken":"00BClWr4T"}`), "error verifying MFA"))
+	require.EqualError(t, err, `error verifying MFA: unexpected response {"stateToken":"REDACTED"}`)
+	require.EqualError(t, errors.Cause(err), `unexpected response {"stateToken":"REDACTED"}`)
+}
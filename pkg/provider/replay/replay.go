@@ -0,0 +1,128 @@
+package replay
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// Response a recorded response which is replayed when the matching request is made
+type Response struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Request a request received by the transport along with a copy of its body
+type Request struct {
+	*http.Request
+	Body []byte
+}
+
+// Transport http transport which replays recorded responses in the order they were added, this enables
+// providers to be tested without a live IdP
+type Transport struct {
+	mu        sync.Mutex
+	responses []*Response
+	requests  []*Request
+}
+
+// New create a new replay transport with no recorded responses
+func New() *Transport {
+	return &Transport{}
+}
+
+// Add record a response to be replayed for the next request with the given method and path
+func (tr *Transport) Add(method, path string, statusCode int, contentType string, body []byte) *Transport {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	tr.responses = append(tr.responses, &Response{
+		Method:     method,
+		Path:       path,
+		StatusCode: statusCode,
+		Header:     http.Header{"Content-Type": []string{contentType}},
+		Body:       body,
+	})
+
+	return tr
+}
+
+// AddResponse record a response, this is used when the response needs headers other than the content type
+func (tr *Transport) AddResponse(res *Response) *Transport {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	tr.responses = append(tr.responses, res)
+
+	return tr
+}
+
+// AddFile record a response with the body loaded from the supplied fixture file
+func (tr *Transport) AddFile(method, path string, statusCode int, contentType string, filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	tr.Add(method, path, statusCode, contentType, data)
+
+	return nil
+}
+
+// Requests the requests received by the transport so far
+func (tr *Transport) Requests() []*Request {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	return tr.requests
+}
+
+// Remaining the number of recorded responses which haven't been replayed
+func (tr *Transport) Remaining() int {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	return len(tr.responses)
+}
+
+// RoundTrip replay the next recorded response, an error is returned if the request doesn't match it
+func (tr *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	recorded := &Request{Request: req}
+	if req.Body != nil {
+		recorded.Body, _ = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+	}
+	tr.requests = append(tr.requests, recorded)
+
+	if len(tr.responses) == 0 {
+		return nil, fmt.Errorf("no recorded response for %s %s", req.Method, req.URL)
+	}
+
+	next := tr.responses[0]
+
+	if next.Method != req.Method || next.Path != req.URL.Path {
+		return nil, fmt.Errorf("expected request %s %s but received %s %s", next.Method, next.Path, req.Method, req.URL.Path)
+	}
+
+	tr.responses = tr.responses[1:]
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", next.StatusCode, http.StatusText(next.StatusCode)),
+		StatusCode:    next.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        next.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader(next.Body)),
+		ContentLength: int64(len(next.Body)),
+		Request:       req,
+	}, nil
+}
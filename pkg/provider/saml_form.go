@@ -0,0 +1,101 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+)
+
+// SAMLForm the SAML response extracted from the form the IdP would post to the service provider, along with
+// the form action, which is the ACS URL, for callers routing the response somewhere other than AWS
+type SAMLForm struct {
+	SAMLResponse string
+	RelayState   string
+	Action       string
+
+	// MFAUsed whether a second factor was verified during the login, MFAFactor identifies which, such as
+	// OKTA PUSH, it is empty when the IdP didn't require mfa
+	MFAUsed   bool
+	MFAFactor string
+}
+
+// samlResponseField the name of the form field holding the assertion, some IdPs vary its case
+const samlResponseField = "SAMLResponse"
+
+// ErrSAMLResponseNotFound returned when the page has no SAMLResponse field
+var ErrSAMLResponseNotFound = errors.New("unable to locate SAMLResponse")
+
+// FindSAMLResponse locate the input holding the SAML response in the form the IdP posts to the service provider,
+// the field name is matched ignoring case and inputs in a form with an action, the auto submit pattern, are tried
+// before any others. The first with a valid value is used, with any line breaks removed. When the fields found
+// are all invalid the error describes the first.
+func FindSAMLResponse(doc *goquery.Document) (*goquery.Selection, string, error) {
+
+	var invalid error
+
+	for _, selector := range []string{"form[action] input[name]", "input[name]"} {
+
+		var input *goquery.Selection
+		var value string
+
+		doc.Find(selector).EachWithBreak(func(i int, s *goquery.Selection) bool {
+			name, _ := s.Attr("name")
+			if !strings.EqualFold(name, samlResponseField) {
+				return true
+			}
+
+			val, _ := s.Attr("value")
+			val = strings.Join(strings.Fields(val), "")
+
+			if err := ValidateSAMLResponse(val); err != nil {
+				if invalid == nil {
+					invalid = err
+				}
+				return true
+			}
+
+			input, value = s, val
+			return false
+		})
+
+		if input != nil {
+			return input, value, nil
+		}
+	}
+
+	if invalid != nil {
+		return nil, "", invalid
+	}
+
+	return nil, "", ErrSAMLResponseNotFound
+}
+
+// ExtractSAMLResponse extract the assertion from the form which posts it to the service provider, returning
+// ErrSAMLResponseNotFound when the page has no SAMLResponse field, or the error describing an invalid value
+func ExtractSAMLResponse(doc *goquery.Document) (string, error) {
+	_, samlAssertion, err := FindSAMLResponse(doc)
+
+	return samlAssertion, err
+}
+
+// ValidateSAMLResponse check the SAML response is base64 encoded XML, so an error page or truncated value
+// returned by the IdP is reported rather than failing later when it is sent to AWS
+func ValidateSAMLResponse(samlResponse string) error {
+	if samlResponse == "" {
+		return errors.New("invalid SAML assertion received, the value is empty")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(samlResponse)
+	if err != nil {
+		return errors.Wrap(err, "invalid SAML assertion received")
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+		return errors.New("invalid SAML assertion received, the value isn't XML")
+	}
+
+	return nil
+}
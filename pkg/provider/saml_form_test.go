@@ -0,0 +1,126 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindSAMLResponse(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		html   string
+		value  string
+		action string
+		err    string
+	}{
+		{
+			name:   "exact name",
+			html:   `<form action="https://signin.aws.amazon.com/saml"><input name="SAMLResponse" value="PHNhbWw+"></form>`,
+			value:  "PHNhbWw+",
+			action: "https://signin.aws.amazon.com/saml",
+		},
+		{
+			name:   "name in another case",
+			html:   `<form action="https://signin.aws.amazon.com/saml"><input name="samlresponse" value="PHNhbWw+"></form>`,
+			value:  "PHNhbWw+",
+			action: "https://signin.aws.amazon.com/saml",
+		},
+		{
+			name:   "auto submit form preferred",
+			html:   `<input name="SAMLResponse" value="b3RoZXI="><form action="https://signin.aws.amazon.com/saml"><input name="SAMLResponse" value="PHNhbWw+"></form>`,
+			value:  "PHNhbWw+",
+			action: "https://signin.aws.amazon.com/saml",
+		},
+		{
+			name:  "outside a form",
+			html:  `<input name="SAMLResponse" value="PHNhbWw+">`,
+			value: "PHNhbWw+",
+		},
+		{
+			name:   "value wrapped over lines",
+			html:   "<form action=\"https://signin.aws.amazon.com/saml\"><input name=\"SAMLResponse\" value=\"PHNh\nbWw+\"></form>",
+			value:  "PHNhbWw+",
+			action: "https://signin.aws.amazon.com/saml",
+		},
+		{
+			name:   "value which isn't base64 skipped",
+			html:   `<form action="https://signin.aws.amazon.com/saml"><input name="SAMLResponse" value="{{samlResponse}}"><input name="SAMLResponse" value="PHNhbWw+"></form>`,
+			value:  "PHNhbWw+",
+			action: "https://signin.aws.amazon.com/saml",
+		},
+		{
+			name: "missing",
+			html: `<form action="/login"><input name="username"></form>`,
+			err:  "unable to locate SAMLResponse",
+		},
+		{
+			name: "empty",
+			html: `<form action="/login"><input name="SAMLResponse" value=""></form>`,
+			err:  "invalid SAML assertion received, the value is empty",
+		},
+		{
+			name: "error message",
+			html: `<form action="https://signin.aws.amazon.com/saml"><input name="SAMLResponse" value="error: session expired"></form>`,
+			err:  "invalid SAML assertion received: illegal base64 data at input byte 5",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+			require.Nil(t, err)
+
+			input, value, err := FindSAMLResponse(doc)
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+				return
+			}
+
+			require.Nil(t, err)
+			require.Equal(t, tt.value, value)
+
+			action, _ := input.Closest("form").Attr("action")
+			require.Equal(t, tt.action, action)
+		})
+	}
+}
+
+func TestExtractSAMLResponse(t *testing.T) {
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<form action="https://signin.aws.amazon.com/saml"><input name="SAMLResponse" value="PHNhbWxwOlJlc3BvbnNlLz4="></form>`))
+	require.Nil(t, err)
+
+	samlAssertion, err := ExtractSAMLResponse(doc)
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlLz4=", samlAssertion)
+
+	doc, err = goquery.NewDocumentFromReader(strings.NewReader(`<form action="/login"><input name="username"></form>`))
+	require.Nil(t, err)
+
+	_, err = ExtractSAMLResponse(doc)
+	require.Equal(t, ErrSAMLResponseNotFound, err)
+
+	// the reason the value is invalid is returned rather than an empty assertion
+	doc, err = goquery.NewDocumentFromReader(strings.NewReader(`<form action="https://signin.aws.amazon.com/saml"><input name="SAMLResponse" value="U2Vzc2lvbiBleHBpcmVk"></form>`))
+	require.Nil(t, err)
+
+	_, err = ExtractSAMLResponse(doc)
+	require.EqualError(t, err, "invalid SAML assertion received, the value isn't XML")
+}
+
+func TestValidateSAMLResponse(t *testing.T) {
+
+	require.Nil(t, ValidateSAMLResponse("PHNhbWxwOlJlc3BvbnNlLz4="))
+
+	// base64 which decodes to an error page rather than the XML of the response
+	require.EqualError(t, ValidateSAMLResponse("U2Vzc2lvbiBleHBpcmVk"), "invalid SAML assertion received, the value isn't XML")
+
+	// truncated
+	require.Error(t, ValidateSAMLResponse("PHNhbWxwOlJlc3BvbnNl"[:15]))
+
+	require.EqualError(t, ValidateSAMLResponse(""), "invalid SAML assertion received, the value is empty")
+}
@@ -0,0 +1,249 @@
+package shibboleth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/dump"
+	"github.com/versent/saml2aws/pkg/prompter"
+	"github.com/versent/saml2aws/pkg/provider"
+	"github.com/versent/saml2aws/pkg/provider/duo"
+)
+
+const (
+	// proceedEvent the name of the submit button which continues the Shibboleth login flow
+	proceedEvent = "_eventId_proceed"
+
+	// proceedSelector locates pages which only need to be continued, the client storage page hides its
+	// continue button in a noscript element so it is found by the storage inputs instead
+	proceedSelector = "[name=\"_eventId_proceed\"], input[name^=\"shib_idp_ls_\"]"
+
+	// maxLoginSteps the number of pages followed before giving up on finding the assertion
+	maxLoginSteps = 6
+)
+
+var logger = logrus.WithField("provider", "shibboleth")
+
+// Client wrapper around Shibboleth.
+type Client struct {
+	client *provider.HTTPClient
+	duo    *duo.Client
+}
+
+// New create a new Shibboleth Client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
+
+	client, err := provider.NewHTTPClientForAccount(tr, idpAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	dc := duo.New(client, prompter.ActivePrompter)
+	dc.RememberDevice = idpAccount.DuoRememberDevice
+	dc.PushFallback = idpAccount.PushFallback
+	if idpAccount.CookieFile != "" {
+		dc.CookieFile = idpAccount.CookieFile
+	}
+	if idpAccount.DuoPushTimeout > 0 {
+		dc.PushTimeout = time.Duration(idpAccount.DuoPushTimeout) * time.Second
+	}
+
+	return &Client{
+		client: client,
+		duo:    dc,
+	}, nil
+}
+
+// Authenticate logs into Shibboleth and returns a SAML response
+func (sc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+	return sc.AuthenticateContext(context.Background(), loginDetails)
+}
+
+// AuthenticateContext logs into Shibboleth as Authenticate does, giving up waiting for Duo when the context is
+// cancelled
+func (sc *Client) AuthenticateContext(ctx context.Context, loginDetails *creds.LoginDetails) (string, error) {
+
+	res, err := sc.client.Get(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	logger.WithField("status", res.StatusCode).WithField("url", loginDetails.URL).WithField("res", dump.ResponseString(res)).Debug("GET")
+
+	doc, err := provider.NewDocumentFromResponse(res)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing login page")
+	}
+
+	loginSubmitted := false
+
+	for step := 0; step < maxLoginSteps; step++ {
+
+		if samlAssertion, err := provider.ExtractSAMLResponse(doc); err != provider.ErrSAMLResponseNotFound {
+			return samlAssertion, err
+		}
+
+		switch {
+		case doc.Find("input[name=\"j_username\"]").Length() > 0:
+			if loginSubmitted {
+				return "", fmt.Errorf("login failed: %s", strings.TrimSpace(doc.Find(".form-error").Text()))
+			}
+			loginSubmitted = true
+			doc, err = sc.postLoginForm(doc, loginDetails)
+		case doc.Find("iframe#duo_iframe").Length() > 0:
+			doc, err = sc.postDuoResponse(ctx, doc, loginDetails)
+		case doc.Find(proceedSelector).Length() > 0:
+			doc, err = sc.proceed(doc)
+		default:
+			return "", errors.New("unable to locate SAMLResponse")
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", errors.New("unable to locate SAMLResponse after completing the login flow")
+}
+
+func (sc *Client) postLoginForm(doc *goquery.Document, loginDetails *creds.LoginDetails) (*goquery.Document, error) {
+
+	submitURL, form, err := extractForm(doc, doc.Find("input[name=\"j_username\"]").Closest("form"))
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing login form")
+	}
+
+	form.Set("j_username", loginDetails.Username)
+	form.Set("j_password", loginDetails.Password)
+	form.Set(proceedEvent, "")
+
+	doc, err = sc.post(submitURL, form)
+	if err != nil {
+		return nil, errors.Wrap(err, "error posting login form")
+	}
+
+	return doc, nil
+}
+
+// postDuoResponse verify with Duo using the signed request embedded in the Duo iframe, then post the
+// signed response back to Shibboleth
+func (sc *Client) postDuoResponse(ctx context.Context, doc *goquery.Document, loginDetails *creds.LoginDetails) (*goquery.Document, error) {
+
+	iframe := doc.Find("iframe#duo_iframe")
+
+	duoHost, _ := iframe.Attr("data-host")
+	sigRequest, _ := iframe.Attr("data-sig-request")
+	if duoHost == "" || sigRequest == "" {
+		return nil, errors.New("unable to locate duo host and signature")
+	}
+
+	postAction, _ := iframe.Attr("data-post-action")
+
+	submitURL, err := doc.Url.Parse(postAction)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing duo post action")
+	}
+
+	sigResponse, err := sc.duo.VerifyContext(ctx, duoHost, sigRequest, doc.Url.String(), loginDetails)
+	if err != nil {
+		return nil, errors.Wrap(err, "error verifying with duo")
+	}
+
+	form := url.Values{}
+
+	// the duo form holds the _eventId used to continue the flow
+	doc.Find("form#duo_form input").Each(func(i int, s *goquery.Selection) {
+		if name, ok := s.Attr("name"); ok {
+			val, _ := s.Attr("value")
+			form.Set(name, val)
+		}
+	})
+
+	form.Set("sig_response", sigResponse)
+
+	doc, err = sc.post(submitURL.String(), form)
+	if err != nil {
+		return nil, errors.Wrap(err, "error posting duo response")
+	}
+
+	return doc, nil
+}
+
+// proceed submit a page which only needs to be continued, such as the client storage or consent pages
+func (sc *Client) proceed(doc *goquery.Document) (*goquery.Document, error) {
+
+	submitURL, form, err := extractForm(doc, doc.Find(proceedSelector).Closest("form"))
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing continue form")
+	}
+
+	form.Set(proceedEvent, "")
+
+	doc, err = sc.post(submitURL, form)
+	if err != nil {
+		return nil, errors.Wrap(err, "error continuing login")
+	}
+
+	return doc, nil
+}
+
+func (sc *Client) post(submitURL string, form url.Values) (*goquery.Document, error) {
+
+	req, err := http.NewRequest("POST", submitURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building request")
+	}
+
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := sc.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving response")
+	}
+
+	logger.WithField("status", res.StatusCode).WithField("url", submitURL).WithField("res", dump.ResponseString(res)).Debug("POST")
+
+	return provider.NewDocumentFromResponse(res)
+}
+
+// extractForm return the absolute url the form submits to, which defaults to the page url, along with
+// the values of its named inputs other than buttons
+func extractForm(doc *goquery.Document, form *goquery.Selection) (string, url.Values, error) {
+
+	if form.Length() == 0 {
+		return "", nil, errors.New("unable to locate form")
+	}
+
+	action, _ := form.Attr("action")
+
+	submitURL, err := doc.Url.Parse(action)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "error parsing form action")
+	}
+
+	values := url.Values{}
+
+	form.Find("input").Each(func(i int, s *goquery.Selection) {
+		name, ok := s.Attr("name")
+		if !ok {
+			return
+		}
+		if inputType, _ := s.Attr("type"); inputType == "submit" {
+			return
+		}
+		val, _ := s.Attr("value")
+		values.Set(name, val)
+	})
+
+	return submitURL.String(), values, nil
+}
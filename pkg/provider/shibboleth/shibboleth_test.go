@@ -0,0 +1,110 @@
+package shibboleth
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/provider/replay"
+)
+
+const (
+	exampleLoginURL      = "https://idp.example.edu/idp/profile/SAML2/Unsolicited/SSO?providerId=urn:amazon:webservices"
+	exampleSSOPath       = "/idp/profile/SAML2/Unsolicited/SSO"
+	exampleSAMLAssertion = "PHNhbWxwOlJlc3BvbnNlIHhtbG5zOnNhbWxwPSJ1cm46b2FzaXM6bmFtZXM6dGM6U0FNTDoyLjA6cHJvdG9jb2wiLz4="
+)
+
+var exampleLoginDetails = &creds.LoginDetails{URL: exampleLoginURL, Username: "isaac.brock", Password: "test123"}
+
+func newTestClient(t *testing.T, tr *replay.Transport) *Client {
+	sc, err := New(&cfg.IDPAccount{})
+	require.Nil(t, err)
+
+	sc.client.Transport = tr
+
+	return sc
+}
+
+func TestClient_Authenticate(t *testing.T) {
+
+	tr := replay.New()
+	require.Nil(t, tr.AddFile("GET", exampleSSOPath, 200, "text/html", "example/login.html"))
+	require.Nil(t, tr.AddFile("POST", exampleSSOPath, 200, "text/html", "example/saml.html"))
+
+	sc := newTestClient(t, tr)
+
+	samlAssertion, err := sc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+
+	req := tr.Requests()[1]
+	require.Equal(t, "e1s2", req.URL.Query().Get("execution"))
+
+	loginForm, err := url.ParseQuery(string(req.Body))
+	require.Nil(t, err)
+	require.Equal(t, "isaac.brock", loginForm.Get("j_username"))
+	require.Equal(t, "test123", loginForm.Get("j_password"))
+	require.Equal(t, "_8e1c6d2b4f7a9e3c", loginForm.Get("csrf_token"))
+	require.Contains(t, loginForm, "_eventId_proceed")
+}
+
+func TestClient_AuthenticateProceedsThroughClientStorage(t *testing.T) {
+
+	tr := replay.New()
+	require.Nil(t, tr.AddFile("GET", exampleSSOPath, 200, "text/html", "example/local-storage.html"))
+	require.Nil(t, tr.AddFile("POST", exampleSSOPath, 200, "text/html", "example/login.html"))
+	require.Nil(t, tr.AddFile("POST", exampleSSOPath, 200, "text/html", "example/saml.html"))
+
+	sc := newTestClient(t, tr)
+
+	samlAssertion, err := sc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+
+	proceedForm, err := url.ParseQuery(string(tr.Requests()[1].Body))
+	require.Nil(t, err)
+	require.Equal(t, "_2f9b4a7c1e8d3f6a", proceedForm.Get("csrf_token"))
+	require.Equal(t, "false", proceedForm.Get("shib_idp_ls_success.shib_idp_session_ss"))
+	require.Contains(t, proceedForm, "_eventId_proceed")
+}
+
+func TestClient_AuthenticateDuoRememberedDevice(t *testing.T) {
+
+	tr := replay.New()
+	require.Nil(t, tr.AddFile("GET", exampleSSOPath, 200, "text/html", "example/login.html"))
+	require.Nil(t, tr.AddFile("POST", exampleSSOPath, 200, "text/html", "example/duo.html"))
+	require.Nil(t, tr.AddFile("POST", "/frame/web/v1/auth", 200, "text/html", "example/duo-remembered.html"))
+	require.Nil(t, tr.AddFile("POST", exampleSSOPath, 200, "text/html", "example/saml.html"))
+
+	sc := newTestClient(t, tr)
+
+	samlAssertion, err := sc.Authenticate(exampleLoginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleSAMLAssertion, samlAssertion)
+	require.Equal(t, 0, tr.Remaining())
+
+	req := tr.Requests()[3]
+	require.Equal(t, "e1s3", req.URL.Query().Get("execution"))
+
+	duoForm, err := url.ParseQuery(string(req.Body))
+	require.Nil(t, err)
+	require.Equal(t, "proceed", duoForm.Get("_eventId"))
+	require.Equal(t, "_5a3e9c1f7b2d8e4a", duoForm.Get("csrf_token"))
+	require.Regexp(t, ":APP\\|YXBwX3NpZ25hdHVyZQ==\\|1516425260$", duoForm.Get("sig_response"))
+}
+
+func TestClient_AuthenticateBadPassword(t *testing.T) {
+
+	tr := replay.New()
+	require.Nil(t, tr.AddFile("GET", exampleSSOPath, 200, "text/html", "example/login.html"))
+	require.Nil(t, tr.AddFile("POST", exampleSSOPath, 200, "text/html", "example/bad-login.html"))
+
+	sc := newTestClient(t, tr)
+
+	_, err := sc.Authenticate(exampleLoginDetails)
+	require.EqualError(t, err, "login failed: The password you entered was incorrect.")
+}
@@ -0,0 +1,32 @@
+package provider
+
+import "fmt"
+
+// StatusCallback reports the progress of a login, for example to update the UI of an app embedding saml2aws.
+// The stage is one of the Status constants, the detail describes it, such as the MFA factor or the status
+// reported by Duo.
+type StatusCallback func(stage, detail string)
+
+// The stages of a login reported to a StatusCallback
+const (
+	StatusAuthSubmitted    = "auth-submitted"
+	StatusMFARequired      = "mfa-required"
+	StatusMFAChallengeSent = "mfa-challenge-sent"
+	StatusPushPending      = "push-pending"
+	StatusMFAVerified      = "mfa-verified"
+	StatusMFAFailed        = "mfa-failed"
+	StatusSAMLReceived     = "saml-received"
+)
+
+// ReportStatus pass the stage to the callback, without one the message, if any, is printed to Output as
+// providers did before status could be reported
+func ReportStatus(callback StatusCallback, stage, detail, message string) {
+	if callback != nil {
+		callback(stage, detail)
+		return
+	}
+
+	if message != "" {
+		fmt.Fprint(Output, message)
+	}
+}
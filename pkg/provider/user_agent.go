@@ -0,0 +1,98 @@
+package provider
+
+import "net/http"
+
+// DefaultUserAgent the browser like user agent sent with requests, as some IdPs and Duo policies treat the go
+// default user agent as a bot
+const DefaultUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_13_3) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/64.0.3282.186 Safari/537.36"
+
+// DefaultAcceptLanguage the language requested from the IdP, so it serves the English pages the providers
+// locate the login form fields in rather than those localized for the org
+const DefaultAcceptLanguage = "en-US"
+
+// userAgentTransport set the user agent, accept language and any extra headers of requests which don't already
+// have them, and limit the size of the response bodies
+type userAgentTransport struct {
+	tr             http.RoundTripper
+	userAgent      string
+	acceptLanguage string
+	headers        map[string]string
+	maxBodySize    int64
+}
+
+func (uat *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tr := uat.tr
+	if tr == nil {
+		tr = http.DefaultTransport
+	}
+
+	headers := map[string]string{}
+
+	for name, value := range uat.headers {
+		if req.Header.Get(name) == "" {
+			headers[name] = value
+		}
+	}
+
+	if req.Header.Get("User-Agent") == "" {
+		headers["User-Agent"] = uat.userAgent
+	}
+
+	if uat.acceptLanguage != "" && req.Header.Get("Accept-Language") == "" {
+		headers["Accept-Language"] = uat.acceptLanguage
+	}
+
+	if len(headers) > 0 {
+		// a round tripper mustn't modify the request, so the headers are set on a copy
+		r := new(http.Request)
+		*r = *req
+		r.Header = make(http.Header, len(req.Header)+len(headers))
+		for k, v := range req.Header {
+			r.Header[k] = v
+		}
+
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+
+		req = r
+	}
+
+	res, err := tr.RoundTrip(req)
+	if err != nil || res.Body == nil || uat.maxBodySize <= 0 {
+		return res, err
+	}
+
+	res.Body = &limitedBody{ReadCloser: res.Body, url: req.URL.String(), limit: uat.maxBodySize, remaining: uat.maxBodySize}
+
+	return res, nil
+}
+
+// SetUserAgent send the user agent with every request made by the client
+func (client *HTTPClient) SetUserAgent(userAgent string) {
+	client.defaultHeaders().userAgent = userAgent
+}
+
+// SetAcceptLanguage request the language with every request made by the client, an empty language leaves
+// the header unset so the IdP serves the org default
+func (client *HTTPClient) SetAcceptLanguage(acceptLanguage string) {
+	client.defaultHeaders().acceptLanguage = acceptLanguage
+}
+
+// SetHeaders send the extra headers with every request made by the client, such as a token required by a WAF in
+// front of the IdP, they don't replace headers set on the request
+func (client *HTTPClient) SetHeaders(headers map[string]string) {
+	client.defaultHeaders().headers = headers
+}
+
+// defaultHeaders the transport setting the default headers, wrapping a transport which replaced it
+func (client *HTTPClient) defaultHeaders() *userAgentTransport {
+	if uat, ok := client.Transport.(*userAgentTransport); ok {
+		return uat
+	}
+
+	uat := &userAgentTransport{tr: client.Transport, userAgent: DefaultUserAgent, acceptLanguage: DefaultAcceptLanguage, maxBodySize: DefaultMaxBodySize}
+	client.Transport = uat
+
+	return uat
+}
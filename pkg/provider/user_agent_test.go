@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/provider/replay"
+)
+
+func TestUserAgent(t *testing.T) {
+
+	tr := replay.New().
+		Add("GET", "/", 200, "text/html", []byte("<html></html>")).
+		Add("GET", "/", 200, "text/html", []byte("<html></html>")).
+		Add("GET", "/", 200, "text/html", []byte("<html></html>"))
+
+	client, err := NewHTTPClient(tr)
+	require.Nil(t, err)
+
+	_, err = client.Get("https://idp.example.com/")
+	require.Nil(t, err)
+
+	client.SetUserAgent("saml2aws-test")
+
+	req, err := http.NewRequest("GET", "https://idp.example.com/", nil)
+	require.Nil(t, err)
+
+	_, err = client.Do(req)
+	require.Nil(t, err)
+	require.Empty(t, req.Header.Get("User-Agent"))
+
+	req.Header.Set("User-Agent", "explicit")
+
+	_, err = client.Do(req)
+	require.Nil(t, err)
+
+	require.Equal(t, DefaultUserAgent, tr.Requests()[0].Header.Get("User-Agent"))
+	require.Equal(t, "saml2aws-test", tr.Requests()[1].Header.Get("User-Agent"))
+	require.Equal(t, "explicit", tr.Requests()[2].Header.Get("User-Agent"))
+}
+
+func TestAcceptLanguage(t *testing.T) {
+
+	tr := replay.New().
+		Add("GET", "/", 200, "text/html", []byte("<html></html>")).
+		Add("GET", "/", 200, "text/html", []byte("<html></html>")).
+		Add("GET", "/", 200, "text/html", []byte("<html></html>"))
+
+	client, err := NewHTTPClient(tr)
+	require.Nil(t, err)
+
+	_, err = client.Get("https://idp.example.com/")
+	require.Nil(t, err)
+
+	client.SetAcceptLanguage("de-DE")
+
+	req, err := http.NewRequest("GET", "https://idp.example.com/", nil)
+	require.Nil(t, err)
+	req.Header.Set("User-Agent", "explicit")
+
+	_, err = client.Do(req)
+	require.Nil(t, err)
+	require.Empty(t, req.Header.Get("Accept-Language"))
+
+	client.SetAcceptLanguage("")
+
+	_, err = client.Get("https://idp.example.com/")
+	require.Nil(t, err)
+
+	require.Equal(t, DefaultAcceptLanguage, tr.Requests()[0].Header.Get("Accept-Language"))
+	require.Equal(t, "de-DE", tr.Requests()[1].Header.Get("Accept-Language"))
+	require.Equal(t, "explicit", tr.Requests()[1].Header.Get("User-Agent"))
+	require.Empty(t, tr.Requests()[2].Header.Get("Accept-Language"))
+}
+
+func TestSetHeaders(t *testing.T) {
+
+	tr := replay.New().
+		Add("GET", "/", 200, "text/html", []byte("<html></html>"))
+
+	client, err := NewHTTPClient(tr)
+	require.Nil(t, err)
+
+	client.SetHeaders(map[string]string{"X-Corp-Token": "abc123", "X-Region": "apac"})
+
+	req, err := http.NewRequest("GET", "https://idp.example.com/", nil)
+	require.Nil(t, err)
+	req.Header.Set("X-Region", "emea")
+
+	_, err = client.Do(req)
+	require.Nil(t, err)
+	require.Empty(t, req.Header.Get("X-Corp-Token"))
+
+	require.Equal(t, "abc123", tr.Requests()[0].Header.Get("X-Corp-Token"))
+	require.Equal(t, "emea", tr.Requests()[0].Header.Get("X-Region"))
+	require.Equal(t, DefaultUserAgent, tr.Requests()[0].Header.Get("User-Agent"))
+}
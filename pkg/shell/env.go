@@ -1,6 +1,10 @@
 package shell
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 // BuildEnvVars build an array of env vars in the format required for exec
 func BuildEnvVars(id, secret, token string) []string {
@@ -12,3 +16,47 @@ func BuildEnvVars(id, secret, token string) []string {
 		fmt.Sprintf("EC2_SECURITY_TOKEN=%s", token),
 	}
 }
+
+// BuildExports format the credentials as statements which export them in the shell, which is one of
+// bash, fish or powershell, the output can be evaluated to use the credentials in the current session
+func BuildExports(shell, id, secret, token string, expiration time.Time) string {
+
+	vars := [][]string{
+		{"AWS_ACCESS_KEY_ID", id},
+		{"AWS_SECRET_ACCESS_KEY", secret},
+		{"AWS_SESSION_TOKEN", token},
+		{"AWS_SECURITY_TOKEN", token},
+		{"EC2_SECURITY_TOKEN", token},
+	}
+
+	// credentials saved by older versions don't record when they expire
+	if !expiration.IsZero() {
+		vars = append(vars, []string{"AWS_SESSION_EXPIRATION", expiration.UTC().Format(time.RFC3339)})
+	}
+
+	format := "export %s=\"%s\"\n"
+	quoter := bashQuoter
+
+	switch shell {
+	case "fish":
+		format = "set -gx %s \"%s\";\n"
+		quoter = fishQuoter
+	case "powershell":
+		format = "$env:%s = \"%s\"\n"
+		quoter = powershellQuoter
+	}
+
+	exports := make([]string, 0, len(vars))
+	for _, v := range vars {
+		exports = append(exports, fmt.Sprintf(format, v[0], quoter.Replace(v[1])))
+	}
+
+	return strings.Join(exports, "")
+}
+
+// escape the characters each shell treats specially within double quotes, so the values are exported as is
+var (
+	bashQuoter       = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "`", "\\`")
+	fishQuoter       = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`)
+	powershellQuoter = strings.NewReplacer("`", "``", `"`, "`\"", `$`, "`$")
+)
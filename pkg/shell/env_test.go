@@ -2,6 +2,7 @@ package shell
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -18,3 +19,51 @@ func TestBuildEnvVars(t *testing.T) {
 
 	assert.Equal(t, expectedArray, BuildEnvVars("123", "345", "567"))
 }
+
+func TestBuildExports(t *testing.T) {
+
+	expiration := time.Date(2018, 1, 20, 4, 14, 20, 0, time.UTC)
+
+	assert.Equal(t, `export AWS_ACCESS_KEY_ID="123"
+export AWS_SECRET_ACCESS_KEY="345"
+export AWS_SESSION_TOKEN="567"
+export AWS_SECURITY_TOKEN="567"
+export EC2_SECURITY_TOKEN="567"
+export AWS_SESSION_EXPIRATION="2018-01-20T04:14:20Z"
+`, BuildExports("bash", "123", "345", "567", expiration))
+
+	assert.Equal(t, `set -gx AWS_ACCESS_KEY_ID "123";
+set -gx AWS_SECRET_ACCESS_KEY "345";
+set -gx AWS_SESSION_TOKEN "567";
+set -gx AWS_SECURITY_TOKEN "567";
+set -gx EC2_SECURITY_TOKEN "567";
+set -gx AWS_SESSION_EXPIRATION "2018-01-20T04:14:20Z";
+`, BuildExports("fish", "123", "345", "567", expiration))
+
+	assert.Equal(t, `$env:AWS_ACCESS_KEY_ID = "123"
+$env:AWS_SECRET_ACCESS_KEY = "345"
+$env:AWS_SESSION_TOKEN = "567"
+$env:AWS_SECURITY_TOKEN = "567"
+$env:EC2_SECURITY_TOKEN = "567"
+$env:AWS_SESSION_EXPIRATION = "2018-01-20T04:14:20Z"
+`, BuildExports("powershell", "123", "345", "567", expiration))
+}
+
+func TestBuildExportsWithoutExpiration(t *testing.T) {
+
+	assert.Equal(t, `export AWS_ACCESS_KEY_ID="123"
+export AWS_SECRET_ACCESS_KEY="345"
+export AWS_SESSION_TOKEN="567"
+export AWS_SECURITY_TOKEN="567"
+export EC2_SECURITY_TOKEN="567"
+`, BuildExports("bash", "123", "345", "567", time.Time{}))
+}
+
+func TestBuildExportsEscapesValues(t *testing.T) {
+
+	value := "a\"b$c`d\\e"
+
+	assert.Contains(t, BuildExports("bash", value, "345", "567", time.Time{}), "export AWS_ACCESS_KEY_ID=\"a\\\"b\\$c\\`d\\\\e\"\n")
+	assert.Contains(t, BuildExports("fish", value, "345", "567", time.Time{}), "set -gx AWS_ACCESS_KEY_ID \"a\\\"b\\$c`d\\\\e\";\n")
+	assert.Contains(t, BuildExports("powershell", value, "345", "567", time.Time{}), "$env:AWS_ACCESS_KEY_ID = \"a`\"b`$c``d\\e\"\n")
+}
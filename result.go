@@ -0,0 +1,95 @@
+package saml2aws
+
+import (
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/provider"
+)
+
+// FormAuthenticator implemented by providers which return the SAML form along with whether MFA was used, such as Okta
+type FormAuthenticator interface {
+	AuthenticateForm(loginDetails *creds.LoginDetails) (*provider.SAMLForm, error)
+}
+
+// AuthResult describes an authentication with the IdP, it marshals to JSON for scripts which log the login
+// or choose the role themselves
+type AuthResult struct {
+	Provider  string           `json:"provider"`
+	Assertion string           `json:"assertion"`
+	MFAUsed   bool             `json:"mfaUsed"`
+	MFAFactor string           `json:"mfaFactor,omitempty"`
+	Roles     []AuthResultRole `json:"roles"`
+
+	// PrincipalTags the session tags STS applies from the assertion, for orgs using attribute based access control
+	PrincipalTags map[string]string `json:"principalTags,omitempty"`
+}
+
+// AuthResultRole a role granted by the assertion
+type AuthResultRole struct {
+	AccountID    string `json:"accountId"`
+	RoleName     string `json:"roleName"`
+	RoleARN      string `json:"roleArn"`
+	PrincipalARN string `json:"principalArn"`
+}
+
+// Authenticate login to the IdP with the client and describe the result, the provider name is the one
+// configured for the account. Whether MFA was used is only known for providers which implement FormAuthenticator.
+func Authenticate(client SAMLClient, providerName string, loginDetails *creds.LoginDetails) (*AuthResult, error) {
+
+	var form *provider.SAMLForm
+
+	if formClient, ok := client.(FormAuthenticator); ok {
+		var err error
+		form, err = formClient.AuthenticateForm(loginDetails)
+		if err != nil {
+			return nil, provider.RedactError(errors.Wrap(err, "error authenticating to IdP"))
+		}
+	} else {
+		samlAssertion, err := client.Authenticate(loginDetails)
+		if err != nil {
+			return nil, provider.RedactError(errors.Wrap(err, "error authenticating to IdP"))
+		}
+		form = &provider.SAMLForm{SAMLResponse: samlAssertion}
+	}
+
+	return NewAuthResult(providerName, form)
+}
+
+// NewAuthResult describe the SAML form returned by the provider, including the roles granted by its assertion
+func NewAuthResult(providerName string, form *provider.SAMLForm) (*AuthResult, error) {
+
+	err := provider.ValidateSAMLResponse(form.SAMLResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	assertion, err := ParseSAMLAssertion(form.SAMLResponse)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing saml assertion")
+	}
+
+	awsRoles, err := ParseAWSRoles(assertion.Roles)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing aws roles")
+	}
+
+	result := &AuthResult{
+		Provider:      providerName,
+		Assertion:     form.SAMLResponse,
+		MFAUsed:       form.MFAUsed,
+		MFAFactor:     form.MFAFactor,
+		Roles:         []AuthResultRole{},
+		PrincipalTags: assertion.PrincipalTags,
+	}
+
+	for _, awsRole := range awsRoles {
+		result.Roles = append(result.Roles, AuthResultRole{
+			AccountID:    awsRole.AccountID(),
+			RoleName:     awsRole.RoleName(),
+			RoleARN:      awsRole.RoleARN,
+			PrincipalARN: awsRole.PrincipalARN,
+		})
+	}
+
+	return result, nil
+}
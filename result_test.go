@@ -0,0 +1,90 @@
+package saml2aws
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/provider"
+)
+
+type fakeFormClient struct {
+	fakeSAMLClient
+	form *provider.SAMLForm
+}
+
+func (fc *fakeFormClient) AuthenticateForm(loginDetails *creds.LoginDetails) (*provider.SAMLForm, error) {
+	return fc.form, nil
+}
+
+func TestAuthenticate(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion.xml")
+	require.Nil(t, err)
+
+	samlAssertion := base64.StdEncoding.EncodeToString(data)
+
+	result, err := Authenticate(&fakeSAMLClient{samlAssertion: samlAssertion}, "ADFS", &creds.LoginDetails{})
+	require.Nil(t, err)
+	require.Equal(t, "ADFS", result.Provider)
+	require.Equal(t, samlAssertion, result.Assertion)
+	require.False(t, result.MFAUsed)
+	require.Equal(t, []AuthResultRole{
+		{
+			AccountID:    "123123123123",
+			RoleName:     "AWS-Admin-CloudOPSBuild",
+			RoleARN:      "arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSBuild",
+			PrincipalARN: "arn:aws:iam::123123123123:saml-provider/ExampleADFS",
+		},
+		{
+			AccountID:    "123123123123",
+			RoleName:     "AWS-Admin-CloudOPSNonProd",
+			RoleARN:      "arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSNonProd",
+			PrincipalARN: "arn:aws:iam::123123123123:saml-provider/ExampleADFS",
+		},
+	}, result.Roles)
+
+	_, err = Authenticate(&fakeSAMLClient{samlAssertion: ""}, "ADFS", &creds.LoginDetails{})
+	require.EqualError(t, err, "invalid SAML assertion received, the value is empty")
+}
+
+func TestAuthenticateForm(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion.xml")
+	require.Nil(t, err)
+
+	client := &fakeFormClient{form: &provider.SAMLForm{
+		SAMLResponse: base64.StdEncoding.EncodeToString(data),
+		MFAUsed:      true,
+		MFAFactor:    "OKTA PUSH",
+	}}
+
+	result, err := Authenticate(client, "Okta", &creds.LoginDetails{})
+	require.Nil(t, err)
+	require.True(t, result.MFAUsed)
+	require.Equal(t, "OKTA PUSH", result.MFAFactor)
+
+	out, err := json.Marshal(result)
+	require.Nil(t, err)
+
+	var decoded map[string]interface{}
+	require.Nil(t, json.Unmarshal(out, &decoded))
+	require.Equal(t, "Okta", decoded["provider"])
+	require.Equal(t, true, decoded["mfaUsed"])
+	require.Equal(t, "OKTA PUSH", decoded["mfaFactor"])
+	require.Len(t, decoded["roles"], 2)
+
+	// the tags are omitted when the IdP doesn't send any
+	_, ok := decoded["principalTags"]
+	require.False(t, ok)
+}
+
+func TestAuthenticatePrincipalTags(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion_principal_tags.xml")
+	require.Nil(t, err)
+
+	result, err := Authenticate(&fakeSAMLClient{samlAssertion: base64.StdEncoding.EncodeToString(data)}, "Okta", &creds.LoginDetails{})
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"Project": "Automation", "CostCenter": "987654"}, result.PrincipalTags)
+}
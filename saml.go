@@ -2,6 +2,7 @@ package saml2aws
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/beevik/etree"
 )
@@ -11,6 +12,9 @@ const (
 	attributeStatementTag = "AttributeStatement"
 	attributeTag          = "Attribute"
 	attributeValueTag     = "AttributeValue"
+
+	awsRoleAttribute            = "https://aws.amazon.com/SAML/Attributes/Role"
+	awsSessionDurationAttribute = "https://aws.amazon.com/SAML/Attributes/SessionDuration"
 )
 
 //ErrMissingElement is the error type that indicates an element and/or attribute is
@@ -36,11 +40,37 @@ func (e ErrMissingElement) Error() string {
 // ExtractAwsRoles given an assertion document extract the aws roles
 func ExtractAwsRoles(data []byte) ([]string, error) {
 
-	awsroles := []string{}
+	return extractAttributeValues(data, awsRoleAttribute)
+}
+
+// ExtractSessionDuration given an assertion document extract the session duration in seconds,
+// zero is returned if the assertion doesn't contain a session duration
+func ExtractSessionDuration(data []byte) (int64, error) {
+
+	values, err := extractAttributeValues(data, awsSessionDurationAttribute)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(values) == 0 {
+		return 0, nil
+	}
+
+	duration, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid session duration in assertion: %s", values[0])
+	}
+
+	return duration, nil
+}
+
+func extractAttributeValues(data []byte, name string) ([]string, error) {
+
+	values := []string{}
 
 	doc := etree.NewDocument()
 	if err := doc.ReadFromBytes(data); err != nil {
-		return awsroles, err
+		return values, err
 	}
 
 	// log.Printf("root tag: %s", doc.Root().Tag)
@@ -62,16 +92,16 @@ func ExtractAwsRoles(data []byte) ([]string, error) {
 
 	attributes := attributeStatement.FindElements(childPath(assertionElement.Space, attributeTag))
 	for _, attribute := range attributes {
-		if attribute.SelectAttrValue("Name", "") != "https://aws.amazon.com/SAML/Attributes/Role" {
+		if attribute.SelectAttrValue("Name", "") != name {
 			continue
 		}
 		atributeValues := attribute.FindElements(childPath(assertionElement.Space, attributeValueTag))
 		for _, attrValue := range atributeValues {
-			awsroles = append(awsroles, attrValue.Text())
+			values = append(values, attrValue.Text())
 		}
 	}
 
-	return awsroles, nil
+	return values, nil
 }
 
 func childPath(space, tag string) string {
@@ -1,17 +1,24 @@
 package saml2aws
 
 import (
+	"context"
 	"fmt"
 	"sort"
 
 	"github.com/versent/saml2aws/pkg/cfg"
 	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/provider/aad"
 	"github.com/versent/saml2aws/pkg/provider/adfs"
 	"github.com/versent/saml2aws/pkg/provider/adfs2"
+	"github.com/versent/saml2aws/pkg/provider/auth0"
+	"github.com/versent/saml2aws/pkg/provider/browser"
+	"github.com/versent/saml2aws/pkg/provider/f5apm"
+	"github.com/versent/saml2aws/pkg/provider/googleapps"
 	"github.com/versent/saml2aws/pkg/provider/jumpcloud"
 	"github.com/versent/saml2aws/pkg/provider/keycloak"
 	"github.com/versent/saml2aws/pkg/provider/okta"
 	"github.com/versent/saml2aws/pkg/provider/pingfed"
+	"github.com/versent/saml2aws/pkg/provider/shibboleth"
 )
 
 // ProviderList list of providers with their MFAs
@@ -19,12 +26,18 @@ type ProviderList map[string][]string
 
 // MFAsByProvider a list of providers with their respective supported MFAs
 var MFAsByProvider = ProviderList{
-	"ADFS":      []string{"Auto", "VIP"},
-	"ADFS2":     []string{"Auto"},
-	"Ping":      []string{"Auto"}, // automatically detects PingID
-	"JumpCloud": []string{"Auto"},
-	"Okta":      []string{"Auto"}, // automatically detects DUO, SMS and ToTP
-	"KeyCloak":  []string{"Auto"}, // automatically detects ToTP
+	"ADFS":       []string{"Auto", "VIP"},
+	"ADFS2":      []string{"Auto"},
+	"Ping":       []string{"Auto"}, // automatically detects PingID
+	"JumpCloud":  []string{"Auto"},
+	"Okta":       []string{"Auto"}, // automatically detects DUO, SMS and ToTP
+	"KeyCloak":   []string{"Auto"}, // automatically detects ToTP
+	"AzureAD":    []string{"Auto"}, // automatically detects the Microsoft Authenticator push
+	"GoogleApps": []string{"Auto"}, // automatically detects TOTP, SMS and the Google prompt
+	"Shibboleth": []string{"Auto"}, // automatically detects DUO
+	"Auth0":      []string{"Auto"}, // automatically detects Guardian push and OTP
+	"F5APM":      []string{"Auto"},
+	"Browser":    []string{"Auto"}, // the login, including any MFA, is completed in the system browser
 }
 
 // Names get a list of provider names
@@ -71,6 +84,13 @@ type SAMLClient interface {
 	Authenticate(loginDetails *creds.LoginDetails) (string, error)
 }
 
+// ContextSAMLClient a client which gives up logging in when the context is cancelled, such as while waiting for
+// MFA to be approved
+type ContextSAMLClient interface {
+	SAMLClient
+	AuthenticateContext(ctx context.Context, loginDetails *creds.LoginDetails) (string, error)
+}
+
 // NewSAMLClient create a new SAML client
 func NewSAMLClient(idpAccount *cfg.IDPAccount) (SAMLClient, error) {
 	switch idpAccount.Provider {
@@ -104,6 +124,36 @@ func NewSAMLClient(idpAccount *cfg.IDPAccount) (SAMLClient, error) {
 			return nil, fmt.Errorf("Invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
 		}
 		return keycloak.New(idpAccount)
+	case "AzureAD":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("Invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return aad.New(idpAccount)
+	case "GoogleApps":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("Invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return googleapps.New(idpAccount)
+	case "Shibboleth":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("Invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return shibboleth.New(idpAccount)
+	case "Auth0":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("Invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return auth0.New(idpAccount)
+	case "F5APM":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("Invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return f5apm.New(idpAccount)
+	case "Browser":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("Invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return browser.New(idpAccount)
 	default:
 		return nil, fmt.Errorf("Invalid provider: %v", idpAccount.Provider)
 	}
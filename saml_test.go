@@ -15,3 +15,19 @@ func TestExtractAwsRoles(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Len(t, roles, 2)
 }
+
+func TestExtractSessionDuration(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion_session_duration.xml")
+	assert.Nil(t, err)
+
+	duration, err := ExtractSessionDuration(data)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1800), duration)
+
+	data, err = ioutil.ReadFile("testdata/assertion.xml")
+	assert.Nil(t, err)
+
+	duration, err = ExtractSessionDuration(data)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), duration)
+}